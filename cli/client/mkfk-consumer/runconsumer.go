@@ -1,6 +1,8 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"time"
 
@@ -8,47 +10,130 @@ import (
 	clientlib "github.com/peterhoward42/minikafka/client"
 )
 
+// noSuchTopicRetryInterval is how long the consumer waits before trying again,
+// when the topic it consumes does not exist yet.
+const noSuchTopicRetryInterval = time.Second
+
 // This command line program contains a MiniKafka consumer client.
 // You provide a topic for it to subscribe to with the -topic flag. It will then
 // consume (and report on), both the existing messages in this topic, and newly
-// arriving ones, by polling the server every 3 seconds.
+// arriving ones, as the server pushes them to it. When the topic does not exist
+// yet, it waits for a producer to create it.
 func main() {
 
+	// The optional -group and -partition flags are specific to the consumer,
+	// so we register them before the common command line flags get parsed.
+	group := flag.String("group", "",
+		"Optionally specify a consumer group to consume on behalf of.")
+	partition := flag.Int("partition", 0,
+		"Optionally specify which of the topic's partitions to consume.")
+	since := flag.String("since", "",
+		"Optionally start from the first message stored since a time. "+
+			"E.g. 09:00 (today), 2018-05-01T09:00:00Z, or 90m (ago).")
 	topic, host := clientcli.ParseCommandLine()
 
-	// Unlike this examplar consumer command line app, most real-world consumer
-	// apps will not start consuming from message 1 at every boot time. But will
-	// instead persist their current readFrom message number, so as to only
-	// consume messages they have not previously seen.
-
-	readFrom := 1 // Start consuming at message 1.
-
 	// You specify the response timeout for each consumer.Poll() at consumer
-	// construction time.
+	// construction time. (It does not apply to subscriptions.)
 	timeout := time.Duration(500 * time.Millisecond)
-	consumer, err := clientlib.NewConsumer(topic, readFrom, timeout, host)
-	if err != nil {
-		log.Fatalf("client.NewConsumer: %v", err)
+
+	// Without a consumer group, this examplar app starts consuming from
+	// message 1 every time. Most real-world consumer apps will not want to do
+	// that, and can instead consume on behalf of a consumer group. The server
+	// then remembers the group's read-from message number, so that only
+	// messages the group has not previously seen are consumed.
+	var consumer *clientlib.Consumer
+	var err error
+	if *group == "" {
+		readFrom := 1 // Start consuming at message 1.
+		consumer, err = clientlib.NewPartitionConsumer(
+			topic, *partition, readFrom, timeout, host)
+		if err != nil {
+			log.Fatalf("client.NewPartitionConsumer: %v", err)
+		}
+	} else {
+		autoCommit := true
+		consumer, err = clientlib.NewGroupPartitionConsumer(
+			*group, topic, *partition, autoCommit, timeout, host)
+		if err != nil {
+			log.Fatalf("client.NewGroupPartitionConsumer: %v", err)
+		}
 	}
 
-	// Poll at regular intervals, reporting one what is thus received.
+	// When asked to, replay from a point in time instead.
+	if *since != "" {
+		sinceTime, err := parseSince(*since, time.Now())
+		if err != nil {
+			log.Fatalf("parseSince: %v", err)
+		}
+		err = retryWhileNoSuchTopic(func() error {
+			return consumer.SeekToTime(sinceTime)
+		})
+		if err != nil {
+			log.Fatalf("consumer.SeekToTime: %v", err)
+		}
+	}
 
-	// Using a 3 second polling interval is intended to be convenient
-	// for a human keeping an eye on what the CLI is reporting.
-	ticker := time.NewTicker(3 * time.Second)
+	// Subscribe, and report on each message as it is received. The
+	// subscription ends when the topic does not exist, so subscribe again.
+	err = retryWhileNoSuchTopic(func() error {
+		return consume(consumer)
+	})
+	log.Fatalf("consume: %v", err)
+}
 
-	defer ticker.Stop()
-	for range ticker.C {
-		log.Printf("Polling")
-		messages, newReadFrom, err := consumer.Poll()
+// consume subscribes, and reports on each message as it is received, until
+// the subscription fails.
+func consume(consumer *clientlib.Consumer) error {
+	subscription, err := consumer.Subscribe()
+	if err != nil {
+		return fmt.Errorf("consumer.Subscribe: %v", err)
+	}
+	defer subscription.Close()
+	for {
+		record, err := subscription.NextRecord()
+		if _, ok := err.(*clientlib.NoSuchTopicError); ok {
+			return err
+		}
 		if err != nil {
-			log.Fatalf("consumer.Poll: %v", err)
+			return fmt.Errorf("subscription.NextRecord: %v", err)
 		}
-		log.Printf("Received %d messages.", len(messages))
-		log.Printf("Next message to read advanced to: %d", newReadFrom)
-		for _, msg := range messages {
-			log.Printf("  %s", string(msg))
+		// The latency reported is the time since the server stored it.
+		log.Printf("Received message %d (latency %v): %s", record.Number,
+			time.Since(record.Created), string(record.Payload))
+	}
+}
+
+// retryWhileNoSuchTopic calls *f*, and calls it again after a while for as
+// long as it reports that the topic does not exist. It returns the first other
+// outcome.
+func retryWhileNoSuchTopic(f func() error) error {
+	reported := false
+	for {
+		err := f()
+		if _, ok := err.(*clientlib.NoSuchTopicError); ok == false {
+			return err
 		}
-		log.Printf("")
+		if reported == false {
+			log.Printf("%v - waiting for it to be created", err)
+			reported = true
+		}
+		time.Sleep(noSuchTopicRetryInterval)
+	}
+}
+
+// parseSince interprets the -since flag's value, which may be a time of day
+// (today), a full RFC3339 time, or a duration to go back from *now*.
+func parseSince(since string, now time.Time) (time.Time, error) {
+	clock, err := time.Parse("15:04", since)
+	if err == nil {
+		return time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(),
+			clock.Minute(), 0, 0, now.Location()), nil
+	}
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		return t, nil
+	}
+	if ago, err := time.ParseDuration(since); err == nil {
+		return now.Add(-ago), nil
 	}
+	return time.Time{}, fmt.Errorf("Cannot interpret -since value: %s", since)
 }
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2018, 5, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		since    string
+		expected time.Time
+		ok       bool
+	}{
+		{"90m", time.Date(2018, 5, 1, 11, 0, 0, 0, time.UTC), true},
+		{"2h30m", time.Date(2018, 5, 1, 10, 0, 0, 0, time.UTC), true},
+		{"2018-04-30T09:15:00Z", time.Date(2018, 4, 30, 9, 15, 0, 0, time.UTC),
+			true},
+		{"09:00", time.Date(2018, 5, 1, 9, 0, 0, 0, time.UTC), true},
+		{"yesterday", time.Time{}, false},
+		{"2018-04-30", time.Time{}, false},
+		{"", time.Time{}, false},
+	}
+	for _, test := range tests {
+		sinceTime, err := parseSince(test.since, now)
+		if test.ok == false {
+			assert.NotNil(t, err, test.since)
+			continue
+		}
+		assert.Nil(t, err, test.since)
+		assert.True(t, test.expected.Equal(sinceTime), test.since)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore"
+)
+
+// This command-line program checks a file-based MiniKafka store; that its
+// message files are intact, and agree with its topics' indexes. It reports
+// what it finds, and exits with status 1 when there are problems. With the
+// -rebuild flag, it first regenerates the indexes from the message files,
+// which is the way back when an index has been damaged or lost. With the
+// -remove-orphans flag, it deletes the files that the indexes do not refer
+// to, including those the server has moved aside to topics' quarantine
+// directories. Stop the server that uses the store before running it.
+func main() {
+
+	const rootDirEnvVar string = "MINIKAFKA_ROOT_DIR"
+
+	rootDir := flag.String("root", os.Getenv(rootDirEnvVar),
+		"Specify the store's root directory. (Defaults to the "+
+			rootDirEnvVar+" environment variable).")
+	rebuild := flag.Bool("rebuild", false,
+		"Regenerate the indexes from the message files before checking.")
+	removeOrphans := flag.Bool("remove-orphans", false,
+		"Delete the files that the indexes do not refer to, including "+
+			"quarantined ones, before checking.")
+	flag.Parse()
+
+	if *rootDir == "" {
+		log.Fatalf("You must specify a root directory with the -root flag, "+
+			"or the %s environment variable.", rootDirEnvVar)
+	}
+	if _, err := os.Stat(*rootDir); err != nil {
+		log.Fatalf("os.Stat(): %v", err)
+	}
+
+	if *rebuild {
+		kept, err := filestore.Rebuild(*rootDir)
+		if err != nil {
+			log.Fatalf("filestore.Rebuild(): %v", err)
+		}
+		fmt.Printf("Rebuilt the indexes from the message files.\n")
+		if kept == false {
+			fmt.Printf("An old index could not be read, so the retention " +
+				"policies of some topics have been lost.\n")
+		}
+	}
+
+	if *removeOrphans {
+		removed, err := filestore.RemoveOrphans(*rootDir)
+		if err != nil {
+			log.Fatalf("filestore.RemoveOrphans(): %v", err)
+		}
+		fmt.Printf("Removed %d files that the indexes do not refer to.\n",
+			removed)
+	}
+
+	problems, err := filestore.Verify(*rootDir)
+	if err != nil {
+		log.Fatalf("filestore.Verify(): %v\n"+
+			"(Use the -rebuild flag to regenerate the indexes).", err)
+	}
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("%d problems found. Bytes that the indexes do not refer "+
+			"to are discarded when the server next starts, and files moved "+
+			"aside to the topic's quarantine directory. Move such files "+
+			"back before using -rebuild if they hold messages that an "+
+			"index has lost; otherwise use -remove-orphans to delete "+
+			"them.\n", len(problems))
+		os.Exit(1)
+	}
+	fmt.Printf("No problems found.\n")
+}
@@ -0,0 +1,182 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/grpc"
+
+	pb "github.com/peterhoward42/minikafka/protocol"
+)
+
+// Admin is a MiniKafka client object dedicated to the administration of
+// topics.
+type Admin struct {
+	timeout     time.Duration
+	clientProxy pb.MiniKafkaAdminClient // gRPC component.
+	// For the calls that live in the main MiniKafka service.
+	dataProxy pb.MiniKafkaClient
+}
+
+// TopicDescription is the summary information about one partition of a topic
+// that Admin.DescribePartition provides. The message numbers and creation
+// times are those of the oldest and newest messages currently held. They have
+// zero values when the partition holds no messages.
+type TopicDescription struct {
+	OldestMsgNumber int
+	NewestMsgNumber int
+	OldestCreated   time.Time
+	NewestCreated   time.Time
+	NumMessages     int
+	NumBytes        int64
+	NumSegments     int // The number of files the messages are stored in.
+	Retention       RetentionPolicy
+	NumPartitions   int // The number of partitions the topic has.
+}
+
+// RetentionPolicy governs how long the messages in one topic are kept for.
+// Messages are removed when they are older than *MaxAge*, or when they are
+// the oldest messages and keeping them would take the topic beyond
+// *MaxMessages* messages, or *MaxBytes* bytes of messages. Limits with a zero
+// value do not apply; except for *MaxAge*, when zero means the server's
+// default retention time applies. *Infinite* overrides the limits above,
+// and means the topic's messages are never removed on their account.
+// *Compact* makes the server compact the topic: keeping only the newest
+// message with each key, and treating a message with a key and an empty
+// payload as a tombstone, that deletes its key. Messages keep their message
+// numbers, so compacted topics have gaps in them. *MaxAge* is sent to the
+// server in whole milliseconds.
+type RetentionPolicy struct {
+	MaxAge      time.Duration
+	MaxBytes    int64
+	MaxMessages int
+	Infinite    bool
+	Compact     bool
+}
+
+// NewAdmin provides a new Admin client instance that is bound to a given
+// host.
+// *host* should be of the form "myhost.com:1234".
+func NewAdmin(timeout time.Duration, host string) (*Admin, error) {
+	a := &Admin{timeout: timeout}
+	opts := []grpc.DialOption{grpc.WithInsecure()}
+	conn, err := grpc.Dial(host, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("grpc.Dial: %v", err)
+	}
+	a.clientProxy = pb.NewMiniKafkaAdminClient(conn)
+	a.dataProxy = pb.NewMiniKafkaClient(conn)
+	return a, nil
+}
+
+// CreateTopic creates a topic with a single partition, without storing any
+// messages in it. It is an error for the topic to exist already.
+func (a *Admin) CreateTopic(topic string) error {
+	return a.CreatePartitionedTopic(topic, 1)
+}
+
+// CreatePartitionedTopic creates a topic with the given number of partitions,
+// without storing any messages in it. It is an error for the topic to exist
+// already.
+func (a *Admin) CreatePartitionedTopic(topic string, numPartitions int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+	req := &pb.CreateTopicRequest{
+		Topic: topic, NumPartitions: uint32(numPartitions)}
+	_, err := a.clientProxy.CreateTopic(ctx, req)
+	if err != nil {
+		return fmt.Errorf("client.CreateTopic: %v", err)
+	}
+	return nil
+}
+
+// DeleteTopic deletes a topic, along with all its messages and the message
+// numbers committed for it by consumer groups.
+func (a *Admin) DeleteTopic(topic string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+	_, err := a.clientProxy.DeleteTopic(ctx, &pb.Topic{Topic: topic})
+	if err != nil {
+		return fmt.Errorf("client.DeleteTopic: %v", err)
+	}
+	return nil
+}
+
+// ListTopics provides the names of all the topics on the server, in
+// alphabetical order.
+func (a *Admin) ListTopics() (topics []string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+	topicList, err := a.clientProxy.ListTopics(ctx, &pb.Empty{})
+	if err != nil {
+		return nil, fmt.Errorf("client.ListTopics: %v", err)
+	}
+	return topicList.GetTopics(), nil
+}
+
+// DescribeTopic provides summary information about a topic; or, for topics
+// with more than one partition, about its first partition.
+func (a *Admin) DescribeTopic(topic string) (
+	description TopicDescription, err error) {
+	return a.DescribePartition(topic, 0)
+}
+
+// DescribePartition provides summary information about one partition of a
+// topic.
+func (a *Admin) DescribePartition(topic string, partition int) (
+	description TopicDescription, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+	req := &pb.DescribeTopicRequest{Topic: topic, Partition: uint32(partition)}
+	resp, err := a.clientProxy.DescribeTopic(ctx, req)
+	if err != nil {
+		return description, fmt.Errorf("client.DescribeTopic: %v", err)
+	}
+	description.NumMessages = int(resp.GetNumMessages())
+	description.NumBytes = int64(resp.GetNumBytes())
+	description.NumSegments = int(resp.GetNumSegments())
+	description.NumPartitions = int(resp.GetNumPartitions())
+	retention := resp.GetRetention()
+	description.Retention = RetentionPolicy{
+		MaxAge:      time.Duration(retention.GetMaxAgeMs()) * time.Millisecond,
+		MaxBytes:    int64(retention.GetMaxBytes()),
+		MaxMessages: int(retention.GetMaxMessages()),
+		Infinite:    retention.GetInfinite(),
+		Compact:     retention.GetCompact()}
+	if description.NumMessages == 0 {
+		return description, nil
+	}
+	description.OldestMsgNumber = int(resp.GetOldestMsgNumber().GetMsgNumber())
+	description.NewestMsgNumber = int(resp.GetNewestMsgNumber().GetMsgNumber())
+	description.OldestCreated, err = ptypes.Timestamp(resp.GetOldestCreated())
+	if err != nil {
+		return description, fmt.Errorf("ptypes.Timestamp: %v", err)
+	}
+	description.NewestCreated, err = ptypes.Timestamp(resp.GetNewestCreated())
+	if err != nil {
+		return description, fmt.Errorf("ptypes.Timestamp: %v", err)
+	}
+	return description, nil
+}
+
+// SetRetentionPolicy sets the retention policy for a topic, in place of the
+// server's default retention time.
+func (a *Admin) SetRetentionPolicy(topic string, policy RetentionPolicy) error {
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+	req := &pb.SetRetentionPolicyRequest{
+		Topic: topic,
+		Policy: &pb.RetentionPolicy{
+			MaxAgeMs:    uint64(policy.MaxAge / time.Millisecond),
+			MaxBytes:    uint64(policy.MaxBytes),
+			MaxMessages: uint32(policy.MaxMessages),
+			Infinite:    policy.Infinite,
+			Compact:     policy.Compact}}
+	_, err := a.clientProxy.SetRetentionPolicy(ctx, req)
+	if err != nil {
+		return fmt.Errorf("client.SetRetentionPolicy: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	minikafka "github.com/peterhoward42/minikafka"
+	pb "github.com/peterhoward42/minikafka/protocol"
+)
+
+// AsyncConfig governs how a Producer in async mode collects messages into
+// batches. A batch is sent when it reaches *MaxBatchMessages* messages, or
+// *MaxBatchBytes* bytes of messages, or when its oldest message has waited
+// for *Linger*. Zero values get the defaults: a Linger of 5ms, 500 messages,
+// and 1 MiB.
+type AsyncConfig struct {
+	Linger           time.Duration
+	MaxBatchMessages int
+	MaxBatchBytes    int
+}
+
+// The defaults for the AsyncConfig fields.
+const (
+	defaultLinger           = 5 * time.Millisecond
+	defaultMaxBatchMessages = 500
+	defaultMaxBatchBytes    = 1024 * 1024
+)
+
+// SendFuture is the eventual outcome of sending a message asynchronously.
+type SendFuture struct {
+	done      chan struct{}
+	msgNum    uint32
+	partition int
+	err       error
+}
+
+// Done provides a channel that is closed once the outcome is known.
+func (f *SendFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the outcome is known, and then provides it. The message
+// number and partition are those the server assigned to the message.
+func (f *SendFuture) Wait() (msgNum uint32, partition int, err error) {
+	<-f.done
+	return f.msgNum, f.partition, f.err
+}
+
+// complete records the outcome, and tells those waiting for it.
+func (f *SendFuture) complete(msgNum uint32, partition int, err error) {
+	f.msgNum = msgNum
+	f.partition = partition
+	f.err = err
+	close(f.done)
+}
+
+// StartAsync switches the producer to async mode, in which SendAsync can be
+// used. Messages sent with SendAsync are collected into batches in the
+// background, and each batch is sent with a single request. (See
+// AsyncConfig). The batches are sent one at a time, in order, so messages
+// that go to the same partition keep their order. Keyed messages go to the
+// partition chosen by the producer's Partitioner, or by a HashPartitioner
+// when it has none. Other messages go to the partition the server chooses
+// for the producer. Call Close() to leave async mode.
+func (p *Producer) StartAsync(config AsyncConfig) {
+	if config.Linger == 0 {
+		config.Linger = defaultLinger
+	}
+	if config.MaxBatchMessages == 0 {
+		config.MaxBatchMessages = defaultMaxBatchMessages
+	}
+	if config.MaxBatchBytes == 0 {
+		config.MaxBatchBytes = defaultMaxBatchBytes
+	}
+	async := &asyncSender{
+		producer: p,
+		config:   config,
+		input:    make(chan asyncRequest, config.MaxBatchMessages),
+		finished: make(chan struct{}),
+		batches:  map[int]*asyncBatch{},
+	}
+	go async.run()
+	p.asyncMutex.Lock()
+	defer p.asyncMutex.Unlock()
+	p.async = async
+}
+
+// sender provides the producer's asyncSender, or nil when it is not in
+// async mode. Once provided, the sender can be used even if Close is called
+// concurrently; it then fails what is submitted to it. (See submit).
+func (p *Producer) sender() *asyncSender {
+	p.asyncMutex.Lock()
+	defer p.asyncMutex.Unlock()
+	return p.async
+}
+
+// SendAsync queues the given message for sending, and returns immediately,
+// unless the queue is full. The future returned delivers the outcome. When
+// *callback* is not nil, it is also called with the outcome, from the
+// producer's background goroutine - so it should not take long. It is an
+// error to call SendAsync when the producer is not in async mode.
+func (p *Producer) SendAsync(message minikafka.Message,
+	callback func(msgNum uint32, partition int, err error)) *SendFuture {
+	future := &SendFuture{done: make(chan struct{})}
+	async := p.sender()
+	if async == nil {
+		future.complete(0, 0, fmt.Errorf("Producer is not in async mode"))
+		return future
+	}
+	async.submit(asyncRequest{
+		message: &pendingMessage{message, future, callback}})
+	return future
+}
+
+// Flush sends any messages queued by SendAsync without waiting for their
+// batches to fill, and blocks until the outcome of every one is known.
+func (p *Producer) Flush() {
+	async := p.sender()
+	if async == nil {
+		return
+	}
+	flushed := make(chan struct{})
+	async.submit(asyncRequest{flushed: flushed})
+	<-flushed
+}
+
+// Close leaves async mode, after sending any messages queued by SendAsync,
+// and waiting until the outcome of every one is known. SendAsync calls made
+// afterwards fail. It also ends the producer's ProduceStream, if it has one.
+// The producer can still be used, but it opens a new stream when it needs
+// one.
+func (p *Producer) Close() {
+	p.asyncMutex.Lock()
+	async := p.async
+	p.async = nil
+	p.asyncMutex.Unlock()
+	if async != nil {
+		async.close()
+	}
+	p.streamMutex.Lock()
+	defer p.streamMutex.Unlock()
+	if p.stream != nil {
+		p.stream.close()
+		p.stream = nil
+	}
+}
+
+// asyncSender collects messages into batches, and sends them, in its own
+// goroutine.
+type asyncSender struct {
+	producer *Producer
+	config   AsyncConfig
+	input    chan asyncRequest
+	finished chan struct{} // Closed when run() returns.
+
+	// Guards against submitting to the input channel once it is closed.
+	mutex  sync.RWMutex
+	closed bool
+
+	// Only touched by run(). Keyed on partition, or noPartition.
+	batches map[int]*asyncBatch
+	timer   *time.Timer
+
+	// Counts the batches sent, whose outcome is not yet known.
+	inFlight sync.WaitGroup
+}
+
+// noPartition is the key of the batch for messages that go to a partition of
+// the server's choosing.
+const noPartition = -1
+
+// asyncRequest is either a message to send, or a request to flush.
+type asyncRequest struct {
+	message *pendingMessage
+	flushed chan struct{} // Closed once the flush is done.
+}
+
+// pendingMessage is a message waiting to be sent, with where to deliver its
+// outcome.
+type pendingMessage struct {
+	message  minikafka.Message
+	future   *SendFuture
+	callback func(msgNum uint32, partition int, err error)
+}
+
+// complete delivers the outcome of sending the message.
+func (m *pendingMessage) complete(msgNum uint32, partition int, err error) {
+	m.future.complete(msgNum, partition, err)
+	if m.callback != nil {
+		m.callback(msgNum, partition, err)
+	}
+}
+
+// asyncBatch is a batch of messages bound for the same partition.
+type asyncBatch struct {
+	messages []*pendingMessage
+	nBytes   int
+}
+
+// submit hands a request to the goroutine, or fails it when the sender is
+// closed.
+func (s *asyncSender) submit(request asyncRequest) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.closed {
+		if request.message != nil {
+			request.message.complete(0, 0, fmt.Errorf("Producer is closed"))
+		}
+		if request.flushed != nil {
+			close(request.flushed)
+		}
+		return
+	}
+	s.input <- request
+}
+
+// close stops the goroutine, once it has sent everything submitted.
+func (s *asyncSender) close() {
+	s.mutex.Lock()
+	if s.closed == false {
+		s.closed = true
+		close(s.input)
+	}
+	s.mutex.Unlock()
+	<-s.finished
+}
+
+// run is the goroutine that collects messages into batches and sends them.
+func (s *asyncSender) run() {
+	defer close(s.finished)
+	for {
+		var lingerC <-chan time.Time
+		if s.timer != nil {
+			lingerC = s.timer.C
+		}
+		select {
+		case request, ok := <-s.input:
+			if ok == false {
+				s.sendAll()
+				s.inFlight.Wait()
+				return
+			}
+			if request.flushed != nil {
+				s.sendAll()
+				s.inFlight.Wait()
+				close(request.flushed)
+				continue
+			}
+			s.add(request.message)
+		case <-lingerC:
+			s.timer = nil
+			s.sendAll()
+		}
+	}
+}
+
+// add puts a message into the batch for its partition, and sends the batch
+// if that fills it.
+func (s *asyncSender) add(message *pendingMessage) {
+	partition, err := s.partitionFor(message.message)
+	if err != nil {
+		message.complete(0, 0, err)
+		return
+	}
+	batch, ok := s.batches[partition]
+	if ok == false {
+		batch = &asyncBatch{}
+		s.batches[partition] = batch
+	}
+	batch.messages = append(batch.messages, message)
+	batch.nBytes += message.message.Size()
+	if len(batch.messages) >= s.config.MaxBatchMessages ||
+		batch.nBytes >= s.config.MaxBatchBytes {
+		s.send(partition, batch)
+		delete(s.batches, partition)
+		return
+	}
+	if s.timer == nil {
+		s.timer = time.NewTimer(s.config.Linger)
+	}
+}
+
+// partitionFor decides which batch a message belongs in.
+func (s *asyncSender) partitionFor(message minikafka.Message) (int, error) {
+	if len(message.Key) == 0 {
+		return noPartition, nil
+	}
+	p := s.producer
+	numPartitions, err := p.partitionCount()
+	if err != nil {
+		return 0, err
+	}
+	partitioner := p.partitioner
+	if partitioner == nil {
+		partitioner = HashPartitioner{}
+	}
+	return partitioner.Partition(message.Key, numPartitions), nil
+}
+
+// sendAll sends every batch that has messages waiting.
+func (s *asyncSender) sendAll() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	for partition, batch := range s.batches {
+		s.send(partition, batch)
+	}
+	s.batches = map[int]*asyncBatch{}
+}
+
+// send sends one batch, and arranges for the outcome for each of its
+// messages to be delivered. Over a ProduceStream, it does not wait for the
+// outcome. Failed batches are retried. (See Producer.startProduceBatch).
+func (s *asyncSender) send(partition int, batch *asyncBatch) {
+	messages := []minikafka.Message{}
+	for _, pending := range batch.messages {
+		messages = append(messages, pending.message)
+	}
+	var requested *pb.Partition
+	if partition != noPartition {
+		requested = &pb.Partition{Partition: uint32(partition)}
+	}
+	request, err := s.producer.makeProduceBatchRequest(messages, requested)
+	if err != nil {
+		for _, pending := range batch.messages {
+			pending.complete(0, 0, err)
+		}
+		return
+	}
+	s.inFlight.Add(1)
+	s.producer.startProduceBatch(request,
+		func(response *pb.ProduceBatchResponse, err error) {
+			defer s.inFlight.Done()
+			for i, pending := range batch.messages {
+				if err != nil {
+					pending.complete(0, 0, err)
+					continue
+				}
+				pending.complete(response.GetFirstMsgNumber()+uint32(i),
+					int(response.GetPartition()), nil)
+			}
+		})
+}
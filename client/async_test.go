@@ -0,0 +1,209 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	minikafka "github.com/peterhoward42/minikafka"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/memstore"
+)
+
+// sendAsync sends messages "msg 0", "msg 1" etc. asynchronously.
+func sendAsync(producer *Producer, n int) []*SendFuture {
+	futures := []*SendFuture{}
+	for i := 0; i < n; i++ {
+		futures = append(futures, producer.SendAsync(minikafka.Message{
+			Payload: []byte(fmt.Sprintf("msg %d", i))}, nil))
+	}
+	return futures
+}
+
+func TestAsyncBatchIsSentAfterLinger(t *testing.T) {
+	store := &batchRecordingStore{BackingStore: memstore.NewMemStore()}
+	host, stop := startTestServerWith(t, store)
+	defer stop()
+	producer, err := NewProducer("topicA", time.Second, host)
+	assert.Nil(t, err)
+	producer.StartAsync(AsyncConfig{Linger: 50 * time.Millisecond})
+	defer producer.Close()
+
+	// Without a Flush, only the linger sends the batch.
+	for _, future := range sendAsync(producer, 5) {
+		select {
+		case <-future.Done():
+		case <-time.After(2 * time.Second):
+			assert.Fail(t, "Batch not sent after linger")
+			return
+		}
+	}
+	assert.Equal(t, []int{5}, store.batchSizes())
+}
+
+func TestAsyncBatchIsSentWhenFull(t *testing.T) {
+	store := &batchRecordingStore{BackingStore: memstore.NewMemStore()}
+	host, stop := startTestServerWith(t, store)
+	defer stop()
+	producer, err := NewProducer("topicA", time.Second, host)
+	assert.Nil(t, err)
+	producer.StartAsync(AsyncConfig{Linger: time.Hour, MaxBatchMessages: 3})
+	defer producer.Close()
+
+	sendAsync(producer, 7)
+	producer.Flush()
+	assert.Equal(t, []int{3, 3, 1}, store.batchSizes())
+}
+
+func TestAsyncBatchIsSentWhenBytesReached(t *testing.T) {
+	store := &batchRecordingStore{BackingStore: memstore.NewMemStore()}
+	host, stop := startTestServerWith(t, store)
+	defer stop()
+	producer, err := NewProducer("topicA", time.Second, host)
+	assert.Nil(t, err)
+	// Each message is 5 bytes.
+	producer.StartAsync(AsyncConfig{Linger: time.Hour, MaxBatchBytes: 10})
+	defer producer.Close()
+
+	sendAsync(producer, 5)
+	producer.Flush()
+	assert.Equal(t, []int{2, 2, 1}, store.batchSizes())
+}
+
+func TestSendFutureDeliversOutcome(t *testing.T) {
+	host, stop := startTestServer(t)
+	defer stop()
+	producer, err := NewProducer("topicA", time.Second, host)
+	assert.Nil(t, err)
+	producer.StartAsync(AsyncConfig{MaxBatchMessages: 2})
+	defer producer.Close()
+
+	called := make(chan uint32, 3)
+	futures := []*SendFuture{}
+	for i := 0; i < 3; i++ {
+		futures = append(futures, producer.SendAsync(
+			minikafka.Message{Payload: []byte("msg")},
+			func(msgNum uint32, partition int, err error) {
+				assert.Nil(t, err)
+				called <- msgNum
+			}))
+	}
+	producer.Flush()
+	for i, future := range futures {
+		msgNum, partition, err := future.Wait()
+		assert.Nil(t, err)
+		assert.Equal(t, uint32(i+1), msgNum)
+		assert.Equal(t, 0, partition)
+		assert.Equal(t, uint32(i+1), <-called)
+	}
+}
+
+func TestSendAsyncFailsWhenNotInAsyncMode(t *testing.T) {
+	host, stop := startTestServer(t)
+	defer stop()
+	producer, err := NewProducer("topicA", time.Second, host)
+	assert.Nil(t, err)
+	_, _, err = producer.SendAsync(
+		minikafka.Message{Payload: []byte("msg")}, nil).Wait()
+	assert.EqualError(t, err, "Producer is not in async mode")
+}
+
+func TestCloseWaitsForSendsInFlight(t *testing.T) {
+	host, stop := startTestServer(t)
+	defer stop()
+	producer, err := NewProducer("topicA", time.Second, host)
+	assert.Nil(t, err)
+	producer.StartAsync(AsyncConfig{Linger: time.Hour, MaxBatchMessages: 10})
+
+	futures := sendAsync(producer, 25)
+	producer.Close()
+	for _, future := range futures {
+		select {
+		case <-future.Done():
+		default:
+			assert.Fail(t, "Close returned before outcome known")
+			return
+		}
+		_, _, err := future.Wait()
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 25, len(pollAll(t, host, "topicA")))
+
+	// Having left async mode, SendAsync fails.
+	_, _, err = producer.SendAsync(
+		minikafka.Message{Payload: []byte("msg")}, nil).Wait()
+	assert.NotNil(t, err)
+}
+
+func TestAsyncBatchesKeepTheirOrderOverStream(t *testing.T) {
+	host, stop := startTestServer(t)
+	defer stop()
+	producer, err := NewProducer("topicA", time.Second, host)
+	assert.Nil(t, err)
+	// Small batches, so that many are in flight at once.
+	producer.StartAsync(AsyncConfig{MaxBatchMessages: 3})
+	defer producer.Close()
+
+	const n = 300
+	futures := sendAsync(producer, n)
+	producer.Flush()
+	for i, future := range futures {
+		msgNum, _, err := future.Wait()
+		assert.Nil(t, err)
+		assert.Equal(t, uint32(i+1), msgNum)
+	}
+	received := pollAll(t, host, "topicA")
+	assert.Equal(t, n, len(received))
+	for i, message := range received {
+		assert.Equal(t, fmt.Sprintf("msg %d", i), message)
+	}
+}
+
+func TestSendSendAsyncAndCloseConcurrently(t *testing.T) {
+	// Run with -race, to make sure that the producer's state is guarded.
+	host, stop := startTestServer(t)
+	defer stop()
+	admin, err := NewAdmin(time.Second, host)
+	assert.Nil(t, err)
+	assert.Nil(t, admin.CreatePartitionedTopic("topicA", 2))
+	producer, err := NewProducer("topicA", time.Second, host)
+	assert.Nil(t, err)
+	producer.SetPartitioner(HashPartitioner{})
+	producer.StartAsync(AsyncConfig{MaxBatchMessages: 2})
+
+	const n = 20
+	futures := make(chan *SendFuture, n)
+	sent := make(chan error, n)
+	go func() {
+		for i := 0; i < n; i++ {
+			futures <- producer.SendAsync(minikafka.Message{
+				Key: []byte(fmt.Sprintf("key %d", i))}, nil)
+		}
+		close(futures)
+	}()
+	go func() {
+		for i := 0; i < n; i++ {
+			_, _, err := producer.Send(minikafka.Message{
+				Key: []byte(fmt.Sprintf("key %d", i))})
+			sent <- err
+		}
+		close(sent)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	producer.Close()
+
+	for err := range sent {
+		assert.Nil(t, err)
+	}
+	// Those sent before Close succeed, and the rest fail; but every one
+	// gets an outcome.
+	for future := range futures {
+		select {
+		case <-future.Done():
+		case <-time.After(2 * time.Second):
+			assert.Fail(t, "No outcome for message")
+			return
+		}
+	}
+}
@@ -5,46 +5,190 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/golang/protobuf/ptypes"
 	"google.golang.org/grpc"
 
+	minikafka "github.com/peterhoward42/minikafka"
 	pb "github.com/peterhoward42/minikafka/protocol"
 )
 
+// maxPagesPerPoll is the most requests that one call to Poll makes, to page
+// through the messages available. It bounds how many messages a consumer that
+// has fallen behind holds in memory at once, and how long Poll takes on a
+// topic that is being written to continuously.
+const maxPagesPerPoll = 10
+
 // Consumer is a MiniKafka client object dedicated to sending *poll* messages to
 // the server using gRPC.
 type Consumer struct {
 	topic       string
+	partition   int
 	readFrom    int // Message number.
 	timeout     time.Duration
+	maxWait     time.Duration // Zero means don't long-poll.
+	minMessages int
+	maxMessages int                // Per request, zero means no limit.
+	maxBytes    int                // Per request, zero means no limit.
 	clientProxy pb.MiniKafkaClient // gRPC component.
+
+	// What to do when the read-from position is out of range, and the range
+	// of messages available, as last reported by the server.
+	resetPolicy ResetPolicy
+	earliest    int
+	next        int
+
+	// Consumer group membership. (Unused when group is empty).
+	group      string
+	autoCommit bool
+	committed  int // The read-from position last committed.
+	lastCommit time.Time
 }
 
 // NewConsumer provides a new Consumer client instance that is bound to a given
 // host, and a given message topic. The caller specifies which
 // message number read-from position they wish the subsequent polling to start.
+// For topics with more than one partition, it consumes only the first
+// partition.
 // *host* should be of the form "myhost.com:1234".
 func NewConsumer(topic string, readFrom int, timeout time.Duration,
 	host string) (*Consumer, error) {
+	return NewPartitionConsumer(topic, 0, readFrom, timeout, host)
+}
+
+// NewPartitionConsumer is like NewConsumer, but consumes the given partition
+// of the topic. Each partition has its own message numbering.
+func NewPartitionConsumer(topic string, partition int, readFrom int,
+	timeout time.Duration, host string) (*Consumer, error) {
 
-	p := &Consumer{topic: topic, readFrom: readFrom, timeout: timeout}
 	opts := []grpc.DialOption{grpc.WithInsecure()}
 	conn, err := grpc.Dial(host, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("grpc.Dial: %v", err)
 	}
-	p.clientProxy = pb.NewMiniKafkaClient(conn)
-	return p, nil
+	return newPartitionConsumer(topic, partition, readFrom, timeout, conn), nil
+}
+
+// newPartitionConsumer is like NewPartitionConsumer, but uses the given
+// connection, which it leaves to the caller to close.
+func newPartitionConsumer(topic string, partition int, readFrom int,
+	timeout time.Duration, conn *grpc.ClientConn) *Consumer {
+	return &Consumer{topic: topic, partition: partition, readFrom: readFrom,
+		timeout: timeout, clientProxy: pb.NewMiniKafkaClient(conn)}
+}
+
+// SetLongPoll switches the consumer to long-polling. Subsequent calls to
+// Poll() will ask the server to wait for up to *maxWait* for at least
+// *minMessages* to become available before responding, rather than responding
+// immediately with nothing when there is nothing to return. Each Poll's
+// timeout is extended by *maxWait* to allow for this. A *maxWait* of zero
+// switches long-polling back off.
+func (c *Consumer) SetLongPoll(maxWait time.Duration, minMessages int) {
+	c.maxWait = maxWait
+	c.minMessages = minMessages
+}
+
+// SetPageLimits sets limits on how many messages, and how many bytes of
+// message, the server should return in response to each individual request
+// the consumer makes. (Zero means no limit, although the server always
+// applies its own byte limit). Poll() pages through what is available, making
+// up to maxPagesPerPoll requests, so these limits are used to tune the
+// request size, and with it, the most that one Poll() returns.
+func (c *Consumer) SetPageLimits(maxMessages int, maxBytes int) {
+	c.maxMessages = maxMessages
+	c.maxBytes = maxBytes
+}
+
+// SeekToTime moves the consumer's *readFrom* position to the first message
+// that the server stored at or after the given time, so that subsequent
+// polling replays everything since then. When every message was stored
+// earlier, it moves to where the next message to arrive will be. For group
+// consumers, the new position is committed in the same way as any other.
+// When the topic does not exist, it returns a *NoSuchTopicError.
+func (c *Consumer) SeekToTime(t time.Time) error {
+	timestamp, err := ptypes.TimestampProto(t)
+	if err != nil {
+		return fmt.Errorf("ptypes.TimestampProto: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	request := &pb.OffsetForTimeRequest{
+		Topic: c.topic, Partition: uint32(c.partition), Time: timestamp}
+	msgNumber, err := c.clientProxy.OffsetForTime(ctx, request)
+	if noSuchTopic, ok := c.noSuchTopic(err); ok {
+		return noSuchTopic
+	}
+	if err != nil {
+		return fmt.Errorf("client.OffsetForTime: %v", err)
+	}
+	c.readFrom = int(msgNumber.GetMsgNumber())
+	return nil
 }
 
 // Poll is the primary API method for Consumer, which sends a Poll
 // message to the server and returns the messages provided back to the caller.
 // It also advances its internal *readFrom* position state accordingly (ready
 // for the next poll), and additionally notifies the caller of this this in its
-// return values.
+// return values. When the server has more messages available than it will
+// return in one response, Poll transparently pages through them, sending up
+// to maxPagesPerPoll requests. It returns once it has caught up, or has made
+// that many; so a consumer that has fallen behind gets the backlog over
+// several calls.
+// When the server reports that the read-from position is out of range, Poll
+// applies the consumer's ResetPolicy. When the topic does not exist, Poll
+// returns a *NoSuchTopicError at once, even when long-polling.
 func (c *Consumer) Poll() (
 	messages []MessagePayload, newReadFrom int, err error) {
+	records, newReadFrom, err := c.PollRecords()
+	if err != nil {
+		return nil, 0, err
+	}
+	messages = []MessagePayload{}
+	for _, record := range records {
+		messages = append(messages, record.Payload)
+	}
+	return messages, newReadFrom, nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+// PollRecords is like Poll, but returns each message in full - with its key,
+// headers and timestamp, along with its message number and the time at which
+// the server stored it.
+func (c *Consumer) PollRecords() (
+	records []minikafka.StoredMessage, newReadFrom int, err error) {
+
+	// Auto-commit the position reached by the previous Poll, on the basis
+	// that asking for more means the caller has finished with those.
+	if c.autoCommit {
+		err := c.commitIfAdvanced()
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	records = []minikafka.StoredMessage{}
+	maxWait := c.maxWait
+	for pages := 0; pages < maxPagesPerPoll; pages++ {
+		page, err := c.pollPage(maxWait)
+		if err != nil {
+			return nil, 0, err
+		}
+		records = append(records, page...)
+		// Stop once caught up with what the server had available.
+		if len(page) == 0 || c.readFrom >= c.next {
+			break
+		}
+		// Only the first request should wait for messages to arrive.
+		maxWait = 0
+	}
+	return records, c.readFrom, nil
+}
+
+// pollPage sends a single Poll message to the server, asking it to wait for up
+// to *maxWait* for messages to become available. It returns the messages
+// provided, and advances the consumer's *readFrom* position accordingly.
+func (c *Consumer) pollPage(maxWait time.Duration) (
+	records []minikafka.StoredMessage, err error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout+maxWait)
 	defer cancel()
 
 	// Derive the message number to read from the state held in this consumer
@@ -52,22 +196,41 @@ func (c *Consumer) Poll() (
 	readFrom := &pb.MsgNumber{MsgNumber: uint32(c.readFrom)}
 
 	pollRequest := &pb.PollRequest{
-		Topic: c.topic, ReadFrom: readFrom}
+		Topic:       c.topic,
+		Partition:   uint32(c.partition),
+		ReadFrom:    readFrom,
+		MaxWaitMs:   uint32(maxWait / time.Millisecond),
+		MinMessages: uint32(c.minMessages),
+		MaxMessages: uint32(c.maxMessages),
+		MaxBytes:    uint32(c.maxBytes)}
 	pollResponse, err := c.clientProxy.Poll(ctx, pollRequest)
+	if earliest, next, ok := outOfRange(err); ok {
+		err = c.reset(earliest, next)
+		if err != nil {
+			return nil, err
+		}
+		return c.pollPage(maxWait)
+	}
+	if noSuchTopic, ok := c.noSuchTopic(err); ok {
+		return nil, noSuchTopic
+	}
 	if err != nil {
-		return nil, 0, fmt.Errorf("client.Poll: %v", err)
+		return nil, fmt.Errorf("client.Poll: %v", err)
 	}
+	c.earliest = int(pollResponse.GetAvailable().GetEarliest())
+	c.next = int(pollResponse.GetAvailable().GetNext())
 
 	// Capture the messages to return.
-	messages = []MessagePayload{}
-	payloads := pollResponse.GetPayloads()
-	for _, payloadObj := range payloads {
-		payload := payloadObj.GetPayload()
-		messages = append(messages, payload)
+	records = []minikafka.StoredMessage{}
+	for _, payload := range pollResponse.GetPayloads() {
+		record, err := makeRecord(payload)
+		if err != nil {
+			return nil, fmt.Errorf("makeRecord: %v", err)
+		}
+		records = append(records, record)
 	}
 
 	// Update the newReadFrom message number, ready for the next poll.
 	c.readFrom = int(pollResponse.GetNewReadFrom().GetMsgNumber())
-	newReadFrom = c.readFrom
-	return
+	return records, nil
 }
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPollReturnsBacklogInBoundedSteps(t *testing.T) {
+	host, stop := startTestServer(t)
+	defer stop()
+	producer, err := NewProducer("topicA", time.Second, host)
+	assert.Nil(t, err)
+	for i := 0; i < 25; i++ {
+		_, err = producer.SendMessage([]byte(fmt.Sprintf("msg %d", i)))
+		assert.Nil(t, err)
+	}
+
+	consumer, err := NewConsumer("topicA", 1, time.Second, host)
+	assert.Nil(t, err)
+	consumer.SetPageLimits(1, 0)
+	// Each Poll should page through no more than maxPagesPerPoll, and the
+	// next should carry on from there.
+	for _, expected := range []int{10, 10, 5, 0} {
+		messages, newReadFrom, err := consumer.Poll()
+		assert.Nil(t, err)
+		assert.Equal(t, expected, len(messages))
+		if len(messages) > 0 {
+			assert.Equal(t, "msg "+fmt.Sprint(newReadFrom-2),
+				string(messages[len(messages)-1]))
+		}
+	}
+}
+
+func TestPollReturnsWhenTopicIsBusy(t *testing.T) {
+	host, stop := startTestServer(t)
+	defer stop()
+	producer, err := NewProducer("topicA", time.Second, host)
+	assert.Nil(t, err)
+	_, err = producer.SendMessage([]byte("first"))
+	assert.Nil(t, err)
+
+	// Keep producing throughout.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			producer.SendMessage([]byte("more"))
+		}
+	}()
+
+	consumer, err := NewConsumer("topicA", 1, time.Second, host)
+	assert.Nil(t, err)
+	consumer.SetPageLimits(1, 0)
+	polled := make(chan int)
+	go func() {
+		messages, _, _ := consumer.Poll()
+		polled <- len(messages)
+	}()
+	select {
+	case n := <-polled:
+		assert.True(t, n > 0 && n <= maxPagesPerPoll)
+	case <-time.After(3 * time.Second):
+		assert.Fail(t, "Poll did not return")
+	}
+}
+
+func TestPollWhenNoSuchTopic(t *testing.T) {
+	host, stop := startTestServer(t)
+	defer stop()
+	consumer, err := NewConsumer("nosuchtopic", 1, time.Second, host)
+	assert.Nil(t, err)
+	// Even when long-polling, it should not wait.
+	consumer.SetLongPoll(time.Hour, 1)
+	_, _, err = consumer.Poll()
+	assert.Equal(t, &NoSuchTopicError{Topic: "nosuchtopic"}, err)
+}
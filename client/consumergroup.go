@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pb "github.com/peterhoward42/minikafka/protocol"
+)
+
+// autoCommitInterval is the minimum time between the automatic commits made
+// by an auto-committing consumer while it harvests messages from a
+// Subscription.
+const autoCommitInterval = time.Second
+
+// NewGroupConsumer provides a new Consumer client instance that consumes a
+// topic on behalf of a named consumer group. Its read-from position starts at
+// the one most recently committed by the group for the topic, or at message 1
+// if the group has never committed one. When *autoCommit* is true, the
+// consumer commits its read-from position automatically. It does so at the
+// start of each Poll() (thereby committing the messages returned by the
+// previous one), at most once every second as a Subscription delivers
+// messages, and when a Subscription is closed. Otherwise call Commit()
+// yourself. For topics with more than one partition, it consumes only the
+// first partition. *host* should be of the form "myhost.com:1234".
+func NewGroupConsumer(group string, topic string, autoCommit bool,
+	timeout time.Duration, host string) (*Consumer, error) {
+	return NewGroupPartitionConsumer(group, topic, 0, autoCommit, timeout, host)
+}
+
+// NewGroupPartitionConsumer is like NewGroupConsumer, but consumes the given
+// partition of the topic. Consumer groups commit their read-from position
+// separately for each partition.
+func NewGroupPartitionConsumer(group string, topic string, partition int,
+	autoCommit bool, timeout time.Duration, host string) (*Consumer, error) {
+
+	c, err := NewPartitionConsumer(topic, partition, 1, timeout, host)
+	if err != nil {
+		return nil, fmt.Errorf("NewPartitionConsumer: %v", err)
+	}
+	c.group = group
+	c.autoCommit = autoCommit
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	fetchRequest := &pb.FetchOffsetRequest{
+		Group: group, Topic: topic, Partition: uint32(partition)}
+	fetchResponse, err := c.clientProxy.FetchOffset(ctx, fetchRequest)
+	if err != nil {
+		return nil, fmt.Errorf("client.FetchOffset: %v", err)
+	}
+	if fetchResponse.GetReadFrom() != nil {
+		c.readFrom = int(fetchResponse.GetReadFrom().GetMsgNumber())
+	}
+	c.committed = c.readFrom
+	return c, nil
+}
+
+// Commit records the consumer's current read-from position on the server, as
+// the one from which its consumer group should resume consuming the topic.
+// It is only valid for consumers made with NewGroupConsumer().
+func (c *Consumer) Commit() error {
+	if c.group == "" {
+		return fmt.Errorf("Commit: consumer does not belong to a group")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	readFrom := c.readFrom
+	commitRequest := &pb.CommitOffsetRequest{
+		Group:     c.group,
+		Topic:     c.topic,
+		Partition: uint32(c.partition),
+		ReadFrom:  &pb.MsgNumber{MsgNumber: uint32(readFrom)}}
+	_, err := c.clientProxy.CommitOffset(ctx, commitRequest)
+	if err != nil {
+		return fmt.Errorf("client.CommitOffset: %v", err)
+	}
+	c.committed = readFrom
+	c.lastCommit = time.Now()
+	return nil
+}
+
+// commitIfAdvanced commits the consumer's read-from position, unless it has
+// not changed since it was last committed.
+func (c *Consumer) commitIfAdvanced() error {
+	if c.readFrom == c.committed {
+		return nil
+	}
+	return c.Commit()
+}
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// NoSuchTopicError is the error a Consumer returns from Poll, SeekToTime and
+// Subscription.Next, when the topic it consumes does not exist. Typically
+// because no producer has written to it yet; so it is worth trying again
+// later.
+type NoSuchTopicError struct {
+	Topic string
+}
+
+// Error is defined by, and documented in the standard error interface.
+func (e *NoSuchTopicError) Error() string {
+	return fmt.Sprintf("No such topic: %s", e.Topic)
+}
+
+// noSuchTopic examines an error returned by a Poll, Subscribe or
+// OffsetForTime call. When it is the server reporting that the consumer's
+// topic does not exist, it provides the error to return to the caller in its
+// place, and *ok* is true.
+func (c *Consumer) noSuchTopic(err error) (
+	noSuchTopic *NoSuchTopicError, ok bool) {
+	st, isStatus := status.FromError(err)
+	if err == nil || isStatus == false || st.Code() != codes.NotFound {
+		return nil, false
+	}
+	return &NoSuchTopicError{Topic: c.topic}, true
+}
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pb "github.com/peterhoward42/minikafka/protocol"
+)
+
+// PartitionOffsets describes the range of messages one partition of a topic
+// has available: those numbered from Earliest, up to but not including Next.
+// (They are equal when the partition holds no messages).
+type PartitionOffsets struct {
+	Partition int
+	Earliest  int
+	Next      int
+}
+
+// ListOffsets provides the range of messages available in each of a topic's
+// partitions, in partition order.
+func (a *Admin) ListOffsets(topic string) ([]PartitionOffsets, error) {
+	return listOffsets(a.dataProxy, a.timeout, topic)
+}
+
+// GroupLag provides, for each of a topic's partitions, how many of the
+// messages available lie beyond the read-from position last committed by the
+// named consumer group. Partitions for which the group has never committed
+// a position count every message available.
+func (a *Admin) GroupLag(group string, topic string) (lags []int, err error) {
+	offsets, err := a.ListOffsets(topic)
+	if err != nil {
+		return nil, err
+	}
+	lags = []int{}
+	for _, partitionOffsets := range offsets {
+		ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+		fetchResponse, err := a.dataProxy.FetchOffset(ctx,
+			&pb.FetchOffsetRequest{Group: group, Topic: topic,
+				Partition: uint32(partitionOffsets.Partition)})
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("client.FetchOffset: %v", err)
+		}
+		readFrom := partitionOffsets.Earliest
+		if fetchResponse.GetReadFrom() != nil {
+			readFrom = int(fetchResponse.GetReadFrom().GetMsgNumber())
+		}
+		lags = append(lags, lag(readFrom, partitionOffsets))
+	}
+	return lags, nil
+}
+
+// SeekToBeginning moves the consumer's *readFrom* position to the oldest
+// message available in the partition it consumes.
+func (c *Consumer) SeekToBeginning() error {
+	offsets, err := c.partitionOffsets()
+	if err != nil {
+		return err
+	}
+	c.readFrom = offsets.Earliest
+	return nil
+}
+
+// SeekToEnd moves the consumer's *readFrom* position to where the next message
+// to be stored in the partition it consumes will be. It thus starts at the
+// tail, without reading the messages that are already available.
+func (c *Consumer) SeekToEnd() error {
+	offsets, err := c.partitionOffsets()
+	if err != nil {
+		return err
+	}
+	c.readFrom = offsets.Next
+	return nil
+}
+
+// Lag provides how many of the messages available in the partition the
+// consumer consumes, lie at or beyond its *readFrom* position.
+func (c *Consumer) Lag() (int, error) {
+	offsets, err := c.partitionOffsets()
+	if err != nil {
+		return 0, err
+	}
+	return lag(c.readFrom, offsets), nil
+}
+
+// partitionOffsets provides the range of messages available in the partition
+// the consumer consumes.
+func (c *Consumer) partitionOffsets() (PartitionOffsets, error) {
+	offsets, err := listOffsets(c.clientProxy, c.timeout, c.topic)
+	if err != nil {
+		return PartitionOffsets{}, err
+	}
+	if c.partition >= len(offsets) {
+		return PartitionOffsets{}, fmt.Errorf(
+			"Partition %d does not exist", c.partition)
+	}
+	return offsets[c.partition], nil
+}
+
+// listOffsets asks the server for the range of messages available in each of
+// a topic's partitions.
+func listOffsets(clientProxy pb.MiniKafkaClient, timeout time.Duration,
+	topic string) ([]PartitionOffsets, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	resp, err := clientProxy.ListOffsets(ctx, &pb.Topic{Topic: topic})
+	if err != nil {
+		return nil, fmt.Errorf("client.ListOffsets: %v", err)
+	}
+	offsets := []PartitionOffsets{}
+	for _, partitionOffsets := range resp.GetPartitions() {
+		offsets = append(offsets, PartitionOffsets{
+			Partition: int(partitionOffsets.GetPartition()),
+			Earliest:  int(partitionOffsets.GetAvailable().GetEarliest()),
+			Next:      int(partitionOffsets.GetAvailable().GetNext())})
+	}
+	return offsets, nil
+}
+
+// lag provides how many of the messages available lie at or beyond the given
+// read-from position.
+func lag(readFrom int, offsets PartitionOffsets) int {
+	if readFrom < offsets.Earliest {
+		readFrom = offsets.Earliest
+	}
+	if readFrom > offsets.Next {
+		return 0
+	}
+	return offsets.Next - readFrom
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/peterhoward42/minikafka/protocol"
+)
+
+// ResetPolicy says what a Consumer should do when the server reports that
+// its read-from position is out of range. That happens when the messages it
+// was due to read have expired, or when it is beyond the next message to be
+// stored. (E.g. because the topic has been deleted and created again).
+type ResetPolicy int
+
+// The reset policies available.
+const (
+	// ResetEarliest moves the consumer to the oldest message available. It
+	// is the default.
+	ResetEarliest ResetPolicy = iota
+	// ResetLatest moves the consumer to the next message to be stored,
+	// skipping those that are available.
+	ResetLatest
+	// ResetNone leaves the consumer where it is, and makes Poll and
+	// Subscription.Next return an *OutOfRangeError.
+	ResetNone
+)
+
+// OutOfRangeError is the error a Consumer returns when its read-from
+// position is out of range, and its ResetPolicy is ResetNone. It reports the
+// range of messages available, from Earliest up to (but not including) Next.
+type OutOfRangeError struct {
+	ReadFrom int
+	Earliest int
+	Next     int
+}
+
+// Error is defined by, and documented in the standard error interface.
+func (e *OutOfRangeError) Error() string {
+	return fmt.Sprintf(
+		"Read-from message number %d is out of range. Messages %d up to "+
+			"(but not including) %d are available", e.ReadFrom, e.Earliest,
+		e.Next)
+}
+
+// Expired reports whether the error arose because the messages the consumer
+// was due to read have been removed by the server.
+func (e *OutOfRangeError) Expired() bool {
+	return e.ReadFrom < e.Earliest
+}
+
+// SetResetPolicy sets what the consumer does when the server reports that its
+// read-from position is out of range. (See ResetPolicy).
+func (c *Consumer) SetResetPolicy(policy ResetPolicy) {
+	c.resetPolicy = policy
+}
+
+// AvailableRange provides the range of messages that the partition being
+// consumed had available, from *earliest* up to (but not including) *next*,
+// as reported by the server in response to the most recent Poll. Both are
+// zero before the first Poll.
+func (c *Consumer) AvailableRange() (earliest int, next int) {
+	return c.earliest, c.next
+}
+
+// outOfRange examines an error returned by a Poll or Subscribe call. When it
+// is the server reporting that the read-from position is out of range, it
+// provides the range of messages available, and *ok* is true.
+func outOfRange(err error) (earliest int, next int, ok bool) {
+	st, isStatus := status.FromError(err)
+	if err == nil || isStatus == false || st.Code() != codes.OutOfRange {
+		return 0, 0, false
+	}
+	for _, detail := range st.Details() {
+		if available, isRange := detail.(*pb.AvailableRange); isRange {
+			return int(available.GetEarliest()), int(available.GetNext()),
+				true
+		}
+	}
+	return 0, 0, false
+}
+
+// reset applies the consumer's reset policy, given the range of messages
+// available. It returns an *OutOfRangeError when the policy is ResetNone.
+func (c *Consumer) reset(earliest int, next int) error {
+	c.earliest = earliest
+	c.next = next
+	switch c.resetPolicy {
+	case ResetEarliest:
+		c.readFrom = earliest
+	case ResetLatest:
+		c.readFrom = next
+	default:
+		return &OutOfRangeError{
+			ReadFrom: c.readFrom, Earliest: earliest, Next: next}
+	}
+	return nil
+}
@@ -3,10 +3,15 @@ package client
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/golang/protobuf/ptypes"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
+	minikafka "github.com/peterhoward42/minikafka"
 	pb "github.com/peterhoward42/minikafka/protocol"
 )
 
@@ -16,17 +21,65 @@ type Producer struct {
 	topic       string
 	timeout     time.Duration
 	clientProxy pb.MiniKafkaClient
+
+	// Chooses partitions for keyed messages. When nil, the server chooses.
+	partitioner Partitioner
+	// The topic's partition count, which is needed by the async goroutine
+	// as well as by Send. (See partitionCount).
+	partitionsMutex sync.Mutex
+	numPartitions   int // Zero until fetched from the server.
+
+	// Collects messages into batches in the background, once async mode is
+	// switched on. (See StartAsync).
+	asyncMutex sync.Mutex // Guards async.
+	async      *asyncSender
+
+	// The ProduceStream held open for sending batches, whether the server
+	// has acknowledged a batch on one yet, and whether it has turned out not
+	// to support them. (See startProduceBatch).
+	streamMutex     sync.Mutex
+	stream          *produceStream
+	streamConfirmed bool
+	noStream        bool
+	// Closed once the replacement under way of a failed stream has
+	// finished. Nil when there is none. (See replace).
+	replacing chan struct{}
+
+	// Identify the producer's requests, so that they can be retried
+	// safely. (See SetMaxRetries).
+	producerID string
+	sequence   uint64 // The last used. Accessed atomically.
+	maxRetries int
+}
+
+// Partitioner chooses which of a topic's partitions a message with the given
+// key should be sent to. It should return a partition in the range zero to
+// numPartitions-1.
+type Partitioner interface {
+	Partition(key []byte, numPartitions int) int
+}
+
+// HashPartitioner is a Partitioner that chooses partitions the same way the
+// server does when it is left to choose for itself.
+type HashPartitioner struct{}
+
+// Partition is defined by, and documented in the Partitioner interface.
+func (HashPartitioner) Partition(key []byte, numPartitions int) int {
+	return minikafka.PartitionForKey(key, numPartitions)
 }
 
 // NewProducer provides a new Producer instance that is bound to a given
-// host, and a given message topic.
+// host, and a given message topic. It retries failed requests, as described
+// for SetMaxRetries.
 // *host* should be of the form "myhost.com:1234".
 func NewProducer(topic string, timeout time.Duration, host string) (
 	*Producer, error) {
 
 	p := &Producer{
-		topic:   topic,
-		timeout: timeout,
+		topic:      topic,
+		timeout:    timeout,
+		producerID: newProducerID(),
+		maxRetries: defaultMaxRetries,
 	}
 	opts := []grpc.DialOption{grpc.WithInsecure()}
 	conn, err := grpc.Dial(host, opts...)
@@ -37,18 +90,514 @@ func NewProducer(topic string, timeout time.Duration, host string) (
 	return p, nil
 }
 
+// SetPartitioner makes the producer choose the partitions that keyed messages
+// are sent to, using the given Partitioner, rather than leaving the server to
+// choose. The producer asks the server how many partitions the topic has the
+// first time it needs to know.
+func (p *Producer) SetPartitioner(partitioner Partitioner) {
+	p.partitioner = partitioner
+}
+
 // SendMessage is the primary API method for Producer, which sends
-// the given message payload to the server in a Produce message.
+// the given message payload to the server in a Produce message. When the
+// topic has more than one partition, the server stores all the producer's
+// messages without keys in the same one, chosen by the producer's ID.
 func (p *Producer) SendMessage(messagePayload MessagePayload) (
 	msgNum uint32, err error) {
+	msgNum, _, err = p.Send(minikafka.Message{Payload: messagePayload})
+	if err != nil {
+		return 1, err
+	}
+	return msgNum, err
+}
+
+// SendKeyedMessage sends the given message payload to the server, along with
+// a key that determines the partition it is stored in. Messages with the same
+// key always go to the same partition, and thus retain their order. It
+// returns the partition used, along with the message number.
+func (p *Producer) SendKeyedMessage(key []byte,
+	messagePayload MessagePayload) (
+	msgNum uint32, partition int, err error) {
+	return p.Send(minikafka.Message{Key: key, Payload: messagePayload})
+}
+
+// Send sends the given message to the server, along with whichever of its
+// key, headers and timestamp it has. Consumers get these back alongside the
+// payload. The key determines the partition the message is stored in, as it
+// does for SendKeyedMessage. It returns the partition used, along with the
+// message number.
+func (p *Producer) Send(message minikafka.Message) (
+	msgNum uint32, partition int, err error) {
+	return p.send(message, nil)
+}
+
+// SendIfNext is like Send, but the message is stored only if it would get
+// the message number *expectedNext* in its partition. Otherwise nothing is
+// stored, and the error returned is an *UnexpectedNextError. This serves for
+// optimistic concurrency control; for example when a topic (or partition) is
+// the event stream of a single entity, and *expectedNext* is where the
+// producer's view of it ends. The partition must be predictable: determined
+// by the message's key, or the topic must have only one.
+func (p *Producer) SendIfNext(message minikafka.Message,
+	expectedNext uint32) (msgNum uint32, partition int, err error) {
+	return p.send(message, &pb.MsgNumber{MsgNumber: expectedNext})
+}
+
+// send is the common implementation of Send and SendIfNext. A nil
+// *expectedNext* means the message is stored unconditionally.
+func (p *Producer) send(message minikafka.Message,
+	expectedNext *pb.MsgNumber) (msgNum uint32, partition int, err error) {
+	produceRequest, err := p.makeProduceRequest(message)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(message.Key) > 0 && p.partitioner != nil {
+		partition, err = p.choosePartition([][]byte{message.Key})
+		if err != nil {
+			return 0, 0, err
+		}
+		produceRequest.Partition = &pb.Partition{
+			Partition: uint32(partition)}
+	}
+	produceRequest.ExpectedNext = expectedNext
+	produceResponse, err := p.produceWithRetries(produceRequest)
+	if err != nil {
+		return 0, 0, err
+	}
+	return produceResponse.GetMsgNumber(),
+		int(produceResponse.GetPartition()), nil
+}
+
+// SendBatch sends the given messages to the server in a single request, which
+// is much quicker than sending them one at a time. The server stores them all
+// in the same partition, all or nothing, and the message numbers it assigns
+// run from *firstMsgNum* to *lastMsgNum*. When the messages have keys, they
+// must all belong in the same partition.
+func (p *Producer) SendBatch(messages []minikafka.Message) (
+	firstMsgNum uint32, lastMsgNum uint32, partition int, err error) {
+	return p.sendBatch(messages, nil)
+}
+
+// SendBatchIfNext is like SendBatch, but the messages are stored only if the
+// first of them would get the message number *expectedNext*, in the way
+// described for SendIfNext.
+func (p *Producer) SendBatchIfNext(messages []minikafka.Message,
+	expectedNext uint32) (
+	firstMsgNum uint32, lastMsgNum uint32, partition int, err error) {
+	return p.sendBatch(messages, &pb.MsgNumber{MsgNumber: expectedNext})
+}
+
+// sendBatch is the common implementation of SendBatch and SendBatchIfNext.
+// A nil *expectedNext* means the messages are stored unconditionally.
+func (p *Producer) sendBatch(messages []minikafka.Message,
+	expectedNext *pb.MsgNumber) (
+	firstMsgNum uint32, lastMsgNum uint32, partition int, err error) {
+	keys := [][]byte{}
+	for _, message := range messages {
+		if len(message.Key) > 0 {
+			keys = append(keys, message.Key)
+		}
+	}
+	var requested *pb.Partition
+	if len(keys) > 0 && p.partitioner != nil {
+		partition, err = p.choosePartition(keys)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		requested = &pb.Partition{Partition: uint32(partition)}
+	}
+	request, err := p.makeProduceBatchRequest(messages, requested)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	request.ExpectedNext = expectedNext
+	return p.produceBatch(request)
+}
+
+// SendToPartition sends the given message payload to the server, to be stored
+// in the given partition of the topic.
+func (p *Producer) SendToPartition(partition int,
+	messagePayload MessagePayload) (msgNum uint32, err error) {
+	produceRequest, err := p.makeProduceRequest(
+		minikafka.Message{Payload: messagePayload})
+	if err != nil {
+		return 0, err
+	}
+	produceRequest.Partition = &pb.Partition{Partition: uint32(partition)}
+	produceResponse, err := p.produceWithRetries(produceRequest)
+	if err != nil {
+		return 0, err
+	}
+	return produceResponse.GetMsgNumber(), nil
+}
+
+// makeProduceRequest packages up a message, to suit a Produce request.
+func (p *Producer) makeProduceRequest(
+	message minikafka.Message) (*pb.ProduceRequest, error) {
+	topic := &pb.Topic{Topic: p.topic}
+	payload := &pb.Payload{Payload: message.Payload, Headers: message.Headers}
+	if message.Timestamp.IsZero() == false {
+		timestamp, err := ptypes.TimestampProto(message.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("ptypes.TimestampProto: %v", err)
+		}
+		payload.Timestamp = timestamp
+	}
+	return &pb.ProduceRequest{
+		Topic: topic, Payload: payload, Key: message.Key}, nil
+}
+
+// produceBatch sends the given ProduceBatch request to the server, retrying
+// it when necessary, and waits for the outcome.
+func (p *Producer) produceBatch(request *pb.ProduceBatchRequest) (
+	firstMsgNum uint32, lastMsgNum uint32, partition int, err error) {
+	outcome := make(chan batchOutcome, 1)
+	p.startProduceBatch(request,
+		func(r *pb.ProduceBatchResponse, e error) {
+			outcome <- batchOutcome{r, e}
+		})
+	var response *pb.ProduceBatchResponse
+	timeout := p.retryingTimeout()
+	select {
+	case o := <-outcome:
+		response, err = o.response, o.err
+	case <-time.After(timeout):
+		return 0, 0, 0, fmt.Errorf("No response from server within %v",
+			timeout)
+	}
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return response.GetFirstMsgNumber(), response.GetLastMsgNumber(),
+		int(response.GetPartition()), nil
+}
+
+// makeProduceBatchRequest makes a ProduceBatch request to send the given
+// messages to the requested partition. It identifies the request with the
+// producer's next sequence number, so each must be sent only once, other
+// than by retrying it.
+func (p *Producer) makeProduceBatchRequest(messages []minikafka.Message,
+	requested *pb.Partition) (*pb.ProduceBatchRequest, error) {
+	request := &pb.ProduceBatchRequest{
+		Topic:     &pb.Topic{Topic: p.topic},
+		Partition: requested,
+		Producer:  p.nextSequence()}
+	for _, message := range messages {
+		produceRequest, err := p.makeProduceRequest(message)
+		if err != nil {
+			return nil, err
+		}
+		payload := produceRequest.GetPayload()
+		payload.Key = message.Key
+		request.Payloads = append(request.Payloads, payload)
+	}
+	return request, nil
+}
+
+// batchOutcome is the outcome of sending a ProduceBatch request.
+type batchOutcome struct {
+	response *pb.ProduceBatchResponse
+	err      error
+}
+
+// startProduceBatch sends the given request to the server, and arranges for
+// *done* to be called with the outcome. It uses the producer's ProduceStream,
+// opening one when necessary, and returns as soon as the request is sent.
+// Until the server has acknowledged a batch on a stream though, it waits
+// for the outcome; because servers that do not support ProduceStream only
+// say so then. It falls back to sending a ProduceBatch request on its own
+// for such servers, and when the stream cannot be opened. Either way, the
+// request is retried. (See replace).
+func (p *Producer) startProduceBatch(request *pb.ProduceBatchRequest,
+	done func(*pb.ProduceBatchResponse, error)) {
+	stream, confirmed := p.produceStream()
+	if stream == nil {
+		done(p.produceBatchUnaryWithRetries(request, 0))
+		return
+	}
+
+	if confirmed {
+		err := stream.send(&streamBatch{request: request,
+			done: func(r *pb.ProduceBatchResponse, e error) {
+				done(r, wrapProduceError("client.ProduceStream", e))
+			}})
+		// Having failed, the stream is replaced the next time round.
+		if err != nil {
+			p.startProduceBatch(request, done)
+		}
+		return
+	}
+
+	outcome := make(chan batchOutcome, 1)
+	err := stream.send(&streamBatch{request: request,
+		done: func(r *pb.ProduceBatchResponse, e error) {
+			outcome <- batchOutcome{r, e}
+		}})
+	if err != nil {
+		p.startProduceBatch(request, done)
+		return
+	}
+	o := <-outcome
+	p.streamMutex.Lock()
+	if status.Code(o.err) == codes.Unimplemented {
+		p.noStream = true
+		p.stream = nil
+		p.streamMutex.Unlock()
+		done(p.produceBatchUnaryWithRetries(request, 0))
+		return
+	}
+	if o.err == nil {
+		p.streamConfirmed = true
+	}
+	p.streamMutex.Unlock()
+	done(o.response, wrapProduceError("client.ProduceStream", o.err))
+}
+
+// produceStream provides the ProduceStream the producer should send batches
+// over, and whether the server has acknowledged a batch on one yet. It opens
+// a new stream if the producer has none, and replaces the one it has if that
+// has failed. While a replacement is under way, it waits for it to finish,
+// so that nothing is sent ahead of the batches being sent again. It provides
+// nil when the server does not support ProduceStream, or a stream cannot be
+// opened.
+func (p *Producer) produceStream() (*produceStream, bool) {
+	p.streamMutex.Lock()
+	for {
+		if p.replacing != nil {
+			replacing := p.replacing
+			p.streamMutex.Unlock()
+			<-replacing
+			p.streamMutex.Lock()
+			continue
+		}
+		if p.stream != nil && p.stream.failed() {
+			failed := p.stream
+			p.streamMutex.Unlock()
+			p.replaceStream(failed)
+			p.streamMutex.Lock()
+			continue
+		}
+		break
+	}
+	defer p.streamMutex.Unlock()
+	if p.noStream {
+		return nil, false
+	}
+	if p.stream == nil {
+		stream, err := openProduceStream(
+			p.clientProxy, p.timeout, p.replaceStream)
+		if err != nil {
+			return nil, false
+		}
+		p.stream = stream
+	}
+	return p.stream, p.streamConfirmed
+}
+
+// replaceStream replaces the given stream, which has failed, unless that has
+// been done already. It is called by the stream itself once it has failed,
+// and by produceStream when it finds it has. (See replace).
+func (p *Producer) replaceStream(failed *produceStream) {
+	p.streamMutex.Lock()
+	if failed != p.stream {
+		// It has been replaced already, or the producer closed.
+		p.streamMutex.Unlock()
+		deliverFailures(failed.takeFailed())
+		return
+	}
+	if p.replacing != nil {
+		// It is the new stream of a replacement under way, which deals
+		// with its failure.
+		p.streamMutex.Unlock()
+		return
+	}
+	p.stream = nil
+	p.replacing = make(chan struct{})
+	p.streamMutex.Unlock()
+	deliverFailures(p.replace(failed.takeFailed()))
+}
+
+// replace sends the given batches, which were in flight on a stream that
+// has failed, again on a new stream, in their original order, after waiting
+// as for any retry. It provides those that have used up their retries, or
+// failed in a way that would recur, for the caller to deliver the error to.
+// The caller must have set *replacing*, so that nothing else is sent until
+// it returns, and retried batches keep their place. It does not hold the
+// streamMutex while it waits, nor while it sends.
+func (p *Producer) replace(batches []*streamBatch) (
+	undelivered []*streamBatch) {
+	for {
+		resend := []*streamBatch{}
+		for _, batch := range batches {
+			if isTransient(batch.err) && batch.retries < p.maxRetries {
+				resend = append(resend, batch)
+				continue
+			}
+			undelivered = append(undelivered, batch)
+		}
+		if len(resend) == 0 {
+			p.streamMutex.Lock()
+			p.finishReplacing()
+			p.streamMutex.Unlock()
+			return undelivered
+		}
+		time.Sleep(retryDelay(resend[0].retries))
+		for _, batch := range resend {
+			batch.retries++
+		}
+		stream, err := openProduceStream(
+			p.clientProxy, p.timeout, p.replaceStream)
+		if err != nil {
+			for _, batch := range resend {
+				batch.err = err
+			}
+			batches = resend
+			continue
+		}
+		p.streamMutex.Lock()
+		p.stream = stream
+		p.streamMutex.Unlock()
+		unsent := []*streamBatch{}
+		for i, batch := range resend {
+			if err := stream.send(batch); err != nil {
+				// It has failed already.
+				for _, batch := range resend[i:] {
+					batch.err = err
+				}
+				unsent = resend[i:]
+				break
+			}
+		}
+		// Checking whether the new stream has failed, and finishing if not,
+		// happen together; so that a failure from now on is dealt with by
+		// replaceStream.
+		p.streamMutex.Lock()
+		if p.stream == stream && stream.failed() {
+			p.stream = nil
+			p.streamMutex.Unlock()
+			batches = append(stream.takeFailed(), unsent...)
+			continue
+		}
+		p.finishReplacing()
+		p.streamMutex.Unlock()
+		// Any unsent are because the producer closed the stream.
+		return append(undelivered, unsent...)
+	}
+}
+
+// finishReplacing lets those waiting for a replacement to finish, carry on.
+// It expects the streamMutex to be held.
+func (p *Producer) finishReplacing() {
+	close(p.replacing)
+	p.replacing = nil
+}
+
+// deliverFailures delivers to each of the given batches the error it failed
+// with.
+func deliverFailures(batches []*streamBatch) {
+	for _, batch := range batches {
+		batch.done(nil, batch.err)
+	}
+}
+
+// produceBatchUnary sends the given ProduceBatch request to the server on
+// its own, rather than over a ProduceStream.
+func (p *Producer) produceBatchUnary(request *pb.ProduceBatchRequest) (
+	*pb.ProduceBatchResponse, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
 	defer cancel()
-	topic := &pb.Topic{Topic: p.topic}
-	payload := &pb.Payload{Payload: messagePayload}
-	produceRequest := &pb.ProduceRequest{Topic: topic, Payload: payload}
-	msgNumber, err := p.clientProxy.Produce(ctx, produceRequest)
+	resp, err := p.clientProxy.ProduceBatch(ctx, request)
+	if err != nil {
+		return nil, wrapProduceError("client.ProduceBatch", err)
+	}
+	return resp, nil
+}
+
+// produceBatchUnaryWithRetries is like produceBatchUnary, but sends the
+// request again, up to the producer's maximum number of retries, when it
+// fails in a way that might not recur. *retries* is how many retries have
+// been made already.
+func (p *Producer) produceBatchUnaryWithRetries(
+	request *pb.ProduceBatchRequest, retries int) (
+	response *pb.ProduceBatchResponse, err error) {
+	for ; ; retries++ {
+		response, err = p.produceBatchUnary(request)
+		if err == nil || isTransient(err) == false || retries >= p.maxRetries {
+			return response, err
+		}
+		time.Sleep(retryDelay(retries))
+	}
+}
+
+// produceWithRetries identifies the given Produce request with the
+// producer's next sequence number, and sends it to the server; sending it
+// again, up to the producer's maximum number of retries, when it fails in a
+// way that might not recur.
+func (p *Producer) produceWithRetries(produceRequest *pb.ProduceRequest) (
+	produceResponse *pb.ProduceResponse, err error) {
+	produceRequest.Producer = p.nextSequence()
+	for retry := 0; ; retry++ {
+		produceResponse, err = p.produce(produceRequest)
+		if err == nil || isTransient(err) == false || retry == p.maxRetries {
+			return produceResponse, err
+		}
+		time.Sleep(retryDelay(retry))
+	}
+}
+
+// produce sends the given Produce request to the server.
+func (p *Producer) produce(produceRequest *pb.ProduceRequest) (
+	*pb.ProduceResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	produceResponse, err := p.clientProxy.Produce(ctx, produceRequest)
+	if err != nil {
+		return nil, wrapProduceError("client.Produce", err)
+	}
+	return produceResponse, nil
+}
+
+// choosePartition uses the producer's Partitioner to choose the partition
+// for messages with the given keys. It is an error for them to belong in
+// different partitions.
+func (p *Producer) choosePartition(keys [][]byte) (int, error) {
+	numPartitions, err := p.partitionCount()
+	if err != nil {
+		return 0, err
+	}
+	partition := p.partitioner.Partition(keys[0], numPartitions)
+	for _, key := range keys[1:] {
+		if p.partitioner.Partition(key, numPartitions) != partition {
+			return 0, fmt.Errorf("The keys belong in different partitions")
+		}
+	}
+	return partition, nil
+}
+
+// partitionCount provides how many partitions the producer's topic has;
+// asking the server the first time, and remembering the answer.
+func (p *Producer) partitionCount() (int, error) {
+	p.partitionsMutex.Lock()
+	defer p.partitionsMutex.Unlock()
+	if p.numPartitions == 0 {
+		numPartitions, err := p.fetchNumPartitionsOf(p.topic)
+		if err != nil {
+			return 0, err
+		}
+		p.numPartitions = numPartitions
+	}
+	return p.numPartitions, nil
+}
+
+// fetchNumPartitionsOf asks the server how many partitions the given topic
+// has.
+func (p *Producer) fetchNumPartitionsOf(topic string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	partitionCount, err := p.clientProxy.NumPartitions(
+		ctx, &pb.Topic{Topic: topic})
 	if err != nil {
-		return 1, fmt.Errorf("client.Produce: %v", err)
+		return 0, fmt.Errorf("client.NumPartitions: %v", err)
 	}
-	return msgNumber.GetMsgNumber(), err
+	return int(partitionCount.GetNumPartitions()), nil
 }
@@ -0,0 +1,193 @@
+package client
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	minikafka "github.com/peterhoward42/minikafka"
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/memstore"
+)
+
+// stallingStore is a MemStore that holds up the first *stalls* sequenced
+// requests it gets, each for *stall*, before storing them.
+type stallingStore struct {
+	contract.BackingStore
+	stalls int32
+	stall  time.Duration
+}
+
+func (s *stallingStore) StoreSequenced(topic string, producerID string,
+	sequence uint64, messages []minikafka.Message) (int, int, error) {
+	if atomic.AddInt32(&s.stalls, -1) >= 0 {
+		time.Sleep(s.stall)
+	}
+	return s.BackingStore.StoreSequenced(topic, producerID, sequence, messages)
+}
+
+func TestUnacknowledgedBatchesFailAfterRetries(t *testing.T) {
+	store := &stallingStore{BackingStore: memstore.NewMemStore(),
+		stalls: 100, stall: time.Hour}
+	host, stop := startTestServerWith(t, store)
+	defer stop()
+	producer, err := NewProducer("topicA", 200*time.Millisecond, host)
+	assert.Nil(t, err)
+	producer.SetMaxRetries(1)
+	producer.StartAsync(AsyncConfig{MaxBatchMessages: 1})
+	futures := []*SendFuture{}
+	for i := 0; i < 3; i++ {
+		futures = append(futures, producer.SendAsync(
+			minikafka.Message{Payload: []byte("msg")}, nil))
+	}
+
+	flushed := make(chan struct{})
+	go func() {
+		producer.Flush()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "Flush did not return")
+		return
+	}
+	for _, future := range futures {
+		_, _, err := future.Wait()
+		assert.NotNil(t, err)
+	}
+}
+
+func TestRetriedBatchesKeepTheirOrder(t *testing.T) {
+	// The first batch is held up for long enough that the stream times
+	// out, with more batches behind it.
+	store := &stallingStore{BackingStore: memstore.NewMemStore(),
+		stalls: 1, stall: 500 * time.Millisecond}
+	host, stop := startTestServerWith(t, store)
+	defer stop()
+	producer, err := NewProducer("topicA", 200*time.Millisecond, host)
+	assert.Nil(t, err)
+	producer.StartAsync(AsyncConfig{MaxBatchMessages: 1})
+	const n = 30
+	futures := []*SendFuture{}
+	for i := 0; i < n; i++ {
+		futures = append(futures, producer.SendAsync(minikafka.Message{
+			Payload: []byte(fmt.Sprintf("msg %d", i))}, nil))
+	}
+	producer.Flush()
+	for _, future := range futures {
+		_, _, err := future.Wait()
+		assert.Nil(t, err)
+	}
+
+	received := pollAll(t, host, "topicA")
+	assert.Equal(t, n, len(received))
+	for i, message := range received {
+		assert.Equal(t, fmt.Sprintf("msg %d", i), message)
+	}
+}
+
+func TestRetriedBatchIsStoredOnce(t *testing.T) {
+	// The first attempt is held up until after the retry has been stored.
+	store := &stallingStore{BackingStore: memstore.NewMemStore(),
+		stalls: 1, stall: 500 * time.Millisecond}
+	host, stop := startTestServerWith(t, store)
+	defer stop()
+	producer, err := NewProducer("topicA", 200*time.Millisecond, host)
+	assert.Nil(t, err)
+	first, last, _, err := producer.SendBatch([]minikafka.Message{
+		{Payload: []byte("msg 0")}, {Payload: []byte("msg 1")}})
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), first)
+	assert.Equal(t, uint32(2), last)
+
+	// Let the held up attempt finish.
+	time.Sleep(time.Second)
+	assert.Equal(t, []string{"msg 0", "msg 1"}, pollAll(t, host, "topicA"))
+}
+
+func TestSendIfNextRejectsUnexpectedNext(t *testing.T) {
+	host, stop := startTestServer(t)
+	defer stop()
+	producer, err := NewProducer("topicA", time.Second, host)
+	assert.Nil(t, err)
+	msgNum, _, err := producer.SendIfNext(
+		minikafka.Message{Payload: []byte("msg 0")}, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), msgNum)
+
+	_, _, err = producer.SendIfNext(
+		minikafka.Message{Payload: []byte("stale")}, 1)
+	assert.Equal(t, &UnexpectedNextError{Expected: 1, Next: 2}, err)
+	_, _, _, err = producer.SendBatchIfNext([]minikafka.Message{
+		{Payload: []byte("stale")}, {Payload: []byte("stale")}}, 3)
+	assert.Equal(t, &UnexpectedNextError{Expected: 3, Next: 2}, err)
+
+	first, last, _, err := producer.SendBatchIfNext([]minikafka.Message{
+		{Payload: []byte("msg 1")}, {Payload: []byte("msg 2")}}, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), first)
+	assert.Equal(t, uint32(3), last)
+	assert.Equal(t, []string{"msg 0", "msg 1", "msg 2"},
+		pollAll(t, host, "topicA"))
+}
+
+func TestUnkeyedMessagesStayInOnePartition(t *testing.T) {
+	host, stop := startTestServer(t)
+	defer stop()
+	admin, err := NewAdmin(time.Second, host)
+	assert.Nil(t, err)
+	assert.Nil(t, admin.CreatePartitionedTopic("topicA", 4))
+	producer, err := NewProducer("topicA", time.Second, host)
+	assert.Nil(t, err)
+
+	_, first, err := producer.Send(minikafka.Message{Payload: []byte("msg")})
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		_, partition, err := producer.Send(
+			minikafka.Message{Payload: []byte("msg")})
+		assert.Nil(t, err)
+		assert.Equal(t, first, partition)
+		_, _, partition, err = producer.SendBatch([]minikafka.Message{
+			{Payload: []byte("msg")}})
+		assert.Nil(t, err)
+		assert.Equal(t, first, partition)
+	}
+}
+
+func TestCallbackCanSendWhenStreamFails(t *testing.T) {
+	store := &stallingStore{BackingStore: memstore.NewMemStore(),
+		stall: 500 * time.Millisecond}
+	host, stop := startTestServerWith(t, store)
+	defer stop()
+	producer, err := NewProducer("topicA", 200*time.Millisecond, host)
+	assert.Nil(t, err)
+	producer.SetMaxRetries(0)
+	producer.StartAsync(AsyncConfig{MaxBatchMessages: 1})
+	defer producer.Close()
+	// Once the server has acknowledged a batch on the stream, the next is
+	// held up for long enough that the stream times out; and without
+	// retries, its callback is given the error.
+	_, _, err = producer.SendAsync(
+		minikafka.Message{Payload: []byte("msg 0")}, nil).Wait()
+	assert.Nil(t, err)
+	atomic.StoreInt32(&store.stalls, 1)
+
+	sent := make(chan error, 1)
+	producer.SendAsync(minikafka.Message{Payload: []byte("msg 1")},
+		func(msgNum uint32, partition int, err error) {
+			assert.NotNil(t, err)
+			_, _, _, err = producer.SendBatch([]minikafka.Message{
+				{Payload: []byte("msg 2")}})
+			sent <- err
+		})
+	select {
+	case err := <-sent:
+		assert.Nil(t, err)
+	case <-time.After(3 * time.Second):
+		assert.Fail(t, "SendBatch from callback did not return")
+	}
+}
@@ -0,0 +1,232 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	pb "github.com/peterhoward42/minikafka/protocol"
+)
+
+// maxBatchesInFlight is how many batches a producer sends over its
+// ProduceStream without waiting for them to be acknowledged. Once it is
+// reached, sending waits for the oldest acknowledgement. This is on top of
+// gRPC's own flow control, and bounds how much is lost when a stream fails.
+const maxBatchesInFlight = 8
+
+// produceStream is a ProduceStream call that a producer holds open, to send
+// batches without waiting for each to be acknowledged before sending the
+// next. The server acknowledges them in the order they were sent, and the
+// outcome of each is delivered, in that order, from the stream's own
+// goroutine. Each batch must be acknowledged within the producer's timeout;
+// the stream fails when one is not.
+//
+// When the stream fails, the batches in flight on it are not delivered the
+// error straight away, but kept for the producer to send again, in order, on
+// the stream that replaces it. (See Producer.replace).
+type produceStream struct {
+	stream  pb.MiniKafka_ProduceStreamClient // gRPC component.
+	cancel  context.CancelFunc
+	timeout time.Duration
+
+	// Called, from the stream's own goroutine, once it has failed.
+	onFailure func(*produceStream)
+
+	// Holds a token for each batch in flight. (See maxBatchesInFlight).
+	window chan struct{}
+
+	// Serialises sending, so that the order of *pending* matches the order
+	// of the requests in the stream.
+	sendMutex sync.Mutex
+
+	// Guards the fields below.
+	mutex sync.Mutex
+	// The batches in flight, oldest first.
+	pending []*streamBatch
+	// Fires when the oldest batch in flight is due to be acknowledged.
+	timer  *time.Timer
+	err    error // Why the stream failed, once it has.
+	closed bool  // Whether it was ended by close().
+	// The batches that were in flight when it failed, until they are taken.
+	failedBatches []*streamBatch
+}
+
+// streamBatch is a batch sent, or to be sent, over a ProduceStream.
+type streamBatch struct {
+	request *pb.ProduceBatchRequest
+	// Where to deliver the outcome. The errors it is given are those from
+	// gRPC unwrapped, so that their status codes can be inspected.
+	done     func(*pb.ProduceBatchResponse, error)
+	retries  int       // How many times it has been sent again.
+	deadline time.Time // When it is due to be acknowledged.
+	err      error     // Why it last failed.
+}
+
+// openProduceStream starts a ProduceStream call, and the goroutine that
+// receives its acknowledgements. *onFailure* is called once the stream has
+// failed. The error it returns is that from gRPC unwrapped.
+func openProduceStream(clientProxy pb.MiniKafkaClient, timeout time.Duration,
+	onFailure func(*produceStream)) (*produceStream, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := clientProxy.ProduceStream(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	s := &produceStream{
+		stream:    stream,
+		cancel:    cancel,
+		timeout:   timeout,
+		onFailure: onFailure,
+		window:    make(chan struct{}, maxBatchesInFlight),
+	}
+	s.timer = time.AfterFunc(timeout, s.expire)
+	s.timer.Stop()
+	go s.receive()
+	return s, nil
+}
+
+// send sends the batch, and arranges for its *done* to be called with the
+// outcome once the server acknowledges it. It waits only when too many
+// batches are already in flight. It returns an error, without sending, when
+// the stream has already failed.
+func (s *produceStream) send(batch *streamBatch) error {
+	s.window <- struct{}{}
+	s.sendMutex.Lock()
+	defer s.sendMutex.Unlock()
+	s.mutex.Lock()
+	if s.err != nil {
+		s.mutex.Unlock()
+		<-s.window
+		return s.err
+	}
+	batch.deadline = time.Now().Add(s.timeout)
+	s.pending = append(s.pending, batch)
+	if len(s.pending) == 1 {
+		s.timer.Reset(s.timeout)
+	}
+	s.mutex.Unlock()
+	// A failure to send also makes the stream fail on the receiving side,
+	// and it is there that the error is dealt with.
+	s.stream.Send(batch.request)
+	return nil
+}
+
+// failed reports whether the stream has failed.
+func (s *produceStream) failed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.err != nil
+}
+
+// takeFailed provides the batches that were in flight when the stream
+// failed, oldest first, each with the error it failed with. It provides them
+// only once.
+func (s *produceStream) takeFailed() []*streamBatch {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	failed := s.failedBatches
+	s.failedBatches = nil
+	return failed
+}
+
+// close ends the stream. Batches still in flight fail, and are not sent
+// again.
+func (s *produceStream) close() {
+	s.mutex.Lock()
+	s.closed = true
+	s.mutex.Unlock()
+	s.stream.CloseSend()
+	s.cancel()
+}
+
+// receive is the goroutine that delivers the server's acknowledgements. It
+// runs until the stream fails.
+func (s *produceStream) receive() {
+	for {
+		response, err := s.stream.Recv()
+		s.mutex.Lock()
+		if err == nil && len(s.pending) == 0 {
+			err = fmt.Errorf("Unexpected acknowledgement from server")
+		}
+		if err != nil {
+			s.mutex.Unlock()
+			if err == io.EOF {
+				err = transientError{fmt.Errorf("Server ended the stream")}
+			}
+			s.fail(err)
+			return
+		}
+		batch := s.pending[0]
+		s.pending = s.pending[1:]
+		if len(s.pending) == 0 {
+			s.timer.Stop()
+		} else {
+			s.timer.Reset(time.Until(s.pending[0].deadline))
+		}
+		s.mutex.Unlock()
+		<-s.window
+		batch.done(response, nil)
+	}
+}
+
+// expire is called by the timer, and fails the stream if the oldest batch in
+// flight is overdue.
+func (s *produceStream) expire() {
+	s.mutex.Lock()
+	if s.err != nil || len(s.pending) == 0 {
+		s.mutex.Unlock()
+		return
+	}
+	if wait := time.Until(s.pending[0].deadline); wait > 0 {
+		s.timer.Reset(wait)
+		s.mutex.Unlock()
+		return
+	}
+	s.mutex.Unlock()
+	s.fail(transientError{fmt.Errorf(
+		"No acknowledgement from server within %v", s.timeout)})
+}
+
+// fail records that the stream has failed with the given error, and ends
+// it. Unless it was closed, the batches in flight are kept to be sent again.
+// Otherwise they are delivered the error. It does nothing if the stream has
+// failed already.
+func (s *produceStream) fail(err error) {
+	s.mutex.Lock()
+	if s.err != nil {
+		s.mutex.Unlock()
+		return
+	}
+	s.err = err
+	s.timer.Stop()
+	failed := s.pending
+	s.pending = nil
+	// The server stops at the first batch that fails, so those behind it
+	// were not stored, and can be sent again.
+	for i, batch := range failed {
+		batch.err = err
+		if i > 0 && isTransient(err) == false {
+			batch.err = transientError{fmt.Errorf(
+				"An earlier batch in the stream failed: %v", err)}
+		}
+	}
+	closed := s.closed
+	if closed == false {
+		s.failedBatches = failed
+	}
+	s.mutex.Unlock()
+	for range failed {
+		<-s.window
+	}
+	s.cancel()
+	if closed {
+		for _, batch := range failed {
+			batch.done(nil, batch.err)
+		}
+		return
+	}
+	s.onFailure(s)
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/ptypes"
+
+	minikafka "github.com/peterhoward42/minikafka"
+	pb "github.com/peterhoward42/minikafka/protocol"
+)
+
+// makeRecord reconstructs a stored message from the form in which the server
+// returns it. The message number and creation time it carries let consumers
+// know precisely where each message sits in the topic, even when there are
+// gaps in the numbering, and how long ago it was stored.
+func makeRecord(payload *pb.Payload) (minikafka.StoredMessage, error) {
+	record := minikafka.StoredMessage{
+		Message: minikafka.Message{
+			Payload: payload.GetPayload(),
+			Key:     payload.GetKey(),
+			Headers: payload.GetHeaders()},
+		Number: int(payload.GetMsgNumber().GetMsgNumber())}
+	var err error
+	if payload.GetTimestamp() != nil {
+		record.Timestamp, err = ptypes.Timestamp(payload.GetTimestamp())
+		if err != nil {
+			return record, fmt.Errorf("ptypes.Timestamp: %v", err)
+		}
+	}
+	if payload.GetCreated() != nil {
+		record.Created, err = ptypes.Timestamp(payload.GetCreated())
+		if err != nil {
+			return record, fmt.Errorf("ptypes.Timestamp: %v", err)
+		}
+	}
+	return record, nil
+}
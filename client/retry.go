@@ -0,0 +1,102 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/peterhoward42/minikafka/protocol"
+)
+
+// defaultMaxRetries is how many times a producer sends a request again, by
+// default, when it fails in a way that might not recur. (See SetMaxRetries).
+const defaultMaxRetries = 3
+
+// firstRetryDelay is how long a producer waits before its first retry of a
+// request. It doubles for each retry after that.
+const firstRetryDelay = 100 * time.Millisecond
+
+// SetMaxRetries sets how many times the producer sends a request again when
+// it fails in a way that might not recur; such as the server being
+// unavailable, or not responding in time. Retrying is safe, because the
+// producer identifies each request it makes, and the server recognises those
+// it has already stored; so that the messages are stored once, and the
+// retry gets their original message numbers. Zero switches retrying off.
+func (p *Producer) SetMaxRetries(maxRetries int) {
+	p.maxRetries = maxRetries
+}
+
+// transientError is an error that might not recur, were the request that met
+// it sent again.
+type transientError struct {
+	error
+}
+
+// isTransient reports whether the given error might not recur, were the
+// request that met it sent again. It expects errors from gRPC unwrapped, or
+// wrapped by wrapProduceError.
+func isTransient(err error) bool {
+	if _, ok := err.(transientError); ok {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted,
+		codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// wrapProduceError wraps an error from gRPC in the usual way, but preserves
+// whether it is transient. It does not wrap the server reporting that the
+// next message number was not the one expected, but converts it to an
+// *UnexpectedNextError, so that callers can recognise it.
+func wrapProduceError(callee string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if unexpected, ok := unexpectedNext(err); ok {
+		return unexpected
+	}
+	wrapped := fmt.Errorf("%s: %v", callee, err)
+	if isTransient(err) {
+		return transientError{wrapped}
+	}
+	return wrapped
+}
+
+// retryDelay is how long to wait before the given retry, counting from zero.
+func retryDelay(retry int) time.Duration {
+	return firstRetryDelay << uint(retry)
+}
+
+// retryingTimeout is how long it can take to send a request, including all
+// its retries.
+func (p *Producer) retryingTimeout() time.Duration {
+	timeout := p.timeout
+	for retry := 0; retry < p.maxRetries; retry++ {
+		timeout += retryDelay(retry) + p.timeout
+	}
+	return timeout
+}
+
+// newProducerID makes a random ID, with which a producer identifies itself
+// to the server.
+func newProducerID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// nextSequence identifies the next request the producer makes, so that the
+// server can recognise it if it is retried.
+func (p *Producer) nextSequence() *pb.Producer {
+	return &pb.Producer{
+		ProducerId: p.producerID,
+		Sequence:   atomic.AddUint64(&p.sequence, 1)}
+}
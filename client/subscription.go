@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	minikafka "github.com/peterhoward42/minikafka"
+	pb "github.com/peterhoward42/minikafka/protocol"
+)
+
+// Subscription is a live stream of messages, being pushed by the server to a
+// Consumer as they arrive. Obtain one from Consumer.Subscribe().
+type Subscription struct {
+	consumer *Consumer
+	stream   pb.MiniKafka_SubscribeClient // gRPC component.
+	cancel   context.CancelFunc
+}
+
+// Subscribe asks the server to start streaming messages to this consumer,
+// starting from the consumer's current read-from position. You then harvest
+// the messages by calling Next() on the Subscription returned. Unlike Poll,
+// the consumer's timeout is not applied - the subscription lasts until you
+// Close() it.
+func (c *Consumer) Subscribe() (*Subscription, error) {
+	s := &Subscription{consumer: c}
+	err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open asks the server to start streaming messages from the consumer's
+// current read-from position.
+func (s *Subscription) open() error {
+	c := s.consumer
+	ctx, cancel := context.WithCancel(context.Background())
+	readFrom := &pb.MsgNumber{MsgNumber: uint32(c.readFrom)}
+	subscribeRequest := &pb.SubscribeRequest{
+		Topic: c.topic, ReadFrom: readFrom, Partition: uint32(c.partition)}
+	stream, err := c.clientProxy.Subscribe(ctx, subscribeRequest)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("client.Subscribe: %v", err)
+	}
+	s.stream = stream
+	s.cancel = cancel
+	return nil
+}
+
+// Next blocks until the server pushes the next message, and then returns it,
+// along with its message number. It also advances the consumer's *readFrom*
+// position to just beyond this message. This means that should the
+// subscription fail, a fresh Subscribe() or Poll() on the same consumer will
+// carry on from where it left off. When the server reports that the read-from
+// position is out of range, Next applies the consumer's ResetPolicy. When the
+// topic does not exist, Next returns a *NoSuchTopicError, and the
+// subscription is over; Subscribe again later to see if it has been created.
+func (s *Subscription) Next() (
+	message MessagePayload, msgNumber int, err error) {
+	record, err := s.NextRecord()
+	if err != nil {
+		return nil, 0, err
+	}
+	return record.Payload, record.Number, nil
+}
+
+// NextRecord is like Next, but returns the message in full - with its key,
+// headers and timestamp, along with its message number and the time at which
+// the server stored it.
+func (s *Subscription) NextRecord() (
+	record minikafka.StoredMessage, err error) {
+
+	// Asking for the next message means the caller has finished with the
+	// previous ones; so they can be committed. (Periodically).
+	c := s.consumer
+	if c.autoCommit && time.Since(c.lastCommit) >= autoCommitInterval {
+		err := c.commitIfAdvanced()
+		if err != nil {
+			return record, err
+		}
+	}
+
+	msg, err := s.stream.Recv()
+	// The server ends the stream when the read-from position is out of
+	// range, so having applied the reset policy, start a new one.
+	if earliest, next, ok := outOfRange(err); ok {
+		s.cancel()
+		err = c.reset(earliest, next)
+		if err != nil {
+			return record, err
+		}
+		err = s.open()
+		if err != nil {
+			return record, err
+		}
+		return s.NextRecord()
+	}
+	if noSuchTopic, ok := c.noSuchTopic(err); ok {
+		s.cancel()
+		return record, noSuchTopic
+	}
+	if err != nil {
+		return record, fmt.Errorf("stream.Recv: %v", err)
+	}
+	record, err = makeRecord(msg.GetPayload())
+	if err != nil {
+		return record, fmt.Errorf("makeRecord: %v", err)
+	}
+	s.consumer.readFrom = record.Number + 1
+	return record, nil
+}
+
+// Close ends the subscription. When the consumer is an auto-committing group
+// consumer, it also commits the consumer's read-from position.
+func (s *Subscription) Close() error {
+	s.cancel()
+	if s.consumer.autoCommit {
+		return s.consumer.commitIfAdvanced()
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+package client
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	minikafka "github.com/peterhoward42/minikafka"
+	pb "github.com/peterhoward42/minikafka/protocol"
+)
+
+// tableMaxWait is how long each long-poll waits for messages to arrive, while
+// a Table follows its topic in the background. It bounds how long Close takes.
+const tableMaxWait = time.Second
+
+// Table is an in-memory view of a topic as a set of keys and values, that
+// holds the payload of the newest message with each key. A message with a
+// key and an empty payload (a tombstone) deletes its key. Messages without a
+// key are ignored. It consumes every partition of the topic, and suits
+// topics whose retention policy asks for compaction. Obtain one from
+// NewTable, bring it up to date with Update, or Start it following the topic
+// in the background, and Close it once finished with. It is safe to read
+// from several goroutines.
+type Table struct {
+	topic     string
+	conn      *grpc.ClientConn // Shared by the consumers.
+	consumers []*Consumer      // One for each partition.
+	onChange  func(TableChange)
+
+	// Guards the fields below.
+	mutex  sync.RWMutex
+	values map[string][]byte
+	// The read-from position reached in each partition. These are kept
+	// separately from the consumers' own, so that snapshots can capture
+	// them consistently with *values*.
+	readFrom []int
+
+	// Serialises the calls to *onChange*.
+	changeMutex sync.Mutex
+
+	// For following the topic in the background.
+	stop     chan struct{}
+	finished sync.WaitGroup
+	errMutex sync.Mutex
+	err      error // The first error encountered.
+}
+
+// TableChange describes a change made to a Table, by a message consumed from
+// its topic.
+type TableChange struct {
+	Key       []byte
+	Value     []byte // Nil when the key has been deleted.
+	Deleted   bool
+	Partition int
+	MsgNumber int
+}
+
+// tableSnapshot is what Table.Snapshot saves to a file, gob-encoded.
+type tableSnapshot struct {
+	Topic    string
+	ReadFrom []int
+	Values   map[string][]byte
+}
+
+// NewTable provides a new, empty Table for the given topic, which must
+// exist. It does not consume anything until Update or Start is called.
+// *host* should be of the form "myhost.com:1234".
+func NewTable(topic string, timeout time.Duration, host string) (
+	*Table, error) {
+	opts := []grpc.DialOption{grpc.WithInsecure()}
+	conn, err := grpc.Dial(host, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("grpc.Dial: %v", err)
+	}
+	offsets, err := listOffsets(pb.NewMiniKafkaClient(conn), timeout, topic)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	t := &Table{topic: topic, conn: conn, values: map[string][]byte{}}
+	for partition := range offsets {
+		t.consumers = append(t.consumers,
+			newPartitionConsumer(topic, partition, 1, timeout, conn))
+		t.readFrom = append(t.readFrom, 1)
+	}
+	return t, nil
+}
+
+// OnChange registers a function to be called with each change made to the
+// table, in the order they are made. Deleting a key that is not present is
+// not a change. The function is not called concurrently with itself, but is
+// called from the goroutines that follow the topic once the table is
+// started. Call OnChange before Update or Start.
+func (t *Table) OnChange(onChange func(change TableChange)) {
+	t.onChange = onChange
+}
+
+// Get provides the value held for the given key, and whether there is one.
+func (t *Table) Get(key []byte) (value []byte, ok bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	value, ok = t.values[string(key)]
+	return value, ok
+}
+
+// Len provides how many keys the table holds.
+func (t *Table) Len() int {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return len(t.values)
+}
+
+// Range calls *f* with each key and value the table holds, in key order,
+// until *f* returns false. It works from a copy of the table taken at the
+// outset, so *f* may call the table's other methods.
+func (t *Table) Range(f func(key []byte, value []byte) bool) {
+	t.mutex.RLock()
+	keys := make([]string, 0, len(t.values))
+	values := make(map[string][]byte, len(t.values))
+	for key, value := range t.values {
+		keys = append(keys, key)
+		values[key] = value
+	}
+	t.mutex.RUnlock()
+	sort.Strings(keys)
+	for _, key := range keys {
+		if f([]byte(key), values[key]) == false {
+			return
+		}
+	}
+}
+
+// Update consumes messages from each of the topic's partitions with a single
+// Poll, and applies them to the table. So it takes a bounded time, but when
+// there is a large backlog, it may not consume everything available. It
+// reports *caughtUp* true when it has, so bringing the table up to date
+// means calling it until then. It must not be called once the table has
+// been started.
+func (t *Table) Update() (caughtUp bool, err error) {
+	caughtUp = true
+	for partition, consumer := range t.consumers {
+		records, newReadFrom, err := consumer.PollRecords()
+		if err != nil {
+			return false, err
+		}
+		t.apply(partition, records, newReadFrom)
+		if consumer.readFrom < consumer.next {
+			caughtUp = false
+		}
+	}
+	return caughtUp, nil
+}
+
+// Start sets the table following its topic in the background, applying
+// messages as they arrive, until Close is called. When consuming fails, the
+// table stops following the partition concerned, and Close reports why.
+func (t *Table) Start() {
+	t.stop = make(chan struct{})
+	for partition, consumer := range t.consumers {
+		consumer.SetLongPoll(tableMaxWait, 1)
+		t.finished.Add(1)
+		go t.follow(partition, consumer)
+	}
+}
+
+// Close stops a started table following its topic, waiting for it to do so,
+// and reports the first error it encountered while following it. It also
+// closes the table's connection to the server, so the table cannot be
+// updated afterwards, but it can still be read.
+func (t *Table) Close() error {
+	if t.stop != nil {
+		close(t.stop)
+		t.finished.Wait()
+		t.stop = nil
+	}
+	if t.conn != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+	t.errMutex.Lock()
+	defer t.errMutex.Unlock()
+	return t.err
+}
+
+// Snapshot saves the table's contents, along with how far it has got through
+// each partition, to the given file. The file is replaced all at once, so
+// that a failure part way through leaves the previous snapshot intact. It can
+// be called while the table is following its topic.
+func (t *Table) Snapshot(filePath string) error {
+	t.mutex.RLock()
+	snapshot := tableSnapshot{Topic: t.topic,
+		ReadFrom: append([]int{}, t.readFrom...), Values: t.values}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(snapshot)
+	t.mutex.RUnlock()
+	if err != nil {
+		return fmt.Errorf("encoder.Encode: %v", err)
+	}
+	tmpFile, err := ioutil.TempFile(path.Dir(filePath), "snapshot")
+	if err != nil {
+		return fmt.Errorf("ioutil.TempFile: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	_, err = tmpFile.Write(buf.Bytes())
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	closeErr := tmpFile.Close()
+	if err != nil {
+		return fmt.Errorf("file.Write: %v", err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("file.Close: %v", closeErr)
+	}
+	err = os.Rename(tmpFile.Name(), filePath)
+	if err != nil {
+		return fmt.Errorf("os.Rename: %v", err)
+	}
+	return nil
+}
+
+// Restore replaces the table's contents with those saved by Snapshot in the
+// given file, so that consuming resumes from where the snapshot was taken,
+// rather than replaying the whole topic. It reports *restored* false, without
+// error, when the file does not exist. It is an error for the snapshot to be
+// of a different topic, or of a different number of partitions. Call Restore
+// before Update or Start. OnChange's function is not called for what it
+// restores.
+func (t *Table) Restore(filePath string) (restored bool, err error) {
+	contents, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ioutil.ReadFile: %v", err)
+	}
+	var snapshot tableSnapshot
+	err = gob.NewDecoder(bytes.NewReader(contents)).Decode(&snapshot)
+	if err != nil {
+		return false, fmt.Errorf("decoder.Decode: %v", err)
+	}
+	if snapshot.Topic != t.topic {
+		return false, fmt.Errorf("The snapshot is of topic %v, not %v",
+			snapshot.Topic, t.topic)
+	}
+	if len(snapshot.ReadFrom) != len(t.consumers) {
+		return false, fmt.Errorf(
+			"The snapshot is of %d partitions, but the topic has %d",
+			len(snapshot.ReadFrom), len(t.consumers))
+	}
+	if snapshot.Values == nil {
+		snapshot.Values = map[string][]byte{}
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.values = snapshot.Values
+	t.readFrom = snapshot.ReadFrom
+	for partition, consumer := range t.consumers {
+		consumer.readFrom = snapshot.ReadFrom[partition]
+	}
+	return true, nil
+}
+
+// follow is the goroutine that follows one of the topic's partitions, for a
+// started table. It relies on each PollRecords being bounded, by the
+// consumer's long-poll wait and maxPagesPerPoll, to notice promptly when it
+// is to stop.
+func (t *Table) follow(partition int, consumer *Consumer) {
+	defer t.finished.Done()
+	for {
+		select {
+		case <-t.stop:
+			return
+		default:
+		}
+		records, newReadFrom, err := consumer.PollRecords()
+		if err != nil {
+			t.errMutex.Lock()
+			if t.err == nil {
+				t.err = fmt.Errorf("Partition %d: %v", partition, err)
+			}
+			t.errMutex.Unlock()
+			return
+		}
+		t.apply(partition, records, newReadFrom)
+	}
+}
+
+// apply applies the given records, consumed from the given partition, to the
+// table, and then notes *newReadFrom* as the position reached in the
+// partition.
+func (t *Table) apply(partition int, records []minikafka.StoredMessage,
+	newReadFrom int) {
+	changes := []TableChange{}
+	t.mutex.Lock()
+	for _, record := range records {
+		if len(record.Key) == 0 {
+			continue
+		}
+		key := string(record.Key)
+		change := TableChange{Key: record.Key, Partition: partition,
+			MsgNumber: record.Number}
+		if len(record.Payload) == 0 {
+			if _, ok := t.values[key]; ok == false {
+				continue
+			}
+			delete(t.values, key)
+			change.Deleted = true
+		} else {
+			t.values[key] = record.Payload
+			change.Value = record.Payload
+		}
+		changes = append(changes, change)
+	}
+	t.readFrom[partition] = newReadFrom
+	// Take the change mutex before releasing the other, so that changes are
+	// delivered in the order they were made.
+	t.changeMutex.Lock()
+	t.mutex.Unlock()
+	defer t.changeMutex.Unlock()
+	if t.onChange == nil {
+		return
+	}
+	for _, change := range changes {
+		t.onChange(change)
+	}
+}
@@ -0,0 +1,223 @@
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	minikafka "github.com/peterhoward42/minikafka"
+)
+
+// sendKeyed sends messages with the given keys and payloads, in turn.
+func sendKeyed(t *testing.T, producer *Producer, keysAndPayloads ...string) {
+	for i := 0; i < len(keysAndPayloads); i += 2 {
+		_, _, err := producer.Send(minikafka.Message{
+			Key:     []byte(keysAndPayloads[i]),
+			Payload: []byte(keysAndPayloads[i+1])})
+		assert.Nil(t, err)
+	}
+}
+
+// startTableTopic starts a test server with a topic of two partitions, and
+// provides a producer for it.
+func startTableTopic(t *testing.T) (host string, producer *Producer,
+	stop func()) {
+	host, stop = startTestServer(t)
+	admin, err := NewAdmin(time.Second, host)
+	assert.Nil(t, err)
+	assert.Nil(t, admin.CreatePartitionedTopic("topicA", 2))
+	producer, err = NewProducer("topicA", time.Second, host)
+	assert.Nil(t, err)
+	return host, producer, stop
+}
+
+// contents provides what the table holds, as Range provides it.
+func contents(table *Table) []string {
+	kvs := []string{}
+	table.Range(func(key []byte, value []byte) bool {
+		kvs = append(kvs, string(key)+"="+string(value))
+		return true
+	})
+	return kvs
+}
+
+func TestTableUpdateGetAndRange(t *testing.T) {
+	host, producer, stop := startTableTopic(t)
+	defer stop()
+	sendKeyed(t, producer, "b", "1", "a", "2", "c", "3", "b", "4", "c", "")
+	_, err := producer.SendMessage([]byte("no key"))
+	assert.Nil(t, err)
+
+	table, err := NewTable("topicA", time.Second, host)
+	assert.Nil(t, err)
+	defer table.Close()
+	caughtUp, err := table.Update()
+	assert.Nil(t, err)
+	assert.True(t, caughtUp)
+
+	value, ok := table.Get([]byte("b"))
+	assert.True(t, ok)
+	assert.Equal(t, "4", string(value))
+	_, ok = table.Get([]byte("c"))
+	assert.False(t, ok)
+	assert.Equal(t, 2, table.Len())
+	assert.Equal(t, []string{"a=2", "b=4"}, contents(table))
+
+	// Range stops when asked to.
+	n := 0
+	table.Range(func(key []byte, value []byte) bool {
+		n++
+		return false
+	})
+	assert.Equal(t, 1, n)
+}
+
+func TestTableUpdateIsBounded(t *testing.T) {
+	host, producer, stop := startTableTopic(t)
+	defer stop()
+	for i := 0; i < 25; i++ {
+		sendKeyed(t, producer, fmt.Sprintf("key %d", i), "value")
+	}
+
+	table, err := NewTable("topicA", time.Second, host)
+	assert.Nil(t, err)
+	defer table.Close()
+	for _, consumer := range table.consumers {
+		consumer.SetPageLimits(1, 0)
+	}
+	updates := 0
+	for {
+		caughtUp, err := table.Update()
+		assert.Nil(t, err)
+		updates++
+		if caughtUp {
+			break
+		}
+		assert.True(t, updates < 3)
+	}
+	assert.Equal(t, 25, table.Len())
+	assert.True(t, updates > 1)
+}
+
+func TestTableOnChange(t *testing.T) {
+	host, stop := startTestServer(t)
+	defer stop()
+	producer, err := NewProducer("topicA", time.Second, host)
+	assert.Nil(t, err)
+	sendKeyed(t, producer, "a", "1", "b", "", "a", "2", "a", "")
+
+	table, err := NewTable("topicA", time.Second, host)
+	assert.Nil(t, err)
+	defer table.Close()
+	changes := []TableChange{}
+	table.OnChange(func(change TableChange) {
+		changes = append(changes, change)
+	})
+	_, err = table.Update()
+	assert.Nil(t, err)
+	// Deleting "b", which is not present, is not a change.
+	assert.Equal(t, []TableChange{
+		{Key: []byte("a"), Value: []byte("1"), MsgNumber: 1},
+		{Key: []byte("a"), Value: []byte("2"), MsgNumber: 3},
+		{Key: []byte("a"), Deleted: true, MsgNumber: 4},
+	}, changes)
+}
+
+func TestTableSnapshotAndRestore(t *testing.T) {
+	host, producer, stop := startTableTopic(t)
+	defer stop()
+	dir, err := ioutil.TempDir("", "table")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	snapshotPath := path.Join(dir, "snapshot")
+
+	sendKeyed(t, producer, "a", "1", "b", "2")
+	table, err := NewTable("topicA", time.Second, host)
+	assert.Nil(t, err)
+	_, err = table.Update()
+	assert.Nil(t, err)
+	assert.Nil(t, table.Snapshot(snapshotPath))
+	assert.Nil(t, table.Close())
+
+	sendKeyed(t, producer, "b", "3", "c", "4")
+	restored, err := NewTable("topicA", time.Second, host)
+	assert.Nil(t, err)
+	defer restored.Close()
+	changes := []string{}
+	restored.OnChange(func(change TableChange) {
+		changes = append(changes, string(change.Key))
+	})
+	ok, err := restored.Restore(snapshotPath)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a=1", "b=2"}, contents(restored))
+
+	// Consuming resumes from where the snapshot was taken.
+	_, err = restored.Update()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a=1", "b=3", "c=4"}, contents(restored))
+	assert.ElementsMatch(t, []string{"b", "c"}, changes)
+}
+
+func TestTableRestoreWhenNoSnapshot(t *testing.T) {
+	host, _, stop := startTableTopic(t)
+	defer stop()
+	table, err := NewTable("topicA", time.Second, host)
+	assert.Nil(t, err)
+	defer table.Close()
+	ok, err := table.Restore(path.Join(os.TempDir(), "nosuchsnapshot"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestTableRestoreOfOtherTopic(t *testing.T) {
+	host, _, stop := startTableTopic(t)
+	defer stop()
+	admin, err := NewAdmin(time.Second, host)
+	assert.Nil(t, err)
+	assert.Nil(t, admin.CreatePartitionedTopic("topicB", 2))
+	dir, err := ioutil.TempDir("", "table")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	snapshotPath := path.Join(dir, "snapshot")
+
+	other, err := NewTable("topicB", time.Second, host)
+	assert.Nil(t, err)
+	assert.Nil(t, other.Snapshot(snapshotPath))
+	other.Close()
+
+	table, err := NewTable("topicA", time.Second, host)
+	assert.Nil(t, err)
+	defer table.Close()
+	_, err = table.Restore(snapshotPath)
+	assert.EqualError(t, err, "The snapshot is of topic topicB, not topicA")
+}
+
+func TestTableFollowsTopicOnceStarted(t *testing.T) {
+	host, producer, stop := startTableTopic(t)
+	defer stop()
+	table, err := NewTable("topicA", time.Second, host)
+	assert.Nil(t, err)
+	changed := make(chan TableChange, 10)
+	table.OnChange(func(change TableChange) {
+		changed <- change
+	})
+	table.Start()
+
+	sendKeyed(t, producer, "a", "1")
+	select {
+	case change := <-changed:
+		assert.Equal(t, "a", string(change.Key))
+	case <-time.After(3 * time.Second):
+		assert.Fail(t, "Change not seen")
+	}
+	value, ok := table.Get([]byte("a"))
+	assert.True(t, ok)
+	assert.Equal(t, "1", string(value))
+	assert.Nil(t, table.Close())
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	minikafka "github.com/peterhoward42/minikafka"
+	pb "github.com/peterhoward42/minikafka/protocol"
+	"github.com/peterhoward42/minikafka/svr"
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/memstore"
+)
+
+// startTestServer starts a server in-process, backed by an empty MemStore,
+// on a port of its own. It provides the host to give clients, and the
+// function that stops the server.
+func startTestServer(t *testing.T) (host string, stop func()) {
+	return startTestServerWith(t, memstore.NewMemStore())
+}
+
+// startTestServerWith is like startTestServer, but backed by the given store,
+// which it empties first.
+func startTestServerWith(t *testing.T, store contract.BackingStore) (
+	host string, stop func()) {
+	err := store.DeleteContents()
+	if err != nil {
+		t.Fatalf("store.DeleteContents: %v", err)
+	}
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	server := svr.NewServer(store)
+	grpcServer := grpc.NewServer()
+	pb.RegisterMiniKafkaServer(grpcServer, server)
+	pb.RegisterMiniKafkaAdminServer(grpcServer, server)
+	go grpcServer.Serve(lis)
+	return lis.Addr().String(), grpcServer.Stop
+}
+
+// batchRecordingStore is a MemStore that records how many messages are in
+// each sequenced request it gets.
+type batchRecordingStore struct {
+	contract.BackingStore
+	mutex sync.Mutex
+	sizes []int
+}
+
+func (s *batchRecordingStore) StoreSequenced(topic string, producerID string,
+	sequence uint64, messages []minikafka.Message) (int, int, error) {
+	s.mutex.Lock()
+	s.sizes = append(s.sizes, len(messages))
+	s.mutex.Unlock()
+	return s.BackingStore.StoreSequenced(topic, producerID, sequence, messages)
+}
+
+// batchSizes provides the sizes recorded so far.
+func (s *batchRecordingStore) batchSizes() []int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]int{}, s.sizes...)
+}
+
+// pollAll provides every message in partition zero of the given topic.
+func pollAll(t *testing.T, host string, topic string) []string {
+	consumer, err := NewConsumer(topic, 1, time.Second, host)
+	if err != nil {
+		t.Fatalf("NewConsumer: %v", err)
+	}
+	received := []string{}
+	for {
+		messages, _, err := consumer.Poll()
+		if err != nil {
+			t.Fatalf("consumer.Poll: %v", err)
+		}
+		if len(messages) == 0 {
+			return received
+		}
+		for _, message := range messages {
+			received = append(received, string(message))
+		}
+	}
+}
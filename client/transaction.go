@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	minikafka "github.com/peterhoward42/minikafka"
+	pb "github.com/peterhoward42/minikafka/protocol"
+)
+
+// Transaction collects messages, which may be bound for different topics, to
+// be stored all or nothing when it is committed. Nothing is sent to the
+// server until then, so none of the messages is visible to consumers
+// before. Obtain one from Producer.BeginTransaction().
+type Transaction struct {
+	producer *Producer
+	messages []transactionMessage
+	finished bool // Committed or aborted.
+}
+
+// transactionMessage is a message in a transaction, with its topic.
+type transactionMessage struct {
+	topic   string
+	message minikafka.Message
+}
+
+// Committed reports where a message sent in a transaction was stored.
+type Committed struct {
+	Topic     string
+	Partition int
+	MsgNumber uint32
+}
+
+// BeginTransaction starts a new transaction, in which messages can be sent
+// to any topic, not just the producer's own.
+func (p *Producer) BeginTransaction() *Transaction {
+	return &Transaction{producer: p}
+}
+
+// Send adds a message bound for the given topic to the transaction. Messages
+// bound for the same partition are stored in the order they were added. A
+// message's key determines its partition, as it does for Producer.Send.
+func (t *Transaction) Send(topic string, message minikafka.Message) error {
+	if t.finished {
+		return fmt.Errorf("The transaction is finished")
+	}
+	t.messages = append(t.messages, transactionMessage{topic, message})
+	return nil
+}
+
+// Commit sends the transaction's messages to the server in a single request,
+// and the server stores them all or nothing. It returns where each message
+// was stored, in the order they were added. Unlike other requests, it is not
+// retried, because the server cannot recognise a retried transaction.
+func (t *Transaction) Commit() (committed []Committed, err error) {
+	if t.finished {
+		return nil, fmt.Errorf("The transaction is finished")
+	}
+	t.finished = true
+	request, placements, err := t.makeRequest()
+	if err != nil {
+		return nil, err
+	}
+	p := t.producer
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	resp, err := p.clientProxy.ProduceTransaction(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("client.ProduceTransaction: %v", err)
+	}
+	if len(resp.GetBatches()) != len(request.GetBatches()) {
+		return nil, fmt.Errorf("Server responded for %d batches, not %d",
+			len(resp.GetBatches()), len(request.GetBatches()))
+	}
+	committed = []Committed{}
+	for i, placement := range placements {
+		batchResp := resp.GetBatches()[placement.batch]
+		committed = append(committed, Committed{
+			Topic:     t.messages[i].topic,
+			Partition: int(batchResp.GetPartition()),
+			MsgNumber: batchResp.GetFirstMsgNumber() +
+				uint32(placement.position)})
+	}
+	return committed, nil
+}
+
+// Abort discards the transaction's messages.
+func (t *Transaction) Abort() {
+	t.finished = true
+	t.messages = nil
+}
+
+// placement is where a message is in a ProduceTransaction request: which
+// batch, and its position in the batch.
+type placement struct {
+	batch    int
+	position int
+}
+
+// makeRequest groups the transaction's messages into batches, one for each
+// partition, and makes the ProduceTransaction request to send them. Keyed
+// messages are assigned to their partitions here, as they would be by the
+// producer's Partitioner, so that messages with different keys can share a
+// transaction. Messages without keys are batched by topic, and left to the
+// server. It also provides the placement of each message in the request.
+func (t *Transaction) makeRequest() (
+	request *pb.ProduceTransactionRequest, placements []placement,
+	err error) {
+	p := t.producer
+	partitioner := p.partitioner
+	if partitioner == nil {
+		partitioner = HashPartitioner{}
+	}
+	type destination struct {
+		topic     string
+		partition int // Or noPartition.
+	}
+	batchFor := map[destination]int{}
+	numPartitions := map[string]int{}
+	request = &pb.ProduceTransactionRequest{}
+	placements = []placement{}
+	for _, m := range t.messages {
+		dest := destination{m.topic, noPartition}
+		if len(m.message.Key) > 0 {
+			if _, ok := numPartitions[m.topic]; ok == false {
+				numPartitions[m.topic], err = p.fetchNumPartitionsOf(m.topic)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+			dest.partition = partitioner.Partition(
+				m.message.Key, numPartitions[m.topic])
+		}
+		batch, ok := batchFor[dest]
+		if ok == false {
+			batch = len(request.Batches)
+			batchFor[dest] = batch
+			batchReq := &pb.ProduceBatchRequest{
+				Topic: &pb.Topic{Topic: m.topic}}
+			if dest.partition != noPartition {
+				batchReq.Partition = &pb.Partition{
+					Partition: uint32(dest.partition)}
+			}
+			request.Batches = append(request.Batches, batchReq)
+		}
+		produceRequest, err := p.makeProduceRequest(m.message)
+		if err != nil {
+			return nil, nil, err
+		}
+		payload := produceRequest.GetPayload()
+		payload.Key = m.message.Key
+		batchReq := request.Batches[batch]
+		placements = append(placements,
+			placement{batch, len(batchReq.Payloads)})
+		batchReq.Payloads = append(batchReq.Payloads, payload)
+	}
+	return request, placements, nil
+}
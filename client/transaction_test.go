@@ -0,0 +1,60 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	minikafka "github.com/peterhoward42/minikafka"
+)
+
+func TestTransactionCommit(t *testing.T) {
+	host, stop := startTestServer(t)
+	defer stop()
+	producer, err := NewProducer("topicA", time.Second, host)
+	assert.Nil(t, err)
+	_, err = producer.SendMessage([]byte("before"))
+	assert.Nil(t, err)
+
+	transaction := producer.BeginTransaction()
+	assert.Nil(t, transaction.Send("topicA", minikafka.Message{
+		Payload: []byte("a 0")}))
+	assert.Nil(t, transaction.Send("topicB", minikafka.Message{
+		Payload: []byte("b 0")}))
+	assert.Nil(t, transaction.Send("topicA", minikafka.Message{
+		Payload: []byte("a 1")}))
+	committed, err := transaction.Commit()
+	assert.Nil(t, err)
+	assert.Equal(t, []Committed{
+		{Topic: "topicA", Partition: 0, MsgNumber: 2},
+		{Topic: "topicB", Partition: 0, MsgNumber: 1},
+		{Topic: "topicA", Partition: 0, MsgNumber: 3},
+	}, committed)
+	assert.Equal(t, []string{"before", "a 0", "a 1"},
+		pollAll(t, host, "topicA"))
+	assert.Equal(t, []string{"b 0"}, pollAll(t, host, "topicB"))
+
+	// It cannot be used again.
+	err = transaction.Send("topicA", minikafka.Message{Payload: []byte("x")})
+	assert.EqualError(t, err, "The transaction is finished")
+	_, err = transaction.Commit()
+	assert.EqualError(t, err, "The transaction is finished")
+}
+
+func TestTransactionAbort(t *testing.T) {
+	host, stop := startTestServer(t)
+	defer stop()
+	producer, err := NewProducer("topicA", time.Second, host)
+	assert.Nil(t, err)
+	_, err = producer.SendMessage([]byte("before"))
+	assert.Nil(t, err)
+
+	transaction := producer.BeginTransaction()
+	assert.Nil(t, transaction.Send("topicA", minikafka.Message{
+		Payload: []byte("a 0")}))
+	transaction.Abort()
+	_, err = transaction.Commit()
+	assert.EqualError(t, err, "The transaction is finished")
+	assert.Equal(t, []string{"before"}, pollAll(t, host, "topicA"))
+}
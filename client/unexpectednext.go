@@ -0,0 +1,45 @@
+package client
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/peterhoward42/minikafka/protocol"
+)
+
+// UnexpectedNextError is the error that SendIfNext and SendBatchIfNext
+// return when the partition's next message number is not the one the
+// producer expected; meaning that others have stored messages there in the
+// meantime. It reports the message number the partition is expecting next.
+type UnexpectedNextError struct {
+	Expected uint32
+	Next     uint32
+}
+
+// Error is defined by, and documented in the standard error interface.
+func (e *UnexpectedNextError) Error() string {
+	return fmt.Sprintf(
+		"Expected the next message number to be %d, but it is %d",
+		e.Expected, e.Next)
+}
+
+// unexpectedNext examines an error returned by a Produce, ProduceBatch or
+// ProduceStream call. When it is the server reporting that the next message
+// number was not the one expected, it provides the error to return to the
+// caller in its place, and *ok* is true.
+func unexpectedNext(err error) (unexpected *UnexpectedNextError, ok bool) {
+	st, isStatus := status.FromError(err)
+	if err == nil || isStatus == false ||
+		st.Code() != codes.FailedPrecondition {
+		return nil, false
+	}
+	for _, detail := range st.Details() {
+		if numbers, isNext := detail.(*pb.UnexpectedNext); isNext {
+			return &UnexpectedNextError{
+				Expected: numbers.GetExpected(), Next: numbers.GetNext()}, true
+		}
+	}
+	return nil, false
+}
@@ -1,5 +1,34 @@
 package minikafka
 
+import (
+	"time"
+)
+
 // Message encapsulates the fundamental message objects that the whole of
-// this package is concerned with. I.e. an arbitrary-length sequence of bytes.
-type Message []byte
+// this package is concerned with. I.e. an arbitrary-length sequence of bytes
+// (the payload), optionally accompanied by a key, some named headers, and the
+// time at which the producer made it.
+type Message struct {
+	Payload   []byte
+	Key       []byte
+	Headers   map[string][]byte
+	Timestamp time.Time // Zero when the producer did not provide one.
+}
+
+// Size provides the number of bytes held in the message's payload, key and
+// headers.
+func (m Message) Size() int {
+	size := len(m.Payload) + len(m.Key)
+	for name, value := range m.Headers {
+		size += len(name) + len(value)
+	}
+	return size
+}
+
+// StoredMessage is a Message as it is held in a store; along with the
+// message number assigned to it, and the time at which it was stored.
+type StoredMessage struct {
+	Message
+	Number  int
+	Created time.Time
+}
@@ -0,0 +1,17 @@
+package minikafka
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSize(t *testing.T) {
+	msg := Message{
+		Payload: []byte("abc"),
+		Key:     []byte("de"),
+		Headers: map[string][]byte{"f": []byte("gh")}}
+	assert.Equal(t, 8, msg.Size())
+
+	assert.Equal(t, 0, Message{}.Size())
+}
@@ -0,0 +1,18 @@
+package minikafka
+
+import (
+	"hash/fnv"
+)
+
+// PartitionForKey provides the partition, out of *numPartitions*, to which
+// messages with the given key belong. It is the single source of truth for
+// this, so that the server, and clients that choose partitions for
+// themselves, agree.
+func PartitionForKey(key []byte, numPartitions int) int {
+	if numPartitions <= 1 {
+		return 0
+	}
+	hash := fnv.New32a()
+	hash.Write(key)
+	return int(hash.Sum32() % uint32(numPartitions))
+}
@@ -0,0 +1,24 @@
+package minikafka
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionForKey(t *testing.T) {
+	// The same key should always map to the same partition.
+	p := PartitionForKey([]byte("customer-42"), 8)
+	assert.Equal(t, p, PartitionForKey([]byte("customer-42"), 8))
+	assert.True(t, p >= 0 && p < 8)
+
+	// Different keys should spread across the partitions.
+	used := map[int]bool{}
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		used[PartitionForKey([]byte(key), 4)] = true
+	}
+	assert.True(t, len(used) > 1)
+
+	// A topic with one partition has only partition zero.
+	assert.Equal(t, 0, PartitionForKey([]byte("anything"), 1))
+}
@@ -6,6 +6,7 @@ package protocol
 import proto "github.com/golang/protobuf/proto"
 import fmt "fmt"
 import math "math"
+import timestamp "github.com/golang/protobuf/ptypes/timestamp"
 
 import (
 	context "golang.org/x/net/context"
@@ -23,6 +24,36 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
+type Empty struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Empty) Reset()         { *m = Empty{} }
+func (m *Empty) String() string { return proto.CompactTextString(m) }
+func (*Empty) ProtoMessage()    {}
+func (*Empty) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{0}
+}
+func (m *Empty) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Empty.Unmarshal(m, b)
+}
+func (m *Empty) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Empty.Marshal(b, m, deterministic)
+}
+func (dst *Empty) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Empty.Merge(dst, src)
+}
+func (m *Empty) XXX_Size() int {
+	return xxx_messageInfo_Empty.Size(m)
+}
+func (m *Empty) XXX_DiscardUnknown() {
+	xxx_messageInfo_Empty.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Empty proto.InternalMessageInfo
+
 type Topic struct {
 	Topic                string   `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -34,7 +65,7 @@ func (m *Topic) Reset()         { *m = Topic{} }
 func (m *Topic) String() string { return proto.CompactTextString(m) }
 func (*Topic) ProtoMessage()    {}
 func (*Topic) Descriptor() ([]byte, []int) {
-	return fileDescriptor_minikafka_07f0578420994a20, []int{0}
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{1}
 }
 func (m *Topic) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_Topic.Unmarshal(m, b)
@@ -61,18 +92,28 @@ func (m *Topic) GetTopic() string {
 	return ""
 }
 
+// Payload is a message's content, along with its headers and the timestamp
+// (if any) that its producer gave it. When the server returns a message, it
+// also fills in the message's key (which producers send in
+// ProduceRequest.key, or in the Payload itself for ProduceBatchRequest), its
+// message number, and the time at which it was stored.
 type Payload struct {
-	Payload              []byte   `protobuf:"bytes,1,opt,name=payload,proto3" json:"payload,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	Payload              []byte               `protobuf:"bytes,1,opt,name=payload,proto3" json:"payload,omitempty"`
+	Headers              map[string][]byte    `protobuf:"bytes,2,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Timestamp            *timestamp.Timestamp `protobuf:"bytes,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Key                  []byte               `protobuf:"bytes,4,opt,name=key,proto3" json:"key,omitempty"`
+	MsgNumber            *MsgNumber           `protobuf:"bytes,5,opt,name=msg_number,json=msgNumber,proto3" json:"msg_number,omitempty"`
+	Created              *timestamp.Timestamp `protobuf:"bytes,6,opt,name=created,proto3" json:"created,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
 }
 
 func (m *Payload) Reset()         { *m = Payload{} }
 func (m *Payload) String() string { return proto.CompactTextString(m) }
 func (*Payload) ProtoMessage()    {}
 func (*Payload) Descriptor() ([]byte, []int) {
-	return fileDescriptor_minikafka_07f0578420994a20, []int{1}
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{2}
 }
 func (m *Payload) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_Payload.Unmarshal(m, b)
@@ -99,19 +140,114 @@ func (m *Payload) GetPayload() []byte {
 	return nil
 }
 
-type ProduceRequest struct {
-	Topic                *Topic   `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
-	Payload              *Payload `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`
+func (m *Payload) GetHeaders() map[string][]byte {
+	if m != nil {
+		return m.Headers
+	}
+	return nil
+}
+
+func (m *Payload) GetTimestamp() *timestamp.Timestamp {
+	if m != nil {
+		return m.Timestamp
+	}
+	return nil
+}
+
+func (m *Payload) GetKey() []byte {
+	if m != nil {
+		return m.Key
+	}
+	return nil
+}
+
+func (m *Payload) GetMsgNumber() *MsgNumber {
+	if m != nil {
+		return m.MsgNumber
+	}
+	return nil
+}
+
+func (m *Payload) GetCreated() *timestamp.Timestamp {
+	if m != nil {
+		return m.Created
+	}
+	return nil
+}
+
+// Partition wraps a partition number, so that its absence can be detected.
+type Partition struct {
+	Partition            uint32   `protobuf:"varint,1,opt,name=partition,proto3" json:"partition,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
 }
 
+func (m *Partition) Reset()         { *m = Partition{} }
+func (m *Partition) String() string { return proto.CompactTextString(m) }
+func (*Partition) ProtoMessage()    {}
+func (*Partition) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{3}
+}
+func (m *Partition) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Partition.Unmarshal(m, b)
+}
+func (m *Partition) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Partition.Marshal(b, m, deterministic)
+}
+func (dst *Partition) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Partition.Merge(dst, src)
+}
+func (m *Partition) XXX_Size() int {
+	return xxx_messageInfo_Partition.Size(m)
+}
+func (m *Partition) XXX_DiscardUnknown() {
+	xxx_messageInfo_Partition.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Partition proto.InternalMessageInfo
+
+func (m *Partition) GetPartition() uint32 {
+	if m != nil {
+		return m.Partition
+	}
+	return 0
+}
+
+type ProduceRequest struct {
+	Topic   *Topic   `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
+	Payload *Payload `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`
+	// The message is stored in the partition given. When that is absent, the
+	// server chooses the partition by hashing the key. When that is absent
+	// too, it spreads messages across the partitions in turn.
+	Key       []byte     `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
+	Partition *Partition `protobuf:"bytes,4,opt,name=partition,proto3" json:"partition,omitempty"`
+	// A producer that gives its ID, identifies each request it makes with a
+	// sequence number; and can then retry a request safely. When a retried
+	// request was stored the first time round, the server stores nothing, and
+	// responds with the original message number. The server does not spread
+	// such requests without a key across the partitions in turn, but stores
+	// them all in the partition the producer's ID hashes to; so that retries
+	// go to the same partition, and the producer's messages keep their order.
+	Producer *Producer `protobuf:"bytes,5,opt,name=producer,proto3" json:"producer,omitempty"`
+	// When given, the message is stored only if it would get this message
+	// number in its partition; otherwise the request fails with the
+	// FAILED_PRECONDITION status code, and an UnexpectedNext detail. This
+	// serves for optimistic concurrency control, and is best combined with a
+	// partition or key, so that the partition is known in advance. Message
+	// numbers start at 1, so a request expecting 0 fails with the
+	// INVALID_ARGUMENT status code.
+	ExpectedNext         *MsgNumber `protobuf:"bytes,6,opt,name=expected_next,json=expectedNext,proto3" json:"expected_next,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
+	XXX_unrecognized     []byte     `json:"-"`
+	XXX_sizecache        int32      `json:"-"`
+}
+
 func (m *ProduceRequest) Reset()         { *m = ProduceRequest{} }
 func (m *ProduceRequest) String() string { return proto.CompactTextString(m) }
 func (*ProduceRequest) ProtoMessage()    {}
 func (*ProduceRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_minikafka_07f0578420994a20, []int{2}
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{4}
 }
 func (m *ProduceRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ProduceRequest.Unmarshal(m, b)
@@ -145,222 +281,1789 @@ func (m *ProduceRequest) GetPayload() *Payload {
 	return nil
 }
 
-type MsgNumber struct {
-	MsgNumber            uint32   `protobuf:"varint,1,opt,name=msg_number,json=msgNumber,proto3" json:"msg_number,omitempty"`
+func (m *ProduceRequest) GetKey() []byte {
+	if m != nil {
+		return m.Key
+	}
+	return nil
+}
+
+func (m *ProduceRequest) GetPartition() *Partition {
+	if m != nil {
+		return m.Partition
+	}
+	return nil
+}
+
+func (m *ProduceRequest) GetProducer() *Producer {
+	if m != nil {
+		return m.Producer
+	}
+	return nil
+}
+
+func (m *ProduceRequest) GetExpectedNext() *MsgNumber {
+	if m != nil {
+		return m.ExpectedNext
+	}
+	return nil
+}
+
+type UnexpectedNext struct {
+	Expected             uint32   `protobuf:"varint,1,opt,name=expected,proto3" json:"expected,omitempty"`
+	Next                 uint32   `protobuf:"varint,2,opt,name=next,proto3" json:"next,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
 }
 
-func (m *MsgNumber) Reset()         { *m = MsgNumber{} }
-func (m *MsgNumber) String() string { return proto.CompactTextString(m) }
-func (*MsgNumber) ProtoMessage()    {}
-func (*MsgNumber) Descriptor() ([]byte, []int) {
-	return fileDescriptor_minikafka_07f0578420994a20, []int{3}
+func (m *UnexpectedNext) Reset()         { *m = UnexpectedNext{} }
+func (m *UnexpectedNext) String() string { return proto.CompactTextString(m) }
+func (*UnexpectedNext) ProtoMessage()    {}
+func (*UnexpectedNext) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{5}
 }
-func (m *MsgNumber) XXX_Unmarshal(b []byte) error {
-	return xxx_messageInfo_MsgNumber.Unmarshal(m, b)
+func (m *UnexpectedNext) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_UnexpectedNext.Unmarshal(m, b)
 }
-func (m *MsgNumber) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
-	return xxx_messageInfo_MsgNumber.Marshal(b, m, deterministic)
+func (m *UnexpectedNext) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_UnexpectedNext.Marshal(b, m, deterministic)
 }
-func (dst *MsgNumber) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_MsgNumber.Merge(dst, src)
+func (dst *UnexpectedNext) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_UnexpectedNext.Merge(dst, src)
 }
-func (m *MsgNumber) XXX_Size() int {
-	return xxx_messageInfo_MsgNumber.Size(m)
+func (m *UnexpectedNext) XXX_Size() int {
+	return xxx_messageInfo_UnexpectedNext.Size(m)
 }
-func (m *MsgNumber) XXX_DiscardUnknown() {
-	xxx_messageInfo_MsgNumber.DiscardUnknown(m)
+func (m *UnexpectedNext) XXX_DiscardUnknown() {
+	xxx_messageInfo_UnexpectedNext.DiscardUnknown(m)
 }
 
-var xxx_messageInfo_MsgNumber proto.InternalMessageInfo
+var xxx_messageInfo_UnexpectedNext proto.InternalMessageInfo
 
-func (m *MsgNumber) GetMsgNumber() uint32 {
+func (m *UnexpectedNext) GetExpected() uint32 {
 	if m != nil {
-		return m.MsgNumber
+		return m.Expected
 	}
 	return 0
 }
 
-type PollRequest struct {
-	Topic                string     `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
-	ReadFrom             *MsgNumber `protobuf:"bytes,2,opt,name=read_from,json=readFrom,proto3" json:"read_from,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
-	XXX_unrecognized     []byte     `json:"-"`
-	XXX_sizecache        int32      `json:"-"`
+func (m *UnexpectedNext) GetNext() uint32 {
+	if m != nil {
+		return m.Next
+	}
+	return 0
 }
 
-func (m *PollRequest) Reset()         { *m = PollRequest{} }
-func (m *PollRequest) String() string { return proto.CompactTextString(m) }
-func (*PollRequest) ProtoMessage()    {}
-func (*PollRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_minikafka_07f0578420994a20, []int{4}
+type Producer struct {
+	ProducerId           string   `protobuf:"bytes,1,opt,name=producer_id,json=producerId,proto3" json:"producer_id,omitempty"`
+	Sequence             uint64   `protobuf:"varint,2,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
-func (m *PollRequest) XXX_Unmarshal(b []byte) error {
-	return xxx_messageInfo_PollRequest.Unmarshal(m, b)
+
+func (m *Producer) Reset()         { *m = Producer{} }
+func (m *Producer) String() string { return proto.CompactTextString(m) }
+func (*Producer) ProtoMessage()    {}
+func (*Producer) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{6}
 }
-func (m *PollRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
-	return xxx_messageInfo_PollRequest.Marshal(b, m, deterministic)
+func (m *Producer) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Producer.Unmarshal(m, b)
 }
-func (dst *PollRequest) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_PollRequest.Merge(dst, src)
+func (m *Producer) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Producer.Marshal(b, m, deterministic)
 }
-func (m *PollRequest) XXX_Size() int {
-	return xxx_messageInfo_PollRequest.Size(m)
+func (dst *Producer) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Producer.Merge(dst, src)
 }
-func (m *PollRequest) XXX_DiscardUnknown() {
-	xxx_messageInfo_PollRequest.DiscardUnknown(m)
+func (m *Producer) XXX_Size() int {
+	return xxx_messageInfo_Producer.Size(m)
+}
+func (m *Producer) XXX_DiscardUnknown() {
+	xxx_messageInfo_Producer.DiscardUnknown(m)
 }
 
-var xxx_messageInfo_PollRequest proto.InternalMessageInfo
+var xxx_messageInfo_Producer proto.InternalMessageInfo
 
-func (m *PollRequest) GetTopic() string {
+func (m *Producer) GetProducerId() string {
 	if m != nil {
-		return m.Topic
+		return m.ProducerId
 	}
 	return ""
 }
 
-func (m *PollRequest) GetReadFrom() *MsgNumber {
+func (m *Producer) GetSequence() uint64 {
 	if m != nil {
-		return m.ReadFrom
+		return m.Sequence
 	}
-	return nil
+	return 0
 }
 
-type PollResponse struct {
-	// payloads holds the returned messages.
-	Payloads []*Payload `protobuf:"bytes,1,rep,name=payloads,proto3" json:"payloads,omitempty"`
-	// new_read_from tells the requester where they should update their
-	// read_from value to to move past the returned messages.
-	NewReadFrom          *MsgNumber `protobuf:"bytes,2,opt,name=new_read_from,json=newReadFrom,proto3" json:"new_read_from,omitempty"`
+// The whole batch is stored in one partition: the one given, or else the one
+// that the messages' keys hash to (which must be the same for all of them), or
+// else the one the producer's ID hashes to for sequenced batches, or else the
+// next one in turn. Unlike ProduceRequest, each message's key travels
+// in its Payload. Batches may be sequenced, and conditional on the message
+// number the first message would get, in the same way as ProduceRequests.
+type ProduceBatchRequest struct {
+	Topic                *Topic     `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
+	Payloads             []*Payload `protobuf:"bytes,2,rep,name=payloads,proto3" json:"payloads,omitempty"`
+	Partition            *Partition `protobuf:"bytes,3,opt,name=partition,proto3" json:"partition,omitempty"`
+	Producer             *Producer  `protobuf:"bytes,4,opt,name=producer,proto3" json:"producer,omitempty"`
+	ExpectedNext         *MsgNumber `protobuf:"bytes,5,opt,name=expected_next,json=expectedNext,proto3" json:"expected_next,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
 	XXX_unrecognized     []byte     `json:"-"`
 	XXX_sizecache        int32      `json:"-"`
 }
 
-func (m *PollResponse) Reset()         { *m = PollResponse{} }
-func (m *PollResponse) String() string { return proto.CompactTextString(m) }
-func (*PollResponse) ProtoMessage()    {}
-func (*PollResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_minikafka_07f0578420994a20, []int{5}
+func (m *ProduceBatchRequest) Reset()         { *m = ProduceBatchRequest{} }
+func (m *ProduceBatchRequest) String() string { return proto.CompactTextString(m) }
+func (*ProduceBatchRequest) ProtoMessage()    {}
+func (*ProduceBatchRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{7}
 }
-func (m *PollResponse) XXX_Unmarshal(b []byte) error {
-	return xxx_messageInfo_PollResponse.Unmarshal(m, b)
+func (m *ProduceBatchRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ProduceBatchRequest.Unmarshal(m, b)
 }
-func (m *PollResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
-	return xxx_messageInfo_PollResponse.Marshal(b, m, deterministic)
+func (m *ProduceBatchRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ProduceBatchRequest.Marshal(b, m, deterministic)
 }
-func (dst *PollResponse) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_PollResponse.Merge(dst, src)
+func (dst *ProduceBatchRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ProduceBatchRequest.Merge(dst, src)
 }
-func (m *PollResponse) XXX_Size() int {
-	return xxx_messageInfo_PollResponse.Size(m)
+func (m *ProduceBatchRequest) XXX_Size() int {
+	return xxx_messageInfo_ProduceBatchRequest.Size(m)
 }
-func (m *PollResponse) XXX_DiscardUnknown() {
-	xxx_messageInfo_PollResponse.DiscardUnknown(m)
+func (m *ProduceBatchRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ProduceBatchRequest.DiscardUnknown(m)
 }
 
-var xxx_messageInfo_PollResponse proto.InternalMessageInfo
+var xxx_messageInfo_ProduceBatchRequest proto.InternalMessageInfo
 
-func (m *PollResponse) GetPayloads() []*Payload {
+func (m *ProduceBatchRequest) GetTopic() *Topic {
+	if m != nil {
+		return m.Topic
+	}
+	return nil
+}
+
+func (m *ProduceBatchRequest) GetPayloads() []*Payload {
 	if m != nil {
 		return m.Payloads
 	}
 	return nil
 }
 
-func (m *PollResponse) GetNewReadFrom() *MsgNumber {
+func (m *ProduceBatchRequest) GetPartition() *Partition {
 	if m != nil {
-		return m.NewReadFrom
+		return m.Partition
 	}
 	return nil
 }
 
-func init() {
-	proto.RegisterType((*Topic)(nil), "protocol.Topic")
-	proto.RegisterType((*Payload)(nil), "protocol.Payload")
-	proto.RegisterType((*ProduceRequest)(nil), "protocol.ProduceRequest")
-	proto.RegisterType((*MsgNumber)(nil), "protocol.MsgNumber")
-	proto.RegisterType((*PollRequest)(nil), "protocol.PollRequest")
-	proto.RegisterType((*PollResponse)(nil), "protocol.PollResponse")
+func (m *ProduceBatchRequest) GetProducer() *Producer {
+	if m != nil {
+		return m.Producer
+	}
+	return nil
 }
 
-// Reference imports to suppress errors if they are not otherwise used.
-var _ context.Context
-var _ grpc.ClientConn
+func (m *ProduceBatchRequest) GetExpectedNext() *MsgNumber {
+	if m != nil {
+		return m.ExpectedNext
+	}
+	return nil
+}
 
-// This is a compile-time assertion to ensure that this generated file
-// is compatible with the grpc package it is being compiled against.
-const _ = grpc.SupportPackageIsVersion4
+type ProduceTransactionRequest struct {
+	Batches              []*ProduceBatchRequest `protobuf:"bytes,1,rep,name=batches,proto3" json:"batches,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}               `json:"-"`
+	XXX_unrecognized     []byte                 `json:"-"`
+	XXX_sizecache        int32                  `json:"-"`
+}
 
-// MiniKafkaClient is the client API for MiniKafka service.
-//
-// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
-type MiniKafkaClient interface {
-	// Produce returns the message number assigned to the stored message.
-	Produce(ctx context.Context, in *ProduceRequest, opts ...grpc.CallOption) (*MsgNumber, error)
-	Poll(ctx context.Context, in *PollRequest, opts ...grpc.CallOption) (*PollResponse, error)
+func (m *ProduceTransactionRequest) Reset()         { *m = ProduceTransactionRequest{} }
+func (m *ProduceTransactionRequest) String() string { return proto.CompactTextString(m) }
+func (*ProduceTransactionRequest) ProtoMessage()    {}
+func (*ProduceTransactionRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{8}
+}
+func (m *ProduceTransactionRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ProduceTransactionRequest.Unmarshal(m, b)
+}
+func (m *ProduceTransactionRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ProduceTransactionRequest.Marshal(b, m, deterministic)
+}
+func (dst *ProduceTransactionRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ProduceTransactionRequest.Merge(dst, src)
+}
+func (m *ProduceTransactionRequest) XXX_Size() int {
+	return xxx_messageInfo_ProduceTransactionRequest.Size(m)
+}
+func (m *ProduceTransactionRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ProduceTransactionRequest.DiscardUnknown(m)
 }
 
-type miniKafkaClient struct {
-	cc *grpc.ClientConn
+var xxx_messageInfo_ProduceTransactionRequest proto.InternalMessageInfo
+
+func (m *ProduceTransactionRequest) GetBatches() []*ProduceBatchRequest {
+	if m != nil {
+		return m.Batches
+	}
+	return nil
 }
 
-func NewMiniKafkaClient(cc *grpc.ClientConn) MiniKafkaClient {
-	return &miniKafkaClient{cc}
+// The responses are in the same order as the batches in the request.
+type ProduceTransactionResponse struct {
+	Batches              []*ProduceBatchResponse `protobuf:"bytes,1,rep,name=batches,proto3" json:"batches,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                `json:"-"`
+	XXX_unrecognized     []byte                  `json:"-"`
+	XXX_sizecache        int32                   `json:"-"`
 }
 
-func (c *miniKafkaClient) Produce(ctx context.Context, in *ProduceRequest, opts ...grpc.CallOption) (*MsgNumber, error) {
-	out := new(MsgNumber)
-	err := c.cc.Invoke(ctx, "/protocol.MiniKafka/Produce", in, out, opts...)
-	if err != nil {
-		return nil, err
-	}
-	return out, nil
+func (m *ProduceTransactionResponse) Reset()         { *m = ProduceTransactionResponse{} }
+func (m *ProduceTransactionResponse) String() string { return proto.CompactTextString(m) }
+func (*ProduceTransactionResponse) ProtoMessage()    {}
+func (*ProduceTransactionResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{9}
+}
+func (m *ProduceTransactionResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ProduceTransactionResponse.Unmarshal(m, b)
+}
+func (m *ProduceTransactionResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ProduceTransactionResponse.Marshal(b, m, deterministic)
+}
+func (dst *ProduceTransactionResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ProduceTransactionResponse.Merge(dst, src)
+}
+func (m *ProduceTransactionResponse) XXX_Size() int {
+	return xxx_messageInfo_ProduceTransactionResponse.Size(m)
+}
+func (m *ProduceTransactionResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ProduceTransactionResponse.DiscardUnknown(m)
 }
 
-func (c *miniKafkaClient) Poll(ctx context.Context, in *PollRequest, opts ...grpc.CallOption) (*PollResponse, error) {
-	out := new(PollResponse)
-	err := c.cc.Invoke(ctx, "/protocol.MiniKafka/Poll", in, out, opts...)
-	if err != nil {
-		return nil, err
+var xxx_messageInfo_ProduceTransactionResponse proto.InternalMessageInfo
+
+func (m *ProduceTransactionResponse) GetBatches() []*ProduceBatchResponse {
+	if m != nil {
+		return m.Batches
 	}
-	return out, nil
+	return nil
 }
 
-// MiniKafkaServer is the server API for MiniKafka service.
-type MiniKafkaServer interface {
-	// Produce returns the message number assigned to the stored message.
-	Produce(context.Context, *ProduceRequest) (*MsgNumber, error)
-	Poll(context.Context, *PollRequest) (*PollResponse, error)
+type ProduceBatchResponse struct {
+	FirstMsgNumber       uint32   `protobuf:"varint,1,opt,name=first_msg_number,json=firstMsgNumber,proto3" json:"first_msg_number,omitempty"`
+	LastMsgNumber        uint32   `protobuf:"varint,2,opt,name=last_msg_number,json=lastMsgNumber,proto3" json:"last_msg_number,omitempty"`
+	Partition            uint32   `protobuf:"varint,3,opt,name=partition,proto3" json:"partition,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
-func RegisterMiniKafkaServer(s *grpc.Server, srv MiniKafkaServer) {
-	s.RegisterService(&_MiniKafka_serviceDesc, srv)
+func (m *ProduceBatchResponse) Reset()         { *m = ProduceBatchResponse{} }
+func (m *ProduceBatchResponse) String() string { return proto.CompactTextString(m) }
+func (*ProduceBatchResponse) ProtoMessage()    {}
+func (*ProduceBatchResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{10}
+}
+func (m *ProduceBatchResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ProduceBatchResponse.Unmarshal(m, b)
+}
+func (m *ProduceBatchResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ProduceBatchResponse.Marshal(b, m, deterministic)
+}
+func (dst *ProduceBatchResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ProduceBatchResponse.Merge(dst, src)
+}
+func (m *ProduceBatchResponse) XXX_Size() int {
+	return xxx_messageInfo_ProduceBatchResponse.Size(m)
+}
+func (m *ProduceBatchResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ProduceBatchResponse.DiscardUnknown(m)
 }
 
-func _MiniKafka_Produce_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(ProduceRequest)
-	if err := dec(in); err != nil {
-		return nil, err
-	}
-	if interceptor == nil {
-		return srv.(MiniKafkaServer).Produce(ctx, in)
-	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/protocol.MiniKafka/Produce",
-	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(MiniKafkaServer).Produce(ctx, req.(*ProduceRequest))
+var xxx_messageInfo_ProduceBatchResponse proto.InternalMessageInfo
+
+func (m *ProduceBatchResponse) GetFirstMsgNumber() uint32 {
+	if m != nil {
+		return m.FirstMsgNumber
 	}
-	return interceptor(ctx, in, info, handler)
+	return 0
 }
 
-func _MiniKafka_Poll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(PollRequest)
+func (m *ProduceBatchResponse) GetLastMsgNumber() uint32 {
+	if m != nil {
+		return m.LastMsgNumber
+	}
+	return 0
+}
+
+func (m *ProduceBatchResponse) GetPartition() uint32 {
+	if m != nil {
+		return m.Partition
+	}
+	return 0
+}
+
+type ProduceResponse struct {
+	MsgNumber            uint32   `protobuf:"varint,1,opt,name=msg_number,json=msgNumber,proto3" json:"msg_number,omitempty"`
+	Partition            uint32   `protobuf:"varint,2,opt,name=partition,proto3" json:"partition,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ProduceResponse) Reset()         { *m = ProduceResponse{} }
+func (m *ProduceResponse) String() string { return proto.CompactTextString(m) }
+func (*ProduceResponse) ProtoMessage()    {}
+func (*ProduceResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{11}
+}
+func (m *ProduceResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ProduceResponse.Unmarshal(m, b)
+}
+func (m *ProduceResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ProduceResponse.Marshal(b, m, deterministic)
+}
+func (dst *ProduceResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ProduceResponse.Merge(dst, src)
+}
+func (m *ProduceResponse) XXX_Size() int {
+	return xxx_messageInfo_ProduceResponse.Size(m)
+}
+func (m *ProduceResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ProduceResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ProduceResponse proto.InternalMessageInfo
+
+func (m *ProduceResponse) GetMsgNumber() uint32 {
+	if m != nil {
+		return m.MsgNumber
+	}
+	return 0
+}
+
+func (m *ProduceResponse) GetPartition() uint32 {
+	if m != nil {
+		return m.Partition
+	}
+	return 0
+}
+
+type PartitionCount struct {
+	NumPartitions        uint32   `protobuf:"varint,1,opt,name=num_partitions,json=numPartitions,proto3" json:"num_partitions,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PartitionCount) Reset()         { *m = PartitionCount{} }
+func (m *PartitionCount) String() string { return proto.CompactTextString(m) }
+func (*PartitionCount) ProtoMessage()    {}
+func (*PartitionCount) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{12}
+}
+func (m *PartitionCount) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PartitionCount.Unmarshal(m, b)
+}
+func (m *PartitionCount) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PartitionCount.Marshal(b, m, deterministic)
+}
+func (dst *PartitionCount) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PartitionCount.Merge(dst, src)
+}
+func (m *PartitionCount) XXX_Size() int {
+	return xxx_messageInfo_PartitionCount.Size(m)
+}
+func (m *PartitionCount) XXX_DiscardUnknown() {
+	xxx_messageInfo_PartitionCount.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PartitionCount proto.InternalMessageInfo
+
+func (m *PartitionCount) GetNumPartitions() uint32 {
+	if m != nil {
+		return m.NumPartitions
+	}
+	return 0
+}
+
+type MsgNumber struct {
+	MsgNumber            uint32   `protobuf:"varint,1,opt,name=msg_number,json=msgNumber,proto3" json:"msg_number,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *MsgNumber) Reset()         { *m = MsgNumber{} }
+func (m *MsgNumber) String() string { return proto.CompactTextString(m) }
+func (*MsgNumber) ProtoMessage()    {}
+func (*MsgNumber) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{13}
+}
+func (m *MsgNumber) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MsgNumber.Unmarshal(m, b)
+}
+func (m *MsgNumber) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MsgNumber.Marshal(b, m, deterministic)
+}
+func (dst *MsgNumber) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MsgNumber.Merge(dst, src)
+}
+func (m *MsgNumber) XXX_Size() int {
+	return xxx_messageInfo_MsgNumber.Size(m)
+}
+func (m *MsgNumber) XXX_DiscardUnknown() {
+	xxx_messageInfo_MsgNumber.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MsgNumber proto.InternalMessageInfo
+
+func (m *MsgNumber) GetMsgNumber() uint32 {
+	if m != nil {
+		return m.MsgNumber
+	}
+	return 0
+}
+
+type PollRequest struct {
+	Topic    string     `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
+	ReadFrom *MsgNumber `protobuf:"bytes,2,opt,name=read_from,json=readFrom,proto3" json:"read_from,omitempty"`
+	// max_wait_ms, when non-zero, asks the server to hold on to the request
+	// until at least min_messages are available, or until this many
+	// milliseconds have elapsed - whichever happens first. (Long-polling).
+	MaxWaitMs uint32 `protobuf:"varint,3,opt,name=max_wait_ms,json=maxWaitMs,proto3" json:"max_wait_ms,omitempty"`
+	// min_messages defaults to 1 when not specified.
+	MinMessages uint32 `protobuf:"varint,4,opt,name=min_messages,json=minMessages,proto3" json:"min_messages,omitempty"`
+	// max_messages and max_bytes limit the size of the response, when they are
+	// non-zero. The server also imposes its own limit on the total bytes. The
+	// first message is always returned, even if it alone exceeds max_bytes.
+	MaxMessages          uint32   `protobuf:"varint,5,opt,name=max_messages,json=maxMessages,proto3" json:"max_messages,omitempty"`
+	MaxBytes             uint32   `protobuf:"varint,6,opt,name=max_bytes,json=maxBytes,proto3" json:"max_bytes,omitempty"`
+	Partition            uint32   `protobuf:"varint,7,opt,name=partition,proto3" json:"partition,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PollRequest) Reset()         { *m = PollRequest{} }
+func (m *PollRequest) String() string { return proto.CompactTextString(m) }
+func (*PollRequest) ProtoMessage()    {}
+func (*PollRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{14}
+}
+func (m *PollRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PollRequest.Unmarshal(m, b)
+}
+func (m *PollRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PollRequest.Marshal(b, m, deterministic)
+}
+func (dst *PollRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PollRequest.Merge(dst, src)
+}
+func (m *PollRequest) XXX_Size() int {
+	return xxx_messageInfo_PollRequest.Size(m)
+}
+func (m *PollRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PollRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PollRequest proto.InternalMessageInfo
+
+func (m *PollRequest) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+func (m *PollRequest) GetReadFrom() *MsgNumber {
+	if m != nil {
+		return m.ReadFrom
+	}
+	return nil
+}
+
+func (m *PollRequest) GetMaxWaitMs() uint32 {
+	if m != nil {
+		return m.MaxWaitMs
+	}
+	return 0
+}
+
+func (m *PollRequest) GetMinMessages() uint32 {
+	if m != nil {
+		return m.MinMessages
+	}
+	return 0
+}
+
+func (m *PollRequest) GetMaxMessages() uint32 {
+	if m != nil {
+		return m.MaxMessages
+	}
+	return 0
+}
+
+func (m *PollRequest) GetMaxBytes() uint32 {
+	if m != nil {
+		return m.MaxBytes
+	}
+	return 0
+}
+
+func (m *PollRequest) GetPartition() uint32 {
+	if m != nil {
+		return m.Partition
+	}
+	return 0
+}
+
+type PollResponse struct {
+	// payloads holds the returned messages. Each carries its own message
+	// number and creation time, since the numbers need not be contiguous
+	// once old messages have been removed.
+	Payloads []*Payload `protobuf:"bytes,1,rep,name=payloads,proto3" json:"payloads,omitempty"`
+	// new_read_from tells the requester where they should update their
+	// read_from value to to move past the returned messages.
+	NewReadFrom *MsgNumber `protobuf:"bytes,2,opt,name=new_read_from,json=newReadFrom,proto3" json:"new_read_from,omitempty"`
+	// available tells the requester which messages the partition held at the
+	// time of the poll.
+	Available            *AvailableRange `protobuf:"bytes,3,opt,name=available,proto3" json:"available,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *PollResponse) Reset()         { *m = PollResponse{} }
+func (m *PollResponse) String() string { return proto.CompactTextString(m) }
+func (*PollResponse) ProtoMessage()    {}
+func (*PollResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{15}
+}
+func (m *PollResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PollResponse.Unmarshal(m, b)
+}
+func (m *PollResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PollResponse.Marshal(b, m, deterministic)
+}
+func (dst *PollResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PollResponse.Merge(dst, src)
+}
+func (m *PollResponse) XXX_Size() int {
+	return xxx_messageInfo_PollResponse.Size(m)
+}
+func (m *PollResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_PollResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PollResponse proto.InternalMessageInfo
+
+func (m *PollResponse) GetPayloads() []*Payload {
+	if m != nil {
+		return m.Payloads
+	}
+	return nil
+}
+
+func (m *PollResponse) GetNewReadFrom() *MsgNumber {
+	if m != nil {
+		return m.NewReadFrom
+	}
+	return nil
+}
+
+func (m *PollResponse) GetAvailable() *AvailableRange {
+	if m != nil {
+		return m.Available
+	}
+	return nil
+}
+
+// AvailableRange describes the messages a partition has available: those
+// numbered from earliest, up to but not including next. (They are equal when
+// it has none).
+type AvailableRange struct {
+	Earliest             uint32   `protobuf:"varint,1,opt,name=earliest,proto3" json:"earliest,omitempty"`
+	Next                 uint32   `protobuf:"varint,2,opt,name=next,proto3" json:"next,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AvailableRange) Reset()         { *m = AvailableRange{} }
+func (m *AvailableRange) String() string { return proto.CompactTextString(m) }
+func (*AvailableRange) ProtoMessage()    {}
+func (*AvailableRange) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{16}
+}
+func (m *AvailableRange) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AvailableRange.Unmarshal(m, b)
+}
+func (m *AvailableRange) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AvailableRange.Marshal(b, m, deterministic)
+}
+func (dst *AvailableRange) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AvailableRange.Merge(dst, src)
+}
+func (m *AvailableRange) XXX_Size() int {
+	return xxx_messageInfo_AvailableRange.Size(m)
+}
+func (m *AvailableRange) XXX_DiscardUnknown() {
+	xxx_messageInfo_AvailableRange.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AvailableRange proto.InternalMessageInfo
+
+func (m *AvailableRange) GetEarliest() uint32 {
+	if m != nil {
+		return m.Earliest
+	}
+	return 0
+}
+
+func (m *AvailableRange) GetNext() uint32 {
+	if m != nil {
+		return m.Next
+	}
+	return 0
+}
+
+type SubscribeRequest struct {
+	Topic                string     `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
+	ReadFrom             *MsgNumber `protobuf:"bytes,2,opt,name=read_from,json=readFrom,proto3" json:"read_from,omitempty"`
+	Partition            uint32     `protobuf:"varint,3,opt,name=partition,proto3" json:"partition,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
+	XXX_unrecognized     []byte     `json:"-"`
+	XXX_sizecache        int32      `json:"-"`
+}
+
+func (m *SubscribeRequest) Reset()         { *m = SubscribeRequest{} }
+func (m *SubscribeRequest) String() string { return proto.CompactTextString(m) }
+func (*SubscribeRequest) ProtoMessage()    {}
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{17}
+}
+func (m *SubscribeRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SubscribeRequest.Unmarshal(m, b)
+}
+func (m *SubscribeRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SubscribeRequest.Marshal(b, m, deterministic)
+}
+func (dst *SubscribeRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SubscribeRequest.Merge(dst, src)
+}
+func (m *SubscribeRequest) XXX_Size() int {
+	return xxx_messageInfo_SubscribeRequest.Size(m)
+}
+func (m *SubscribeRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SubscribeRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SubscribeRequest proto.InternalMessageInfo
+
+func (m *SubscribeRequest) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+func (m *SubscribeRequest) GetReadFrom() *MsgNumber {
+	if m != nil {
+		return m.ReadFrom
+	}
+	return nil
+}
+
+func (m *SubscribeRequest) GetPartition() uint32 {
+	if m != nil {
+		return m.Partition
+	}
+	return 0
+}
+
+// Message is one stored message. Its payload carries the message number
+// that was assigned to it.
+type Message struct {
+	Payload              *Payload `protobuf:"bytes,1,opt,name=payload,proto3" json:"payload,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Message) Reset()         { *m = Message{} }
+func (m *Message) String() string { return proto.CompactTextString(m) }
+func (*Message) ProtoMessage()    {}
+func (*Message) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{18}
+}
+func (m *Message) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Message.Unmarshal(m, b)
+}
+func (m *Message) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Message.Marshal(b, m, deterministic)
+}
+func (dst *Message) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Message.Merge(dst, src)
+}
+func (m *Message) XXX_Size() int {
+	return xxx_messageInfo_Message.Size(m)
+}
+func (m *Message) XXX_DiscardUnknown() {
+	xxx_messageInfo_Message.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Message proto.InternalMessageInfo
+
+func (m *Message) GetPayload() *Payload {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+// Consumer groups commit message numbers separately for each partition.
+type CommitOffsetRequest struct {
+	Group                string     `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Topic                string     `protobuf:"bytes,2,opt,name=topic,proto3" json:"topic,omitempty"`
+	ReadFrom             *MsgNumber `protobuf:"bytes,3,opt,name=read_from,json=readFrom,proto3" json:"read_from,omitempty"`
+	Partition            uint32     `protobuf:"varint,4,opt,name=partition,proto3" json:"partition,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
+	XXX_unrecognized     []byte     `json:"-"`
+	XXX_sizecache        int32      `json:"-"`
+}
+
+func (m *CommitOffsetRequest) Reset()         { *m = CommitOffsetRequest{} }
+func (m *CommitOffsetRequest) String() string { return proto.CompactTextString(m) }
+func (*CommitOffsetRequest) ProtoMessage()    {}
+func (*CommitOffsetRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{19}
+}
+func (m *CommitOffsetRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CommitOffsetRequest.Unmarshal(m, b)
+}
+func (m *CommitOffsetRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CommitOffsetRequest.Marshal(b, m, deterministic)
+}
+func (dst *CommitOffsetRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CommitOffsetRequest.Merge(dst, src)
+}
+func (m *CommitOffsetRequest) XXX_Size() int {
+	return xxx_messageInfo_CommitOffsetRequest.Size(m)
+}
+func (m *CommitOffsetRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_CommitOffsetRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CommitOffsetRequest proto.InternalMessageInfo
+
+func (m *CommitOffsetRequest) GetGroup() string {
+	if m != nil {
+		return m.Group
+	}
+	return ""
+}
+
+func (m *CommitOffsetRequest) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+func (m *CommitOffsetRequest) GetReadFrom() *MsgNumber {
+	if m != nil {
+		return m.ReadFrom
+	}
+	return nil
+}
+
+func (m *CommitOffsetRequest) GetPartition() uint32 {
+	if m != nil {
+		return m.Partition
+	}
+	return 0
+}
+
+type FetchOffsetRequest struct {
+	Group                string   `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Topic                string   `protobuf:"bytes,2,opt,name=topic,proto3" json:"topic,omitempty"`
+	Partition            uint32   `protobuf:"varint,3,opt,name=partition,proto3" json:"partition,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *FetchOffsetRequest) Reset()         { *m = FetchOffsetRequest{} }
+func (m *FetchOffsetRequest) String() string { return proto.CompactTextString(m) }
+func (*FetchOffsetRequest) ProtoMessage()    {}
+func (*FetchOffsetRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{20}
+}
+func (m *FetchOffsetRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FetchOffsetRequest.Unmarshal(m, b)
+}
+func (m *FetchOffsetRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FetchOffsetRequest.Marshal(b, m, deterministic)
+}
+func (dst *FetchOffsetRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FetchOffsetRequest.Merge(dst, src)
+}
+func (m *FetchOffsetRequest) XXX_Size() int {
+	return xxx_messageInfo_FetchOffsetRequest.Size(m)
+}
+func (m *FetchOffsetRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_FetchOffsetRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FetchOffsetRequest proto.InternalMessageInfo
+
+func (m *FetchOffsetRequest) GetGroup() string {
+	if m != nil {
+		return m.Group
+	}
+	return ""
+}
+
+func (m *FetchOffsetRequest) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+func (m *FetchOffsetRequest) GetPartition() uint32 {
+	if m != nil {
+		return m.Partition
+	}
+	return 0
+}
+
+type PartitionOffsets struct {
+	Partition            uint32          `protobuf:"varint,1,opt,name=partition,proto3" json:"partition,omitempty"`
+	Available            *AvailableRange `protobuf:"bytes,2,opt,name=available,proto3" json:"available,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *PartitionOffsets) Reset()         { *m = PartitionOffsets{} }
+func (m *PartitionOffsets) String() string { return proto.CompactTextString(m) }
+func (*PartitionOffsets) ProtoMessage()    {}
+func (*PartitionOffsets) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{21}
+}
+func (m *PartitionOffsets) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PartitionOffsets.Unmarshal(m, b)
+}
+func (m *PartitionOffsets) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PartitionOffsets.Marshal(b, m, deterministic)
+}
+func (dst *PartitionOffsets) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PartitionOffsets.Merge(dst, src)
+}
+func (m *PartitionOffsets) XXX_Size() int {
+	return xxx_messageInfo_PartitionOffsets.Size(m)
+}
+func (m *PartitionOffsets) XXX_DiscardUnknown() {
+	xxx_messageInfo_PartitionOffsets.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PartitionOffsets proto.InternalMessageInfo
+
+func (m *PartitionOffsets) GetPartition() uint32 {
+	if m != nil {
+		return m.Partition
+	}
+	return 0
+}
+
+func (m *PartitionOffsets) GetAvailable() *AvailableRange {
+	if m != nil {
+		return m.Available
+	}
+	return nil
+}
+
+type ListOffsetsResponse struct {
+	Partitions           []*PartitionOffsets `protobuf:"bytes,1,rep,name=partitions,proto3" json:"partitions,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}            `json:"-"`
+	XXX_unrecognized     []byte              `json:"-"`
+	XXX_sizecache        int32               `json:"-"`
+}
+
+func (m *ListOffsetsResponse) Reset()         { *m = ListOffsetsResponse{} }
+func (m *ListOffsetsResponse) String() string { return proto.CompactTextString(m) }
+func (*ListOffsetsResponse) ProtoMessage()    {}
+func (*ListOffsetsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{22}
+}
+func (m *ListOffsetsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListOffsetsResponse.Unmarshal(m, b)
+}
+func (m *ListOffsetsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListOffsetsResponse.Marshal(b, m, deterministic)
+}
+func (dst *ListOffsetsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListOffsetsResponse.Merge(dst, src)
+}
+func (m *ListOffsetsResponse) XXX_Size() int {
+	return xxx_messageInfo_ListOffsetsResponse.Size(m)
+}
+func (m *ListOffsetsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListOffsetsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListOffsetsResponse proto.InternalMessageInfo
+
+func (m *ListOffsetsResponse) GetPartitions() []*PartitionOffsets {
+	if m != nil {
+		return m.Partitions
+	}
+	return nil
+}
+
+type OffsetForTimeRequest struct {
+	Topic                string               `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
+	Partition            uint32               `protobuf:"varint,2,opt,name=partition,proto3" json:"partition,omitempty"`
+	Time                 *timestamp.Timestamp `protobuf:"bytes,3,opt,name=time,proto3" json:"time,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *OffsetForTimeRequest) Reset()         { *m = OffsetForTimeRequest{} }
+func (m *OffsetForTimeRequest) String() string { return proto.CompactTextString(m) }
+func (*OffsetForTimeRequest) ProtoMessage()    {}
+func (*OffsetForTimeRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{23}
+}
+func (m *OffsetForTimeRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_OffsetForTimeRequest.Unmarshal(m, b)
+}
+func (m *OffsetForTimeRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_OffsetForTimeRequest.Marshal(b, m, deterministic)
+}
+func (dst *OffsetForTimeRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_OffsetForTimeRequest.Merge(dst, src)
+}
+func (m *OffsetForTimeRequest) XXX_Size() int {
+	return xxx_messageInfo_OffsetForTimeRequest.Size(m)
+}
+func (m *OffsetForTimeRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_OffsetForTimeRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_OffsetForTimeRequest proto.InternalMessageInfo
+
+func (m *OffsetForTimeRequest) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+func (m *OffsetForTimeRequest) GetPartition() uint32 {
+	if m != nil {
+		return m.Partition
+	}
+	return 0
+}
+
+func (m *OffsetForTimeRequest) GetTime() *timestamp.Timestamp {
+	if m != nil {
+		return m.Time
+	}
+	return nil
+}
+
+type FetchOffsetResponse struct {
+	// read_from is absent when the group has never committed a message number
+	// for the topic.
+	ReadFrom             *MsgNumber `protobuf:"bytes,1,opt,name=read_from,json=readFrom,proto3" json:"read_from,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
+	XXX_unrecognized     []byte     `json:"-"`
+	XXX_sizecache        int32      `json:"-"`
+}
+
+func (m *FetchOffsetResponse) Reset()         { *m = FetchOffsetResponse{} }
+func (m *FetchOffsetResponse) String() string { return proto.CompactTextString(m) }
+func (*FetchOffsetResponse) ProtoMessage()    {}
+func (*FetchOffsetResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{24}
+}
+func (m *FetchOffsetResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FetchOffsetResponse.Unmarshal(m, b)
+}
+func (m *FetchOffsetResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FetchOffsetResponse.Marshal(b, m, deterministic)
+}
+func (dst *FetchOffsetResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FetchOffsetResponse.Merge(dst, src)
+}
+func (m *FetchOffsetResponse) XXX_Size() int {
+	return xxx_messageInfo_FetchOffsetResponse.Size(m)
+}
+func (m *FetchOffsetResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_FetchOffsetResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FetchOffsetResponse proto.InternalMessageInfo
+
+func (m *FetchOffsetResponse) GetReadFrom() *MsgNumber {
+	if m != nil {
+		return m.ReadFrom
+	}
+	return nil
+}
+
+type CreateTopicRequest struct {
+	Topic string `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
+	// num_partitions defaults to 1 when not specified.
+	NumPartitions        uint32   `protobuf:"varint,2,opt,name=num_partitions,json=numPartitions,proto3" json:"num_partitions,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CreateTopicRequest) Reset()         { *m = CreateTopicRequest{} }
+func (m *CreateTopicRequest) String() string { return proto.CompactTextString(m) }
+func (*CreateTopicRequest) ProtoMessage()    {}
+func (*CreateTopicRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{25}
+}
+func (m *CreateTopicRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CreateTopicRequest.Unmarshal(m, b)
+}
+func (m *CreateTopicRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CreateTopicRequest.Marshal(b, m, deterministic)
+}
+func (dst *CreateTopicRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CreateTopicRequest.Merge(dst, src)
+}
+func (m *CreateTopicRequest) XXX_Size() int {
+	return xxx_messageInfo_CreateTopicRequest.Size(m)
+}
+func (m *CreateTopicRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_CreateTopicRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CreateTopicRequest proto.InternalMessageInfo
+
+func (m *CreateTopicRequest) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+func (m *CreateTopicRequest) GetNumPartitions() uint32 {
+	if m != nil {
+		return m.NumPartitions
+	}
+	return 0
+}
+
+type DescribeTopicRequest struct {
+	Topic                string   `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
+	Partition            uint32   `protobuf:"varint,2,opt,name=partition,proto3" json:"partition,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DescribeTopicRequest) Reset()         { *m = DescribeTopicRequest{} }
+func (m *DescribeTopicRequest) String() string { return proto.CompactTextString(m) }
+func (*DescribeTopicRequest) ProtoMessage()    {}
+func (*DescribeTopicRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{26}
+}
+func (m *DescribeTopicRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DescribeTopicRequest.Unmarshal(m, b)
+}
+func (m *DescribeTopicRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DescribeTopicRequest.Marshal(b, m, deterministic)
+}
+func (dst *DescribeTopicRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DescribeTopicRequest.Merge(dst, src)
+}
+func (m *DescribeTopicRequest) XXX_Size() int {
+	return xxx_messageInfo_DescribeTopicRequest.Size(m)
+}
+func (m *DescribeTopicRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_DescribeTopicRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DescribeTopicRequest proto.InternalMessageInfo
+
+func (m *DescribeTopicRequest) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+func (m *DescribeTopicRequest) GetPartition() uint32 {
+	if m != nil {
+		return m.Partition
+	}
+	return 0
+}
+
+type TopicList struct {
+	// topics is in alphabetical order.
+	Topics               []string `protobuf:"bytes,1,rep,name=topics,proto3" json:"topics,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TopicList) Reset()         { *m = TopicList{} }
+func (m *TopicList) String() string { return proto.CompactTextString(m) }
+func (*TopicList) ProtoMessage()    {}
+func (*TopicList) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{27}
+}
+func (m *TopicList) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TopicList.Unmarshal(m, b)
+}
+func (m *TopicList) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TopicList.Marshal(b, m, deterministic)
+}
+func (dst *TopicList) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TopicList.Merge(dst, src)
+}
+func (m *TopicList) XXX_Size() int {
+	return xxx_messageInfo_TopicList.Size(m)
+}
+func (m *TopicList) XXX_DiscardUnknown() {
+	xxx_messageInfo_TopicList.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TopicList proto.InternalMessageInfo
+
+func (m *TopicList) GetTopics() []string {
+	if m != nil {
+		return m.Topics
+	}
+	return nil
+}
+
+// TopicDescription summarises the messages currently held for one partition
+// of a topic. The oldest and newest fields are absent when it holds none.
+type TopicDescription struct {
+	OldestMsgNumber *MsgNumber           `protobuf:"bytes,1,opt,name=oldest_msg_number,json=oldestMsgNumber,proto3" json:"oldest_msg_number,omitempty"`
+	NewestMsgNumber *MsgNumber           `protobuf:"bytes,2,opt,name=newest_msg_number,json=newestMsgNumber,proto3" json:"newest_msg_number,omitempty"`
+	OldestCreated   *timestamp.Timestamp `protobuf:"bytes,3,opt,name=oldest_created,json=oldestCreated,proto3" json:"oldest_created,omitempty"`
+	NewestCreated   *timestamp.Timestamp `protobuf:"bytes,4,opt,name=newest_created,json=newestCreated,proto3" json:"newest_created,omitempty"`
+	NumMessages     uint32               `protobuf:"varint,5,opt,name=num_messages,json=numMessages,proto3" json:"num_messages,omitempty"`
+	NumBytes        uint64               `protobuf:"varint,6,opt,name=num_bytes,json=numBytes,proto3" json:"num_bytes,omitempty"`
+	// num_segments is the number of files the messages are stored in, for
+	// backends that use files.
+	NumSegments          uint32           `protobuf:"varint,7,opt,name=num_segments,json=numSegments,proto3" json:"num_segments,omitempty"`
+	Retention            *RetentionPolicy `protobuf:"bytes,8,opt,name=retention,proto3" json:"retention,omitempty"`
+	NumPartitions        uint32           `protobuf:"varint,9,opt,name=num_partitions,json=numPartitions,proto3" json:"num_partitions,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}         `json:"-"`
+	XXX_unrecognized     []byte           `json:"-"`
+	XXX_sizecache        int32            `json:"-"`
+}
+
+func (m *TopicDescription) Reset()         { *m = TopicDescription{} }
+func (m *TopicDescription) String() string { return proto.CompactTextString(m) }
+func (*TopicDescription) ProtoMessage()    {}
+func (*TopicDescription) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{28}
+}
+func (m *TopicDescription) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TopicDescription.Unmarshal(m, b)
+}
+func (m *TopicDescription) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TopicDescription.Marshal(b, m, deterministic)
+}
+func (dst *TopicDescription) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TopicDescription.Merge(dst, src)
+}
+func (m *TopicDescription) XXX_Size() int {
+	return xxx_messageInfo_TopicDescription.Size(m)
+}
+func (m *TopicDescription) XXX_DiscardUnknown() {
+	xxx_messageInfo_TopicDescription.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TopicDescription proto.InternalMessageInfo
+
+func (m *TopicDescription) GetOldestMsgNumber() *MsgNumber {
+	if m != nil {
+		return m.OldestMsgNumber
+	}
+	return nil
+}
+
+func (m *TopicDescription) GetNewestMsgNumber() *MsgNumber {
+	if m != nil {
+		return m.NewestMsgNumber
+	}
+	return nil
+}
+
+func (m *TopicDescription) GetOldestCreated() *timestamp.Timestamp {
+	if m != nil {
+		return m.OldestCreated
+	}
+	return nil
+}
+
+func (m *TopicDescription) GetNewestCreated() *timestamp.Timestamp {
+	if m != nil {
+		return m.NewestCreated
+	}
+	return nil
+}
+
+func (m *TopicDescription) GetNumMessages() uint32 {
+	if m != nil {
+		return m.NumMessages
+	}
+	return 0
+}
+
+func (m *TopicDescription) GetNumBytes() uint64 {
+	if m != nil {
+		return m.NumBytes
+	}
+	return 0
+}
+
+func (m *TopicDescription) GetNumSegments() uint32 {
+	if m != nil {
+		return m.NumSegments
+	}
+	return 0
+}
+
+func (m *TopicDescription) GetRetention() *RetentionPolicy {
+	if m != nil {
+		return m.Retention
+	}
+	return nil
+}
+
+func (m *TopicDescription) GetNumPartitions() uint32 {
+	if m != nil {
+		return m.NumPartitions
+	}
+	return 0
+}
+
+// RetentionPolicy governs how long a topic's messages are kept for. Messages
+// are removed when they are older than max_age_ms, or when they are the
+// oldest messages and keeping them would take the topic beyond max_messages
+// messages, or max_bytes bytes of messages. Limits of zero do not apply;
+// except for max_age_ms, when zero means the server's default retention time
+// applies. When infinite is set, the topic's messages are never removed on
+// account of these limits. When compact is set, the topic is compacted: only
+// the newest message with each key is kept, and a message with a key and an
+// empty payload (a tombstone) deletes its key. Messages keep their numbers.
+type RetentionPolicy struct {
+	MaxAgeMs             uint64   `protobuf:"varint,1,opt,name=max_age_ms,json=maxAgeMs,proto3" json:"max_age_ms,omitempty"`
+	MaxBytes             uint64   `protobuf:"varint,2,opt,name=max_bytes,json=maxBytes,proto3" json:"max_bytes,omitempty"`
+	MaxMessages          uint32   `protobuf:"varint,3,opt,name=max_messages,json=maxMessages,proto3" json:"max_messages,omitempty"`
+	Infinite             bool     `protobuf:"varint,4,opt,name=infinite,proto3" json:"infinite,omitempty"`
+	Compact              bool     `protobuf:"varint,5,opt,name=compact,proto3" json:"compact,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RetentionPolicy) Reset()         { *m = RetentionPolicy{} }
+func (m *RetentionPolicy) String() string { return proto.CompactTextString(m) }
+func (*RetentionPolicy) ProtoMessage()    {}
+func (*RetentionPolicy) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{29}
+}
+func (m *RetentionPolicy) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RetentionPolicy.Unmarshal(m, b)
+}
+func (m *RetentionPolicy) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RetentionPolicy.Marshal(b, m, deterministic)
+}
+func (dst *RetentionPolicy) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RetentionPolicy.Merge(dst, src)
+}
+func (m *RetentionPolicy) XXX_Size() int {
+	return xxx_messageInfo_RetentionPolicy.Size(m)
+}
+func (m *RetentionPolicy) XXX_DiscardUnknown() {
+	xxx_messageInfo_RetentionPolicy.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RetentionPolicy proto.InternalMessageInfo
+
+func (m *RetentionPolicy) GetMaxAgeMs() uint64 {
+	if m != nil {
+		return m.MaxAgeMs
+	}
+	return 0
+}
+
+func (m *RetentionPolicy) GetMaxBytes() uint64 {
+	if m != nil {
+		return m.MaxBytes
+	}
+	return 0
+}
+
+func (m *RetentionPolicy) GetMaxMessages() uint32 {
+	if m != nil {
+		return m.MaxMessages
+	}
+	return 0
+}
+
+func (m *RetentionPolicy) GetInfinite() bool {
+	if m != nil {
+		return m.Infinite
+	}
+	return false
+}
+
+func (m *RetentionPolicy) GetCompact() bool {
+	if m != nil {
+		return m.Compact
+	}
+	return false
+}
+
+type SetRetentionPolicyRequest struct {
+	Topic                string           `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
+	Policy               *RetentionPolicy `protobuf:"bytes,2,opt,name=policy,proto3" json:"policy,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}         `json:"-"`
+	XXX_unrecognized     []byte           `json:"-"`
+	XXX_sizecache        int32            `json:"-"`
+}
+
+func (m *SetRetentionPolicyRequest) Reset()         { *m = SetRetentionPolicyRequest{} }
+func (m *SetRetentionPolicyRequest) String() string { return proto.CompactTextString(m) }
+func (*SetRetentionPolicyRequest) ProtoMessage()    {}
+func (*SetRetentionPolicyRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_minikafka_bba3362920ca5d92, []int{30}
+}
+func (m *SetRetentionPolicyRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SetRetentionPolicyRequest.Unmarshal(m, b)
+}
+func (m *SetRetentionPolicyRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SetRetentionPolicyRequest.Marshal(b, m, deterministic)
+}
+func (dst *SetRetentionPolicyRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SetRetentionPolicyRequest.Merge(dst, src)
+}
+func (m *SetRetentionPolicyRequest) XXX_Size() int {
+	return xxx_messageInfo_SetRetentionPolicyRequest.Size(m)
+}
+func (m *SetRetentionPolicyRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SetRetentionPolicyRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SetRetentionPolicyRequest proto.InternalMessageInfo
+
+func (m *SetRetentionPolicyRequest) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+func (m *SetRetentionPolicyRequest) GetPolicy() *RetentionPolicy {
+	if m != nil {
+		return m.Policy
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*Empty)(nil), "protocol.Empty")
+	proto.RegisterType((*Topic)(nil), "protocol.Topic")
+	proto.RegisterType((*Payload)(nil), "protocol.Payload")
+	proto.RegisterMapType((map[string][]byte)(nil), "protocol.Payload.HeadersEntry")
+	proto.RegisterType((*Partition)(nil), "protocol.Partition")
+	proto.RegisterType((*ProduceRequest)(nil), "protocol.ProduceRequest")
+	proto.RegisterType((*UnexpectedNext)(nil), "protocol.UnexpectedNext")
+	proto.RegisterType((*Producer)(nil), "protocol.Producer")
+	proto.RegisterType((*ProduceBatchRequest)(nil), "protocol.ProduceBatchRequest")
+	proto.RegisterType((*ProduceTransactionRequest)(nil), "protocol.ProduceTransactionRequest")
+	proto.RegisterType((*ProduceTransactionResponse)(nil), "protocol.ProduceTransactionResponse")
+	proto.RegisterType((*ProduceBatchResponse)(nil), "protocol.ProduceBatchResponse")
+	proto.RegisterType((*ProduceResponse)(nil), "protocol.ProduceResponse")
+	proto.RegisterType((*PartitionCount)(nil), "protocol.PartitionCount")
+	proto.RegisterType((*MsgNumber)(nil), "protocol.MsgNumber")
+	proto.RegisterType((*PollRequest)(nil), "protocol.PollRequest")
+	proto.RegisterType((*PollResponse)(nil), "protocol.PollResponse")
+	proto.RegisterType((*AvailableRange)(nil), "protocol.AvailableRange")
+	proto.RegisterType((*SubscribeRequest)(nil), "protocol.SubscribeRequest")
+	proto.RegisterType((*Message)(nil), "protocol.Message")
+	proto.RegisterType((*CommitOffsetRequest)(nil), "protocol.CommitOffsetRequest")
+	proto.RegisterType((*FetchOffsetRequest)(nil), "protocol.FetchOffsetRequest")
+	proto.RegisterType((*PartitionOffsets)(nil), "protocol.PartitionOffsets")
+	proto.RegisterType((*ListOffsetsResponse)(nil), "protocol.ListOffsetsResponse")
+	proto.RegisterType((*OffsetForTimeRequest)(nil), "protocol.OffsetForTimeRequest")
+	proto.RegisterType((*FetchOffsetResponse)(nil), "protocol.FetchOffsetResponse")
+	proto.RegisterType((*CreateTopicRequest)(nil), "protocol.CreateTopicRequest")
+	proto.RegisterType((*DescribeTopicRequest)(nil), "protocol.DescribeTopicRequest")
+	proto.RegisterType((*TopicList)(nil), "protocol.TopicList")
+	proto.RegisterType((*TopicDescription)(nil), "protocol.TopicDescription")
+	proto.RegisterType((*RetentionPolicy)(nil), "protocol.RetentionPolicy")
+	proto.RegisterType((*SetRetentionPolicyRequest)(nil), "protocol.SetRetentionPolicyRequest")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// MiniKafkaClient is the client API for MiniKafka service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type MiniKafkaClient interface {
+	// Produce returns the message number assigned to the stored message, and
+	// the partition it was stored in.
+	Produce(ctx context.Context, in *ProduceRequest, opts ...grpc.CallOption) (*ProduceResponse, error)
+	// ProduceBatch stores many messages in one partition of a topic, all or
+	// nothing, and returns the range of message numbers assigned to them.
+	ProduceBatch(ctx context.Context, in *ProduceBatchRequest, opts ...grpc.CallOption) (*ProduceBatchResponse, error)
+	// ProduceStream is for producers that send batches continuously. Each
+	// request is handled as ProduceBatch would, one at a time and in order,
+	// and acknowledged by the response at the same position in the response
+	// stream. The stream ends, with the error, at the first request that
+	// fails. The server reads the next request only once it has stored the
+	// last, so a slow backing store holds up the stream, and gRPC flow control
+	// in turn holds up the producer.
+	ProduceStream(ctx context.Context, opts ...grpc.CallOption) (MiniKafka_ProduceStreamClient, error)
+	// ProduceTransaction stores several batches, which may be bound for
+	// different topics, all or nothing. None of the messages is visible to
+	// consumers until all are stored. The batches' partitions are chosen as
+	// for ProduceBatch, but they cannot be sequenced, or conditional.
+	ProduceTransaction(ctx context.Context, in *ProduceTransactionRequest, opts ...grpc.CallOption) (*ProduceTransactionResponse, error)
+	// Poll, and Subscribe, fail with the OUT_OF_RANGE status code when the
+	// read-from message number lies outside the range of messages available.
+	// Either because the messages from there on have expired, or because it
+	// lies beyond the next message to be stored. The status then carries an
+	// AvailableRange as a detail.
+	Poll(ctx context.Context, in *PollRequest, opts ...grpc.CallOption) (*PollResponse, error)
+	// Subscribe streams the topic's messages from the requested message number
+	// onwards, and then keeps streaming new messages as they are stored.
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (MiniKafka_SubscribeClient, error)
+	// CommitOffset records the message number from which a consumer group
+	// should resume consuming a topic.
+	CommitOffset(ctx context.Context, in *CommitOffsetRequest, opts ...grpc.CallOption) (*Empty, error)
+	// FetchOffset provides the message number most recently committed by a
+	// consumer group for a topic.
+	FetchOffset(ctx context.Context, in *FetchOffsetRequest, opts ...grpc.CallOption) (*FetchOffsetResponse, error)
+	// ListOffsets provides the range of messages available in each of a
+	// topic's partitions.
+	ListOffsets(ctx context.Context, in *Topic, opts ...grpc.CallOption) (*ListOffsetsResponse, error)
+	// OffsetForTime provides the number of the first message in a partition
+	// that was stored at or after the given time. When every message was
+	// stored earlier, it is the number the next message stored will get.
+	OffsetForTime(ctx context.Context, in *OffsetForTimeRequest, opts ...grpc.CallOption) (*MsgNumber, error)
+	// NumPartitions provides the number of partitions a topic has. (Topics
+	// that do not exist yet have one).
+	NumPartitions(ctx context.Context, in *Topic, opts ...grpc.CallOption) (*PartitionCount, error)
+}
+
+type miniKafkaClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewMiniKafkaClient(cc *grpc.ClientConn) MiniKafkaClient {
+	return &miniKafkaClient{cc}
+}
+
+func (c *miniKafkaClient) Produce(ctx context.Context, in *ProduceRequest, opts ...grpc.CallOption) (*ProduceResponse, error) {
+	out := new(ProduceResponse)
+	err := c.cc.Invoke(ctx, "/protocol.MiniKafka/Produce", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *miniKafkaClient) ProduceBatch(ctx context.Context, in *ProduceBatchRequest, opts ...grpc.CallOption) (*ProduceBatchResponse, error) {
+	out := new(ProduceBatchResponse)
+	err := c.cc.Invoke(ctx, "/protocol.MiniKafka/ProduceBatch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *miniKafkaClient) ProduceStream(ctx context.Context, opts ...grpc.CallOption) (MiniKafka_ProduceStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_MiniKafka_serviceDesc.Streams[0], "/protocol.MiniKafka/ProduceStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &miniKafkaProduceStreamClient{stream}
+	return x, nil
+}
+
+type MiniKafka_ProduceStreamClient interface {
+	Send(*ProduceBatchRequest) error
+	Recv() (*ProduceBatchResponse, error)
+	grpc.ClientStream
+}
+
+type miniKafkaProduceStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *miniKafkaProduceStreamClient) Send(m *ProduceBatchRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *miniKafkaProduceStreamClient) Recv() (*ProduceBatchResponse, error) {
+	m := new(ProduceBatchResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *miniKafkaClient) ProduceTransaction(ctx context.Context, in *ProduceTransactionRequest, opts ...grpc.CallOption) (*ProduceTransactionResponse, error) {
+	out := new(ProduceTransactionResponse)
+	err := c.cc.Invoke(ctx, "/protocol.MiniKafka/ProduceTransaction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *miniKafkaClient) Poll(ctx context.Context, in *PollRequest, opts ...grpc.CallOption) (*PollResponse, error) {
+	out := new(PollResponse)
+	err := c.cc.Invoke(ctx, "/protocol.MiniKafka/Poll", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *miniKafkaClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (MiniKafka_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_MiniKafka_serviceDesc.Streams[1], "/protocol.MiniKafka/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &miniKafkaSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type MiniKafka_SubscribeClient interface {
+	Recv() (*Message, error)
+	grpc.ClientStream
+}
+
+type miniKafkaSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *miniKafkaSubscribeClient) Recv() (*Message, error) {
+	m := new(Message)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *miniKafkaClient) CommitOffset(ctx context.Context, in *CommitOffsetRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/protocol.MiniKafka/CommitOffset", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *miniKafkaClient) FetchOffset(ctx context.Context, in *FetchOffsetRequest, opts ...grpc.CallOption) (*FetchOffsetResponse, error) {
+	out := new(FetchOffsetResponse)
+	err := c.cc.Invoke(ctx, "/protocol.MiniKafka/FetchOffset", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *miniKafkaClient) ListOffsets(ctx context.Context, in *Topic, opts ...grpc.CallOption) (*ListOffsetsResponse, error) {
+	out := new(ListOffsetsResponse)
+	err := c.cc.Invoke(ctx, "/protocol.MiniKafka/ListOffsets", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *miniKafkaClient) OffsetForTime(ctx context.Context, in *OffsetForTimeRequest, opts ...grpc.CallOption) (*MsgNumber, error) {
+	out := new(MsgNumber)
+	err := c.cc.Invoke(ctx, "/protocol.MiniKafka/OffsetForTime", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *miniKafkaClient) NumPartitions(ctx context.Context, in *Topic, opts ...grpc.CallOption) (*PartitionCount, error) {
+	out := new(PartitionCount)
+	err := c.cc.Invoke(ctx, "/protocol.MiniKafka/NumPartitions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MiniKafkaServer is the server API for MiniKafka service.
+type MiniKafkaServer interface {
+	// Produce returns the message number assigned to the stored message, and
+	// the partition it was stored in.
+	Produce(context.Context, *ProduceRequest) (*ProduceResponse, error)
+	// ProduceBatch stores many messages in one partition of a topic, all or
+	// nothing, and returns the range of message numbers assigned to them.
+	ProduceBatch(context.Context, *ProduceBatchRequest) (*ProduceBatchResponse, error)
+	// ProduceStream is for producers that send batches continuously. Each
+	// request is handled as ProduceBatch would, one at a time and in order,
+	// and acknowledged by the response at the same position in the response
+	// stream. The stream ends, with the error, at the first request that
+	// fails. The server reads the next request only once it has stored the
+	// last, so a slow backing store holds up the stream, and gRPC flow control
+	// in turn holds up the producer.
+	ProduceStream(MiniKafka_ProduceStreamServer) error
+	// ProduceTransaction stores several batches, which may be bound for
+	// different topics, all or nothing. None of the messages is visible to
+	// consumers until all are stored. The batches' partitions are chosen as
+	// for ProduceBatch, but they cannot be sequenced, or conditional.
+	ProduceTransaction(context.Context, *ProduceTransactionRequest) (*ProduceTransactionResponse, error)
+	// Poll, and Subscribe, fail with the OUT_OF_RANGE status code when the
+	// read-from message number lies outside the range of messages available.
+	// Either because the messages from there on have expired, or because it
+	// lies beyond the next message to be stored. The status then carries an
+	// AvailableRange as a detail.
+	Poll(context.Context, *PollRequest) (*PollResponse, error)
+	// Subscribe streams the topic's messages from the requested message number
+	// onwards, and then keeps streaming new messages as they are stored.
+	Subscribe(*SubscribeRequest, MiniKafka_SubscribeServer) error
+	// CommitOffset records the message number from which a consumer group
+	// should resume consuming a topic.
+	CommitOffset(context.Context, *CommitOffsetRequest) (*Empty, error)
+	// FetchOffset provides the message number most recently committed by a
+	// consumer group for a topic.
+	FetchOffset(context.Context, *FetchOffsetRequest) (*FetchOffsetResponse, error)
+	// ListOffsets provides the range of messages available in each of a
+	// topic's partitions.
+	ListOffsets(context.Context, *Topic) (*ListOffsetsResponse, error)
+	// OffsetForTime provides the number of the first message in a partition
+	// that was stored at or after the given time. When every message was
+	// stored earlier, it is the number the next message stored will get.
+	OffsetForTime(context.Context, *OffsetForTimeRequest) (*MsgNumber, error)
+	// NumPartitions provides the number of partitions a topic has. (Topics
+	// that do not exist yet have one).
+	NumPartitions(context.Context, *Topic) (*PartitionCount, error)
+}
+
+func RegisterMiniKafkaServer(s *grpc.Server, srv MiniKafkaServer) {
+	s.RegisterService(&_MiniKafka_serviceDesc, srv)
+}
+
+func _MiniKafka_Produce_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ProduceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MiniKafkaServer).Produce(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protocol.MiniKafka/Produce",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MiniKafkaServer).Produce(ctx, req.(*ProduceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MiniKafka_ProduceBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ProduceBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MiniKafkaServer).ProduceBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protocol.MiniKafka/ProduceBatch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MiniKafkaServer).ProduceBatch(ctx, req.(*ProduceBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MiniKafka_ProduceStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MiniKafkaServer).ProduceStream(&miniKafkaProduceStreamServer{stream})
+}
+
+type MiniKafka_ProduceStreamServer interface {
+	Send(*ProduceBatchResponse) error
+	Recv() (*ProduceBatchRequest, error)
+	grpc.ServerStream
+}
+
+type miniKafkaProduceStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *miniKafkaProduceStreamServer) Send(m *ProduceBatchResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *miniKafkaProduceStreamServer) Recv() (*ProduceBatchRequest, error) {
+	m := new(ProduceBatchRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _MiniKafka_ProduceTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ProduceTransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MiniKafkaServer).ProduceTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protocol.MiniKafka/ProduceTransaction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MiniKafkaServer).ProduceTransaction(ctx, req.(*ProduceTransactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MiniKafka_Poll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PollRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
@@ -377,6 +2080,117 @@ func _MiniKafka_Poll_Handler(srv interface{}, ctx context.Context, dec func(inte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _MiniKafka_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MiniKafkaServer).Subscribe(m, &miniKafkaSubscribeServer{stream})
+}
+
+type MiniKafka_SubscribeServer interface {
+	Send(*Message) error
+	grpc.ServerStream
+}
+
+type miniKafkaSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *miniKafkaSubscribeServer) Send(m *Message) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _MiniKafka_CommitOffset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CommitOffsetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MiniKafkaServer).CommitOffset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protocol.MiniKafka/CommitOffset",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MiniKafkaServer).CommitOffset(ctx, req.(*CommitOffsetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MiniKafka_FetchOffset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FetchOffsetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MiniKafkaServer).FetchOffset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protocol.MiniKafka/FetchOffset",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MiniKafkaServer).FetchOffset(ctx, req.(*FetchOffsetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MiniKafka_ListOffsets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Topic)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MiniKafkaServer).ListOffsets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protocol.MiniKafka/ListOffsets",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MiniKafkaServer).ListOffsets(ctx, req.(*Topic))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MiniKafka_OffsetForTime_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OffsetForTimeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MiniKafkaServer).OffsetForTime(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protocol.MiniKafka/OffsetForTime",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MiniKafkaServer).OffsetForTime(ctx, req.(*OffsetForTimeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MiniKafka_NumPartitions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Topic)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MiniKafkaServer).NumPartitions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protocol.MiniKafka/NumPartitions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MiniKafkaServer).NumPartitions(ctx, req.(*Topic))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _MiniKafka_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "protocol.MiniKafka",
 	HandlerType: (*MiniKafkaServer)(nil),
@@ -385,37 +2199,360 @@ var _MiniKafka_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Produce",
 			Handler:    _MiniKafka_Produce_Handler,
 		},
+		{
+			MethodName: "ProduceBatch",
+			Handler:    _MiniKafka_ProduceBatch_Handler,
+		},
+		{
+			MethodName: "ProduceTransaction",
+			Handler:    _MiniKafka_ProduceTransaction_Handler,
+		},
 		{
 			MethodName: "Poll",
 			Handler:    _MiniKafka_Poll_Handler,
 		},
+		{
+			MethodName: "CommitOffset",
+			Handler:    _MiniKafka_CommitOffset_Handler,
+		},
+		{
+			MethodName: "FetchOffset",
+			Handler:    _MiniKafka_FetchOffset_Handler,
+		},
+		{
+			MethodName: "ListOffsets",
+			Handler:    _MiniKafka_ListOffsets_Handler,
+		},
+		{
+			MethodName: "OffsetForTime",
+			Handler:    _MiniKafka_OffsetForTime_Handler,
+		},
+		{
+			MethodName: "NumPartitions",
+			Handler:    _MiniKafka_NumPartitions_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ProduceStream",
+			Handler:       _MiniKafka_ProduceStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Subscribe",
+			Handler:       _MiniKafka_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "minikafka.proto",
+}
+
+// MiniKafkaAdminClient is the client API for MiniKafkaAdmin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type MiniKafkaAdminClient interface {
+	// CreateTopic fails if the topic already exists.
+	CreateTopic(ctx context.Context, in *CreateTopicRequest, opts ...grpc.CallOption) (*Empty, error)
+	// DeleteTopic removes the topic along with all its messages, and the
+	// message numbers committed for it by consumer groups.
+	DeleteTopic(ctx context.Context, in *Topic, opts ...grpc.CallOption) (*Empty, error)
+	ListTopics(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*TopicList, error)
+	DescribeTopic(ctx context.Context, in *DescribeTopicRequest, opts ...grpc.CallOption) (*TopicDescription, error)
+	// SetRetentionPolicy replaces the server's default retention time, for
+	// one topic, with the policy given.
+	SetRetentionPolicy(ctx context.Context, in *SetRetentionPolicyRequest, opts ...grpc.CallOption) (*Empty, error)
+}
+
+type miniKafkaAdminClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewMiniKafkaAdminClient(cc *grpc.ClientConn) MiniKafkaAdminClient {
+	return &miniKafkaAdminClient{cc}
+}
+
+func (c *miniKafkaAdminClient) CreateTopic(ctx context.Context, in *CreateTopicRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/protocol.MiniKafkaAdmin/CreateTopic", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *miniKafkaAdminClient) DeleteTopic(ctx context.Context, in *Topic, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/protocol.MiniKafkaAdmin/DeleteTopic", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *miniKafkaAdminClient) ListTopics(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*TopicList, error) {
+	out := new(TopicList)
+	err := c.cc.Invoke(ctx, "/protocol.MiniKafkaAdmin/ListTopics", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *miniKafkaAdminClient) DescribeTopic(ctx context.Context, in *DescribeTopicRequest, opts ...grpc.CallOption) (*TopicDescription, error) {
+	out := new(TopicDescription)
+	err := c.cc.Invoke(ctx, "/protocol.MiniKafkaAdmin/DescribeTopic", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *miniKafkaAdminClient) SetRetentionPolicy(ctx context.Context, in *SetRetentionPolicyRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/protocol.MiniKafkaAdmin/SetRetentionPolicy", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MiniKafkaAdminServer is the server API for MiniKafkaAdmin service.
+type MiniKafkaAdminServer interface {
+	// CreateTopic fails if the topic already exists.
+	CreateTopic(context.Context, *CreateTopicRequest) (*Empty, error)
+	// DeleteTopic removes the topic along with all its messages, and the
+	// message numbers committed for it by consumer groups.
+	DeleteTopic(context.Context, *Topic) (*Empty, error)
+	ListTopics(context.Context, *Empty) (*TopicList, error)
+	DescribeTopic(context.Context, *DescribeTopicRequest) (*TopicDescription, error)
+	// SetRetentionPolicy replaces the server's default retention time, for
+	// one topic, with the policy given.
+	SetRetentionPolicy(context.Context, *SetRetentionPolicyRequest) (*Empty, error)
+}
+
+func RegisterMiniKafkaAdminServer(s *grpc.Server, srv MiniKafkaAdminServer) {
+	s.RegisterService(&_MiniKafkaAdmin_serviceDesc, srv)
+}
+
+func _MiniKafkaAdmin_CreateTopic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateTopicRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MiniKafkaAdminServer).CreateTopic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protocol.MiniKafkaAdmin/CreateTopic",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MiniKafkaAdminServer).CreateTopic(ctx, req.(*CreateTopicRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MiniKafkaAdmin_DeleteTopic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Topic)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MiniKafkaAdminServer).DeleteTopic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protocol.MiniKafkaAdmin/DeleteTopic",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MiniKafkaAdminServer).DeleteTopic(ctx, req.(*Topic))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MiniKafkaAdmin_ListTopics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MiniKafkaAdminServer).ListTopics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protocol.MiniKafkaAdmin/ListTopics",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MiniKafkaAdminServer).ListTopics(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MiniKafkaAdmin_DescribeTopic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DescribeTopicRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MiniKafkaAdminServer).DescribeTopic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protocol.MiniKafkaAdmin/DescribeTopic",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MiniKafkaAdminServer).DescribeTopic(ctx, req.(*DescribeTopicRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MiniKafkaAdmin_SetRetentionPolicy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRetentionPolicyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MiniKafkaAdminServer).SetRetentionPolicy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protocol.MiniKafkaAdmin/SetRetentionPolicy",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MiniKafkaAdminServer).SetRetentionPolicy(ctx, req.(*SetRetentionPolicyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _MiniKafkaAdmin_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "protocol.MiniKafkaAdmin",
+	HandlerType: (*MiniKafkaAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateTopic",
+			Handler:    _MiniKafkaAdmin_CreateTopic_Handler,
+		},
+		{
+			MethodName: "DeleteTopic",
+			Handler:    _MiniKafkaAdmin_DeleteTopic_Handler,
+		},
+		{
+			MethodName: "ListTopics",
+			Handler:    _MiniKafkaAdmin_ListTopics_Handler,
+		},
+		{
+			MethodName: "DescribeTopic",
+			Handler:    _MiniKafkaAdmin_DescribeTopic_Handler,
+		},
+		{
+			MethodName: "SetRetentionPolicy",
+			Handler:    _MiniKafkaAdmin_SetRetentionPolicy_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "minikafka.proto",
 }
 
-func init() { proto.RegisterFile("minikafka.proto", fileDescriptor_minikafka_07f0578420994a20) }
-
-var fileDescriptor_minikafka_07f0578420994a20 = []byte{
-	// 310 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x91, 0x5f, 0x4b, 0xc3, 0x30,
-	0x14, 0xc5, 0x57, 0x75, 0x6e, 0xbd, 0xdb, 0x1c, 0x5e, 0xff, 0x50, 0x06, 0x83, 0x11, 0x11, 0x44,
-	0x71, 0xc8, 0x7c, 0x18, 0xf8, 0x01, 0x7c, 0x91, 0xc9, 0x08, 0xfa, 0x3c, 0xba, 0x35, 0x1b, 0x65,
-	0x4d, 0x52, 0x93, 0xd6, 0xe1, 0x9b, 0x1f, 0x5d, 0x9a, 0xa6, 0x6b, 0x95, 0x3e, 0xf8, 0xd4, 0xdc,
-	0xe6, 0xe4, 0xfc, 0xee, 0xb9, 0x17, 0xfa, 0x3c, 0x14, 0xe1, 0xd6, 0x5f, 0x6f, 0xfd, 0x71, 0xac,
-	0x64, 0x22, 0xb1, 0x6d, 0x3e, 0x2b, 0x19, 0x91, 0x21, 0x34, 0xdf, 0x64, 0x1c, 0xae, 0xf0, 0x1c,
-	0x9a, 0x49, 0x76, 0xf0, 0x9c, 0x91, 0x73, 0xe3, 0xd2, 0xbc, 0x20, 0x57, 0xd0, 0x9a, 0xfb, 0x5f,
-	0x91, 0xf4, 0x03, 0xf4, 0xa0, 0x15, 0xe7, 0x47, 0x23, 0xe9, 0xd2, 0xa2, 0x24, 0x01, 0x9c, 0xcc,
-	0x95, 0x0c, 0xd2, 0x15, 0xa3, 0xec, 0x23, 0x65, 0x3a, 0xc1, 0xeb, 0xaa, 0x59, 0x67, 0xd2, 0x1f,
-	0x17, 0xbc, 0xb1, 0x81, 0x59, 0x77, 0xbc, 0x2b, 0x2d, 0x0f, 0x8c, 0xf0, 0xb4, 0x14, 0x5a, 0x6c,
-	0x49, 0xb9, 0x05, 0x77, 0xa6, 0x37, 0xaf, 0x29, 0x5f, 0x32, 0x85, 0x43, 0x00, 0xae, 0x37, 0x0b,
-	0x61, 0x2a, 0x43, 0xe9, 0x51, 0x97, 0x17, 0xd7, 0xe4, 0x1d, 0x3a, 0x73, 0x19, 0x45, 0x45, 0x3b,
-	0xb5, 0xd9, 0xf0, 0x01, 0x5c, 0xc5, 0xfc, 0x60, 0xb1, 0x56, 0x92, 0x5b, 0xfe, 0x59, 0xc9, 0xdf,
-	0xb3, 0x68, 0x3b, 0x53, 0x3d, 0x2b, 0xc9, 0xc9, 0x27, 0x74, 0x73, 0x5b, 0x1d, 0x4b, 0xa1, 0x19,
-	0xde, 0x43, 0xdb, 0x76, 0xa7, 0x3d, 0x67, 0x74, 0x58, 0x1f, 0x60, 0x2f, 0xc1, 0x29, 0xf4, 0x04,
-	0xdb, 0x2d, 0xfe, 0x05, 0xed, 0x08, 0xb6, 0xa3, 0x96, 0x3b, 0xf9, 0x76, 0xc0, 0x9d, 0x85, 0x22,
-	0x7c, 0xc9, 0x56, 0x88, 0x4f, 0xd0, 0xb2, 0xe3, 0x46, 0xaf, 0x82, 0xfb, 0xb5, 0x81, 0x41, 0x9d,
-	0x29, 0x69, 0xe0, 0x14, 0x8e, 0xb2, 0x04, 0x78, 0x51, 0x79, 0x58, 0x0e, 0x6a, 0x70, 0xf9, 0xf7,
-	0x77, 0x1e, 0x94, 0x34, 0x96, 0xc7, 0xe6, 0xe2, 0xf1, 0x27, 0x00, 0x00, 0xff, 0xff, 0xeb, 0x77,
-	0xfc, 0x23, 0x4b, 0x02, 0x00, 0x00,
+func init() { proto.RegisterFile("minikafka.proto", fileDescriptor_minikafka_bba3362920ca5d92) }
+
+var fileDescriptor_minikafka_bba3362920ca5d92 = []byte{
+	// 1548 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x58, 0xdd, 0x72, 0xdb, 0x44,
+	0x14, 0xb6, 0x64, 0x27, 0xb6, 0x8e, 0xed, 0x24, 0xdd, 0x84, 0x8e, 0x22, 0x92, 0xfe, 0xa8, 0xc0,
+	0x04, 0x18, 0xdc, 0x36, 0x74, 0x48, 0xa6, 0xc3, 0xb4, 0x4d, 0x7f, 0xd2, 0x52, 0x9a, 0x34, 0x55,
+	0x02, 0xdc, 0xe1, 0x59, 0xdb, 0x6b, 0x47, 0x53, 0xfd, 0x18, 0x49, 0x6e, 0x1c, 0x1e, 0x80, 0xe1,
+	0x96, 0xe1, 0x19, 0x18, 0xee, 0x78, 0x15, 0xee, 0xb8, 0xe3, 0x35, 0xb8, 0x66, 0xb4, 0x3f, 0xd2,
+	0x5a, 0x92, 0xed, 0xb4, 0x70, 0x65, 0xed, 0xee, 0xb7, 0x47, 0xe7, 0x9c, 0x6f, 0xf7, 0x7c, 0x47,
+	0x86, 0x65, 0xd7, 0xf6, 0xec, 0xd7, 0xb8, 0xff, 0x1a, 0xb7, 0x86, 0x81, 0x1f, 0xf9, 0xa8, 0x46,
+	0x7f, 0xba, 0xbe, 0x63, 0x5c, 0x1d, 0xf8, 0xfe, 0xc0, 0x21, 0x37, 0xe9, 0x44, 0x67, 0xd4, 0xbf,
+	0x19, 0xd9, 0x2e, 0x09, 0x23, 0xec, 0x0e, 0x19, 0xd4, 0xac, 0xc2, 0xc2, 0x13, 0x77, 0x18, 0x9d,
+	0x9b, 0x9b, 0xb0, 0x70, 0xe2, 0x0f, 0xed, 0x2e, 0x5a, 0x83, 0x85, 0x28, 0x7e, 0xd0, 0x95, 0x6b,
+	0xca, 0x96, 0x66, 0xb1, 0x81, 0xf9, 0xa7, 0x0a, 0xd5, 0x23, 0x7c, 0xee, 0xf8, 0xb8, 0x87, 0x74,
+	0xa8, 0x0e, 0xd9, 0x23, 0xc5, 0x34, 0x2c, 0x31, 0x44, 0xbb, 0x50, 0x3d, 0x25, 0xb8, 0x47, 0x82,
+	0x50, 0x57, 0xaf, 0x95, 0xb7, 0xea, 0xdb, 0x57, 0x5a, 0xc2, 0x95, 0x16, 0xdf, 0xdd, 0x7a, 0xc6,
+	0x00, 0x4f, 0xbc, 0x28, 0x38, 0xb7, 0x04, 0x1c, 0xed, 0x82, 0x96, 0xb8, 0xa6, 0x97, 0xaf, 0x29,
+	0x5b, 0xf5, 0x6d, 0xa3, 0xc5, 0x9c, 0x6f, 0x09, 0xe7, 0x5b, 0x27, 0x02, 0x61, 0xa5, 0x60, 0xb4,
+	0x02, 0xe5, 0xd7, 0xe4, 0x5c, 0xaf, 0x50, 0x4f, 0xe2, 0x47, 0xb4, 0x0d, 0xe0, 0x86, 0x83, 0xb6,
+	0x37, 0x72, 0x3b, 0x24, 0xd0, 0x17, 0xa8, 0xb1, 0xd5, 0xd4, 0x91, 0x83, 0x70, 0x70, 0x48, 0x97,
+	0x2c, 0xcd, 0x15, 0x8f, 0xe8, 0x0e, 0x54, 0xbb, 0x01, 0xc1, 0x11, 0xe9, 0xe9, 0x8b, 0x73, 0xdf,
+	0x2e, 0xa0, 0xc6, 0x5d, 0x68, 0xc8, 0xe1, 0x08, 0x5f, 0x58, 0xe6, 0xa8, 0x2f, 0x6b, 0xb0, 0xf0,
+	0x06, 0x3b, 0x23, 0xa2, 0xab, 0xd4, 0x3f, 0x36, 0xb8, 0xab, 0xee, 0x2a, 0xe6, 0xc7, 0xa0, 0x1d,
+	0xe1, 0x20, 0xb2, 0x23, 0xdb, 0xf7, 0xd0, 0x06, 0x68, 0x43, 0x31, 0xa0, 0xdb, 0x9b, 0x56, 0x3a,
+	0x61, 0xfe, 0xaa, 0xc2, 0xd2, 0x51, 0xe0, 0xf7, 0x46, 0x5d, 0x62, 0x91, 0x1f, 0x46, 0x24, 0x8c,
+	0xd0, 0x87, 0x32, 0x4b, 0xf5, 0xed, 0xe5, 0x34, 0x3c, 0xca, 0x22, 0xa7, 0x0d, 0x7d, 0x9a, 0x52,
+	0xa5, 0x52, 0xe0, 0xa5, 0x1c, 0x21, 0x29, 0x7b, 0xdc, 0xfb, 0x72, 0x9a, 0xc9, 0xdb, 0xb2, 0x5b,
+	0x95, 0x6c, 0x22, 0x13, 0xf7, 0x25, 0x5f, 0x51, 0x0b, 0x6a, 0x43, 0xe6, 0xaa, 0x48, 0x3d, 0x92,
+	0x76, 0xf0, 0x15, 0x2b, 0xc1, 0xa0, 0x5d, 0x68, 0x92, 0xf1, 0x90, 0x74, 0x23, 0xd2, 0x6b, 0x7b,
+	0x64, 0x1c, 0xe9, 0x8b, 0xd9, 0xd7, 0xa4, 0x7c, 0x35, 0x04, 0xf2, 0x90, 0x8c, 0x23, 0xf3, 0x01,
+	0x2c, 0x7d, 0xe3, 0xc9, 0x33, 0xc8, 0x80, 0x9a, 0x18, 0xf3, 0x24, 0x26, 0x63, 0x84, 0xa0, 0x42,
+	0xcd, 0xab, 0x74, 0x9e, 0x3e, 0x9b, 0x4f, 0xa1, 0x26, 0x3c, 0x42, 0x57, 0xa1, 0x2e, 0x7c, 0x6a,
+	0xdb, 0x3d, 0x4e, 0x21, 0x88, 0xa9, 0xaf, 0x7a, 0xb1, 0xf1, 0x30, 0x4e, 0xbe, 0xd7, 0x65, 0x64,
+	0x56, 0xac, 0x64, 0x6c, 0xfe, 0xac, 0xc2, 0x2a, 0xb7, 0xf4, 0x10, 0x47, 0xdd, 0xd3, 0xb7, 0x64,
+	0xe9, 0x33, 0xa8, 0x71, 0x0e, 0xc4, 0xbd, 0x29, 0xa0, 0x29, 0x81, 0x4c, 0xb2, 0x52, 0x7e, 0x6b,
+	0x56, 0x2a, 0xef, 0xc2, 0xca, 0xc2, 0x45, 0x59, 0x39, 0x81, 0x75, 0x6e, 0xef, 0x24, 0xc0, 0x5e,
+	0x88, 0xbb, 0xd4, 0x15, 0x9e, 0x8f, 0x1d, 0xa8, 0x76, 0xe2, 0xfc, 0x90, 0x50, 0x57, 0x68, 0x9c,
+	0x9b, 0x39, 0x2f, 0xe4, 0xfc, 0x59, 0x02, 0x6d, 0x7e, 0x0b, 0x46, 0x91, 0xd5, 0x70, 0xe8, 0x7b,
+	0x21, 0x89, 0xcb, 0xce, 0xa4, 0xd9, 0x2b, 0xd3, 0xcc, 0xb2, 0x0d, 0xa9, 0xdd, 0x9f, 0x14, 0x58,
+	0x2b, 0x42, 0xa0, 0x2d, 0x58, 0xe9, 0xdb, 0x41, 0x18, 0xb5, 0xa5, 0x4a, 0xc2, 0x8e, 0xd4, 0x12,
+	0x9d, 0x4f, 0xc2, 0x47, 0x1f, 0xc1, 0xb2, 0x83, 0x27, 0x81, 0xec, 0x8c, 0x35, 0x1d, 0x2c, 0xe3,
+	0x36, 0xb2, 0xac, 0x4d, 0x5c, 0xf1, 0x43, 0x58, 0x4e, 0x6e, 0x38, 0x77, 0x61, 0x13, 0x20, 0xf7,
+	0x72, 0xcd, 0x2d, 0xb6, 0xa7, 0x66, 0xed, 0xed, 0xc0, 0x52, 0x72, 0x10, 0x1e, 0xf9, 0x23, 0x2f,
+	0x3e, 0x8b, 0x4b, 0xde, 0xc8, 0x6d, 0x27, 0x90, 0x90, 0x9b, 0x6c, 0x7a, 0x23, 0x37, 0x81, 0x86,
+	0xe6, 0x27, 0xa0, 0xa5, 0x3e, 0xcf, 0x76, 0xc1, 0xfc, 0x47, 0x81, 0xfa, 0x91, 0xef, 0x38, 0x82,
+	0xde, 0x42, 0xe9, 0x40, 0xb7, 0x40, 0x0b, 0x08, 0xee, 0xb5, 0xfb, 0x81, 0xef, 0xea, 0xea, 0xf4,
+	0x73, 0x54, 0x8b, 0x51, 0xfb, 0x81, 0xef, 0xa2, 0x2b, 0x50, 0x77, 0xf1, 0xb8, 0x7d, 0x86, 0xed,
+	0x38, 0xad, 0x22, 0x59, 0x2e, 0x1e, 0x7f, 0x87, 0xed, 0xe8, 0x20, 0x44, 0xd7, 0xa1, 0xe1, 0xda,
+	0x5e, 0xdb, 0x25, 0x61, 0x88, 0x07, 0x24, 0xa4, 0x27, 0xba, 0x69, 0xd5, 0x5d, 0xdb, 0x3b, 0xe0,
+	0x53, 0x14, 0x82, 0xc7, 0x29, 0x64, 0x81, 0x43, 0xf0, 0x38, 0x81, 0xbc, 0x0f, 0xb1, 0xc9, 0x76,
+	0xe7, 0x3c, 0x22, 0x21, 0xad, 0x3a, 0x4d, 0xab, 0xe6, 0xe2, 0xf1, 0xc3, 0x78, 0x3c, 0x99, 0xdd,
+	0x6a, 0x36, 0xbb, 0x7f, 0x28, 0xd0, 0x60, 0x81, 0x73, 0xae, 0xe4, 0x1b, 0xac, 0xcc, 0xbf, 0xc1,
+	0x3b, 0xd0, 0xf4, 0xc8, 0x59, 0xfb, 0x42, 0x69, 0xa9, 0x7b, 0xe4, 0xcc, 0x12, 0x99, 0xf9, 0x02,
+	0x34, 0xfc, 0x06, 0xdb, 0x0e, 0xee, 0x38, 0x84, 0x5f, 0x7d, 0x3d, 0xdd, 0xb4, 0x27, 0x96, 0x2c,
+	0xec, 0x0d, 0x88, 0x95, 0x42, 0xe3, 0x5a, 0x39, 0xb9, 0x48, 0x6b, 0x25, 0x0e, 0x1c, 0x9b, 0x84,
+	0x51, 0x52, 0x2b, 0xf9, 0xb8, 0xb0, 0x56, 0x8e, 0x61, 0xe5, 0x78, 0xd4, 0x09, 0xbb, 0x81, 0xdd,
+	0x21, 0xff, 0x37, 0xdf, 0xb3, 0xaf, 0xc6, 0x33, 0xa8, 0x72, 0xce, 0x64, 0x39, 0x53, 0xe6, 0xc9,
+	0xd9, 0xf3, 0x4a, 0x4d, 0x5d, 0x29, 0x5b, 0xd2, 0x01, 0x36, 0x7f, 0x51, 0x60, 0xf5, 0x91, 0xef,
+	0xba, 0x76, 0xf4, 0xb2, 0xdf, 0x0f, 0x49, 0x24, 0xc5, 0x31, 0x08, 0xfc, 0xd1, 0x50, 0xc4, 0x41,
+	0x07, 0x69, 0x74, 0xea, 0xd4, 0xe8, 0xca, 0x6f, 0x1d, 0x5d, 0x25, 0x1b, 0xdd, 0xf7, 0x80, 0xf6,
+	0x49, 0xd4, 0x3d, 0x7d, 0x77, 0x8f, 0x66, 0x67, 0xef, 0x14, 0x56, 0x92, 0xdb, 0xcd, 0xde, 0x11,
+	0xce, 0xee, 0x36, 0x26, 0xcf, 0x98, 0x7a, 0xf1, 0x33, 0xf6, 0x0a, 0x56, 0x5f, 0xd8, 0x21, 0x4f,
+	0x6d, 0x98, 0x5c, 0x8d, 0xbb, 0x00, 0x13, 0x35, 0xa7, 0x4c, 0x9b, 0xab, 0xbc, 0x5c, 0x89, 0x7d,
+	0x12, 0xda, 0xfc, 0x11, 0xd6, 0xd8, 0xf4, 0xbe, 0x1f, 0xc4, 0xed, 0xd7, 0xec, 0x83, 0x37, 0xb3,
+	0x22, 0xa2, 0x16, 0x54, 0xe2, 0xa6, 0xf1, 0x02, 0xcd, 0x25, 0xc5, 0x99, 0x4f, 0x61, 0x75, 0x82,
+	0x18, 0x1e, 0xce, 0x04, 0xff, 0xca, 0x05, 0xf8, 0x37, 0x5f, 0x01, 0x7a, 0x44, 0xfb, 0x45, 0xa6,
+	0xf9, 0x33, 0x43, 0xc8, 0x17, 0x69, 0xb5, 0xa8, 0x48, 0x3f, 0x87, 0xb5, 0xc7, 0x84, 0xdd, 0xc5,
+	0x0b, 0x18, 0x9d, 0xad, 0x14, 0x37, 0x40, 0xa3, 0x36, 0x62, 0xee, 0xd0, 0x65, 0x58, 0xa4, 0x7b,
+	0x18, 0x51, 0x9a, 0xc5, 0x47, 0xe6, 0xdf, 0x65, 0x58, 0xa1, 0x28, 0xf6, 0xda, 0x21, 0xcd, 0xe8,
+	0x7d, 0xb8, 0xe4, 0x3b, 0x3d, 0x92, 0x17, 0xc9, 0x29, 0x29, 0x59, 0x66, 0xe8, 0x64, 0x22, 0x36,
+	0xe0, 0x91, 0x33, 0x92, 0x17, 0xcf, 0x69, 0x06, 0x18, 0x3a, 0x35, 0xb0, 0x07, 0x4b, 0xdc, 0x03,
+	0xd1, 0xbc, 0xcf, 0x67, 0xb7, 0xc9, 0x76, 0x30, 0x4a, 0x7a, 0xb1, 0x09, 0xee, 0x83, 0x30, 0x51,
+	0x99, 0x6f, 0x82, 0xed, 0x10, 0x26, 0xae, 0x43, 0x23, 0x26, 0x2d, 0xab, 0x35, 0xde, 0xc8, 0x95,
+	0xb5, 0x26, 0x86, 0xa4, 0x5a, 0x53, 0xb1, 0x6a, 0xde, 0xc8, 0x65, 0x5a, 0xc3, 0xf7, 0x87, 0x64,
+	0xe0, 0x12, 0x2f, 0x0a, 0xf5, 0x6a, 0xb2, 0xff, 0x98, 0x4f, 0xa1, 0x9d, 0xf8, 0xd4, 0x45, 0xc4,
+	0xa3, 0x14, 0xd6, 0xa8, 0x83, 0xeb, 0x69, 0x86, 0x2c, 0xb1, 0x74, 0xe4, 0x3b, 0x76, 0xf7, 0xdc,
+	0x4a, 0xb1, 0x05, 0x07, 0x4a, 0x2b, 0x3a, 0x50, 0xbf, 0x29, 0xb0, 0x9c, 0xb1, 0x82, 0x36, 0x00,
+	0x62, 0x7d, 0xc4, 0x03, 0x12, 0x8b, 0xb0, 0xc2, 0x9c, 0x76, 0xf1, 0x78, 0x6f, 0x40, 0x0e, 0x32,
+	0xea, 0xa9, 0x26, 0x8b, 0x49, 0x44, 0x13, 0xea, 0x5b, 0xce, 0xab, 0xaf, 0x01, 0x35, 0xdb, 0xeb,
+	0xdb, 0x9e, 0x1d, 0x11, 0x9a, 0xf1, 0x9a, 0x95, 0x8c, 0xe3, 0x0f, 0xcc, 0xae, 0xef, 0x0e, 0x71,
+	0x97, 0xf5, 0x9d, 0x35, 0x4b, 0x0c, 0xcd, 0x1e, 0xac, 0x1f, 0x93, 0x28, 0xe3, 0xe9, 0xec, 0xd3,
+	0x7f, 0x1b, 0x16, 0x87, 0x14, 0xa6, 0xab, 0xf3, 0xf2, 0xc6, 0x81, 0xdb, 0xbf, 0x2f, 0x82, 0x76,
+	0x60, 0x7b, 0xf6, 0xd7, 0xf1, 0x37, 0x35, 0x7a, 0x00, 0x55, 0xde, 0x9a, 0x21, 0x3d, 0xd7, 0x57,
+	0xf2, 0x77, 0x1b, 0xeb, 0x05, 0x2b, 0xac, 0x62, 0x98, 0x25, 0xf4, 0x12, 0x1a, 0x72, 0x93, 0x89,
+	0x66, 0x77, 0xbd, 0xc6, 0x9c, 0xee, 0xd5, 0x2c, 0xa1, 0x13, 0x68, 0xf2, 0x95, 0xe3, 0x28, 0x20,
+	0xd8, 0xfd, 0xcf, 0x16, 0xb7, 0x94, 0x5b, 0x0a, 0xc2, 0x80, 0xf2, 0x4d, 0x36, 0xba, 0x91, 0xdb,
+	0x9b, 0x6f, 0xec, 0x8d, 0x0f, 0x66, 0x83, 0x12, 0xc7, 0x77, 0xa0, 0x12, 0xf7, 0x4d, 0xe8, 0x3d,
+	0x09, 0x9f, 0x36, 0x90, 0xc6, 0xe5, 0xec, 0x74, 0xb2, 0xf1, 0x1e, 0x68, 0x49, 0xfb, 0x81, 0x24,
+	0xf9, 0xc8, 0xf6, 0x24, 0x86, 0xd4, 0x11, 0xf0, 0xb3, 0x66, 0x96, 0x6e, 0x29, 0xe8, 0x01, 0x34,
+	0x64, 0xe5, 0x97, 0x13, 0x56, 0xd0, 0x11, 0x18, 0xd2, 0x97, 0x1a, 0xfb, 0x7b, 0xa4, 0x84, 0x5e,
+	0x40, 0x5d, 0xd2, 0x03, 0xb4, 0x91, 0x22, 0xf2, 0xfa, 0x6d, 0x6c, 0x4e, 0x59, 0x4d, 0xe2, 0xb9,
+	0x0f, 0x75, 0x49, 0x2c, 0x51, 0xf6, 0xcb, 0x50, 0x36, 0x50, 0x20, 0xaa, 0x66, 0x09, 0xed, 0x43,
+	0x73, 0x42, 0x1a, 0x91, 0xc4, 0x71, 0x91, 0x66, 0x1a, 0x45, 0x15, 0xd5, 0x2c, 0xa1, 0x2f, 0xa1,
+	0x79, 0x28, 0x97, 0x82, 0xbc, 0x2b, 0x7a, 0x81, 0x58, 0xd3, 0x4f, 0x0a, 0xb3, 0xb4, 0xfd, 0x97,
+	0x0a, 0x4b, 0xc9, 0x4d, 0xd9, 0xeb, 0xb9, 0xb6, 0x87, 0xee, 0x41, 0x5d, 0x92, 0x3b, 0x39, 0x4f,
+	0x79, 0x15, 0x2c, 0xca, 0xf3, 0x6d, 0xa8, 0x3f, 0x26, 0x0e, 0x11, 0xfb, 0x73, 0xee, 0x14, 0x6c,
+	0xb9, 0x03, 0x10, 0x27, 0x89, 0xae, 0x87, 0x28, 0x0b, 0x90, 0x23, 0x4f, 0x94, 0xce, 0x2c, 0xa1,
+	0x03, 0x68, 0x4e, 0x88, 0xa8, 0x9c, 0xc1, 0x22, 0x75, 0x35, 0x8c, 0x8c, 0x1d, 0x49, 0x0b, 0xe9,
+	0xf9, 0x40, 0xf9, 0xd2, 0x24, 0xdf, 0x9e, 0xa9, 0x85, 0xab, 0x20, 0xa4, 0xce, 0x22, 0x9d, 0xf9,
+	0xfc, 0xdf, 0x01, 0x00, 0x90, 0x96, 0xe9, 0x10, 0xdc, 0x13, 0x00, 0x00,
 }
@@ -0,0 +1,133 @@
+package svr
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+
+	pb "github.com/peterhoward42/minikafka/protocol"
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+)
+
+// This file holds the server's handler functions for the MiniKafkaAdmin
+// gRPC service, which is registered alongside the MiniKafka service.
+
+// CreateTopic is the server's handler function for the *CreateTopic* API
+// call.
+func (s *Server) CreateTopic(
+	ctx context.Context, req *pb.CreateTopicRequest) (*pb.Empty, error) {
+	err := validateTopicName(req.GetTopic())
+	if err != nil {
+		return nil, err
+	}
+	numPartitions := int(req.GetNumPartitions())
+	if numPartitions == 0 {
+		numPartitions = 1
+	}
+	err = s.store.CreateTopic(req.GetTopic(), numPartitions)
+	if err != nil {
+		return nil, fmt.Errorf("store.CreateTopic: %v", err)
+	}
+	return &pb.Empty{}, nil
+}
+
+// DeleteTopic is the server's handler function for the *DeleteTopic* API
+// call.
+func (s *Server) DeleteTopic(
+	ctx context.Context, req *pb.Topic) (*pb.Empty, error) {
+	err := validateTopicName(req.GetTopic())
+	if err != nil {
+		return nil, err
+	}
+	err = s.store.DeleteTopic(req.GetTopic())
+	if err != nil {
+		return nil, fmt.Errorf("store.DeleteTopic: %v", err)
+	}
+	return &pb.Empty{}, nil
+}
+
+// ListTopics is the server's handler function for the *ListTopics* API call.
+func (s *Server) ListTopics(
+	ctx context.Context, req *pb.Empty) (*pb.TopicList, error) {
+	topics, err := s.store.ListTopics()
+	if err != nil {
+		return nil, fmt.Errorf("store.ListTopics: %v", err)
+	}
+	return &pb.TopicList{Topics: topics}, nil
+}
+
+// DescribeTopic is the server's handler function for the *DescribeTopic* API
+// call. It describes one partition of the topic.
+func (s *Server) DescribeTopic(
+	ctx context.Context, req *pb.DescribeTopicRequest) (
+	*pb.TopicDescription, error) {
+	err := validateTopicName(req.GetTopic())
+	if err != nil {
+		return nil, err
+	}
+	description, err := s.store.DescribeTopic(
+		contract.PartitionLog(req.GetTopic(), int(req.GetPartition())))
+	if err != nil {
+		return nil, fmt.Errorf("store.DescribeTopic: %v", err)
+	}
+	resp := &pb.TopicDescription{
+		NumMessages:   uint32(description.NumMessages),
+		NumBytes:      uint64(description.NumBytes),
+		NumSegments:   uint32(description.NumSegments),
+		Retention:     makeRetentionPolicyMsg(description.Retention),
+		NumPartitions: uint32(description.NumPartitions)}
+	// Leave the oldest and newest fields absent when there are no messages.
+	if description.NumMessages == 0 {
+		return resp, nil
+	}
+	resp.OldestMsgNumber = &pb.MsgNumber{
+		MsgNumber: uint32(description.OldestMsgNumber)}
+	resp.NewestMsgNumber = &pb.MsgNumber{
+		MsgNumber: uint32(description.NewestMsgNumber)}
+	resp.OldestCreated, err = ptypes.TimestampProto(description.OldestCreated)
+	if err != nil {
+		return nil, fmt.Errorf("ptypes.TimestampProto: %v", err)
+	}
+	resp.NewestCreated, err = ptypes.TimestampProto(description.NewestCreated)
+	if err != nil {
+		return nil, fmt.Errorf("ptypes.TimestampProto: %v", err)
+	}
+	return resp, nil
+}
+
+// SetRetentionPolicy is the server's handler function for the
+// *SetRetentionPolicy* API call.
+func (s *Server) SetRetentionPolicy(
+	ctx context.Context, req *pb.SetRetentionPolicyRequest) (
+	*pb.Empty, error) {
+	err := validateTopicName(req.GetTopic())
+	if err != nil {
+		return nil, err
+	}
+	msg := req.GetPolicy()
+	policy := contract.RetentionPolicy{
+		MaxAge:      time.Duration(msg.GetMaxAgeMs()) * time.Millisecond,
+		MaxBytes:    int64(msg.GetMaxBytes()),
+		MaxMessages: int(msg.GetMaxMessages()),
+		Infinite:    msg.GetInfinite(),
+		Compact:     msg.GetCompact()}
+	err = s.store.SetRetentionPolicy(req.GetTopic(), policy)
+	if err != nil {
+		return nil, fmt.Errorf("store.SetRetentionPolicy: %v", err)
+	}
+	return &pb.Empty{}, nil
+}
+
+// makeRetentionPolicyMsg packages up a retention policy to suit a gRPC
+// response.
+func makeRetentionPolicyMsg(
+	policy contract.RetentionPolicy) *pb.RetentionPolicy {
+	return &pb.RetentionPolicy{
+		MaxAgeMs:    uint64(policy.MaxAge / time.Millisecond),
+		MaxBytes:    uint64(policy.MaxBytes),
+		MaxMessages: uint32(policy.MaxMessages),
+		Infinite:    policy.Infinite,
+		Compact:     policy.Compact}
+}
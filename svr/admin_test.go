@@ -0,0 +1,42 @@
+package svr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/peterhoward42/minikafka/protocol"
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/memstore"
+)
+
+func TestAdminRejectsPartitionLogs(t *testing.T) {
+	server := NewServer(memstore.NewMemStore())
+	ctx := context.Background()
+	_, err := server.CreateTopic(ctx,
+		&pb.CreateTopicRequest{Topic: "t", NumPartitions: 2})
+	assert.Nil(t, err)
+	partitionLog := contract.PartitionLog("t", 1)
+
+	_, err = server.CreateTopic(ctx,
+		&pb.CreateTopicRequest{Topic: partitionLog})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = server.DeleteTopic(ctx, &pb.Topic{Topic: partitionLog})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = server.DescribeTopic(ctx,
+		&pb.DescribeTopicRequest{Topic: partitionLog})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = server.SetRetentionPolicy(ctx, &pb.SetRetentionPolicyRequest{
+		Topic: partitionLog, Policy: &pb.RetentionPolicy{MaxMessages: 1}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// The topic, and its partitions, are as they were.
+	description, err := server.DescribeTopic(ctx,
+		&pb.DescribeTopicRequest{Topic: "t", Partition: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), description.GetNumPartitions())
+	assert.Equal(t, uint32(0), description.GetRetention().GetMaxMessages())
+}
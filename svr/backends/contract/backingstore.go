@@ -10,27 +10,169 @@ import (
 )
 
 // BackingStore is an interface that offers a core set of CRUD methods
-// on a backing store for messages.
+// on a backing store for messages. The *topic* parameter of the methods that
+// deal with messages, may also be the name of the log that holds a partition
+// of a topic. (See PartitionLog).
 type BackingStore interface {
 
 	// Store adds the given message to the sequence of Messages already
 	// held in the store for a Topic, and returns the message number thus
-	// asigned to it.
+	// asigned to it. The store records the time at which it stored the
+	// message, along with the message itself.
 	Store(topic string, message minikafka.Message) (
 		messageNumber int, err error)
 
+	// StoreBatch adds the given messages to a topic, in order, as Store
+	// does, and returns the range of message numbers assigned to them. The
+	// batch is all-or-nothing: either every message is stored, or, when an
+	// error is returned, none is. It is an error for the batch to be empty.
+	StoreBatch(topic string, messages []minikafka.Message) (
+		firstMsgNumber int, lastMsgNumber int, err error)
+
+	// StoreSequenced is like StoreBatch, but for producers that identify
+	// each request they make with a sequence number, so that they can
+	// retry requests safely. When the producer's request with the given
+	// sequence number is one of the most recent it has had stored in the
+	// topic, (See SequenceWindow), the messages are not stored again, and
+	// the message numbers they got the first time are returned instead.
+	// What the store remembers about producers' requests is held as
+	// durably as the messages.
+	StoreSequenced(topic string, producerID string, sequence uint64,
+		messages []minikafka.Message) (
+		firstMsgNumber int, lastMsgNumber int, err error)
+
+	// StoreBatchIfNext is like StoreSequenced, but stores the messages only
+	// when the first of them would get the message number *expectedNext*.
+	// Otherwise it stores nothing, and returns an UnexpectedNextError. The
+	// check and the storing are atomic, so this serves for optimistic
+	// concurrency control. A retry of a request already stored returns the
+	// original message numbers, rather than the error. An empty
+	// *producerID* means the request is not sequenced.
+	StoreBatchIfNext(topic string, expectedNext int, producerID string,
+		sequence uint64, messages []minikafka.Message) (
+		firstMsgNumber int, lastMsgNumber int, err error)
+
+	// StoreTransaction stores several batches of messages, each in its own
+	// topic, all or nothing: either every message in every batch is stored,
+	// or, when an error is returned, none is. None of them is visible to
+	// Poll until all have been stored, and a failure part way through
+	// (including the server stopping) leaves no trace of any. It returns
+	// the range of message numbers assigned to each batch, in the same
+	// order as the batches. It is an error for there to be no batches, or
+	// for any of them to be empty.
+	StoreTransaction(batches []TopicBatch) (ranges []MsgNumberRange,
+		err error)
+
 	// RemoveOldMessages invites the store to remove any messages in the 
     // store that were stored before the time specified. The store is allowed to
     // deploy some internal optimisation to **not** remove these messages at
     // this time.
+	// The time specified is a default, which applies only to topics whose
+	// retention policy does not specify a maximum age. The store must also
+	// apply the rest of each topic's retention policy. (See
+	// SetRetentionPolicy).
 	RemoveOldMessages(maxAge time.Time) error
 
+	// Compact invites the store to compact the topics whose retention
+	// policy asks for it. Compaction removes every message that has a key,
+	// other than the newest message with that key. Messages without a key
+	// are unaffected. A message with a key and an empty payload is a
+	// tombstone, which marks its key as deleted; tombstones themselves are
+	// removed once there is no newer message with their key, and they were
+	// stored before *tombstonesBefore*. The messages that remain keep their
+	// message numbers, so a topic's message numbers can have gaps once it
+	// has been compacted. Like RemoveOldMessages, the store is allowed to
+	// not compact some of the messages at this time; in particular the
+	// newest of them.
+	Compact(tombstonesBefore time.Time) error
+
+	// SetRetentionPolicy sets the retention policy for a topic, which
+	// RemoveOldMessages and Compact apply from then on. The policy must be stored
+	// persistently, along with the topic, and is reported by DescribeTopic.
+	// It is an error for the topic not to exist.
+	SetRetentionPolicy(topic string, policy RetentionPolicy) error
+
 	// Provide a list of all the messages held for this topic, whose message
 	// number is greater than or equal to the specified read-from message
 	// number. Returns the messages, and also the advised new read-from message
 	// number. (beyond those returned by this invocation).
-	Poll(topic string, readFrom int) (messages []minikafka.Message,
-		newReadFrom int, err error)
+	// The list is truncated to no more than *maxMessages*, and to no more than
+	// *maxBytes* in total, when these are non-zero. But the first message is
+	// always returned, even when it alone exceeds *maxBytes*, so that
+	// consumers can always make progress. The new read-from message number
+	// advised points just beyond the last message returned. The sizes counted
+	// against *maxBytes* are those of the messages as the store holds them,
+	// which may include some overhead beyond their Size().
+	// When the read-from message number lies outside the range of messages
+	// available (see CheckReadFrom), Poll returns an OutOfRangeError, without
+	// wrapping it, rather than quietly serving from somewhere else. When the
+	// topic does not exist, it returns a NoSuchTopicError, without wrapping
+	// it.
+	Poll(topic string, readFrom int, maxMessages int, maxBytes int) (
+		messages []minikafka.StoredMessage, newReadFrom int, err error)
+
+	// ListOffsets provides the range of messages available in each of a
+	// topic's partitions, in partition order. It is an error for the topic not
+	// to exist.
+	ListOffsets(topic string) (offsets []PartitionOffsets, err error)
+
+	// OffsetForTime provides the number of the first message in the topic
+	// that was stored at or after the given time. When every message was
+	// stored earlier, it provides the number that the next message to be
+	// stored will get. When the topic does not exist, it returns a
+	// NoSuchTopicError, without wrapping it.
+	OffsetForTime(topic string, t time.Time) (msgNumber int, err error)
+
+	// AvailableRange provides the number of the oldest message held for the
+	// topic, and the number that the next message stored will get. They are
+	// equal when the topic holds no messages. It is an error for the topic not
+	// to exist.
+	AvailableRange(topic string) (earliest int, next int, err error)
+
+	// ArrivalC provides a channel that will be closed the next time a message
+	// is stored in the given topic. It is the hook by which callers can wait
+	// for new messages to arrive, instead of polling repeatedly. Acquire the
+	// channel before polling, so as not to miss an arrival in between. The
+	// channel is also closed when the topic is deleted, or the store emptied.
+	// When the topic does not exist, the channel provided is already closed,
+	// so that the caller polls again at once, and finds that out; the store
+	// keeps nothing for it.
+	ArrivalC(topic string) <-chan struct{}
+
+	// CommitOffset records *readFrom* as the message number from which the
+	// named consumer group should resume consuming the given topic.
+	CommitOffset(group string, topic string, readFrom int) error
+
+	// FetchOffset provides the read-from message number most recently
+	// committed by the named consumer group for the given topic. *committed*
+	// is returned false when the group has never committed one.
+	FetchOffset(group string, topic string) (
+		readFrom int, committed bool, err error)
+
+	// CreateTopic brings a topic into being, with the given number of
+	// partitions, without storing any messages in it. (Store also creates
+	// topics implicitly, with one partition). It is an error for the topic to
+	// already exist.
+	CreateTopic(topic string, numPartitions int) error
+
+	// NumPartitions provides the number of partitions a topic has. Topics
+	// that do not yet exist have one, because that is how many Store will
+	// create them with.
+	NumPartitions(topic string) (numPartitions int, err error)
+
+	// DeleteTopic removes a topic, along with all its partitions, all its
+	// messages, and the read-from message numbers committed for it by consumer
+	// groups. It is an error for the topic not to exist.
+	DeleteTopic(topic string) error
+
+	// ListTopics provides the names of all the topics in the store, in
+	// alphabetical order. (Not the names of their partitions' logs).
+	ListTopics() (topics []string, err error)
+
+	// DescribeTopic provides summary information about a topic, or, when
+	// given the name of a partition's log, about that partition. It is an
+	// error for the topic or partition not to exist.
+	DescribeTopic(topic string) (description TopicDescription, err error)
 
 	// DeleteContents empties the store of all its contents.
 	DeleteContents() error
@@ -0,0 +1,38 @@
+package contract
+
+import (
+	"time"
+
+	minikafka "github.com/peterhoward42/minikafka"
+)
+
+// NewestForKeys records the number of the newest message that has each key,
+// keyed on the key; which is what compaction needs to know about a topic to
+// decide which of its messages to keep. (See BackingStore.Compact).
+type NewestForKeys map[string]int
+
+// Record notes a message with the given key, and message number. Messages
+// without a key are ignored.
+func (n NewestForKeys) Record(key []byte, msgNumber int) {
+	if len(key) == 0 {
+		return
+	}
+	if msgNumber > n[string(key)] {
+		n[string(key)] = msgNumber
+	}
+}
+
+// Keep reports whether compaction should keep the given message, which was
+// stored at time *created*, once every message in the topic has been
+// recorded.
+func (n NewestForKeys) Keep(message minikafka.Message, msgNumber int,
+	created time.Time, tombstonesBefore time.Time) bool {
+	if len(message.Key) == 0 {
+		return true
+	}
+	if n[string(message.Key)] != msgNumber {
+		return false
+	}
+	isTombstone := len(message.Payload) == 0
+	return !(isTombstone && created.Before(tombstonesBefore))
+}
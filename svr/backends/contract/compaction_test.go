@@ -0,0 +1,33 @@
+package contract
+
+import (
+	"testing"
+	"time"
+
+	minikafka "github.com/peterhoward42/minikafka"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewestForKeys(t *testing.T) {
+	newest := NewestForKeys{}
+	newest.Record([]byte("a"), 1)
+	newest.Record([]byte("b"), 2)
+	newest.Record(nil, 3)
+	newest.Record([]byte("a"), 4)
+	assert.Equal(t, NewestForKeys{"a": 4, "b": 2}, newest)
+
+	now := time.Now()
+	later := now.Add(time.Hour)
+	value := minikafka.Message{Key: []byte("a"), Payload: []byte("v")}
+	assert.False(t, newest.Keep(value, 1, now, later))
+	assert.True(t, newest.Keep(value, 4, now, later))
+
+	// Messages without a key are always kept.
+	keyless := minikafka.Message{Payload: []byte("v")}
+	assert.True(t, newest.Keep(keyless, 3, now, later))
+
+	// Tombstones are kept until they are old enough.
+	tombstone := minikafka.Message{Key: []byte("b")}
+	assert.True(t, newest.Keep(tombstone, 2, now, now))
+	assert.False(t, newest.Keep(tombstone, 2, now, later))
+}
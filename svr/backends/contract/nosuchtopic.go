@@ -0,0 +1,17 @@
+package contract
+
+import (
+	"fmt"
+)
+
+// NoSuchTopicError is the error that Poll and OffsetForTime return when the
+// topic does not exist (yet). It lets callers tell a topic that no producer
+// has written to yet, from a request that failed.
+type NoSuchTopicError struct {
+	Topic string
+}
+
+// Error is defined by, and documented in the standard error interface.
+func (e NoSuchTopicError) Error() string {
+	return fmt.Sprintf("No such topic: %s", e.Topic)
+}
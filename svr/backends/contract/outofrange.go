@@ -0,0 +1,51 @@
+package contract
+
+import (
+	"fmt"
+)
+
+// OutOfRangeError is the error that Poll returns when asked to read from a
+// message number that lies outside the range of messages a topic has
+// available. Either because the messages from there on have been removed
+// (expired), or because it lies beyond the next message to be stored. It
+// reports the range that is available, so that the caller can choose where
+// to resume.
+type OutOfRangeError struct {
+	ReadFrom int
+	// The number of the oldest message available. (Equal to Next when there
+	// are none).
+	Earliest int
+	// The number the next message to be stored will get.
+	Next int
+}
+
+// Error is defined by, and documented in the standard error interface.
+func (e OutOfRangeError) Error() string {
+	return fmt.Sprintf(
+		"Read-from message number %d is out of range. Messages %d up to "+
+			"(but not including) %d are available", e.ReadFrom, e.Earliest,
+		e.Next)
+}
+
+// Expired reports whether the error arose because the messages the caller
+// was due to read have been removed.
+func (e OutOfRangeError) Expired() bool {
+	return e.ReadFrom < e.Earliest
+}
+
+// CheckReadFrom provides an OutOfRangeError when the given read-from message
+// number lies outside the range of messages available from *earliest* up to
+// (but not including) *next*, and nil otherwise. Reading from *next* is
+// allowed, because that is where consumers wait for new messages. Reading
+// from below 1 is treated as reading from 1, and is only out of range once
+// message 1 has been removed.
+func CheckReadFrom(readFrom int, earliest int, next int) error {
+	if readFrom < 1 {
+		readFrom = 1
+	}
+	if readFrom < earliest || readFrom > next {
+		return OutOfRangeError{ReadFrom: readFrom, Earliest: earliest,
+			Next: next}
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package contract
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckReadFrom(t *testing.T) {
+	// Within range, including waiting at the next message.
+	assert.Nil(t, CheckReadFrom(3, 3, 5))
+	assert.Nil(t, CheckReadFrom(5, 3, 5))
+	// Nothing ever removed.
+	assert.Nil(t, CheckReadFrom(0, 1, 5))
+	assert.Nil(t, CheckReadFrom(1, 1, 1))
+
+	err := CheckReadFrom(2, 3, 5)
+	assert.Equal(t, OutOfRangeError{ReadFrom: 2, Earliest: 3, Next: 5}, err)
+	assert.True(t, err.(OutOfRangeError).Expired())
+
+	err = CheckReadFrom(6, 3, 5)
+	assert.Equal(t, OutOfRangeError{ReadFrom: 6, Earliest: 3, Next: 5}, err)
+	assert.False(t, err.(OutOfRangeError).Expired())
+}
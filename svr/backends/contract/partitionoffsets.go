@@ -0,0 +1,11 @@
+package contract
+
+// PartitionOffsets describes the range of messages one partition of a topic
+// has available, as BackingStore.ListOffsets provides. Those numbered from
+// Earliest, up to but not including Next. (They are equal when the partition
+// holds no messages).
+type PartitionOffsets struct {
+	Partition int
+	Earliest  int
+	Next      int
+}
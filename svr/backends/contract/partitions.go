@@ -0,0 +1,51 @@
+package contract
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A topic can be divided into partitions, each of which is an independent
+// sequence of messages, with its own message numbering. Backing stores hold
+// each partition as a *log* of its own, named according to PartitionLog.
+// Methods that deal with messages (Store, Poll etc.) take the name of a log,
+// whilst methods that administer topics take the name of a topic.
+
+// partitionSeparator separates a topic name from a partition number in the
+// names of logs.
+const partitionSeparator = "#"
+
+// PartitionLog provides the name of the log that holds a partition of a
+// topic. The log for partition zero is named after the topic alone, so that
+// topics with just one partition are held exactly as they were before
+// partitions existed.
+func PartitionLog(topic string, partition int) string {
+	if partition == 0 {
+		return topic
+	}
+	return fmt.Sprintf("%s%s%d", topic, partitionSeparator, partition)
+}
+
+// ParsePartitionLog is the inverse of PartitionLog.
+func ParsePartitionLog(log string) (topic string, partition int) {
+	i := strings.LastIndex(log, partitionSeparator)
+	if i < 0 {
+		return log, 0
+	}
+	partition, err := strconv.Atoi(log[i+len(partitionSeparator):])
+	if err != nil {
+		return log, 0
+	}
+	return log[:i], partition
+}
+
+// ValidateTopicName returns an error when the given topic name cannot be
+// used, because it could be confused with the name of a partition's log.
+func ValidateTopicName(topic string) error {
+	if strings.Contains(topic, partitionSeparator) {
+		return fmt.Errorf("Topic names may not contain %q: %v",
+			partitionSeparator, topic)
+	}
+	return nil
+}
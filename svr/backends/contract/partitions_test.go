@@ -0,0 +1,32 @@
+package contract
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionLog(t *testing.T) {
+	assert.Equal(t, "topicA", PartitionLog("topicA", 0))
+	assert.Equal(t, "topicA#3", PartitionLog("topicA", 3))
+}
+
+func TestParsePartitionLog(t *testing.T) {
+	topic, partition := ParsePartitionLog("topicA")
+	assert.Equal(t, "topicA", topic)
+	assert.Equal(t, 0, partition)
+
+	topic, partition = ParsePartitionLog("topicA#3")
+	assert.Equal(t, "topicA", topic)
+	assert.Equal(t, 3, partition)
+
+	// When what follows the separator is not a partition number.
+	topic, partition = ParsePartitionLog("topicA#x")
+	assert.Equal(t, "topicA#x", topic)
+	assert.Equal(t, 0, partition)
+}
+
+func TestValidateTopicName(t *testing.T) {
+	assert.Nil(t, ValidateTopicName("topicA"))
+	assert.NotNil(t, ValidateTopicName("topicA#3"))
+}
@@ -0,0 +1,23 @@
+package contract
+
+import (
+	"time"
+)
+
+// RetentionPolicy governs how long the messages in one topic are kept for.
+// Messages are removed when they are older than *MaxAge*, or when they are
+// the oldest messages and keeping them would take the topic beyond
+// *MaxMessages* messages, or *MaxBytes* bytes of messages. (Counting the
+// bytes the store holds, as reported by DescribeTopic). Limits with a zero
+// value do not apply; except for *MaxAge*, when zero means the server's
+// default retention time applies. *Infinite* overrides the limits above,
+// and means the topic's messages are never removed on their account.
+// *Compact* is independent of the other fields, and makes the topic subject
+// to compaction by key. (See BackingStore.Compact).
+type RetentionPolicy struct {
+	MaxAge      time.Duration
+	MaxBytes    int64
+	MaxMessages int
+	Infinite    bool
+	Compact     bool
+}
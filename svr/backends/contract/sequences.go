@@ -0,0 +1,42 @@
+package contract
+
+// SequenceWindow is how many of each producer's most recent requests a
+// backing store remembers for each topic, to recognise retries. (See
+// StoreSequenced). It comfortably exceeds the number of requests a producer
+// has in flight at once.
+const SequenceWindow = 32
+
+// SequencedBatch records the message numbers given to the messages in one
+// of a producer's requests.
+type SequencedBatch struct {
+	Sequence       uint64
+	FirstMsgNumber int
+	LastMsgNumber  int
+}
+
+// ProducerSequences is what a backing store remembers about producers'
+// requests for one topic: the most recent SequenceWindow of them for each
+// producer, oldest first. Keyed on producer ID.
+type ProducerSequences map[string][]SequencedBatch
+
+// Find looks for the producer's request with the given sequence number, and
+// returns false for *ok* when it is not one of those remembered.
+func (ps ProducerSequences) Find(producerID string, sequence uint64) (
+	batch SequencedBatch, ok bool) {
+	for _, batch := range ps[producerID] {
+		if batch.Sequence == sequence {
+			return batch, true
+		}
+	}
+	return SequencedBatch{}, false
+}
+
+// Record remembers the given request of the producer's, forgetting its
+// oldest when there are more than SequenceWindow.
+func (ps ProducerSequences) Record(producerID string, batch SequencedBatch) {
+	batches := append(ps[producerID], batch)
+	if len(batches) > SequenceWindow {
+		batches = batches[len(batches)-SequenceWindow:]
+	}
+	ps[producerID] = batches
+}
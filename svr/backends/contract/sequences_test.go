@@ -0,0 +1,34 @@
+package contract
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProducerSequences(t *testing.T) {
+	ps := ProducerSequences{}
+	_, ok := ps.Find("p1", 1)
+	assert.False(t, ok)
+
+	ps.Record("p1", SequencedBatch{Sequence: 1, FirstMsgNumber: 4,
+		LastMsgNumber: 6})
+	batch, ok := ps.Find("p1", 1)
+	assert.True(t, ok)
+	assert.Equal(t, 4, batch.FirstMsgNumber)
+	assert.Equal(t, 6, batch.LastMsgNumber)
+
+	// Producers are independent.
+	_, ok = ps.Find("p2", 1)
+	assert.False(t, ok)
+
+	// Only the most recent are remembered.
+	for sequence := uint64(2); sequence <= SequenceWindow+1; sequence++ {
+		ps.Record("p1", SequencedBatch{Sequence: sequence})
+	}
+	assert.Equal(t, SequenceWindow, len(ps["p1"]))
+	_, ok = ps.Find("p1", 1)
+	assert.False(t, ok)
+	_, ok = ps.Find("p1", 2)
+	assert.True(t, ok)
+}
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	minikafka "github.com/peterhoward42/minikafka"
 )
 
 // RunBackingStoreTests is a test suite entry point function that checks all the
@@ -25,6 +27,109 @@ func RunBackingStoreTests(t *testing.T, implementation BackingStore) {
 	testPollWhenTopicIsEmpty(t, implementation)
 	testNewReadFromAdvancement(t, implementation)
 	testMessageNumbersIncrementAcrossRemovals(t, implementation)
+	testArrivalNotification(t, implementation)
+	testArrivalNotificationWhenNoSuchTopic(t, implementation)
+	testDeleteTopicWakesWaiters(t, implementation)
+	testPollLimitedByMessageCount(t, implementation)
+	testPollLimitedByBytes(t, implementation)
+	testCommitAndFetchOffset(t, implementation)
+	testFetchOffsetWhenNoneCommitted(t, implementation)
+	testCommittedOffsetsAreDeletedWithContents(t, implementation)
+	testCreateTopic(t, implementation)
+	testCreateTopicWhenAlreadyExists(t, implementation)
+	testDeleteTopic(t, implementation)
+	testDeleteTopicWhenNoSuchTopic(t, implementation)
+	testListTopics(t, implementation)
+	testDescribeTopic(t, implementation)
+	testDescribeTopicWhenEmpty(t, implementation)
+	testDescribeTopicWhenNoSuchTopic(t, implementation)
+	testSetRetentionPolicy(t, implementation)
+	testSetRetentionPolicyWhenNoSuchTopic(t, implementation)
+	testInfiniteRetention(t, implementation)
+	testRetentionMaxAgeOverridesDefault(t, implementation)
+	testRetentionByMessageCountKeepsNewest(t, implementation)
+	testRetentionByBytesKeepsNewest(t, implementation)
+	testRetentionPolicyIsDeletedWithTopic(t, implementation)
+	testCreatePartitionedTopic(t, implementation)
+	testNumPartitionsWhenNoSuchTopic(t, implementation)
+	testPartitionsAreNumberedIndependently(t, implementation)
+	testDeletePartitionedTopic(t, implementation)
+	testDescribePartition(t, implementation)
+	testRetentionPolicyAppliesToAllPartitions(t, implementation)
+	testMessageFieldsAreRetained(t, implementation)
+	testMessageNumbersAndCreationTimesAreReturned(t, implementation)
+	testOffsetForTime(t, implementation)
+	testOffsetForTimeAfterRemovals(t, implementation)
+	testOffsetForTimeWhenNoSuchTopic(t, implementation)
+	testAvailableRange(t, implementation)
+	testAvailableRangeWhenNoSuchTopic(t, implementation)
+	testPollWhenMessagesHaveExpired(t, implementation)
+	testPollBeyondNextMessage(t, implementation)
+	testListOffsets(t, implementation)
+	testListOffsetsWhenNoSuchTopic(t, implementation)
+	testStoreBatch(t, implementation)
+	testStoreBatchWhenEmpty(t, implementation)
+	testStoreSequenced(t, implementation)
+	testStoreSequencedRemembersOnlyRecent(t, implementation)
+	testSequencesAreDeletedWithTopic(t, implementation)
+	testStoreBatchIfNext(t, implementation)
+	testStoreBatchIfNextWhenRetried(t, implementation)
+	testStoreTransaction(t, implementation)
+	testStoreTransactionIsAllOrNothing(t, implementation)
+	testCompact(t, implementation)
+	testCompactOnlyTopicsThatAskForIt(t, implementation)
+	testPollAcrossCompactedMessages(t, implementation)
+}
+
+// textMessage makes a message with the given text as its payload.
+func textMessage(text string) minikafka.Message {
+	return minikafka.Message{Payload: []byte(text)}
+}
+
+// pollAvailable polls for all the messages a topic has available, from the
+// oldest that has not been removed.
+func pollAvailable(store BackingStore, topic string) (
+	messages []minikafka.StoredMessage, newReadFrom int, err error) {
+	earliest, _, err := store.AvailableRange(topic)
+	if err != nil {
+		return nil, -1, err
+	}
+	return store.Poll(topic, earliest, 0, 0)
+}
+
+// storeForCompaction stores messages with the given keys and payloads in
+// *topic*, which has a compacting retention policy. It then stores some
+// large messages without keys, so that a store that does not compact its
+// newest messages, has moved past those given. It returns the numbers of
+// the large messages.
+func storeForCompaction(t *testing.T, store BackingStore, topic string,
+	keysAndPayloads ...string) (fillers []int) {
+	err := store.CreateTopic(topic, 1)
+	assert.Nil(t, err)
+	err = store.SetRetentionPolicy(topic, RetentionPolicy{Compact: true})
+	assert.Nil(t, err)
+	for i := 0; i < len(keysAndPayloads); i += 2 {
+		_, err = store.Store(topic, minikafka.Message{
+			Key:     []byte(keysAndPayloads[i]),
+			Payload: []byte(keysAndPayloads[i+1])})
+		assert.Nil(t, err)
+	}
+	filler := minikafka.Message{Payload: make([]byte, 600000)}
+	for i := 0; i < 3; i++ {
+		msgNumber, err := store.Store(topic, filler)
+		assert.Nil(t, err)
+		fillers = append(fillers, msgNumber)
+	}
+	return fillers
+}
+
+// msgNumbersOf provides the numbers of the given messages.
+func msgNumbersOf(messages []minikafka.StoredMessage) []int {
+	numbers := []int{}
+	for _, message := range messages {
+		numbers = append(numbers, message.Number)
+	}
+	return numbers
 }
 
 //----------------------------------------------------------------------------
@@ -34,7 +139,7 @@ func RunBackingStoreTests(t *testing.T, implementation BackingStore) {
 func testCanStoreToVirginStore(t *testing.T, store BackingStore) {
 	err := store.DeleteContents()
 	assert.Nil(t, err)
-	msgNum, err := store.Store("topicA", []byte("hello"))
+	msgNum, err := store.Store("topicA", textMessage("hello"))
 	assert.Nil(t, err)
 	assert.Equal(t, 1, msgNum)
 }
@@ -42,9 +147,9 @@ func testCanStoreToVirginStore(t *testing.T, store BackingStore) {
 func testCanStoreToExistingTopic(t *testing.T, store BackingStore) {
 	err := store.DeleteContents()
 	assert.Nil(t, err)
-	msgNum, err := store.Store("topicA", []byte("hello"))
+	msgNum, err := store.Store("topicA", textMessage("hello"))
 	assert.Nil(t, err)
-	msgNum, err = store.Store("topicA", []byte("goodbye"))
+	msgNum, err = store.Store("topicA", textMessage("goodbye"))
 	assert.Nil(t, err)
 	assert.Equal(t, 2, msgNum)
 }
@@ -52,11 +157,11 @@ func testCanStoreToExistingTopic(t *testing.T, store BackingStore) {
 func testMessageNumberAllocatedPerTopic(t *testing.T, store BackingStore) {
 	err := store.DeleteContents()
 	assert.Nil(t, err)
-	msgNum, err := store.Store("topicA", []byte("foo"))
+	msgNum, err := store.Store("topicA", textMessage("foo"))
 	assert.Nil(t, err)
-	msgNum, err = store.Store("topicA", []byte("bar"))
+	msgNum, err = store.Store("topicA", textMessage("bar"))
 	assert.Nil(t, err)
-	msgNum, err = store.Store("topicB", []byte("baz"))
+	msgNum, err = store.Store("topicB", textMessage("baz"))
 	assert.Nil(t, err)
 	assert.Equal(t, 1, msgNum)
 }
@@ -64,9 +169,9 @@ func testMessageNumberAllocatedPerTopic(t *testing.T, store BackingStore) {
 func testRemoveMsgOperatesAcrossTopics(t *testing.T, store BackingStore) {
 	err := store.DeleteContents()
 	assert.Nil(t, err)
-	_, err = store.Store("topicA", []byte("foo"))
+	_, err = store.Store("topicA", textMessage("foo"))
 	assert.Nil(t, err)
-	_, err = store.Store("topicB", []byte("bar"))
+	_, err = store.Store("topicB", textMessage("bar"))
 	assert.Nil(t, err)
 
 	maxAge := time.Now()
@@ -87,7 +192,7 @@ func testRemoveOnEmptyStore(t *testing.T, store BackingStore) {
 func testRemoveWhenNoneOldEnough(t *testing.T, store BackingStore) {
 	err := store.DeleteContents()
 	assert.Nil(t, err)
-	_, err = store.Store("topicA", []byte("foo"))
+	_, err = store.Store("topicA", textMessage("foo"))
 	assert.Nil(t, err)
 
 	// Remove messages older than one hour ago.
@@ -99,7 +204,7 @@ func testRemoveWhenNoneOldEnough(t *testing.T, store BackingStore) {
 func testRemoveWhenAllOldEnough(t *testing.T, store BackingStore) {
 	err := store.DeleteContents()
 	assert.Nil(t, err)
-	_, err = store.Store("topicA", []byte("foo"))
+	_, err = store.Store("topicA", textMessage("foo"))
 	assert.Nil(t, err)
 
 	// Remove messages older than one hour's hence.
@@ -112,15 +217,15 @@ func testRemoveWhenOnlySomeOldEnough(t *testing.T, store BackingStore) {
 	err := store.DeleteContents()
 	assert.Nil(t, err)
 	// Store two messages immediately.
-	_, err = store.Store("topicA", []byte("abc"))
+	_, err = store.Store("topicA", textMessage("abc"))
 	assert.Nil(t, err)
-	_, err = store.Store("topicA", []byte("def"))
+	_, err = store.Store("topicA", textMessage("def"))
 	assert.Nil(t, err)
 	// Store two more, after a 500ms delay.
 	time.Sleep(time.Millisecond * 500)
-	_, err = store.Store("topicA", []byte("ghi"))
+	_, err = store.Store("topicA", textMessage("ghi"))
 	assert.Nil(t, err)
-	_, err = store.Store("topicA", []byte("klm"))
+	_, err = store.Store("topicA", textMessage("klm"))
 	assert.Nil(t, err)
 	// Remove those older than 250ms.
 	maxAge := time.Now().Add(time.Duration(-250 * time.Microsecond))
@@ -131,56 +236,57 @@ func testRemoveWhenOnlySomeOldEnough(t *testing.T, store BackingStore) {
 func testPollErrorHandlingWhenNoSuchTopic(t *testing.T, store BackingStore) {
 	err := store.DeleteContents()
 	assert.Nil(t, err)
-	_, _, err = store.Poll("XXX", 1)
+	_, _, err = store.Poll("XXX", 1, 0, 0)
 	assert.NotNil(t, err)
 	ok := strings.Contains(err.Error(), "topic")
 	assert.True(t, ok)
+	assert.Equal(t, NoSuchTopicError{Topic: "XXX"}, err)
 }
 
 func testPollWhenTopicIsEmpty(t *testing.T, store BackingStore) {
 	err := store.DeleteContents()
 	assert.Nil(t, err)
 	// Bring topic into being.
-	_, err = store.Store("topicA", []byte("foo"))
+	_, err = store.Store("topicA", textMessage("foo"))
 	assert.Nil(t, err)
 	// Remove all messages.
 	maxAge := time.Now().Add(time.Duration(1 * time.Hour))
 	err = store.RemoveOldMessages(maxAge)
 	assert.Nil(t, err)
 
-	messages, newReadFrom, err := store.Poll("topicA", 1)
+	messages, newReadFrom, err := store.Poll("topicA", 2, 0, 0)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, len(messages))
-	assert.Equal(t, 1, newReadFrom)
+	assert.Equal(t, 2, newReadFrom)
 }
 
 func testNewReadFromAdvancement(t *testing.T, store BackingStore) {
 	err := store.DeleteContents()
 	assert.Nil(t, err)
 	// Add 3 messages.
-	_, err = store.Store("topicA", []byte("foo"))
+	_, err = store.Store("topicA", textMessage("foo"))
 	assert.Nil(t, err)
-	_, err = store.Store("topicA", []byte("bar"))
+	_, err = store.Store("topicA", textMessage("bar"))
 	assert.Nil(t, err)
-	_, err = store.Store("topicA", []byte("baz"))
+	_, err = store.Store("topicA", textMessage("baz"))
 	assert.Nil(t, err)
 	// Check returned values from a Poll that will empty the topic.
-	messages, newReadFrom, err := store.Poll("topicA", 1)
+	messages, newReadFrom, err := store.Poll("topicA", 1, 0, 0)
 	assert.Nil(t, err)
 	assert.Equal(t, 3, len(messages))
 	assert.Equal(t, 4, newReadFrom)
 	// Check returned values when Polling for newever values when there
 	// are none.
-	messages, newReadFrom, err = store.Poll("topicA", newReadFrom)
+	messages, newReadFrom, err = store.Poll("topicA", newReadFrom, 0, 0)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, len(messages))
 	assert.Equal(t, 4, newReadFrom)
 
 	// Check returned values when Polling for newever values when there
 	// are some new ones.
-	_, err = store.Store("topicA", []byte("baz"))
+	_, err = store.Store("topicA", textMessage("baz"))
 	assert.Nil(t, err)
-	messages, newReadFrom, err = store.Poll("topicA", newReadFrom)
+	messages, newReadFrom, err = store.Poll("topicA", newReadFrom, 0, 0)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(messages))
 	assert.Equal(t, 5, newReadFrom)
@@ -191,7 +297,7 @@ func testMessageNumbersIncrementAcrossRemovals(t *testing.T, store BackingStore)
 	assert.Nil(t, err)
 
 	// Store a message.
-	_, err = store.Store("topicA", []byte("foo"))
+	_, err = store.Store("topicA", textMessage("foo"))
 	assert.Nil(t, err)
 
 	// Remove all messages using the RemoveOldMessages API call.
@@ -201,7 +307,1056 @@ func testMessageNumbersIncrementAcrossRemovals(t *testing.T, store BackingStore)
 
 	// Do a fresh storage opertation, and ensure the messgae number
 	// allocated is 2.
-	msgNum, err := store.Store("topicA", []byte("foo"))
+	msgNum, err := store.Store("topicA", textMessage("foo"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, msgNum)
+}
+
+func testArrivalNotification(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+
+	// Acquire arrival channels for two topics, then store a message in
+	// just one of them.
+	for _, topic := range []string{"topicA", "topicB"} {
+		err = store.CreateTopic(topic, 1)
+		assert.Nil(t, err)
+	}
+	arrivalA := store.ArrivalC("topicA")
+	arrivalB := store.ArrivalC("topicB")
+	_, err = store.Store("topicA", textMessage("foo"))
+	assert.Nil(t, err)
+
+	// Only the channel for the topic stored to should have been closed.
+	select {
+	case <-arrivalA:
+	case <-time.After(time.Second):
+		assert.Fail(t, "topicA arrival channel not closed")
+	}
+	select {
+	case <-arrivalB:
+		assert.Fail(t, "topicB arrival channel closed")
+	default:
+	}
+}
+
+func testArrivalNotificationWhenNoSuchTopic(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+
+	// The channel should already be closed, so that the caller polls at
+	// once, and finds there is no such topic.
+	select {
+	case <-store.ArrivalC("nosuchtopic"):
+	default:
+		assert.Fail(t, "arrival channel for unknown topic not closed")
+	}
+}
+
+func testDeleteTopicWakesWaiters(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	err = store.CreateTopic("topicA", 2)
+	assert.Nil(t, err)
+	arrival0 := store.ArrivalC("topicA")
+	arrival1 := store.ArrivalC(PartitionLog("topicA", 1))
+
+	err = store.DeleteTopic("topicA")
+	assert.Nil(t, err)
+	for _, arrivalC := range []<-chan struct{}{arrival0, arrival1} {
+		select {
+		case <-arrivalC:
+		case <-time.After(time.Second):
+			assert.Fail(t, "arrival channel not closed by DeleteTopic")
+		}
+	}
+}
+
+func testPollLimitedByMessageCount(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	for i := 0; i < 5; i++ {
+		_, err = store.Store("topicA", textMessage("foo"))
+		assert.Nil(t, err)
+	}
+	// Page through the topic two messages at a time.
+	messages, newReadFrom, err := store.Poll("topicA", 1, 2, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, 3, newReadFrom)
+	messages, newReadFrom, err = store.Poll("topicA", newReadFrom, 2, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, 5, newReadFrom)
+	messages, newReadFrom, err = store.Poll("topicA", newReadFrom, 2, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(messages))
+	assert.Equal(t, 6, newReadFrom)
+}
+
+func testPollLimitedByBytes(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	// Stores may hold messages with some overhead, so the sizes used here
+	// leave plenty of room for that.
+	small := strings.Repeat("x", 100)
+	big := strings.Repeat("y", 1000)
+	_, err = store.Store("topicA", textMessage(small))
+	assert.Nil(t, err)
+	_, err = store.Store("topicA", textMessage(small))
+	assert.Nil(t, err)
+	_, err = store.Store("topicA", textMessage(big))
+	assert.Nil(t, err)
+	_, err = store.Store("topicA", textMessage(small))
+	assert.Nil(t, err)
+
+	// Only the first two will fit into 300 bytes.
+	messages, newReadFrom, err := store.Poll("topicA", 1, 0, 300)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, small, string(messages[1].Payload))
+	assert.Equal(t, 3, newReadFrom)
+
+	// The next one is too big on its own, but should be returned regardless.
+	messages, newReadFrom, err = store.Poll("topicA", newReadFrom, 0, 300)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(messages))
+	assert.Equal(t, big, string(messages[0].Payload))
+	assert.Equal(t, 4, newReadFrom)
+}
+
+func testCommitAndFetchOffset(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	err = store.CommitOffset("groupA", "topicA", 3)
+	assert.Nil(t, err)
+	err = store.CommitOffset("groupA", "topicB", 7)
+	assert.Nil(t, err)
+	err = store.CommitOffset("groupB", "topicA", 5)
+	assert.Nil(t, err)
+	// Overwrite one.
+	err = store.CommitOffset("groupA", "topicA", 4)
+	assert.Nil(t, err)
+
+	readFrom, committed, err := store.FetchOffset("groupA", "topicA")
+	assert.Nil(t, err)
+	assert.True(t, committed)
+	assert.Equal(t, 4, readFrom)
+	readFrom, committed, err = store.FetchOffset("groupA", "topicB")
+	assert.Nil(t, err)
+	assert.True(t, committed)
+	assert.Equal(t, 7, readFrom)
+	readFrom, committed, err = store.FetchOffset("groupB", "topicA")
+	assert.Nil(t, err)
+	assert.True(t, committed)
+	assert.Equal(t, 5, readFrom)
+}
+
+func testFetchOffsetWhenNoneCommitted(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	err = store.CommitOffset("groupA", "topicA", 3)
+	assert.Nil(t, err)
+
+	// Known group, unknown topic.
+	_, committed, err := store.FetchOffset("groupA", "topicB")
+	assert.Nil(t, err)
+	assert.False(t, committed)
+	// Unknown group.
+	_, committed, err = store.FetchOffset("groupB", "topicA")
+	assert.Nil(t, err)
+	assert.False(t, committed)
+}
+
+func testCommittedOffsetsAreDeletedWithContents(t *testing.T,
+	store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	err = store.CommitOffset("groupA", "topicA", 3)
+	assert.Nil(t, err)
+	err = store.DeleteContents()
+	assert.Nil(t, err)
+	_, committed, err := store.FetchOffset("groupA", "topicA")
+	assert.Nil(t, err)
+	assert.False(t, committed)
+}
+
+func testCreateTopic(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	err = store.CreateTopic("topicA", 1)
+	assert.Nil(t, err)
+
+	// It should be possible to Poll the topic straight away.
+	messages, newReadFrom, err := store.Poll("topicA", 1, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(messages))
+	assert.Equal(t, 1, newReadFrom)
+
+	// And storing in it should start at message 1.
+	msgNum, err := store.Store("topicA", textMessage("foo"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, msgNum)
+}
+
+func testCreateTopicWhenAlreadyExists(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	_, err = store.Store("topicA", textMessage("foo"))
+	assert.Nil(t, err)
+	err = store.CreateTopic("topicA", 1)
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "exists"))
+}
+
+func testDeleteTopic(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	_, err = store.Store("topicA", textMessage("foo"))
+	assert.Nil(t, err)
+	_, err = store.Store("topicB", textMessage("bar"))
+	assert.Nil(t, err)
+	err = store.CommitOffset("groupA", "topicA", 2)
+	assert.Nil(t, err)
+
+	err = store.DeleteTopic("topicA")
+	assert.Nil(t, err)
+
+	// The topic should be gone, along with the offsets committed for it.
+	_, _, err = store.Poll("topicA", 1, 0, 0)
+	assert.NotNil(t, err)
+	_, committed, err := store.FetchOffset("groupA", "topicA")
+	assert.Nil(t, err)
+	assert.False(t, committed)
+
+	// But other topics should be untouched.
+	messages, _, err := store.Poll("topicB", 1, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(messages))
+
+	// When re-created, it should start again from message 1.
+	msgNum, err := store.Store("topicA", textMessage("foo"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, msgNum)
+}
+
+func testDeleteTopicWhenNoSuchTopic(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	err = store.DeleteTopic("XXX")
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "topic"))
+}
+
+func testListTopics(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	topics, err := store.ListTopics()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(topics))
+
+	_, err = store.Store("topicB", textMessage("foo"))
+	assert.Nil(t, err)
+	err = store.CreateTopic("topicC", 1)
+	assert.Nil(t, err)
+	_, err = store.Store("topicA", textMessage("bar"))
+	assert.Nil(t, err)
+
+	topics, err = store.ListTopics()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"topicA", "topicB", "topicC"}, topics)
+}
+
+func testDescribeTopic(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	before := time.Now()
+	_, err = store.Store("topicA", textMessage("abc"))
+	assert.Nil(t, err)
+	_, err = store.Store("topicA", textMessage("defg"))
+	assert.Nil(t, err)
+	_, err = store.Store("topicA", textMessage("hi"))
+	assert.Nil(t, err)
+	after := time.Now()
+
+	description, err := store.DescribeTopic("topicA")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, description.OldestMsgNumber)
+	assert.Equal(t, 3, description.NewestMsgNumber)
+	assert.Equal(t, 3, description.NumMessages)
+	// Stores may hold messages with some overhead.
+	assert.True(t, description.NumBytes >= 9)
+	assert.False(t, description.OldestCreated.Before(before))
+	assert.False(t, description.NewestCreated.After(after))
+	assert.False(t, description.NewestCreated.Before(
+		description.OldestCreated))
+}
+
+func testDescribeTopicWhenEmpty(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	err = store.CreateTopic("topicA", 1)
+	assert.Nil(t, err)
+
+	description, err := store.DescribeTopic("topicA")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, description.OldestMsgNumber)
+	assert.Equal(t, 0, description.NewestMsgNumber)
+	assert.Equal(t, 0, description.NumMessages)
+	assert.Equal(t, int64(0), description.NumBytes)
+}
+
+func testDescribeTopicWhenNoSuchTopic(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	_, err = store.DescribeTopic("XXX")
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "topic"))
+}
+
+func testSetRetentionPolicy(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	err = store.CreateTopic("topicA", 1)
+	assert.Nil(t, err)
+
+	// Before one is set, the policy should be the zero value.
+	description, err := store.DescribeTopic("topicA")
+	assert.Nil(t, err)
+	assert.Equal(t, RetentionPolicy{}, description.Retention)
+
+	policy := RetentionPolicy{
+		MaxAge: time.Hour, MaxBytes: 1000, MaxMessages: 10}
+	err = store.SetRetentionPolicy("topicA", policy)
+	assert.Nil(t, err)
+	description, err = store.DescribeTopic("topicA")
+	assert.Nil(t, err)
+	assert.Equal(t, policy, description.Retention)
+}
+
+func testSetRetentionPolicyWhenNoSuchTopic(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	err = store.SetRetentionPolicy("XXX", RetentionPolicy{Infinite: true})
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "topic"))
+}
+
+func testInfiniteRetention(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	_, err = store.Store("topicA", textMessage("foo"))
+	assert.Nil(t, err)
+	err = store.SetRetentionPolicy("topicA", RetentionPolicy{
+		Infinite: true, MaxAge: time.Nanosecond, MaxMessages: 1})
+	assert.Nil(t, err)
+	_, err = store.Store("topicA", textMessage("bar"))
+	assert.Nil(t, err)
+
+	// Invite the removal of everything.
+	maxAge := time.Now().Add(time.Duration(1 * time.Hour))
+	err = store.RemoveOldMessages(maxAge)
+	assert.Nil(t, err)
+
+	messages, _, err := store.Poll("topicA", 1, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(messages))
+}
+
+func testRetentionMaxAgeOverridesDefault(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	_, err = store.Store("longLived", textMessage("foo"))
+	assert.Nil(t, err)
+	err = store.SetRetentionPolicy("longLived", RetentionPolicy{
+		MaxAge: time.Hour})
+	assert.Nil(t, err)
+	_, err = store.Store("shortLived", textMessage("foo"))
+	assert.Nil(t, err)
+	err = store.SetRetentionPolicy("shortLived", RetentionPolicy{
+		MaxAge: time.Millisecond})
+	assert.Nil(t, err)
+	time.Sleep(10 * time.Millisecond)
+
+	// A default maximum age that would remove everything, should not remove
+	// the long lived message.
+	maxAge := time.Now().Add(time.Duration(1 * time.Hour))
+	err = store.RemoveOldMessages(maxAge)
+	assert.Nil(t, err)
+	messages, _, err := store.Poll("longLived", 1, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(messages))
+
+	// A default maximum age that would remove nothing, should still remove
+	// the short lived message.
+	maxAge = time.Now().Add(time.Duration(-1 * time.Hour))
+	err = store.RemoveOldMessages(maxAge)
+	assert.Nil(t, err)
+	messages, _, err = pollAvailable(store, "shortLived")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(messages))
+}
+
+func testRetentionByMessageCountKeepsNewest(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	err = store.CreateTopic("topicA", 1)
+	assert.Nil(t, err)
+	err = store.SetRetentionPolicy("topicA", RetentionPolicy{MaxMessages: 2})
+	assert.Nil(t, err)
+	for _, msg := range []string{"abc", "def", "ghi", "jkl"} {
+		_, err = store.Store("topicA", textMessage(msg))
+		assert.Nil(t, err)
+	}
+	maxAge := time.Now().Add(time.Duration(-1 * time.Hour))
+	err = store.RemoveOldMessages(maxAge)
+	assert.Nil(t, err)
+
+	// The store may keep more than the limit, but it must keep the newest
+	// messages up to the limit.
+	messages, _, err := pollAvailable(store, "topicA")
+	assert.Nil(t, err)
+	assert.True(t, len(messages) >= 2)
+	assert.Equal(t, "jkl", string(messages[len(messages)-1].Payload))
+	assert.Equal(t, "ghi", string(messages[len(messages)-2].Payload))
+}
+
+func testRetentionByBytesKeepsNewest(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	err = store.CreateTopic("topicA", 1)
+	assert.Nil(t, err)
+	err = store.SetRetentionPolicy("topicA", RetentionPolicy{MaxBytes: 7})
+	assert.Nil(t, err)
+	for _, msg := range []string{"abc", "def", "ghi", "jkl"} {
+		_, err = store.Store("topicA", textMessage(msg))
+		assert.Nil(t, err)
+	}
+	maxAge := time.Now().Add(time.Duration(-1 * time.Hour))
+	err = store.RemoveOldMessages(maxAge)
+	assert.Nil(t, err)
+
+	// The store may keep more than the limit, but it must keep the newest
+	// messages that fit inside it.
+	messages, _, err := pollAvailable(store, "topicA")
+	assert.Nil(t, err)
+	assert.True(t, len(messages) >= 2)
+	assert.Equal(t, "jkl", string(messages[len(messages)-1].Payload))
+	assert.Equal(t, "ghi", string(messages[len(messages)-2].Payload))
+}
+
+func testRetentionPolicyIsDeletedWithTopic(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	err = store.CreateTopic("topicA", 1)
+	assert.Nil(t, err)
+	err = store.SetRetentionPolicy("topicA", RetentionPolicy{Infinite: true})
+	assert.Nil(t, err)
+	err = store.DeleteTopic("topicA")
+	assert.Nil(t, err)
+
+	err = store.CreateTopic("topicA", 1)
+	assert.Nil(t, err)
+	description, err := store.DescribeTopic("topicA")
+	assert.Nil(t, err)
+	assert.Equal(t, RetentionPolicy{}, description.Retention)
+}
+
+func testCreatePartitionedTopic(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	err = store.CreateTopic("topicA", 3)
+	assert.Nil(t, err)
+
+	numPartitions, err := store.NumPartitions("topicA")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, numPartitions)
+
+	// Every partition should be ready to Poll straight away.
+	for partition := 0; partition < 3; partition++ {
+		log := PartitionLog("topicA", partition)
+		messages, _, err := store.Poll(log, 1, 0, 0)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(messages))
+	}
+
+	// The partitions should not be listed as topics in their own right.
+	topics, err := store.ListTopics()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"topicA"}, topics)
+}
+
+func testNumPartitionsWhenNoSuchTopic(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	numPartitions, err := store.NumPartitions("XXX")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, numPartitions)
+
+	// Nor for those created implicitly.
+	_, err = store.Store("topicA", textMessage("foo"))
+	assert.Nil(t, err)
+	numPartitions, err = store.NumPartitions("topicA")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, numPartitions)
+}
+
+func testPartitionsAreNumberedIndependently(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	err = store.CreateTopic("topicA", 2)
+	assert.Nil(t, err)
+	log0 := PartitionLog("topicA", 0)
+	log1 := PartitionLog("topicA", 1)
+
+	msgNum, err := store.Store(log0, textMessage("abc"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, msgNum)
+	msgNum, err = store.Store(log1, textMessage("def"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, msgNum)
+	msgNum, err = store.Store(log1, textMessage("ghi"))
 	assert.Nil(t, err)
 	assert.Equal(t, 2, msgNum)
+
+	messages, _, err := store.Poll(log0, 1, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(messages))
+	assert.Equal(t, "abc", string(messages[0].Payload))
+	messages, _, err = store.Poll(log1, 1, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, "def", string(messages[0].Payload))
+}
+
+func testDeletePartitionedTopic(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	err = store.CreateTopic("topicA", 2)
+	assert.Nil(t, err)
+	log1 := PartitionLog("topicA", 1)
+	_, err = store.Store(log1, textMessage("foo"))
+	assert.Nil(t, err)
+	err = store.CommitOffset("groupA", log1, 2)
+	assert.Nil(t, err)
+
+	err = store.DeleteTopic("topicA")
+	assert.Nil(t, err)
+
+	// All the partitions should be gone, along with the offsets committed
+	// for them.
+	_, _, err = store.Poll(log1, 1, 0, 0)
+	assert.NotNil(t, err)
+	_, committed, err := store.FetchOffset("groupA", log1)
+	assert.Nil(t, err)
+	assert.False(t, committed)
+	topics, err := store.ListTopics()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(topics))
+
+	// When re-created, it should have only the partitions asked for.
+	err = store.CreateTopic("topicA", 1)
+	assert.Nil(t, err)
+	numPartitions, err := store.NumPartitions("topicA")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, numPartitions)
+	_, _, err = store.Poll(log1, 1, 0, 0)
+	assert.NotNil(t, err)
+}
+
+func testDescribePartition(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	err = store.CreateTopic("topicA", 2)
+	assert.Nil(t, err)
+	policy := RetentionPolicy{MaxMessages: 10}
+	err = store.SetRetentionPolicy("topicA", policy)
+	assert.Nil(t, err)
+	log1 := PartitionLog("topicA", 1)
+	_, err = store.Store(log1, textMessage("foo"))
+	assert.Nil(t, err)
+
+	description, err := store.DescribeTopic(log1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, description.NumMessages)
+	assert.Equal(t, 2, description.NumPartitions)
+	assert.Equal(t, policy, description.Retention)
+	description, err = store.DescribeTopic("topicA")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, description.NumMessages)
+	assert.Equal(t, 2, description.NumPartitions)
+
+	// A partition beyond those created.
+	_, err = store.DescribeTopic(PartitionLog("topicA", 2))
+	assert.NotNil(t, err)
+}
+
+func testRetentionPolicyAppliesToAllPartitions(
+	t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	err = store.CreateTopic("topicA", 2)
+	assert.Nil(t, err)
+	err = store.SetRetentionPolicy("topicA", RetentionPolicy{Infinite: true})
+	assert.Nil(t, err)
+	log1 := PartitionLog("topicA", 1)
+	_, err = store.Store(log1, textMessage("foo"))
+	assert.Nil(t, err)
+
+	// Invite the removal of everything.
+	maxAge := time.Now().Add(time.Duration(1 * time.Hour))
+	err = store.RemoveOldMessages(maxAge)
+	assert.Nil(t, err)
+
+	messages, _, err := store.Poll(log1, 1, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(messages))
+}
+
+func testMessageFieldsAreRetained(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	msg := minikafka.Message{
+		Payload: []byte("abc"),
+		Key:     []byte("customer-42"),
+		Headers: map[string][]byte{
+			"content-type": []byte("text/plain"),
+			"trace-id":     []byte{0, 1, 2, 3},
+		},
+		Timestamp: time.Date(2018, 5, 1, 9, 0, 0, 123456789, time.UTC),
+	}
+	_, err = store.Store("topicA", msg)
+	assert.Nil(t, err)
+	// And one with none of the optional fields.
+	_, err = store.Store("topicA", textMessage("def"))
+	assert.Nil(t, err)
+
+	messages, _, err := store.Poll("topicA", 1, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, msg.Payload, messages[0].Payload)
+	assert.Equal(t, msg.Key, messages[0].Key)
+	assert.Equal(t, msg.Headers, messages[0].Headers)
+	assert.True(t, msg.Timestamp.Equal(messages[0].Timestamp))
+	assert.Equal(t, 0, len(messages[1].Key))
+	assert.Equal(t, 0, len(messages[1].Headers))
+	assert.True(t, messages[1].Timestamp.IsZero())
+}
+
+func testMessageNumbersAndCreationTimesAreReturned(
+	t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	before := time.Now()
+	for _, text := range []string{"abc", "def", "ghi"} {
+		_, err = store.Store("topicA", textMessage(text))
+		assert.Nil(t, err)
+	}
+	after := time.Now()
+
+	messages, _, err := store.Poll("topicA", 2, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, 2, messages[0].Number)
+	assert.Equal(t, 3, messages[1].Number)
+	for _, msg := range messages {
+		assert.False(t, msg.Created.Before(before))
+		assert.False(t, msg.Created.After(after))
+	}
+	assert.False(t, messages[1].Created.Before(messages[0].Created))
+}
+
+func testOffsetForTime(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	// Note the time before storing each message.
+	times := []time.Time{}
+	for _, text := range []string{"abc", "def", "ghi"} {
+		times = append(times, time.Now())
+		time.Sleep(2 * time.Millisecond)
+		_, err = store.Store("topicA", textMessage(text))
+		assert.Nil(t, err)
+	}
+	for i, seekTime := range times {
+		msgNumber, err := store.OffsetForTime("topicA", seekTime)
+		assert.Nil(t, err)
+		assert.Equal(t, i+1, msgNumber)
+	}
+	// Later than every message.
+	msgNumber, err := store.OffsetForTime("topicA", time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, 4, msgNumber)
+}
+
+func testOffsetForTimeAfterRemovals(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	before := time.Now()
+	_, err = store.Store("topicA", textMessage("abc"))
+	assert.Nil(t, err)
+	err = store.RemoveOldMessages(time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+
+	msgNumber, err := store.OffsetForTime("topicA", before)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, msgNumber)
+}
+
+func testOffsetForTimeWhenNoSuchTopic(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	_, err = store.OffsetForTime("nosuchtopic", time.Now())
+	assert.Equal(t, NoSuchTopicError{Topic: "nosuchtopic"}, err)
+}
+
+func testAvailableRange(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	err = store.CreateTopic("topicA", 1)
+	assert.Nil(t, err)
+	earliest, next, err := store.AvailableRange("topicA")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, earliest)
+	assert.Equal(t, 1, next)
+
+	for _, text := range []string{"abc", "def"} {
+		_, err = store.Store("topicA", textMessage(text))
+		assert.Nil(t, err)
+	}
+	earliest, next, err = store.AvailableRange("topicA")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, earliest)
+	assert.Equal(t, 3, next)
+
+	// Remove everything.
+	err = store.RemoveOldMessages(time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	earliest, next, err = store.AvailableRange("topicA")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, earliest)
+	assert.Equal(t, 3, next)
+}
+
+func testAvailableRangeWhenNoSuchTopic(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	_, _, err = store.AvailableRange("nosuchtopic")
+	assert.NotNil(t, err)
+}
+
+func testPollWhenMessagesHaveExpired(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	_, err = store.Store("topicA", textMessage("abc"))
+	assert.Nil(t, err)
+	err = store.RemoveOldMessages(time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	_, err = store.Store("topicA", textMessage("def"))
+	assert.Nil(t, err)
+
+	// Message 1 has gone, so polling from it must not quietly serve message
+	// 2 instead.
+	_, _, err = store.Poll("topicA", 1, 0, 0)
+	outOfRange, ok := err.(OutOfRangeError)
+	assert.True(t, ok)
+	assert.True(t, outOfRange.Expired())
+	assert.Equal(t, 2, outOfRange.Earliest)
+	assert.Equal(t, 3, outOfRange.Next)
+}
+
+func testPollBeyondNextMessage(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	_, err = store.Store("topicA", textMessage("abc"))
+	assert.Nil(t, err)
+
+	// Polling from the next message is how consumers wait for it.
+	messages, newReadFrom, err := store.Poll("topicA", 2, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(messages))
+	assert.Equal(t, 2, newReadFrom)
+
+	_, _, err = store.Poll("topicA", 3, 0, 0)
+	outOfRange, ok := err.(OutOfRangeError)
+	assert.True(t, ok)
+	assert.False(t, outOfRange.Expired())
+}
+
+func testListOffsets(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	err = store.CreateTopic("topicA", 2)
+	assert.Nil(t, err)
+	for _, text := range []string{"abc", "def"} {
+		_, err = store.Store(PartitionLog("topicA", 1), textMessage(text))
+		assert.Nil(t, err)
+	}
+	offsets, err := store.ListOffsets("topicA")
+	assert.Nil(t, err)
+	assert.Equal(t, []PartitionOffsets{
+		{Partition: 0, Earliest: 1, Next: 1},
+		{Partition: 1, Earliest: 1, Next: 3}}, offsets)
+
+	// Remove everything.
+	err = store.RemoveOldMessages(time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	offsets, err = store.ListOffsets("topicA")
+	assert.Nil(t, err)
+	assert.Equal(t, PartitionOffsets{Partition: 1, Earliest: 3, Next: 3},
+		offsets[1])
+}
+
+func testListOffsetsWhenNoSuchTopic(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	_, err = store.ListOffsets("nosuchtopic")
+	assert.NotNil(t, err)
+}
+
+func testStoreBatch(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	_, err = store.Store("topicA", textMessage("abc"))
+	assert.Nil(t, err)
+	batch := []minikafka.Message{textMessage("def"), textMessage("ghi"),
+		textMessage("jkl")}
+	first, last, err := store.StoreBatch("topicA", batch)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, first)
+	assert.Equal(t, 4, last)
+
+	messages, newReadFrom, err := store.Poll("topicA", 2, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(messages))
+	assert.Equal(t, "def", string(messages[0].Payload))
+	assert.Equal(t, "jkl", string(messages[2].Payload))
+	assert.Equal(t, 5, newReadFrom)
+
+	// Batches bring topics into being, as Store does.
+	first, last, err = store.StoreBatch("topicB", batch[:1])
+	assert.Nil(t, err)
+	assert.Equal(t, 1, first)
+	assert.Equal(t, 1, last)
+}
+
+func testStoreBatchWhenEmpty(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	_, _, err = store.StoreBatch("topicA", nil)
+	assert.NotNil(t, err)
+}
+
+func testStoreSequenced(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	batch := []minikafka.Message{textMessage("abc"), textMessage("def")}
+	first, last, err := store.StoreSequenced("topicA", "p1", 1, batch)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, first)
+	assert.Equal(t, 2, last)
+
+	// A retry gets the original message numbers, and stores nothing.
+	first, last, err = store.StoreSequenced("topicA", "p1", 1, batch)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, first)
+	assert.Equal(t, 2, last)
+	_, next, err := store.AvailableRange("topicA")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, next)
+
+	// Other producers, and other topics, have sequences of their own.
+	first, _, err = store.StoreSequenced("topicA", "p2", 1, batch[:1])
+	assert.Nil(t, err)
+	assert.Equal(t, 3, first)
+	first, _, err = store.StoreSequenced("topicB", "p1", 1, batch[:1])
+	assert.Nil(t, err)
+	assert.Equal(t, 1, first)
+
+	// It is an error for the batch to be empty.
+	_, _, err = store.StoreSequenced("topicA", "p1", 2, nil)
+	assert.NotNil(t, err)
+}
+
+func testStoreSequencedRemembersOnlyRecent(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	for sequence := uint64(1); sequence <= SequenceWindow+1; sequence++ {
+		_, _, err = store.StoreSequenced("topicA", "p1", sequence,
+			[]minikafka.Message{textMessage("abc")})
+		assert.Nil(t, err)
+	}
+	// The oldest is forgotten, so is stored again.
+	first, _, err := store.StoreSequenced("topicA", "p1", 1,
+		[]minikafka.Message{textMessage("abc")})
+	assert.Nil(t, err)
+	assert.Equal(t, SequenceWindow+2, first)
+	// But the next oldest is not.
+	first, _, err = store.StoreSequenced("topicA", "p1", 3,
+		[]minikafka.Message{textMessage("abc")})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, first)
+}
+
+func testSequencesAreDeletedWithTopic(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	_, _, err = store.StoreSequenced("topicA", "p1", 1,
+		[]minikafka.Message{textMessage("abc")})
+	assert.Nil(t, err)
+	err = store.DeleteTopic("topicA")
+	assert.Nil(t, err)
+	first, _, err := store.StoreSequenced("topicA", "p1", 1,
+		[]minikafka.Message{textMessage("abc")})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, first)
+}
+
+func testStoreBatchIfNext(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	batch := []minikafka.Message{textMessage("abc"), textMessage("def")}
+
+	// A topic that does not exist yet, is expecting message number 1.
+	_, _, err = store.StoreBatchIfNext("topicA", 2, "", 0, batch)
+	assert.Equal(t, UnexpectedNextError{Expected: 2, Next: 1}, err)
+	first, last, err := store.StoreBatchIfNext("topicA", 1, "", 0, batch)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, first)
+	assert.Equal(t, 2, last)
+
+	// A stale expectation stores nothing.
+	_, _, err = store.StoreBatchIfNext("topicA", 1, "", 0, batch)
+	assert.Equal(t, UnexpectedNextError{Expected: 1, Next: 3}, err)
+	_, next, err := store.AvailableRange("topicA")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, next)
+
+	// Removing messages does not change what is expected next.
+	err = store.RemoveOldMessages(time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	first, _, err = store.StoreBatchIfNext("topicA", 3, "", 0, batch)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, first)
+}
+
+func testStoreBatchIfNextWhenRetried(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	batch := []minikafka.Message{textMessage("abc")}
+	first, _, err := store.StoreBatchIfNext("topicA", 1, "p1", 1, batch)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, first)
+
+	// The expectation no longer holds, but the retry is recognised.
+	first, _, err = store.StoreBatchIfNext("topicA", 1, "p1", 1, batch)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, first)
+
+	// Whereas a new request is not.
+	_, _, err = store.StoreBatchIfNext("topicA", 1, "p1", 2, batch)
+	assert.Equal(t, UnexpectedNextError{Expected: 1, Next: 2}, err)
+}
+
+func testStoreTransaction(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	_, err = store.Store("topicA", textMessage("abc"))
+	assert.Nil(t, err)
+	ranges, err := store.StoreTransaction([]TopicBatch{
+		{Topic: "topicA", Messages: []minikafka.Message{
+			textMessage("def"), textMessage("ghi")}},
+		{Topic: "topicB", Messages: []minikafka.Message{
+			textMessage("jkl")}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []MsgNumberRange{{First: 2, Last: 3}, {First: 1, Last: 1}},
+		ranges)
+
+	messages, _, err := store.Poll("topicA", 2, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, "ghi", string(messages[1].Payload))
+	messages, _, err = store.Poll("topicB", 1, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(messages))
+	assert.Equal(t, "jkl", string(messages[0].Payload))
+}
+
+func testStoreTransactionIsAllOrNothing(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	_, err = store.StoreTransaction(nil)
+	assert.NotNil(t, err)
+
+	// An empty batch fails the whole transaction.
+	_, err = store.StoreTransaction([]TopicBatch{
+		{Topic: "topicA", Messages: []minikafka.Message{textMessage("abc")}},
+		{Topic: "topicB"},
+	})
+	assert.NotNil(t, err)
+	_, _, err = store.Poll("topicA", 1, 0, 0)
+	assert.NotNil(t, err) // No such topic.
+}
+
+func testCompact(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	fillers := storeForCompaction(t, store, "topicA",
+		"a", "a1", "a", "a2", "b", "b1", "b", "", "", "no key")
+
+	// Tombstones survive while they are recent.
+	err = store.Compact(time.Time{})
+	assert.Nil(t, err)
+	messages, _, err := pollAvailable(store, "topicA")
+	assert.Nil(t, err)
+	assert.Equal(t, append([]int{2, 4, 5}, fillers...), msgNumbersOf(messages))
+	assert.Equal(t, "a2", string(messages[0].Payload))
+	assert.Equal(t, "a", string(messages[0].Key))
+
+	// Until they are not.
+	err = store.Compact(time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	messages, _, err = pollAvailable(store, "topicA")
+	assert.Nil(t, err)
+	assert.Equal(t, append([]int{2, 5}, fillers...), msgNumbersOf(messages))
+	description, err := store.DescribeTopic("topicA")
+	assert.Nil(t, err)
+	assert.Equal(t, 2+len(fillers), description.NumMessages)
+
+	// Message numbers carry on from where they were.
+	msgNumber, err := store.Store("topicA", textMessage("foo"))
+	assert.Nil(t, err)
+	assert.Equal(t, fillers[len(fillers)-1]+1, msgNumber)
+}
+
+func testCompactOnlyTopicsThatAskForIt(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	fillers := storeForCompaction(t, store, "topicA", "a", "a1", "a", "a2")
+	err = store.SetRetentionPolicy("topicA", RetentionPolicy{})
+	assert.Nil(t, err)
+	err = store.Compact(time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	messages, _, err := pollAvailable(store, "topicA")
+	assert.Nil(t, err)
+	assert.Equal(t, append([]int{1, 2}, fillers...), msgNumbersOf(messages))
+}
+
+func testPollAcrossCompactedMessages(t *testing.T, store BackingStore) {
+	err := store.DeleteContents()
+	assert.Nil(t, err)
+	fillers := storeForCompaction(t, store, "topicA",
+		"c", "c1", "a", "a1", "b", "b1", "a", "a2")
+	err = store.Compact(time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+
+	// Reading from a message that has gone starts from the next that has
+	// not, and limits count only the messages returned.
+	messages, newReadFrom, err := store.Poll("topicA", 2, 2, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{3, 4}, msgNumbersOf(messages))
+	assert.Equal(t, 5, newReadFrom)
+	messages, _, err = store.Poll("topicA", newReadFrom, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, fillers, msgNumbersOf(messages))
 }
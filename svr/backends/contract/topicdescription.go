@@ -0,0 +1,27 @@
+package contract
+
+import (
+	"time"
+)
+
+// TopicDescription is the summary information about a topic (or one of its
+// partitions) that BackingStore.DescribeTopic provides. The message numbers
+// and creation times are those of the oldest and newest messages currently
+// held. They have zero values when there are no messages.
+type TopicDescription struct {
+	OldestMsgNumber int
+	NewestMsgNumber int
+	OldestCreated   time.Time
+	NewestCreated   time.Time
+	NumMessages     int
+	// The bytes held, including any overhead the store incurs per message.
+	NumBytes int64
+	// The number of files (segments) the messages are stored in. Always zero
+	// for stores that do not use files.
+	NumSegments int
+	// The policy set with SetRetentionPolicy, or the zero value if none has
+	// been.
+	Retention RetentionPolicy
+	// The number of partitions the topic has.
+	NumPartitions int
+}
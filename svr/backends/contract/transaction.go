@@ -0,0 +1,19 @@
+package contract
+
+import (
+	minikafka "github.com/peterhoward42/minikafka"
+)
+
+// TopicBatch is a batch of messages bound for one topic, (or partition log),
+// as part of a transaction. (See StoreTransaction).
+type TopicBatch struct {
+	Topic    string
+	Messages []minikafka.Message
+}
+
+// MsgNumberRange is the range of message numbers assigned to a batch of
+// messages, from First to Last inclusive.
+type MsgNumberRange struct {
+	First int
+	Last  int
+}
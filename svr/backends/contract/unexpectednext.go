@@ -0,0 +1,31 @@
+package contract
+
+import (
+	"fmt"
+)
+
+// UnexpectedNextError is the error that StoreBatchIfNext returns when the
+// topic's next message number is not the one the caller expected; meaning
+// that other messages have been stored since the caller learned what it
+// would be.
+type UnexpectedNextError struct {
+	Expected int
+	// The number the next message to be stored will get.
+	Next int
+}
+
+// Error is defined by, and documented in the standard error interface.
+func (e UnexpectedNextError) Error() string {
+	return fmt.Sprintf(
+		"Expected the next message number to be %d, but it is %d",
+		e.Expected, e.Next)
+}
+
+// CheckExpectedNext provides an UnexpectedNextError when the given next
+// message number is not the one expected, and nil otherwise.
+func CheckExpectedNext(expected int, next int) error {
+	if expected != next {
+		return UnexpectedNextError{Expected: expected, Next: next}
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package contract
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckExpectedNext(t *testing.T) {
+	assert.Nil(t, CheckExpectedNext(3, 3))
+	err := CheckExpectedNext(3, 5)
+	assert.Equal(t, UnexpectedNextError{Expected: 3, Next: 5}, err)
+}
@@ -0,0 +1,220 @@
+package actions
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	minikafka "github.com/peterhoward42/minikafka"
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/envelope"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/ioutils"
+)
+
+// CompactAction encapsulates a single execution of the compact command.
+type CompactAction struct {
+	TombstonesBefore time.Time
+	Index            *indexing.Index
+	RootDir          string
+}
+
+// Compact is the internal entry point function to compact the topics whose
+// retention policy asks for it. Every message file except the one being
+// appended to is eligible. Each file that holds messages which compaction
+// removes is replaced by a new file holding only those that remain, which
+// takes its place in the index; or is simply forgotten, when none remain.
+// The messages keep their message numbers, and their original envelopes; and
+// the new file has the same format as the one it replaces. Files written
+// before envelopes existed hold no keys, so are left alone.
+//
+// The files replaced are not deleted. Instead their paths are returned, and
+// the caller should delete them only once it has saved the index, so that
+// the index saved always refers to files that exist - whether or not the
+// server stops part way through. It is not responsible for mutex protection,
+// nor saving the index. After an error, the caller must discard the index
+// rather than save it.
+func (action CompactAction) Compact() (
+	obsoleteFiles []string, nMessagesRemoved int, err error) {
+	obsoleteFiles = []string{}
+	newFiles := []string{}
+	for topic, msgFileList := range action.Index.MessageFileLists {
+		// Partitions share their topic's retention policy.
+		parentTopic, _ := contract.ParsePartitionLog(topic)
+		if action.Index.RetentionPolicy(parentTopic).Compact == false {
+			continue
+		}
+		replaced, created, nRemoved, err := action.compactTopic(
+			topic, msgFileList)
+		newFiles = append(newFiles, created...)
+		if err != nil {
+			// Leave no trace of the new files.
+			for _, filePath := range newFiles {
+				os.Remove(filePath)
+			}
+			return nil, -1, fmt.Errorf("compactTopic(): %v", err)
+		}
+		obsoleteFiles = append(obsoleteFiles, replaced...)
+		nMessagesRemoved += nRemoved
+	}
+	return obsoleteFiles, nMessagesRemoved, nil
+}
+
+// compactTopic is a topic-specific helper function for Compact. It returns
+// the paths of the files it has replaced, and of those it has created.
+func (action CompactAction) compactTopic(topic string,
+	msgFileList *indexing.MessageFileList) (replaced []string,
+	created []string, nRemoved int, err error) {
+
+	if len(msgFileList.Names) < 2 {
+		return nil, nil, 0, nil
+	}
+
+	// Which message has the newest of each key? (The file being appended to
+	// must be included here, even though it is not itself compacted).
+	newest := contract.NewestForKeys{}
+	for _, fileName := range msgFileList.Names {
+		records, err := action.readRecords(topic, fileName, msgFileList)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("readRecords(): %v", err)
+		}
+		for _, record := range records {
+			newest.Record(record.message.Key, int(record.msgNum))
+		}
+	}
+
+	// Work out what becomes of each closed file, without changing the list
+	// of names until afterwards.
+	closedFiles := append([]string{}, msgFileList.Names[:len(
+		msgFileList.Names)-1]...)
+	emptied := []string{}
+	used := usedNames{index: action.Index, replaced: map[string]bool{}}
+	for _, fileName := range closedFiles {
+		records, err := action.readRecords(topic, fileName, msgFileList)
+		if err != nil {
+			return nil, created, 0, fmt.Errorf("readRecords(): %v", err)
+		}
+		kept := []fileRecord{}
+		for _, record := range records {
+			if newest.Keep(record.message, int(record.msgNum), record.created,
+				action.TombstonesBefore) {
+				kept = append(kept, record)
+			}
+		}
+		if len(kept) == len(records) {
+			continue
+		}
+		nRemoved += len(records) - len(kept)
+		replaced = append(replaced, filenamer.MessageFilePath(
+			fileName, topic, action.RootDir))
+		if len(kept) == 0 {
+			emptied = append(emptied, fileName)
+			continue
+		}
+		newName, err := action.writeFile(topic, fileName, kept, msgFileList,
+			used)
+		if err != nil {
+			return nil, created, 0, fmt.Errorf("writeFile(): %v", err)
+		}
+		created = append(created, filenamer.MessageFilePath(
+			newName, topic, action.RootDir))
+	}
+	msgFileList.ForgetFiles(emptied)
+	return replaced, created, nRemoved, nil
+}
+
+// fileRecord is one message as it is held in a message file.
+type fileRecord struct {
+	msgNum  int32
+	bytes   []byte // As held in the file.
+	message minikafka.Message
+	created time.Time
+}
+
+// readRecords reads every message the index knows about in the given file.
+// Files written before envelopes existed provide none, because their
+// messages have no keys, and no creation times.
+func (action CompactAction) readRecords(topic string, fileName string,
+	msgFileList *indexing.MessageFileList) ([]fileRecord, error) {
+	fileMeta := msgFileList.Meta[fileName]
+	if fileMeta.Format == envelope.FormatRaw {
+		return nil, nil
+	}
+	contents, err := ioutil.ReadFile(
+		filenamer.MessageFilePath(fileName, topic, action.RootDir))
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile(): %v", err)
+	}
+	records := []fileRecord{}
+	numbers := fileMeta.MessageNumbers()
+	for i, msgNum := range numbers {
+		start := fileMeta.SeekOffsetForMessageNumber[msgNum]
+		end := endOfMessage(fileMeta, numbers, i)
+		if end > int64(len(contents)) {
+			return nil, fmt.Errorf("Message file %v is shorter than indexed",
+				fileName)
+		}
+		message, created, err := envelope.Decode(contents[start:end],
+			fileMeta.Format)
+		if err != nil {
+			return nil, fmt.Errorf("envelope.Decode(): %v", err)
+		}
+		records = append(records, fileRecord{msgNum: msgNum,
+			bytes: contents[start:end], message: message, created: created})
+	}
+	return records, nil
+}
+
+// writeFile writes the given records to a new message file, and puts it in
+// the place of the file they came from, in the index.
+func (action CompactAction) writeFile(topic string, oldName string,
+	records []fileRecord, msgFileList *indexing.MessageFileList,
+	used usedNames) (newName string, err error) {
+	newName = filenamer.NewMsgFilenameFor(topic, used)
+	fileMeta := indexing.NewFileMeta()
+	fileMeta.Format = msgFileList.Meta[oldName].Format
+	contents := envelope.FileHeader(fileMeta.Format)
+	fileMeta.Size = int64(len(contents))
+	for _, record := range records {
+		fileMeta.RegisterNewMessageAt(record.msgNum, int64(len(record.bytes)),
+			record.created)
+		contents = append(contents, record.bytes...)
+	}
+	filePath := filenamer.MessageFilePath(newName, topic, action.RootDir)
+	err = ioutil.WriteFile(filePath, contents, 0666)
+	if err != nil {
+		os.Remove(filePath)
+		return "", fmt.Errorf("ioutil.WriteFile(): %v", err)
+	}
+	// The index saved refers to the new file, so it must be on disk first.
+	err = ioutils.SyncFile(filePath)
+	if err != nil {
+		os.Remove(filePath)
+		return "", fmt.Errorf("ioutils.SyncFile(): %v", err)
+	}
+	for i, name := range msgFileList.Names {
+		if name == oldName {
+			msgFileList.Names[i] = newName
+		}
+	}
+	delete(msgFileList.Meta, oldName)
+	msgFileList.Meta[newName] = fileMeta
+	used.replaced[oldName] = true
+	return newName, nil
+}
+
+// usedNames is a filenamer.PreviouslyUsedChecker for the files of one topic,
+// that also counts the names of the files that compaction has replaced. They
+// must not be reused, because the files exist until the index is saved.
+type usedNames struct {
+	index    *indexing.Index
+	replaced map[string]bool
+}
+
+// PreviouslyUsed is defined by, and documented in the
+// filenamer.PreviouslyUsedChecker interface.
+func (u usedNames) PreviouslyUsed(name string, topic string) bool {
+	return u.replaced[name] || u.index.PreviouslyUsed(name, topic)
+}
@@ -0,0 +1,109 @@
+package actions
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/peterhoward42/minikafka"
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/ioutils"
+)
+
+func TestCompact(t *testing.T) {
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	index := indexing.NewIndex()
+	const topic = "topicA"
+	index.RegisterTopic(topic)
+	index.SetRetentionPolicy(topic, contract.RetentionPolicy{Compact: true})
+
+	// Big enough messages that two fill a file. The files thus hold:
+	// [1 2] [3 4 5] [6 7], of which the last is not compacted.
+	big := make([]byte, 400000)
+	for _, message := range []minikafka.Message{
+		{Key: []byte("a"), Payload: big},
+		{Key: []byte("b"), Payload: big},
+		{Key: []byte("a"), Payload: big},
+		{Payload: big},
+		{Key: []byte("b")}, // Tombstone.
+		{Key: []byte("c"), Payload: big},
+		{Key: []byte("c"), Payload: big},
+	} {
+		storeAction := StoreAction{Topic: topic, Message: message,
+			Index: index, RootDir: rootDir}
+		_, _, err := storeAction.Store()
+		assert.Nil(t, err)
+	}
+	assert.Len(t, index.MessageFileLists[topic].Names, 3)
+
+	// Tombstones are kept while they are recent.
+	action := CompactAction{Index: index, RootDir: rootDir}
+	obsoleteFiles, nRemoved, err := action.Compact()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, nRemoved)
+	assert.Len(t, obsoleteFiles, 1)
+	assert.Equal(t, []int{3, 4, 5, 6, 7}, pollNumbers(t, index, rootDir, 3))
+
+	// The files replaced are left for the caller to remove.
+	for _, filePath := range obsoleteFiles {
+		assert.True(t, ioutils.Exists(filePath))
+	}
+
+	// And removed once they are old enough.
+	action.TombstonesBefore = time.Now().Add(time.Hour)
+	obsoleteFiles, nRemoved, err = action.Compact()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, nRemoved)
+	assert.Len(t, obsoleteFiles, 1)
+	assert.Equal(t, []int{3, 4, 6, 7}, pollNumbers(t, index, rootDir, 3))
+	assert.Equal(t, 4, index.MessageFileLists[topic].NumMessages())
+
+	// Reading from a message that has gone, carries on from the next.
+	assert.Equal(t, []int{6, 7}, pollNumbers(t, index, rootDir, 5))
+
+	// Numbering carries on from where it was.
+	storeAction := StoreAction{Topic: topic, Message: minikafka.Message{
+		Payload: []byte("abc")}, Index: index, RootDir: rootDir}
+	msgNumber, _, err := storeAction.Store()
+	assert.Nil(t, err)
+	assert.Equal(t, 8, msgNumber)
+}
+
+func TestCompactIgnoresOtherTopics(t *testing.T) {
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	index := indexing.NewIndex()
+	big := make([]byte, 400000)
+	for i := 0; i < 5; i++ {
+		storeAction := StoreAction{Topic: "topicA", Message: minikafka.Message{
+			Key: []byte("a"), Payload: big}, Index: index, RootDir: rootDir}
+		_, _, err := storeAction.Store()
+		assert.Nil(t, err)
+	}
+	action := CompactAction{Index: index, RootDir: rootDir}
+	obsoleteFiles, nRemoved, err := action.Compact()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, nRemoved)
+	assert.Len(t, obsoleteFiles, 0)
+}
+
+// pollNumbers provides the numbers of the messages in topicA, from
+// *readFrom*, in the order Poll provides them.
+func pollNumbers(t *testing.T, index *indexing.Index, rootDir string,
+	readFrom int) []int {
+	pollAction := PollAction{Topic: "topicA", ReadFrom: readFrom,
+		Index: index, RootDir: rootDir}
+	messages, _, err := pollAction.Poll()
+	assert.Nil(t, err)
+	numbers := []int{}
+	for _, message := range messages {
+		numbers = append(numbers, message.Number)
+	}
+	return numbers
+}
@@ -0,0 +1,90 @@
+package actions
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/envelope"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
+)
+
+// OffsetForTimeAction encapsulates a single execution of the OffsetForTime
+// command.
+type OffsetForTimeAction struct {
+	Topic   string
+	Time    time.Time
+	Index   *indexing.Index
+	RootDir string
+}
+
+// OffsetForTime is the internal entry point function to find the first
+// message stored at or after a given time. The index narrows the search down
+// to a single file, without looking inside any. Only when the time falls
+// part way through that file, are the creation times of some of its
+// messages read from it - by binary search. It is not responsible for mutex
+// protection.
+func (action OffsetForTimeAction) OffsetForTime() (msgNumber int, err error) {
+	msgFileList, ok := action.Index.MessageFileLists[action.Topic]
+	if ok == false {
+		return -1, contract.NoSuchTopicError{Topic: action.Topic}
+	}
+	for _, fileName := range msgFileList.Names {
+		fileMeta := msgFileList.Meta[fileName]
+		if fileMeta.Oldest.MsgNum == 0 ||
+			fileMeta.Newest.Created.Before(action.Time) {
+			continue
+		}
+		// Files written before envelopes existed do not record each
+		// message's creation time, so the whole file must qualify.
+		if fileMeta.Oldest.Created.Before(action.Time) == false ||
+			fileMeta.Format == envelope.FormatRaw {
+			return int(fileMeta.Oldest.MsgNum), nil
+		}
+		return action.searchFile(fileName, fileMeta)
+	}
+	// Every message was stored earlier, so only those yet to come qualify.
+	return int(action.Index.NextMessageNumbers[action.Topic]), nil
+}
+
+// searchFile finds the first message in the given file that was stored at or
+// after the action's time, when the file is known to contain one.
+func (action OffsetForTimeAction) searchFile(
+	fileName string, fileMeta *indexing.FileMeta) (msgNumber int, err error) {
+	filePath := filenamer.MessageFilePath(fileName, action.Topic, action.RootDir)
+	file, err := os.Open(filePath)
+	if err != nil {
+		return -1, fmt.Errorf("os.Open(): %v", err)
+	}
+	defer file.Close()
+
+	// Compaction can leave gaps in the message numbers.
+	numbers := fileMeta.MessageNumbers()
+	prefix := make([]byte, envelope.CreatedSize)
+	i := sort.Search(len(numbers), func(i int) bool {
+		if err != nil {
+			return true
+		}
+		seek := fileMeta.SeekOffsetForMessageNumber[numbers[i]] +
+			envelope.CreatedOffset(fileMeta.Format)
+		_, err = file.ReadAt(prefix, seek)
+		if err != nil {
+			err = fmt.Errorf("file.ReadAt(): %v", err)
+			return true
+		}
+		var created time.Time
+		created, err = envelope.DecodeCreated(prefix)
+		if err != nil {
+			err = fmt.Errorf("envelope.DecodeCreated(): %v", err)
+			return true
+		}
+		return created.Before(action.Time) == false
+	})
+	if err != nil {
+		return -1, err
+	}
+	return int(numbers[i]), nil
+}
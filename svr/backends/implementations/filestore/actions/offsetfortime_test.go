@@ -0,0 +1,62 @@
+package actions
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/peterhoward42/minikafka"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/ioutils"
+)
+
+func TestOffsetForTime(t *testing.T) {
+	// Store messages across several files, noting the time between each
+	// one, and make sure that seeking to each of those times finds the
+	// message stored next.
+
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	index := indexing.NewIndex()
+	topic := "sometopic"
+	storeAction := StoreAction{
+		Topic:   topic,
+		Message: minikafka.Message{Payload: make([]byte, 300e3)}, // 3 per file.
+		Index:   index,
+		RootDir: rootDir,
+	}
+	const nMessages = 8
+	times := []time.Time{}
+	for i := 0; i < nMessages; i++ {
+		times = append(times, time.Now())
+		time.Sleep(2 * time.Millisecond)
+		_, _, err := storeAction.Store()
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 3, len(index.MessageFileLists[topic].Names))
+
+	for i, seekTime := range times {
+		action := OffsetForTimeAction{
+			Topic: topic, Time: seekTime, Index: index, RootDir: rootDir}
+		msgNumber, err := action.OffsetForTime()
+		assert.Nil(t, err)
+		assert.Equal(t, i+1, msgNumber)
+	}
+
+	// Later than every message.
+	action := OffsetForTimeAction{
+		Topic: topic, Time: time.Now(), Index: index, RootDir: rootDir}
+	msgNumber, err := action.OffsetForTime()
+	assert.Nil(t, err)
+	assert.Equal(t, nMessages+1, msgNumber)
+}
+
+func TestOffsetForTimeWhenTopicIsUnknown(t *testing.T) {
+	action := OffsetForTimeAction{
+		Topic: "nosuchtopic", Time: time.Now(), Index: indexing.NewIndex()}
+	_, err := action.OffsetForTime()
+	assert.NotNil(t, err)
+}
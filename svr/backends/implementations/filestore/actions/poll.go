@@ -4,32 +4,45 @@ package actions
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
+	"sort"
 
 	"github.com/peterhoward42/minikafka"
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/envelope"
 	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
 	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
 )
 
 // PollAction encapsulates a single execution of the Poll command.
+// MaxMessages and MaxBytes limit how much is returned, when they are
+// non-zero. (See the BackingStore interface).
 type PollAction struct {
-	Topic    string
-	ReadFrom int
-	Index    *indexing.Index
-	RootDir  string
+	Topic       string
+	ReadFrom    int
+	Index       *indexing.Index
+	RootDir     string
+	MaxMessages int
+	MaxBytes    int
 }
 
 // Poll is the internal entry point function to poll for messages beyond a given
 // message number.  Its responsibility is to perform the poll operation. It is
 // not responsible for mutex protection,
 func (action PollAction) Poll() (
-	foundMessages []minikafka.Message, newReadFrom int, err error) {
+	foundMessages []minikafka.StoredMessage, newReadFrom int, err error) {
 
 	// Access the topic-specific indexing information.
 	msgFileList, ok := action.Index.MessageFileLists[action.Topic]
 	if ok == false {
-		return nil, -1, fmt.Errorf("Unknown topic: %v", action.Topic)
+		return nil, -1, contract.NoSuchTopicError{Topic: action.Topic}
+	}
+
+	// Refuse to serve from somewhere other than where was asked.
+	earliest, next, _ := action.Index.AvailableRange(action.Topic)
+	err = contract.CheckReadFrom(action.ReadFrom, int(earliest), int(next))
+	if err != nil {
+		return nil, -1, err
 	}
 
 	// Which message storage files must we look in?
@@ -39,59 +52,134 @@ func (action PollAction) Poll() (
 
 	// If there are none, return benign data.
 	if len(fileNames) == 0 {
-		return []minikafka.Message{}, int(action.ReadFrom), nil
+		return []minikafka.StoredMessage{}, int(action.ReadFrom), nil
 	}
 
-	// Harvest the messages from this list of files.
-	messages := []minikafka.Message{}
+	// Harvest the messages from this list of files - stopping as soon as
+	// the limits are reached, so as not to read files we don't need.
+	messages := []minikafka.StoredMessage{}
+	nBytes := 0
+	var lastMsgNum int32
 	for _, fileName := range fileNames {
-		messages, err = action.addMessagesFromFile(
-			messages, fileName, int32(messageNumberToReadFrom))
+		var lastInFile int32
+		messages, nBytes, lastInFile, err = action.addMessagesFromFile(
+			messages, nBytes, fileName, int32(messageNumberToReadFrom))
 		if err != nil {
 			return nil, -1, fmt.Errorf("action.AddMessagesFromFile(): %v", err)
 		}
+		if lastInFile != 0 {
+			lastMsgNum = lastInFile
+		}
+		// Not harvesting all of a file's messages means the limits are reached.
+		if lastInFile != msgFileList.Meta[fileName].Newest.MsgNum {
+			break
+		}
 	}
 
-	newReadFrom = int(action.Index.NextMessageNumbers[action.Topic])
+	if len(messages) == 0 {
+		newReadFrom = int(action.Index.NextMessageNumbers[action.Topic])
+	} else {
+		newReadFrom = int(lastMsgNum) + 1
+	}
 
 	return messages, newReadFrom, nil
 }
 
-// addMessagesFromFile appends all the messages in the file beyond (incl.)
-// messageNumberToReadFrom, to the addTo slice, and returns it.
+// addMessagesFromFile appends the messages in the file beyond (incl.)
+// messageNumberToReadFrom, to the addTo slice, and returns it. It stops short
+// of the end of the file when the poll limits are reached. It also returns the
+// updated running total of bytes harvested, and the message number of the last
+// message it added. Only the span of the file that holds the messages
+// required is read.
 func (action PollAction) addMessagesFromFile(
-	addTo []minikafka.Message, fileName string, messageNumberToReadFrom int32) (
-	[]minikafka.Message, error) {
+	addTo []minikafka.StoredMessage, nBytes int, fileName string,
+	messageNumberToReadFrom int32) (messages []minikafka.StoredMessage,
+	newNBytes int, lastMsgNum int32, err error) {
 
-	// Read the file contents into memory.
+	// Which message numbers should we harvest? (Compaction can leave gaps
+	// in them).
+	msgFileList, _ := action.Index.MessageFileLists[action.Topic]
+	fileMeta := msgFileList.Meta[fileName]
+	numbers := fileMeta.MessageNumbers()
+	first := sort.Search(len(numbers), func(i int) bool {
+		return numbers[i] >= messageNumberToReadFrom
+	})
+	end := first
+	for end < len(numbers) {
+		msgSize := int(endOfMessage(fileMeta, numbers, end) -
+			fileMeta.SeekOffsetForMessageNumber[numbers[end]])
+		nSoFar := len(addTo) + end - first
+		if action.limitReached(nSoFar, nBytes, msgSize) {
+			break
+		}
+		nBytes += msgSize
+		end++
+	}
+	if end == first {
+		return addTo, nBytes, 0, nil
+	}
+
+	// Read just the span of the file that holds the targeted messages.
+	spanStart := fileMeta.SeekOffsetForMessageNumber[numbers[first]]
+	spanEnd := endOfMessage(fileMeta, numbers, end-1)
 	filePath := filenamer.MessageFilePath(fileName, action.Topic, action.RootDir)
 	file, err := os.Open(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("os.Open(): %v", err)
+		return nil, 0, 0, fmt.Errorf("os.Open(): %v", err)
 	}
 	defer file.Close()
-	fileContents, err := ioutil.ReadAll(file)
-
-	// Which message numbers should we harvest?
-	msgFileList, _ := action.Index.MessageFileLists[action.Topic]
-	fileMeta := msgFileList.Meta[fileName]
-	startMsgNum := messageNumberToReadFrom
-	if fileMeta.Oldest.MsgNum > startMsgNum {
-		startMsgNum = fileMeta.Oldest.MsgNum
+	span := make([]byte, spanEnd-spanStart)
+	_, err = file.ReadAt(span, spanStart)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("file.ReadAt(): %v", err)
 	}
-	endMsgNum := fileMeta.Newest.MsgNum
 
 	// For each targeted message number, harvest the slice of bytes in the
-	// file that represents it.
-	for msgNum := startMsgNum; msgNum <= endMsgNum; msgNum++ {
-		start := fileMeta.SeekOffsetForMessageNumber[msgNum]
-		end, ok := fileMeta.SeekOffsetForMessageNumber[msgNum+1]
-		if ok == false {
-			end = int64(len(fileContents))
+	// span that represents it.
+	for i := first; i < end; i++ {
+		msgNum := numbers[i]
+		msgStart := fileMeta.SeekOffsetForMessageNumber[msgNum] - spanStart
+		msgEnd := endOfMessage(fileMeta, numbers, i) - spanStart
+		message, created, err := envelope.Decode(span[msgStart:msgEnd],
+			fileMeta.Format)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("envelope.Decode(): %v", err)
+		}
+		// Files written before envelopes existed do not record each
+		// message's creation time. The newest in the file is the best
+		// approximation available, and errs on the side of being late.
+		if created.IsZero() {
+			created = fileMeta.Newest.Created
 		}
-		msgBytes := fileContents[start:end]
-		addTo = append(addTo, msgBytes)
+		addTo = append(addTo, minikafka.StoredMessage{
+			Message: message, Number: int(msgNum), Created: created})
+	}
+
+	return addTo, nBytes, numbers[end-1], nil
+}
+
+// limitReached evaluates whether adding a message of size *msgSize* to the
+// *nMessages* (of total size *nBytes*) already harvested, would break the poll
+// limits. The first message is always allowed, so that consumers can make
+// progress past a message that is bigger than the byte limit.
+func (action PollAction) limitReached(nMessages int, nBytes int,
+	msgSize int) bool {
+	if action.MaxMessages > 0 && nMessages >= action.MaxMessages {
+		return true
 	}
+	if action.MaxBytes > 0 && nMessages > 0 &&
+		nBytes+msgSize > action.MaxBytes {
+		return true
+	}
+	return false
+}
 
-	return addTo, nil
+// endOfMessage provides the seek offset in the message file that is one
+// beyond the last byte of the message *numbers[i]*, given all the message
+// numbers in the file, in order.
+func endOfMessage(fileMeta *indexing.FileMeta, numbers []int32, i int) int64 {
+	if i+1 < len(numbers) {
+		return fileMeta.SeekOffsetForMessageNumber[numbers[i+1]]
+	}
+	return fileMeta.Size
 }
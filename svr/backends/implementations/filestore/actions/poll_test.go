@@ -2,6 +2,7 @@ package actions
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"strings"
 	"testing"
@@ -9,6 +10,8 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/peterhoward42/minikafka"
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
 	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
 	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/ioutils"
 )
@@ -27,7 +30,7 @@ func TestSimplestCase(t *testing.T) {
 
 	index := indexing.NewIndex()
 
-	msg := minikafka.Message("some message")
+	msg := minikafka.Message{Payload: []byte("some message")}
 	topic := "sometopic"
 	storeAction := StoreAction{
 		Topic:   topic,
@@ -43,7 +46,8 @@ func TestSimplestCase(t *testing.T) {
 		}
 	}
 	readFrom := 1
-	action := PollAction{topic, readFrom, index, rootDir}
+	action := PollAction{
+		Topic: topic, ReadFrom: readFrom, Index: index, RootDir: rootDir}
 	messages, newReadFrom, err := action.Poll()
 	if err != nil {
 		msg := fmt.Sprintf("action.Poll(): %v", err)
@@ -71,13 +75,13 @@ func TestSeekOffsetsCalculatedRight(t *testing.T) {
 	topic := "sometopic"
 	storeAction := StoreAction{
 		Topic:   topic,
-		Message: []byte{}, // Overwritten before use.
+		Message: minikafka.Message{}, // Overwritten before use.
 		Index:   index,
 		RootDir: rootDir,
 	}
 	for i := 0; i < 3; i++ {
 		msgString := strings.Repeat("X", i+1)
-		storeAction.Message = []byte(msgString)
+		storeAction.Message.Payload = []byte(msgString)
 		_, _, err := storeAction.Store()
 		if err != nil {
 			msg := fmt.Sprintf("storeAction.Store(): %v", err)
@@ -85,16 +89,17 @@ func TestSeekOffsetsCalculatedRight(t *testing.T) {
 		}
 	}
 	readFrom := 1
-	action := PollAction{topic, readFrom, index, rootDir}
+	action := PollAction{
+		Topic: topic, ReadFrom: readFrom, Index: index, RootDir: rootDir}
 	messages, newReadFrom, err := action.Poll()
 	if err != nil {
 		msg := fmt.Sprintf("action.Poll(): %v", err)
 		assert.Fail(t, msg)
 	}
 	assert.Equal(t, 3, len(messages))
-	assert.Equal(t, "X", string(messages[0]))
-	assert.Equal(t, "XX", string(messages[1]))
-	assert.Equal(t, "XXX", string(messages[2]))
+	assert.Equal(t, "X", string(messages[0].Payload))
+	assert.Equal(t, "XX", string(messages[1].Payload))
+	assert.Equal(t, "XXX", string(messages[2].Payload))
 
 	assert.Equal(t, 4, newReadFrom)
 }
@@ -113,7 +118,8 @@ func TestOnStoreWithNoMessagesRegistered(t *testing.T) {
 	index.GetMessageFileListFor(topic)
 
 	readFrom := 1
-	action := PollAction{topic, readFrom, index, rootDir}
+	action := PollAction{
+		Topic: topic, ReadFrom: readFrom, Index: index, RootDir: rootDir}
 	messages, newReadFrom, err := action.Poll()
 	if err != nil {
 		msg := fmt.Sprintf("action.Poll(): %v", err)
@@ -132,9 +138,10 @@ func TestWhenTopicIsUnknown(t *testing.T) {
 	index := indexing.NewIndex()
 
 	readFrom := 1
-	action := PollAction{"nosuchtopic", readFrom, index, rootDir}
+	action := PollAction{
+		Topic: "nosuchtopic", ReadFrom: readFrom, Index: index, RootDir: rootDir}
 	_, _, err := action.Poll()
-	assert.EqualError(t, err, "Unknown topic: nosuchtopic")
+	assert.EqualError(t, err, "No such topic: nosuchtopic")
 }
 
 func TestWhenReadFromIsEarlierThanAllFiles(t *testing.T) {
@@ -147,7 +154,7 @@ func TestWhenReadFromIsEarlierThanAllFiles(t *testing.T) {
 
 	index := indexing.NewIndex()
 
-	msg := minikafka.Message("some message")
+	msg := minikafka.Message{Payload: []byte("some message")}
 	topic := "sometopic"
 	storeAction := StoreAction{
 		Topic:   topic,
@@ -163,7 +170,8 @@ func TestWhenReadFromIsEarlierThanAllFiles(t *testing.T) {
 		}
 	}
 	readFrom := -999
-	action := PollAction{topic, readFrom, index, rootDir}
+	action := PollAction{
+		Topic: topic, ReadFrom: readFrom, Index: index, RootDir: rootDir}
 	messages, newReadFrom, err := action.Poll()
 	if err != nil {
 		msg := fmt.Sprintf("action.Poll(): %v", err)
@@ -176,14 +184,15 @@ func TestWhenReadFromIsEarlierThanAllFiles(t *testing.T) {
 func TestWhenReadFromIsLaterThanAllFiles(t *testing.T) {
 	// Store a handful of tiny messages and make sure that the Poll action
 	// that specifies a read-from message number higher than any stored,
-	// provides an empty list.
+	// reports that it is out of range. (But that the one beyond the newest
+	// provides an empty list).
 
 	rootDir := ioutils.TmpRootDir(t)
 	defer os.RemoveAll(rootDir)
 
 	index := indexing.NewIndex()
 
-	msg := minikafka.Message("some message")
+	msg := minikafka.Message{Payload: []byte("some message")}
 	topic := "sometopic"
 	storeAction := StoreAction{
 		Topic:   topic,
@@ -198,16 +207,21 @@ func TestWhenReadFromIsLaterThanAllFiles(t *testing.T) {
 			assert.Fail(t, msg)
 		}
 	}
-	readFrom := 999
-	action := PollAction{topic, readFrom, index, rootDir}
+	readFrom := 6
+	action := PollAction{
+		Topic: topic, ReadFrom: readFrom, Index: index, RootDir: rootDir}
 	messages, newReadFrom, err := action.Poll()
 	if err != nil {
 		msg := fmt.Sprintf("action.Poll(): %v", err)
 		assert.Fail(t, msg)
 	}
 	assert.Equal(t, 0, len(messages))
+	assert.Equal(t, 6, newReadFrom)
 
-	assert.Equal(t, 999, newReadFrom)
+	action.ReadFrom = 999
+	_, _, err = action.Poll()
+	assert.Equal(t, contract.OutOfRangeError{
+		ReadFrom: 999, Earliest: 1, Next: 6}, err)
 }
 func TestWhenReadFromIsInMiddleOfFile(t *testing.T) {
 	// Store a handful of tiny messages and make sure that the Poll action
@@ -222,13 +236,13 @@ func TestWhenReadFromIsInMiddleOfFile(t *testing.T) {
 	topic := "sometopic"
 	storeAction := StoreAction{
 		Topic:   topic,
-		Message: []byte{}, // Overwritten before use.
+		Message: minikafka.Message{}, // Overwritten before use.
 		Index:   index,
 		RootDir: rootDir,
 	}
 	for i := 0; i < 5; i++ {
 		msgString := strings.Repeat("X", i+1)
-		storeAction.Message = []byte(msgString)
+		storeAction.Message.Payload = []byte(msgString)
 		_, _, err := storeAction.Store()
 		if err != nil {
 			msg := fmt.Sprintf("storeAction.Store(): %v", err)
@@ -236,16 +250,17 @@ func TestWhenReadFromIsInMiddleOfFile(t *testing.T) {
 		}
 	}
 	readFrom := 3
-	action := PollAction{topic, readFrom, index, rootDir}
+	action := PollAction{
+		Topic: topic, ReadFrom: readFrom, Index: index, RootDir: rootDir}
 	messages, newReadFrom, err := action.Poll()
 	if err != nil {
 		msg := fmt.Sprintf("action.Poll(): %v", err)
 		assert.Fail(t, msg)
 	}
 	assert.Equal(t, 3, len(messages))
-	assert.Equal(t, "XXX", string(messages[0]))
-	assert.Equal(t, "XXXX", string(messages[1]))
-	assert.Equal(t, "XXXXX", string(messages[2]))
+	assert.Equal(t, "XXX", string(messages[0].Payload))
+	assert.Equal(t, "XXXX", string(messages[1].Payload))
+	assert.Equal(t, "XXXXX", string(messages[2].Payload))
 
 	assert.Equal(t, 6, newReadFrom)
 }
@@ -259,7 +274,7 @@ func TestResultsWhenFromMultipleFiles(t *testing.T) {
 	index := indexing.NewIndex()
 
 	topic := "sometopic"
-	message := make([]byte, 200e3) // Big.
+	message := minikafka.Message{Payload: make([]byte, 200e3)} // Big.
 	storeAction := StoreAction{
 		Topic:   topic,
 		Message: message,
@@ -274,7 +289,8 @@ func TestResultsWhenFromMultipleFiles(t *testing.T) {
 		}
 	}
 	readFrom := 1
-	action := PollAction{topic, readFrom, index, rootDir}
+	action := PollAction{
+		Topic: topic, ReadFrom: readFrom, Index: index, RootDir: rootDir}
 	messages, newReadFrom, err := action.Poll()
 	if err != nil {
 		msg := fmt.Sprintf("action.Poll(): %v", err)
@@ -283,3 +299,157 @@ func TestResultsWhenFromMultipleFiles(t *testing.T) {
 	assert.Equal(t, 20, len(messages))
 	assert.Equal(t, 21, newReadFrom)
 }
+func TestLimitsStopShortOfLaterFiles(t *testing.T) {
+	// Store some big messages that force several files to be created, and
+	// make sure a Poll that is limited to fewer messages than the first file
+	// holds, gets just those - and doesn't need the later files at all.
+
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	index := indexing.NewIndex()
+
+	topic := "sometopic"
+	message := minikafka.Message{Payload: make([]byte, 200e3)} // Big.
+	storeAction := StoreAction{
+		Topic:   topic,
+		Message: message,
+		Index:   index,
+		RootDir: rootDir,
+	}
+	for i := 0; i < 20; i++ {
+		_, _, err := storeAction.Store()
+		if err != nil {
+			msg := fmt.Sprintf("storeAction.Store(): %v", err)
+			assert.Fail(t, msg)
+		}
+	}
+	// Remove all but the first file, so that reading any of the others would
+	// be reported as an error.
+	msgFileList := index.MessageFileLists[topic]
+	for _, fileName := range msgFileList.Names[1:] {
+		filePath := filenamer.MessageFilePath(fileName, topic, rootDir)
+		err := os.Remove(filePath)
+		if err != nil {
+			msg := fmt.Sprintf("os.Remove(): %v", err)
+			assert.Fail(t, msg)
+		}
+	}
+	readFrom := 2
+	action := PollAction{
+		Topic: topic, ReadFrom: readFrom, Index: index, RootDir: rootDir,
+		MaxMessages: 2}
+	messages, newReadFrom, err := action.Poll()
+	if err != nil {
+		msg := fmt.Sprintf("action.Poll(): %v", err)
+		assert.Fail(t, msg)
+	}
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, 4, newReadFrom)
+
+	// Same again, but limited by bytes.
+	action = PollAction{
+		Topic: topic, ReadFrom: readFrom, Index: index, RootDir: rootDir,
+		MaxBytes: 500e3}
+	messages, newReadFrom, err = action.Poll()
+	if err != nil {
+		msg := fmt.Sprintf("action.Poll(): %v", err)
+		assert.Fail(t, msg)
+	}
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, 4, newReadFrom)
+}
+
+func TestWhenFileIsInLegacyRawFormat(t *testing.T) {
+	// Message files written before envelopes existed hold just the payload
+	// of each message. Make sure they can still be polled, and that new
+	// messages go into a fresh file in the current format.
+
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	index := indexing.NewIndex()
+	topic := "sometopic"
+	err := ioutils.CreateDirIfDoesntExist(
+		filenamer.DirectoryForTopic(topic, rootDir))
+	assert.Nil(t, err)
+
+	// Hand-craft a legacy file holding two messages.
+	legacyFile := filenamer.NewMsgFilenameFor(topic, index)
+	legacyPath := filenamer.MessageFilePath(legacyFile, topic, rootDir)
+	file, err := os.Create(legacyPath)
+	assert.Nil(t, err)
+	file.Close()
+	err = ioutils.AppendToFile(legacyPath, []byte("XXXX"))
+	assert.Nil(t, err)
+	msgFileList := index.GetMessageFileListFor(topic)
+	msgFileList.RegisterNewFile(legacyFile)
+	fileMeta := msgFileList.Meta[legacyFile]
+	for _, size := range []int64{1, 3} {
+		msgNum := index.GetAndIncrementMessageNumberFor(topic)
+		fileMeta.RegisterNewMessage(msgNum, size)
+	}
+
+	storeAction := StoreAction{
+		Topic:   topic,
+		Message: minikafka.Message{Payload: []byte("YY")},
+		Index:   index,
+		RootDir: rootDir,
+	}
+	_, msgFileUsed, err := storeAction.Store()
+	assert.Nil(t, err)
+	assert.NotEqual(t, legacyFile, msgFileUsed)
+
+	action := PollAction{
+		Topic: topic, ReadFrom: 1, Index: index, RootDir: rootDir}
+	messages, newReadFrom, err := action.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(messages))
+	assert.Equal(t, "X", string(messages[0].Payload))
+	assert.Equal(t, "XXX", string(messages[1].Payload))
+	assert.Equal(t, "YY", string(messages[2].Payload))
+	assert.Equal(t, 3, messages[2].Number)
+	assert.False(t, messages[0].Created.IsZero())
+	assert.Equal(t, 4, newReadFrom)
+}
+
+func TestWhenMessageIsCorrupt(t *testing.T) {
+	// Each message is stored with a checksum, so a message whose bytes have
+	// changed since it was stored is reported, rather than served.
+
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	index := indexing.NewIndex()
+	topic := "sometopic"
+	storeAction := StoreAction{
+		Topic:   topic,
+		Message: minikafka.Message{Payload: []byte("some message")},
+		Index:   index,
+		RootDir: rootDir,
+	}
+	_, msgFileUsed, err := storeAction.Store()
+	assert.Nil(t, err)
+	_, _, err = storeAction.Store()
+	assert.Nil(t, err)
+
+	// Change the last byte of the second message's payload.
+	filePath := filenamer.MessageFilePath(msgFileUsed, topic, rootDir)
+	contents, err := ioutil.ReadFile(filePath)
+	assert.Nil(t, err)
+	contents[len(contents)-1] = 'X'
+	err = ioutil.WriteFile(filePath, contents, 0666)
+	assert.Nil(t, err)
+
+	action := PollAction{
+		Topic: topic, ReadFrom: 2, Index: index, RootDir: rootDir}
+	_, _, err = action.Poll()
+	assert.NotNil(t, err)
+
+	// The message before it is unaffected.
+	action = PollAction{Topic: topic, ReadFrom: 1, MaxMessages: 1,
+		Index: index, RootDir: rootDir}
+	messages, _, err := action.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, "some message", string(messages[0].Payload))
+}
@@ -0,0 +1,155 @@
+package actions
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/envelope"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
+)
+
+// RebuildIndexAction encapsulates a single execution of the rebuild index
+// command, which recreates the index from the message files alone, for when
+// the index has been lost. When Logs is not nil, only those logs are
+// rebuilt.
+type RebuildIndexAction struct {
+	RootDir string
+	Logs    []string
+}
+
+// RebuildIndex is the internal entry point function to rebuild the index. It
+// treats every directory in the root directory as a topic's (or a
+// partition's) log, and reads every message file in it, which must be in
+// FormatFramed. The partition counts come from the directories present. Each
+// file's messages are taken up to the first frame that is incomplete or fails
+// its checksum; the bytes beyond are left for reconciliation to discard.
+// Files holding no valid messages are left out, for reconciliation to remove,
+// as are files holding the same messages as another. It is an error for a
+// file to be in an older format, because such files cannot be read without
+// the index. Numbering carries on from the newest message found.
+//
+// What the message files do not hold is lost: committed offsets, retention
+// policies, producers' recent requests, and the numbers of messages that had
+// already been removed from the end of a log. It is not responsible for mutex
+// protection, nor saving the index.
+func (action RebuildIndexAction) RebuildIndex() (*indexing.Index, error) {
+	index := indexing.NewIndex()
+	entries, err := ioutil.ReadDir(action.RootDir)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadDir(): %v", err)
+	}
+	wanted := map[string]bool{}
+	for _, log := range action.Logs {
+		wanted[log] = true
+	}
+	for _, entry := range entries {
+		if entry.IsDir() == false {
+			continue
+		}
+		topic := entry.Name()
+		if action.Logs == nil || wanted[topic] {
+			err = action.rebuildTopic(index, topic)
+			if err != nil {
+				return nil, fmt.Errorf("rebuildTopic(): %v", err)
+			}
+		}
+		parentTopic, partition := contract.ParsePartitionLog(topic)
+		if int32(partition) >= index.NumPartitions(parentTopic) {
+			index.SetNumPartitions(parentTopic, int32(partition+1))
+		}
+	}
+	return index, nil
+}
+
+// rebuildTopic is a topic-specific helper function for RebuildIndex.
+func (action RebuildIndexAction) rebuildTopic(
+	index *indexing.Index, topic string) error {
+	index.RegisterTopic(topic)
+	msgFileList := index.MessageFileLists[topic]
+	entries, err := ioutil.ReadDir(
+		filenamer.DirectoryForTopic(topic, action.RootDir))
+	if err != nil {
+		return fmt.Errorf("ioutil.ReadDir(): %v", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filenamer.IsIndexFile(entry.Name()) {
+			continue
+		}
+		fileMeta, err := action.readFileMeta(topic, entry.Name())
+		if err != nil {
+			return fmt.Errorf("readFileMeta(): %v", err)
+		}
+		if fileMeta == nil {
+			continue
+		}
+		msgFileList.Names = append(msgFileList.Names, entry.Name())
+		msgFileList.Meta[entry.Name()] = fileMeta
+	}
+	// The files are listed in the order their messages were stored.
+	names, meta := msgFileList.Names, msgFileList.Meta
+	sort.Slice(names, func(i, j int) bool {
+		if meta[names[i]].Oldest.MsgNum != meta[names[j]].Oldest.MsgNum {
+			return meta[names[i]].Oldest.MsgNum < meta[names[j]].Oldest.MsgNum
+		}
+		return len(meta[names[i]].SeekOffsetForMessageNumber) >
+			len(meta[names[j]].SeekOffsetForMessageNumber)
+	})
+	// Files whose messages overlap those of an earlier file are left out.
+	// They are files that compaction wrote, before the index that refers to
+	// them, rather than the files they replace, was saved. Those they
+	// replace hold the same messages, and more.
+	overlapping := []string{}
+	var newest int32
+	for _, name := range names {
+		if meta[name].Oldest.MsgNum <= newest {
+			overlapping = append(overlapping, name)
+			continue
+		}
+		newest = meta[name].Newest.MsgNum
+	}
+	msgFileList.ForgetFiles(overlapping)
+	if newest, ok := msgFileList.Newest(); ok {
+		index.NextMessageNumbers[topic] = newest.MsgNum + 1
+	}
+	return nil
+}
+
+// readFileMeta reads the given message file, and provides the FileMeta that
+// describes the valid messages at its start, or nil when there are none.
+// (Including when the file was being created, and has an incomplete header).
+func (action RebuildIndexAction) readFileMeta(topic string,
+	fileName string) (*indexing.FileMeta, error) {
+	contents, err := ioutil.ReadFile(
+		filenamer.MessageFilePath(fileName, topic, action.RootDir))
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile(): %v", err)
+	}
+	if len(contents) < envelope.FileHeaderSize {
+		return nil, nil
+	}
+	format, err := envelope.ReadFileHeader(contents)
+	if err != nil {
+		return nil, fmt.Errorf("Message file %v: %v", fileName, err)
+	}
+	fileMeta := indexing.NewFileMeta()
+	fileMeta.Format = format
+	fileMeta.Size = envelope.FileHeaderSize
+	for fileMeta.Size < int64(len(contents)) {
+		msgNumber, env, size, err := envelope.Unframe(contents[fileMeta.Size:])
+		if err != nil {
+			break
+		}
+		created, err := envelope.DecodeCreated(env)
+		if err != nil {
+			break
+		}
+		fileMeta.RegisterNewMessageAt(msgNumber, int64(size), created)
+	}
+	if fileMeta.Oldest.MsgNum == 0 {
+		return nil, nil
+	}
+	return fileMeta, nil
+}
@@ -0,0 +1,155 @@
+package actions
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/peterhoward42/minikafka"
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/ioutils"
+)
+
+func TestRebuildIndex(t *testing.T) {
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	// Three files in topicA, and one message in a second partition of
+	// topicB.
+	index := indexing.NewIndex()
+	for i := 0; i < 5; i++ {
+		storeAction := StoreAction{Topic: "topicA", Message: minikafka.Message{
+			Key: []byte("a"), Payload: make([]byte, 400000)}, Index: index,
+			RootDir: rootDir}
+		_, _, err := storeAction.Store()
+		assert.Nil(t, err)
+	}
+	storeAction := StoreAction{Topic: contract.PartitionLog("topicB", 1),
+		Message: minikafka.Message{Payload: []byte("abc")}, Index: index,
+		RootDir: rootDir}
+	_, _, err := storeAction.Store()
+	assert.Nil(t, err)
+
+	action := RebuildIndexAction{RootDir: rootDir}
+	rebuilt, err := action.RebuildIndex()
+	assert.Nil(t, err)
+
+	// The message files are described just as they were.
+	for _, topic := range []string{"topicA", "topicB#1"} {
+		assertSameFiles(t, index.MessageFileLists[topic],
+			rebuilt.MessageFileLists[topic])
+	}
+	assert.Equal(t, int32(6), rebuilt.NextMessageNumbers["topicA"])
+	assert.Equal(t, int32(2), rebuilt.NextMessageNumbers["topicB#1"])
+	assert.Equal(t, int32(2), rebuilt.NumPartitions("topicB"))
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, pollNumbers(t, rebuilt, rootDir, 1))
+}
+
+func TestRebuildIndexStopsAtDamage(t *testing.T) {
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	index := indexing.NewIndex()
+	var fileName string
+	for i := 0; i < 3; i++ {
+		storeAction := StoreAction{Topic: "topicA", Message: minikafka.Message{
+			Payload: []byte("abc")}, Index: index, RootDir: rootDir}
+		_, name, err := storeAction.Store()
+		assert.Nil(t, err)
+		fileName = name
+	}
+	fileMeta := index.MessageFileLists["topicA"].Meta[fileName]
+
+	// Corrupt the last byte of the second message, and leave an empty file
+	// that was being created.
+	filePath := filenamer.MessageFilePath(fileName, "topicA", rootDir)
+	contents, err := ioutil.ReadFile(filePath)
+	assert.Nil(t, err)
+	contents[fileMeta.SeekOffsetForMessageNumber[3]-1]++
+	err = ioutil.WriteFile(filePath, contents, 0666)
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(filenamer.MessageFilePath("EMPTY", "topicA",
+		rootDir), []byte{}, 0666)
+	assert.Nil(t, err)
+
+	action := RebuildIndexAction{RootDir: rootDir}
+	rebuilt, err := action.RebuildIndex()
+	assert.Nil(t, err)
+	msgFileList := rebuilt.MessageFileLists["topicA"]
+	assert.Equal(t, []string{fileName}, msgFileList.Names)
+	assert.Equal(t, fileMeta.SeekOffsetForMessageNumber[2],
+		msgFileList.Meta[fileName].Size)
+	assert.Equal(t, []int{1}, pollNumbers(t, rebuilt, rootDir, 1))
+	assert.Equal(t, int32(2), rebuilt.NextMessageNumbers["topicA"])
+}
+
+func TestRebuildIndexRefusesOlderFormats(t *testing.T) {
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	err := os.Mkdir(filenamer.DirectoryForTopic("topicA", rootDir), 0777)
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(filenamer.MessageFilePath("OLD", "topicA",
+		rootDir), []byte("a message with no frame"), 0666)
+	assert.Nil(t, err)
+
+	action := RebuildIndexAction{RootDir: rootDir}
+	_, err = action.RebuildIndex()
+	assert.NotNil(t, err)
+}
+
+// assertSameFiles asserts that two MessageFileLists describe the same files.
+// (Creation times decoded from files lack the monotonic clock reading that
+// those from time.Now() have, so are compared with Equal).
+func assertSameFiles(t *testing.T, expected *indexing.MessageFileList,
+	actual *indexing.MessageFileList) {
+	assert.Equal(t, expected.Names, actual.Names)
+	for _, name := range expected.Names {
+		want, got := expected.Meta[name], actual.Meta[name]
+		if assert.NotNil(t, got) == false {
+			continue
+		}
+		assert.Equal(t, want.Size, got.Size)
+		assert.Equal(t, want.Format, got.Format)
+		assert.Equal(t, want.SeekOffsetForMessageNumber,
+			got.SeekOffsetForMessageNumber)
+		assert.Equal(t, want.Oldest.MsgNum, got.Oldest.MsgNum)
+		assert.Equal(t, want.Newest.MsgNum, got.Newest.MsgNum)
+		assert.True(t, want.Oldest.Created.Equal(got.Oldest.Created))
+		assert.True(t, want.Newest.Created.Equal(got.Newest.Created))
+	}
+}
+
+func TestRebuildIndexLeavesOutOverlappingFiles(t *testing.T) {
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	// A compacted copy of a file, that the index saved did not come to
+	// refer to.
+	index := indexing.NewIndex()
+	for _, key := range []string{"a", "a", "b"} {
+		storeAction := StoreAction{Topic: "topicA", Message: minikafka.Message{
+			Key: []byte(key), Payload: make([]byte, 400000)}, Index: index,
+			RootDir: rootDir}
+		_, _, err := storeAction.Store()
+		assert.Nil(t, err)
+	}
+	original := index.MessageFileLists["topicA"].Names[0]
+	index.SetRetentionPolicy("topicA", contract.RetentionPolicy{Compact: true})
+	compactAction := CompactAction{Index: index, RootDir: rootDir}
+	obsoleteFiles, _, err := compactAction.Compact()
+	assert.Nil(t, err)
+	assert.Len(t, obsoleteFiles, 1)
+
+	action := RebuildIndexAction{RootDir: rootDir}
+	rebuilt, err := action.RebuildIndex()
+	assert.Nil(t, err)
+	msgFileList := rebuilt.MessageFileLists["topicA"]
+	assert.Len(t, msgFileList.Names, 2)
+	assert.Equal(t, original, msgFileList.Names[0])
+	assert.Equal(t, []int{1, 2, 3}, pollNumbers(t, rebuilt, rootDir, 1))
+}
@@ -0,0 +1,181 @@
+package actions
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/envelope"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/ioutils"
+)
+
+// ReconcileAction encapsulates a single execution of the reconcile command,
+// which brings the message files and the index back into agreement, after
+// the server has stopped abruptly.
+type ReconcileAction struct {
+	Index   *indexing.Index
+	RootDir string
+}
+
+// Reconciliation reports what a ReconcileAction repaired.
+type Reconciliation struct {
+	// Files that had bytes beyond those the index records, which have been
+	// discarded. They are messages whose storing did not finish.
+	FilesTruncated int
+	// Messages the index recorded, but whose bytes were missing from their
+	// files, which the index has forgotten.
+	MessagesForgotten int
+	// Files the index recorded, but which were missing or had lost all their
+	// messages, which the index has forgotten.
+	FilesForgotten int
+	// Files in topics' directories that the index did not refer to, which
+	// have been moved aside to the topics' quarantine directories.
+	OrphansQuarantined int
+}
+
+// IndexChanged reports whether the reconciliation changed the index, so
+// that it must be saved.
+func (r Reconciliation) IndexChanged() bool {
+	return r.MessagesForgotten > 0 || r.FilesForgotten > 0
+}
+
+// Reconcile is the internal entry point function to reconcile the message
+// files with the index. The index is taken to be right about which messages
+// exist, unless their bytes are missing. So bytes beyond those the index
+// records are discarded; messages whose bytes are missing are forgotten,
+// along with files that end up holding none; and files the index does not
+// refer to are moved aside to the topic's quarantine directory, rather than
+// removed, in case it is the index that is wrong. (See RemoveOrphansAction).
+// Temporary index files left behind by saves that did not finish are
+// removed. It is not responsible for mutex protection, nor saving the index.
+func (action ReconcileAction) Reconcile() (
+	reconciliation Reconciliation, err error) {
+	tmpPath := indexing.TmpPath(filenamer.IndexFile(action.RootDir))
+	err = os.Remove(tmpPath)
+	if err != nil && os.IsNotExist(err) == false {
+		return reconciliation, fmt.Errorf("os.Remove(): %v", err)
+	}
+	for topic, msgFileList := range action.Index.MessageFileLists {
+		tmpPath := indexing.TmpPath(filenamer.LogIndexFile(topic, action.RootDir))
+		err = os.Remove(tmpPath)
+		if err != nil && os.IsNotExist(err) == false {
+			return reconciliation, fmt.Errorf("os.Remove(): %v", err)
+		}
+		err = action.reconcileFiles(topic, msgFileList, &reconciliation)
+		if err != nil {
+			return reconciliation, fmt.Errorf("reconcileFiles(): %v", err)
+		}
+		err = action.quarantineOrphans(topic, msgFileList, &reconciliation)
+		if err != nil {
+			return reconciliation, fmt.Errorf("quarantineOrphans(): %v", err)
+		}
+	}
+	return reconciliation, nil
+}
+
+// reconcileFiles makes the files the index records for a topic agree with
+// it, and makes the index forget what has been lost.
+func (action ReconcileAction) reconcileFiles(topic string,
+	msgFileList *indexing.MessageFileList,
+	reconciliation *Reconciliation) error {
+	lost := []string{}
+	for _, fileName := range msgFileList.Names {
+		filePath := filenamer.MessageFilePath(fileName, topic, action.RootDir)
+		info, err := os.Stat(filePath)
+		if os.IsNotExist(err) {
+			reconciliation.MessagesForgotten +=
+				msgFileList.NumMessagesInFile(fileName)
+			lost = append(lost, fileName)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("os.Stat(): %v", err)
+		}
+		fileMeta := msgFileList.Meta[fileName]
+		if info.Size() < fileMeta.Size {
+			nForgotten := fileMeta.ForgetMessagesBeyond(info.Size())
+			reconciliation.MessagesForgotten += nForgotten
+			if msgFileList.NumMessagesInFile(fileName) == 0 {
+				lost = append(lost, fileName)
+				continue
+			}
+			err = correctNewestCreated(filePath, fileMeta)
+			if err != nil {
+				return fmt.Errorf("correctNewestCreated(): %v", err)
+			}
+		}
+		if info.Size() > fileMeta.Size {
+			err = os.Truncate(filePath, fileMeta.Size)
+			if err != nil {
+				return fmt.Errorf("os.Truncate(): %v", err)
+			}
+			reconciliation.FilesTruncated++
+		}
+	}
+	// Files without messages must go, so that every file's newest message
+	// number orders it among the others.
+	msgFileList.ForgetFiles(lost)
+	reconciliation.FilesForgotten += len(lost)
+	return nil
+}
+
+// correctNewestCreated sets the creation time of the newest message in the
+// given file's FileMeta, from the message's envelope, after newer messages
+// have been forgotten. Files written before envelopes existed do not record
+// it, so are left as they are.
+func correctNewestCreated(filePath string, fileMeta *indexing.FileMeta) error {
+	if fileMeta.Format == envelope.FormatRaw {
+		return nil
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("os.Open(): %v", err)
+	}
+	defer file.Close()
+	prefix := make([]byte, envelope.CreatedSize)
+	seek := fileMeta.SeekOffsetForMessageNumber[fileMeta.Newest.MsgNum] +
+		envelope.CreatedOffset(fileMeta.Format)
+	_, err = file.ReadAt(prefix, seek)
+	if err != nil {
+		return fmt.Errorf("file.ReadAt(): %v", err)
+	}
+	fileMeta.Newest.Created, err = envelope.DecodeCreated(prefix)
+	if err != nil {
+		return fmt.Errorf("envelope.DecodeCreated(): %v", err)
+	}
+	return nil
+}
+
+// quarantineOrphans moves the files in a topic's directory that the index
+// does not refer to, to the topic's quarantine directory. They are usually
+// files that were being created when the server stopped, or that compaction
+// had replaced; but they could be messages that a damaged index has lost.
+func (action ReconcileAction) quarantineOrphans(topic string,
+	msgFileList *indexing.MessageFileList,
+	reconciliation *Reconciliation) error {
+	orphans, err := orphanedFiles(
+		filenamer.DirectoryForTopic(topic, action.RootDir), msgFileList.Meta)
+	if err != nil {
+		return fmt.Errorf("orphanedFiles(): %v", err)
+	}
+	if len(orphans) == 0 {
+		return nil
+	}
+	quarantineDir := filenamer.QuarantineDirectory(topic, action.RootDir)
+	err = ioutils.CreateDirIfDoesntExist(quarantineDir)
+	if err != nil {
+		return fmt.Errorf("ioutils.CreateDirIfDoesntExist(): %v", err)
+	}
+	for _, orphan := range orphans {
+		err = os.Rename(
+			filenamer.MessageFilePath(orphan, topic, action.RootDir),
+			path.Join(quarantineDir, orphan))
+		if err != nil {
+			return fmt.Errorf("os.Rename(): %v", err)
+		}
+		reconciliation.OrphansQuarantined++
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package actions
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/peterhoward42/minikafka"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/ioutils"
+)
+
+func TestReconcile(t *testing.T) {
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	// Fill two files with two messages each, and start a third.
+	index := indexing.NewIndex()
+	const topic = "topicA"
+	for i := 0; i < 5; i++ {
+		storeAction := StoreAction{Topic: topic, Message: minikafka.Message{
+			Payload: make([]byte, 400000)}, Index: index, RootDir: rootDir}
+		_, _, err := storeAction.Store()
+		assert.Nil(t, err)
+	}
+	msgFileList := index.MessageFileLists[topic]
+	assert.Len(t, msgFileList.Names, 3)
+	filePath := func(i int) string {
+		return filenamer.MessageFilePath(msgFileList.Names[i], topic, rootDir)
+	}
+	currentFile := msgFileList.Names[2]
+
+	// Lose part of the second message in the second file; add bytes to the
+	// end of the current file that the index does not know about; lose the
+	// first file; and leave an orphan file and a temporary index file.
+	fileMeta := msgFileList.Meta[msgFileList.Names[1]]
+	err := os.Truncate(filePath(1), fileMeta.Size-10)
+	assert.Nil(t, err)
+	err = ioutils.AppendToFile(filePath(2), []byte("partial"))
+	assert.Nil(t, err)
+	err = os.Remove(filePath(0))
+	assert.Nil(t, err)
+	orphan := filenamer.MessageFilePath("ORPHAN", topic, rootDir)
+	err = ioutil.WriteFile(orphan, []byte("abc"), 0666)
+	assert.Nil(t, err)
+	tmpIndex := indexing.TmpPath(filenamer.IndexFile(rootDir))
+	err = ioutil.WriteFile(tmpIndex, []byte("abc"), 0666)
+	assert.Nil(t, err)
+
+	action := ReconcileAction{Index: index, RootDir: rootDir}
+	reconciliation, err := action.Reconcile()
+	assert.Nil(t, err)
+	assert.Equal(t, Reconciliation{FilesTruncated: 2, MessagesForgotten: 3,
+		FilesForgotten: 1, OrphansQuarantined: 1}, reconciliation)
+	assert.True(t, reconciliation.IndexChanged())
+	assert.False(t, ioutils.Exists(orphan))
+	contents, err := ioutil.ReadFile(path.Join(
+		filenamer.QuarantineDirectory(topic, rootDir), "ORPHAN"))
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", string(contents))
+	assert.False(t, ioutils.Exists(tmpIndex))
+
+	// What remains is the first message of the second file, and the
+	// current file.
+	assert.Len(t, msgFileList.Names, 2)
+	assert.Equal(t, []int32{3}, fileMeta.MessageNumbers())
+	info, err := os.Stat(filePath(0))
+	assert.Nil(t, err)
+	assert.Equal(t, fileMeta.Size, info.Size())
+	assert.Equal(t, currentFile, msgFileList.Names[1])
+	info, err = os.Stat(filePath(1))
+	assert.Nil(t, err)
+	assert.Equal(t, msgFileList.Meta[currentFile].Size, info.Size())
+	assert.Equal(t, []int{3, 5}, pollNumbers(t, index, rootDir, 3))
+
+	// Once reconciled, there is nothing more to do.
+	reconciliation, err = action.Reconcile()
+	assert.Nil(t, err)
+	assert.Equal(t, Reconciliation{}, reconciliation)
+}
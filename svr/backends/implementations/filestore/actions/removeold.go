@@ -3,10 +3,9 @@
 package actions
 
 import (
-	"fmt"
-	"os"
 	"time"
 
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
 	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
 	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
 )
@@ -20,38 +19,74 @@ type RemoveOldMessagesAction struct {
 }
 
 // RemoveOldMessages is the internal entry point function to remove expired
-// messages from the filestore. Its responsibility to perform the removal
-// operation and to update the in-memory index. It is not responsible for mutex
-// protection, nor re-saving the index afterwards. These are the responsibility
-// of the caller.  The function contains an optimisation as allowed by the
+// messages from the filestore. Its responsibility is to update the in-memory
+// index so that it forgets them. It is not responsible for mutex protection,
+// nor re-saving the index afterwards. These are the responsibility of the
+// caller.  The function contains an optimisation as allowed by the
 // interface, whereby it does not neccesarily remove all of the messages it is
 // invited to.  The optimisation is to only remove whole message files that are
-// eligible rather than crack any of them open. 
+// eligible rather than crack any of them open. Each topic's retention policy
+// is applied in place of *MaxAge* when it has one.
+//
+// The files forgotten are not deleted. Instead their paths are returned, and
+// the caller should delete them only once it has saved the index, so that
+// the index saved always refers to files that exist. (As for Compact).
 func (action RemoveOldMessagesAction) RemoveOldMessages() (
-	filesRemoved []string, nMessagesRemoved int, err error) {
-	filesRemoved = []string{}
+	obsoleteFiles []string, nMessagesRemoved int) {
+	obsoleteFiles = []string{}
 	nMessagesRemoved = 0
 	// Handle the action on a per-topic basis.
 	for topic, msgFileList := range action.Index.MessageFileLists {
+		// Partitions share their topic's retention policy.
+		parentTopic, _ := contract.ParsePartitionLog(topic)
+		policy := action.Index.RetentionPolicy(parentTopic)
+		if policy.Infinite {
+			continue
+		}
 		// Capture the files to delete and how many messages they had
 		// in them.
-		oldFiles := msgFileList.SpentFiles(action.MaxAge)
+		oldFiles := action.filesToRemove(msgFileList, policy)
 		for _, fileName := range oldFiles {
 			nMessages := msgFileList.NumMessagesInFile(fileName)
 			nMessagesRemoved += nMessages
 		}
-		filesRemoved = append(filesRemoved, oldFiles...)
 		// Mandate the index to forget about these files.
 		msgFileList.ForgetFiles(oldFiles)
-		// Physically remove the files.
 		for _, fileName := range oldFiles {
-			filePath := filenamer.MessageFilePath(
-				fileName, topic, action.RootDir)
-			err = os.Remove(filePath)
-			if err != nil {
-				return nil, -1, fmt.Errorf("os.Remove(): %v", err)
-			}
+			obsoleteFiles = append(obsoleteFiles, filenamer.MessageFilePath(
+				fileName, topic, action.RootDir))
+		}
+	}
+	return obsoleteFiles, nMessagesRemoved
+}
+
+// filesToRemove provides the files from the given topic's list which hold only
+// messages that its retention policy makes eligible for removal; either by
+// age, or by being surplus to its message count or size limits.
+func (action RemoveOldMessagesAction) filesToRemove(
+	msgFileList *indexing.MessageFileList,
+	policy contract.RetentionPolicy) []string {
+	maxAge := action.MaxAge
+	if policy.MaxAge != 0 {
+		maxAge = time.Now().Add(-policy.MaxAge)
+	}
+	files := msgFileList.SpentFiles(maxAge)
+	// Avoid duplicates where files are eligible on more than one count.
+	for _, name := range msgFileList.ExcessFiles(
+		policy.MaxMessages, policy.MaxBytes) {
+		if contains(files, name) == false {
+			files = append(files, name)
+		}
+	}
+	return files
+}
+
+// contains reports whether *names* includes *name*.
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
 		}
 	}
-	return filesRemoved, nMessagesRemoved, nil
+	return false
 }
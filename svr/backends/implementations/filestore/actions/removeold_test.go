@@ -12,12 +12,14 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/peterhoward42/minikafka"
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
 	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
 )
 
 // TestRemoveOld makes sure that the construction and operation of
-// RemoveOldMessagesAction removes the files it should, and returns the correct
-// information about which message files have been deleted.
+// RemoveOldMessagesAction forgets the files it should, and returns the correct
+// information about which message files are to be deleted.
 func TestRemoveOld(t *testing.T) {
 
 	// Prepare a root directory that we can delete after the test.
@@ -29,7 +31,8 @@ func TestRemoveOld(t *testing.T) {
 
 	// We use a store-action we can use multiple times so as to spawn
 	// several message files.
-	message := make([]byte, 100000) // Plenty will fit in each file.
+	// Plenty will fit in each file.
+	message := minikafka.Message{Payload: make([]byte, 100000)}
 	const topic string = "neverheardof"
 	storeAction := StoreAction{
 		Topic:   topic,
@@ -58,22 +61,78 @@ func TestRemoveOld(t *testing.T) {
 	// Set maxAge to target the first two files for deletion.
 	maxAge := newestInFile2.Add(time.Duration(10 * time.Millisecond))
 	removeAction := RemoveOldMessagesAction{maxAge, index, rootDir}
-	filesRemoved, _, err := removeAction.RemoveOldMessages()
-	if err != nil {
-		msg := fmt.Sprintf("removeAction.RemoveOldMessages(): %v", err)
-		assert.Fail(t, msg)
-	}
+	filesRemoved, _ := removeAction.RemoveOldMessages()
 	// Were the correct number of files reported as being removed?
 	expected := 2
 	assert.Equal(t, expected, len(filesRemoved))
 
-	// Are there exactly 3 files remaining on disk?
+	// Are there exactly 3 files remaining in the index?
+	expected = 3
+	assert.Equal(t, expected, len(index.MessageFileLists[topic].Names))
+
+	// Have the files been left on disk, for the caller to remove?
 	dir := filenamer.DirectoryForTopic(topic, rootDir)
 	nFilesRemaining, err := ioutils.CountEntitiesInDir(dir)
 	if err != nil {
 		msg := fmt.Sprintf("ioutils.CountFilesInDir(): %v", err)
 		assert.Fail(t, msg)
 	}
-	expected = 3
+	expected = 5
 	assert.Equal(t, expected, nFilesRemaining)
+	for _, filePath := range filesRemoved {
+		assert.True(t, ioutils.Exists(filePath))
+	}
+}
+
+// TestRemoveOldAppliesRetentionPolicy makes sure that RemoveOldMessagesAction
+// removes the files that a topic's message count limit makes surplus, and
+// that it leaves alone topics whose retention is infinite.
+func TestRemoveOldAppliesRetentionPolicy(t *testing.T) {
+
+	// Prepare a root directory that we can delete after the test.
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	index := indexing.NewIndex()
+
+	// Spawn 5 message files in each of two topics. With messages of this
+	// size, 10 fit in each file, so the fifth file gets just one.
+	message := minikafka.Message{Payload: make([]byte, 100000)}
+	for _, topic := range []string{"limited", "infinite"} {
+		storeAction := StoreAction{
+			Topic:   topic,
+			Message: message,
+			Index:   index,
+			RootDir: rootDir,
+		}
+		for i := 0; i < 41; i++ {
+			_, _, err := storeAction.Store()
+			if err != nil {
+				msg := fmt.Sprintf("storeAction.Store(): %v", err)
+				assert.Fail(t, msg)
+			}
+		}
+	}
+	// Keeping 11 messages needs only the last two files.
+	index.SetRetentionPolicy("limited", contract.RetentionPolicy{
+		MaxMessages: 11})
+	index.SetRetentionPolicy("infinite", contract.RetentionPolicy{
+		Infinite: true})
+
+	// A default maximum age that removes nothing by itself.
+	maxAge := time.Now().Add(time.Duration(-1 * time.Hour))
+	removeAction := RemoveOldMessagesAction{maxAge, index, rootDir}
+	filesRemoved, nMessagesRemoved := removeAction.RemoveOldMessages()
+	assert.Equal(t, 3, len(filesRemoved))
+	assert.Equal(t, 30, nMessagesRemoved)
+	assert.Equal(t, 2, len(index.MessageFileLists["limited"].Names))
+	assert.Equal(t, 5, len(index.MessageFileLists["infinite"].Names))
+
+	// A default maximum age that would remove everything, should still
+	// leave the infinite topic alone.
+	maxAge = time.Now().Add(time.Duration(1 * time.Hour))
+	removeAction = RemoveOldMessagesAction{maxAge, index, rootDir}
+	removeAction.RemoveOldMessages()
+	assert.Equal(t, 0, len(index.MessageFileLists["limited"].Names))
+	assert.Equal(t, 5, len(index.MessageFileLists["infinite"].Names))
 }
@@ -0,0 +1,63 @@
+package actions
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
+)
+
+// RemoveOrphansAction encapsulates a single execution of the remove orphans
+// command, which deletes the files in topics' directories that the index
+// does not refer to; along with those that reconciling has moved aside to the
+// topics' quarantine directories. (See ReconcileAction).
+type RemoveOrphansAction struct {
+	Index   *indexing.Index
+	RootDir string
+}
+
+// RemoveOrphans is the internal entry point function to delete the files
+// that the index does not refer to. It deals only with the topics the index
+// knows, and reports how many files it removed. It is not responsible for
+// mutex protection.
+func (action RemoveOrphansAction) RemoveOrphans() (removed int, err error) {
+	for topic, msgFileList := range action.Index.MessageFileLists {
+		dir := filenamer.DirectoryForTopic(topic, action.RootDir)
+		n, err := removeOrphanedFiles(dir, msgFileList.Meta)
+		removed += n
+		if err != nil {
+			return removed, fmt.Errorf("removeOrphanedFiles(): %v", err)
+		}
+		quarantineDir := filenamer.QuarantineDirectory(topic, action.RootDir)
+		n, err = removeOrphanedFiles(quarantineDir, nil)
+		removed += n
+		if err != nil {
+			return removed, fmt.Errorf("removeOrphanedFiles(): %v", err)
+		}
+		err = os.Remove(quarantineDir)
+		if err != nil && os.IsNotExist(err) == false {
+			return removed, fmt.Errorf("os.Remove(): %v", err)
+		}
+	}
+	return removed, nil
+}
+
+// removeOrphanedFiles removes the message files in the given directory that
+// are not in *known*, and reports how many it removed.
+func removeOrphanedFiles(dir string, known map[string]*indexing.FileMeta) (
+	removed int, err error) {
+	orphans, err := orphanedFiles(dir, known)
+	if err != nil {
+		return 0, fmt.Errorf("orphanedFiles(): %v", err)
+	}
+	for _, orphan := range orphans {
+		err = os.Remove(path.Join(dir, orphan))
+		if err != nil {
+			return removed, fmt.Errorf("os.Remove(): %v", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
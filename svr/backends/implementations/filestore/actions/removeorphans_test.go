@@ -0,0 +1,45 @@
+package actions
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/ioutils"
+)
+
+func TestRemoveOrphans(t *testing.T) {
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	index := storeForVerify(t, rootDir)
+	orphan := filenamer.MessageFilePath("ORPHAN", "topicA", rootDir)
+	err := ioutil.WriteFile(orphan, []byte("abc"), 0666)
+	assert.Nil(t, err)
+	quarantineDir := filenamer.QuarantineDirectory("topicA", rootDir)
+	err = os.Mkdir(quarantineDir, 0777)
+	assert.Nil(t, err)
+	quarantined := path.Join(quarantineDir, "QUARANTINED")
+	err = ioutil.WriteFile(quarantined, []byte("abc"), 0666)
+	assert.Nil(t, err)
+
+	action := RemoveOrphansAction{Index: index, RootDir: rootDir}
+	removed, err := action.RemoveOrphans()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, removed)
+	assert.False(t, ioutils.Exists(orphan))
+	assert.False(t, ioutils.Exists(quarantineDir))
+
+	// The files the index refers to are untouched.
+	verifyAction := VerifyAction{Index: index, RootDir: rootDir}
+	problems, err := verifyAction.Verify()
+	assert.Nil(t, err)
+	assert.Len(t, problems, 0)
+	removed, err = action.RemoveOrphans()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, removed)
+}
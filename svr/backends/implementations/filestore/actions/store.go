@@ -4,9 +4,11 @@ package actions
 
 import (
 	"fmt"
-	"os"
+	"io/ioutil"
+	"time"
 
 	minikafka "github.com/peterhoward42/minikafka"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/envelope"
 	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
 	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
 	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/ioutils"
@@ -20,6 +22,11 @@ type StoreAction struct {
 	Message minikafka.Message
 	Index   *indexing.Index
 	RootDir string
+
+	// The message's envelope, (which is framed as it is written to the
+	// file), and its creation time.
+	record  []byte
+	created time.Time
 }
 
 // Store is the internal entry point function to store a new message in the
@@ -29,6 +36,9 @@ type StoreAction struct {
 func (action StoreAction) Store() (
 	messageNumber int, msgFileUsed string, err error) {
 
+	action.created = time.Now()
+	action.record = envelope.Encode(action.Message, action.created)
+
 	// Special case when the store has never stored a message for this
 	// this topic before.
 	err = action.createTopicDirIfNotExists()
@@ -73,10 +83,16 @@ func (action *StoreAction) createTopicDirIfNotExists() error {
 	return nil
 }
 
+// fileHasInsufficentRoom also treats files written in an older format as full,
+// so that a file never holds a mixture of formats.
 func (action *StoreAction) fileHasInsufficentRoom(msgFileName string) bool {
 	msgFileList := action.Index.MessageFileLists[action.Topic]
-	msgSize := int64(len(action.Message))
-	return msgFileList.Meta[msgFileName].Size+msgSize > maximumFileSize
+	fileMeta := msgFileList.Meta[msgFileName]
+	if fileMeta.Format != envelope.CurrentFormat {
+		return true
+	}
+	msgSize := int64(envelope.FrameHeaderSize + len(action.record))
+	return fileMeta.Size+msgSize > maximumFileSize
 }
 
 // setupNewFileForTopic works out what the new file should be called, creates it,
@@ -85,16 +101,16 @@ func (action *StoreAction) setupNewFileForTopic() (msgFileName string, err error
 	fileName := filenamer.NewMsgFilenameFor(action.Topic, action.Index)
 	filePath := filenamer.MessageFilePath(
 		fileName, action.Topic, action.RootDir)
-	file, err := os.Create(filePath)
+	header := envelope.FileHeader(envelope.CurrentFormat)
+	err = ioutil.WriteFile(filePath, header, 0666)
 	if err != nil {
-		return "", fmt.Errorf("os.Create(): %v", err)
-	}
-	err = file.Close()
-	if err != nil {
-		return "", fmt.Errorf("file.Close(): %v", err)
+		return "", fmt.Errorf("ioutil.WriteFile(): %v", err)
 	}
 	msgFileList := action.Index.GetMessageFileListFor(action.Topic)
 	msgFileList.RegisterNewFile(fileName)
+	fileMeta := msgFileList.Meta[fileName]
+	fileMeta.Format = envelope.CurrentFormat
+	fileMeta.Size = int64(len(header))
 	return fileName, nil
 }
 
@@ -104,13 +120,15 @@ func (action *StoreAction) saveAndRegisterMessage(
 	msgFileName string) (msgNumber int, err error) {
 	filepath := filenamer.MessageFilePath(
 		msgFileName, action.Topic, action.RootDir)
-	err = ioutils.AppendToFile(filepath, action.Message)
+	msgNumber = int(action.Index.GetAndIncrementMessageNumberFor(action.Topic))
+	frame := envelope.Frame(int32(msgNumber), action.record)
+	err = ioutils.AppendToFile(filepath, frame)
 	if err != nil {
 		return 0, fmt.Errorf("ioutils.AppendToFile(): %v", err)
 	}
-	msgNumber = int(action.Index.GetAndIncrementMessageNumberFor(action.Topic))
 	msgFileList := action.Index.GetMessageFileListFor(action.Topic)
 	fileMeta := msgFileList.Meta[msgFileName]
-	fileMeta.RegisterNewMessage(int32(msgNumber), int64(len(action.Message)))
+	fileMeta.RegisterNewMessageAt(int32(msgNumber), int64(len(frame)),
+		action.created)
 	return msgNumber, nil
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/peterhoward42/minikafka"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/envelope"
 	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
 	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/ioutils"
 )
@@ -24,7 +25,7 @@ func TestWhenHasToMakeDirectory(t *testing.T) {
 	index := indexing.NewIndex()
 
 	// Create a store-action that cites a topic that is unknown to the index.
-	msg := minikafka.Message("some message")
+	msg := minikafka.Message{Payload: []byte("some message")}
 	storeAction := StoreAction{
 		Topic:   "neverheardof",
 		Message: msg,
@@ -49,7 +50,7 @@ func TestVirginState(t *testing.T) {
 	index := indexing.NewIndex()
 
 	// Create a store-action with a small payload that we can use twice.
-	msg := minikafka.Message("some message")
+	msg := minikafka.Message{Payload: []byte("some message")}
 	storeAction := StoreAction{
 		Topic:   "neverheardof",
 		Message: msg,
@@ -77,7 +78,7 @@ func TestStorageFileReuse(t *testing.T) {
 	index := indexing.NewIndex()
 
 	// Create a store-action with a small payload that we can use twice.
-	msg := minikafka.Message("some message")
+	msg := minikafka.Message{Payload: []byte("some message")}
 	storeAction := StoreAction{
 		Topic:   "neverheardof",
 		Message: msg,
@@ -108,7 +109,8 @@ func TestTwoLargeMessagesGetPutInDifferentFiles(t *testing.T) {
 	index := indexing.NewIndex()
 
 	// Create a store-action with a large payload that we can use twice.
-	largeMsg := make([]byte, 0.75*maximumFileSize)
+	largeMsg := minikafka.Message{
+		Payload: make([]byte, 0.75*maximumFileSize)}
 	storeAction := StoreAction{
 		Topic:   "neverheardof",
 		Message: largeMsg,
@@ -140,7 +142,7 @@ func TestIndexIsUpdated(t *testing.T) {
 
 	// Create a store-action with a small payload that we can use twice.
 	topic := "justforthistest"
-	msg := minikafka.Message("some message")
+	msg := minikafka.Message{Payload: []byte("some message")}
 	storeAction := StoreAction{
 		Topic:   topic,
 		Message: msg,
@@ -165,8 +167,10 @@ func TestIndexIsUpdated(t *testing.T) {
 
 	// Check the index has tracked the sizes of the message files
 	// as they've grown.
-	const msgSize int64 = 12
-	assert.Equal(t, 2*msgSize, msgFileList.Meta[msgFileUsed].Size)
+	headerSize := int64(len(envelope.FileHeader(envelope.CurrentFormat)))
+	msgSize := int64(envelope.FrameHeaderSize +
+		len(envelope.Encode(msg, time.Now())))
+	assert.Equal(t, headerSize+2*msgSize, msgFileList.Meta[msgFileUsed].Size)
 
 	// Check has tracked Oldest and Newest message numbers.
 	assert.Equal(t, int32(1), msgFileList.Meta[msgFileUsed].Oldest.MsgNum)
@@ -183,9 +187,9 @@ func TestIndexIsUpdated(t *testing.T) {
 	// Check has tracked seek indexes.
 	fileMeta := msgFileList.Meta[msgFileUsed]
 	seek := fileMeta.SeekOffsetForMessageNumber[1]
-	expected := int64(0)
+	expected := headerSize
 	assert.Equal(t, expected, seek)
 	seek = fileMeta.SeekOffsetForMessageNumber[2]
-	expected = msgSize
+	expected = headerSize + msgSize
 	assert.Equal(t, expected, seek)
 }
@@ -0,0 +1,172 @@
+package actions
+
+import (
+	"fmt"
+	"os"
+
+	minikafka "github.com/peterhoward42/minikafka"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/ioutils"
+)
+
+// StoreBatchAction encapsulates a single execution of the store batch (of
+// messages) command.
+type StoreBatchAction struct {
+	Topic    string
+	Messages []minikafka.Message
+	Index    *indexing.Index
+	RootDir  string
+}
+
+// StoreBatch is the internal entry point function to store a batch of
+// messages in the filestore, all or nothing. It stores each message in turn,
+// and should one fail, it restores the message files to how they were before
+// the batch began. The in-memory index is not restored, so after an error,
+// the caller must discard it rather than save it. It is not responsible for
+// mutex protection, nor saving the index.
+func (action StoreBatchAction) StoreBatch() (
+	firstMsgNumber int, lastMsgNumber int, err error) {
+	if len(action.Messages) == 0 {
+		return -1, -1, fmt.Errorf("The batch has no messages")
+	}
+	c, err := takeCheckpoint(action.Topic, action.Index, action.RootDir)
+	if err != nil {
+		return -1, -1, fmt.Errorf("takeCheckpoint(): %v", err)
+	}
+	firstMsgNumber, lastMsgNumber, err = storeMessages(action.Topic,
+		action.Messages, action.Index, action.RootDir)
+	if err != nil {
+		return -1, -1, restoreCheckpoints([]checkpoint{c},
+			action.Index, err)
+	}
+	return firstMsgNumber, lastMsgNumber, nil
+}
+
+// storeMessages stores each of the given messages in turn, stopping at the
+// first that fails. It makes no attempt to undo what it has done. Once every
+// message is written, it flushes the message files written to disk, (and the
+// topic's directory, when it has created any); so that the index that
+// records the messages is never saved before they are.
+func storeMessages(topic string, messages []minikafka.Message,
+	index *indexing.Index, rootDir string) (
+	firstMsgNumber int, lastMsgNumber int, err error) {
+	currentFile := index.CurrentMsgFileNameFor(topic)
+	filesUsed := []string{}
+	for i, message := range messages {
+		storeAction := StoreAction{Topic: topic, Message: message,
+			Index: index, RootDir: rootDir}
+		msgNumber, fileUsed, err := storeAction.Store()
+		if err != nil {
+			return -1, -1, fmt.Errorf("storeAction.Store(): %v", err)
+		}
+		if contains(filesUsed, fileUsed) == false {
+			filesUsed = append(filesUsed, fileUsed)
+		}
+		if i == 0 {
+			firstMsgNumber = msgNumber
+		}
+		lastMsgNumber = msgNumber
+	}
+	toSync := []string{}
+	for _, fileName := range filesUsed {
+		toSync = append(toSync, filenamer.MessageFilePath(
+			fileName, topic, rootDir))
+	}
+	if filesUsed[len(filesUsed)-1] != currentFile {
+		toSync = append(toSync, filenamer.DirectoryForTopic(topic, rootDir))
+	}
+	for _, filePath := range toSync {
+		err = ioutils.SyncFile(filePath)
+		if err != nil {
+			return -1, -1, fmt.Errorf("ioutils.SyncFile(): %v", err)
+		}
+	}
+	return firstMsgNumber, lastMsgNumber, nil
+}
+
+// restoreCheckpoints restores each of the given checkpoints, after the
+// given error has made it necessary, and returns the error to report.
+func restoreCheckpoints(checkpoints []checkpoint, index *indexing.Index,
+	cause error) error {
+	for _, c := range checkpoints {
+		err := c.restore(index)
+		if err != nil {
+			return fmt.Errorf("%v, then checkpoint.restore(): %v", cause, err)
+		}
+	}
+	return cause
+}
+
+// checkpoint records the state of a topic's message files, so that they can
+// be restored to it.
+type checkpoint struct {
+	topic       string
+	rootDir     string
+	existing    map[string]bool // The message files that exist.
+	currentFile string          // The one being appended to, if any.
+	currentSize int64
+}
+
+// takeCheckpoint records the state of the given topic's message files.
+// Before doing so, it discards any bytes at the end of the file being
+// appended to, that the index does not know about. They are left behind
+// when the server stops after writing messages, but before saving the index
+// that records them; and they would otherwise be mistaken for the start of
+// the next message.
+func takeCheckpoint(topic string, index *indexing.Index,
+	rootDir string) (checkpoint, error) {
+	c := checkpoint{topic: topic, rootDir: rootDir, existing: map[string]bool{}}
+	msgFileList, ok := index.MessageFileLists[topic]
+	if ok == false {
+		return c, nil
+	}
+	for _, name := range msgFileList.Names {
+		c.existing[name] = true
+	}
+	c.currentFile = index.CurrentMsgFileNameFor(topic)
+	if c.currentFile == "" {
+		return c, nil
+	}
+	c.currentSize = msgFileList.Meta[c.currentFile].Size
+	filePath := filenamer.MessageFilePath(c.currentFile, topic, rootDir)
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return c, fmt.Errorf("os.Stat(): %v", err)
+	}
+	if info.Size() > c.currentSize {
+		err = os.Truncate(filePath, c.currentSize)
+		if err != nil {
+			return c, fmt.Errorf("os.Truncate(): %v", err)
+		}
+	}
+	return c, nil
+}
+
+// restore puts the topic's message files back to the state recorded by the
+// checkpoint. It consults the given index to learn which files have been
+// created since.
+func (c checkpoint) restore(index *indexing.Index) error {
+	msgFileList, ok := index.MessageFileLists[c.topic]
+	if ok == false {
+		return nil
+	}
+	for _, name := range msgFileList.Names {
+		if c.existing[name] {
+			continue
+		}
+		err := os.Remove(filenamer.MessageFilePath(name, c.topic, c.rootDir))
+		if err != nil && os.IsNotExist(err) == false {
+			return fmt.Errorf("os.Remove(): %v", err)
+		}
+	}
+	if c.currentFile == "" {
+		return nil
+	}
+	err := os.Truncate(filenamer.MessageFilePath(
+		c.currentFile, c.topic, c.rootDir), c.currentSize)
+	if err != nil {
+		return fmt.Errorf("os.Truncate(): %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package actions
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/peterhoward42/minikafka"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/ioutils"
+)
+
+func TestStoreBatch(t *testing.T) {
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	index := indexing.NewIndex()
+	topic := "sometopic"
+	messages := []minikafka.Message{}
+	for _, text := range []string{"abc", "def", "ghi"} {
+		messages = append(messages, minikafka.Message{Payload: []byte(text)})
+	}
+	action := StoreBatchAction{
+		Topic: topic, Messages: messages, Index: index, RootDir: rootDir}
+	first, last, err := action.StoreBatch()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, first)
+	assert.Equal(t, 3, last)
+
+	first, last, err = action.StoreBatch()
+	assert.Nil(t, err)
+	assert.Equal(t, 4, first)
+	assert.Equal(t, 6, last)
+
+	action.Messages = nil
+	_, _, err = action.StoreBatch()
+	assert.NotNil(t, err)
+}
+
+func TestCheckpointRestore(t *testing.T) {
+	// Store a message, take a checkpoint, and then store enough to fill more
+	// files. Make sure restoring the checkpoint puts the message files back
+	// how they were.
+
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	index := indexing.NewIndex()
+	topic := "sometopic"
+	storeAction := StoreAction{
+		Topic:   topic,
+		Message: minikafka.Message{Payload: []byte("some message")},
+		Index:   index,
+		RootDir: rootDir,
+	}
+	_, firstFile, err := storeAction.Store()
+	assert.Nil(t, err)
+	firstPath := filenamer.MessageFilePath(firstFile, topic, rootDir)
+	info, err := os.Stat(firstPath)
+	assert.Nil(t, err)
+	sizeBefore := info.Size()
+
+	c, err := takeCheckpoint(topic, index, rootDir)
+	assert.Nil(t, err)
+	storeAction.Message = minikafka.Message{Payload: make([]byte, 600e3)}
+	for i := 0; i < 3; i++ {
+		_, _, err = storeAction.Store()
+		assert.Nil(t, err)
+	}
+	topicDir := filenamer.DirectoryForTopic(topic, rootDir)
+	nFiles, err := ioutils.CountEntitiesInDir(topicDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, nFiles)
+
+	err = c.restore(index)
+	assert.Nil(t, err)
+	nFiles, err = ioutils.CountEntitiesInDir(topicDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, nFiles)
+	info, err = os.Stat(firstPath)
+	assert.Nil(t, err)
+	assert.Equal(t, sizeBefore, info.Size())
+}
+
+func TestCheckpointDiscardsUnindexedBytes(t *testing.T) {
+	// Simulate the server having stopped after writing a message, but before
+	// saving the index, by appending bytes the index does not know about.
+	// Make sure they are discarded, and that the next message to be stored
+	// can be read back.
+
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	index := indexing.NewIndex()
+	topic := "sometopic"
+	storeAction := StoreAction{
+		Topic:   topic,
+		Message: minikafka.Message{Payload: []byte("abc")},
+		Index:   index,
+		RootDir: rootDir,
+	}
+	_, fileName, err := storeAction.Store()
+	assert.Nil(t, err)
+	filePath := filenamer.MessageFilePath(fileName, topic, rootDir)
+	err = ioutils.AppendToFile(filePath, []byte("unindexed"))
+	assert.Nil(t, err)
+
+	action := StoreBatchAction{Topic: topic, Index: index, RootDir: rootDir,
+		Messages: []minikafka.Message{{Payload: []byte("def")}}}
+	_, _, err = action.StoreBatch()
+	assert.Nil(t, err)
+
+	pollAction := PollAction{Topic: topic, ReadFrom: 1, Index: index,
+		RootDir: rootDir}
+	messages, _, err := pollAction.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, "def", string(messages[1].Payload))
+}
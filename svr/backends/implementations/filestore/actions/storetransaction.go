@@ -0,0 +1,62 @@
+package actions
+
+import (
+	"fmt"
+
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
+)
+
+// StoreTransactionAction encapsulates a single execution of the store
+// transaction command.
+type StoreTransactionAction struct {
+	Batches []contract.TopicBatch
+	Index   *indexing.Index
+	RootDir string
+}
+
+// StoreTransaction is the internal entry point function to store several
+// batches of messages, each in its own topic, all or nothing. It stores each
+// batch in turn, and should a message fail, it restores the message files of
+// every topic involved to how they were before the transaction began. As for
+// StoreBatch, the caller must discard the in-memory index after an error,
+// and it is not responsible for mutex protection, nor saving the index.
+//
+// Nothing becomes visible to Poll until the caller saves the index. Should
+// the server stop before then, the messages written are not in the saved
+// index, and are discarded the next time their topic is written to. (See
+// takeCheckpoint).
+func (action StoreTransactionAction) StoreTransaction() (
+	ranges []contract.MsgNumberRange, err error) {
+	if len(action.Batches) == 0 {
+		return nil, fmt.Errorf("The transaction has no batches")
+	}
+	checkpoints := []checkpoint{}
+	checkpointed := map[string]bool{}
+	for _, batch := range action.Batches {
+		if len(batch.Messages) == 0 {
+			return nil, fmt.Errorf("The batch for %s has no messages",
+				batch.Topic)
+		}
+		if checkpointed[batch.Topic] {
+			continue
+		}
+		c, err := takeCheckpoint(batch.Topic, action.Index, action.RootDir)
+		if err != nil {
+			return nil, fmt.Errorf("takeCheckpoint(): %v", err)
+		}
+		checkpoints = append(checkpoints, c)
+		checkpointed[batch.Topic] = true
+	}
+	ranges = []contract.MsgNumberRange{}
+	for _, batch := range action.Batches {
+		first, last, err := storeMessages(batch.Topic, batch.Messages,
+			action.Index, action.RootDir)
+		if err != nil {
+			return nil, restoreCheckpoints(checkpoints, action.Index, err)
+		}
+		ranges = append(ranges, contract.MsgNumberRange{
+			First: first, Last: last})
+	}
+	return ranges, nil
+}
@@ -0,0 +1,74 @@
+package actions
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/peterhoward42/minikafka"
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/ioutils"
+)
+
+func TestStoreTransaction(t *testing.T) {
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	index := indexing.NewIndex()
+	message := minikafka.Message{Payload: []byte("abc")}
+	action := StoreTransactionAction{Index: index, RootDir: rootDir,
+		Batches: []contract.TopicBatch{
+			{Topic: "topicA", Messages: []minikafka.Message{message}},
+			{Topic: "topicB", Messages: []minikafka.Message{message, message}},
+			{Topic: "topicA", Messages: []minikafka.Message{message}},
+		}}
+	ranges, err := action.StoreTransaction()
+	assert.Nil(t, err)
+	assert.Equal(t, []contract.MsgNumberRange{
+		{First: 1, Last: 1}, {First: 1, Last: 2}, {First: 2, Last: 2}},
+		ranges)
+
+	// Empty batches are refused before anything is stored.
+	action.Batches = append(action.Batches,
+		contract.TopicBatch{Topic: "topicC"})
+	_, err = action.StoreTransaction()
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(3), index.NextMessageNumbers["topicA"])
+}
+
+func TestStoreTransactionRestoresEveryTopic(t *testing.T) {
+	// Make the second topic's batch fail, by putting a file where its
+	// directory belongs. Make sure the first topic's file is restored.
+
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	index := indexing.NewIndex()
+	message := minikafka.Message{Payload: []byte("abc")}
+	storeAction := StoreAction{Topic: "topicA", Message: message,
+		Index: index, RootDir: rootDir}
+	_, fileName, err := storeAction.Store()
+	assert.Nil(t, err)
+	filePath := filenamer.MessageFilePath(fileName, "topicA", rootDir)
+	info, err := os.Stat(filePath)
+	assert.Nil(t, err)
+	sizeBefore := info.Size()
+
+	blocker, err := os.Create(filenamer.DirectoryForTopic("topicB", rootDir))
+	assert.Nil(t, err)
+	blocker.Close()
+
+	action := StoreTransactionAction{Index: index, RootDir: rootDir,
+		Batches: []contract.TopicBatch{
+			{Topic: "topicA", Messages: []minikafka.Message{message}},
+			{Topic: "topicB", Messages: []minikafka.Message{message}},
+		}}
+	_, err = action.StoreTransaction()
+	assert.NotNil(t, err)
+	info, err = os.Stat(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, sizeBefore, info.Size())
+}
@@ -0,0 +1,276 @@
+package actions
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/envelope"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
+)
+
+// ProblemKind classifies the problems that a VerifyAction can find.
+type ProblemKind int
+
+// The kinds of problem that a VerifyAction can find.
+const (
+	// A file in a topic's directory that the index does not refer to.
+	OrphanedFile ProblemKind = iota
+	// A file the index refers to, that does not exist.
+	MissingFile
+	// A file whose size differs from that the index records.
+	SizeMismatch
+	// A message that is incomplete, or fails its checksum.
+	CorruptMessage
+	// A message whose number or offset differs from that the index records.
+	MisplacedMessage
+	// Message numbers missing from a topic that is not compacted.
+	SequenceGap
+	// Message numbers that do not increase, or that will be issued again.
+	OutOfSequence
+	// A file that reconciling has moved aside to a topic's quarantine
+	// directory, because the index did not refer to it.
+	QuarantinedFile
+)
+
+var problemKindNames = []string{"Orphaned file", "Missing file",
+	"Size mismatch", "Corrupt message", "Misplaced message", "Sequence gap",
+	"Out of sequence", "Quarantined file"}
+
+func (kind ProblemKind) String() string {
+	return problemKindNames[kind]
+}
+
+// Problem describes one problem that a VerifyAction has found.
+type Problem struct {
+	Kind   ProblemKind
+	Topic  string
+	File   string // Empty when the problem concerns the whole topic.
+	Detail string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%v: topic %q, file %q: %v", p.Kind, p.Topic, p.File,
+		p.Detail)
+}
+
+// VerifyAction encapsulates a single execution of the verify command, which
+// checks the message files against the index, without changing either.
+type VerifyAction struct {
+	Index   *indexing.Index
+	RootDir string
+}
+
+// Verify is the internal entry point function to verify the message files
+// against the index. It checks every file the index refers to exists, and
+// has the size the index records; that the messages in each file are intact,
+// and are those the index records, at the offsets it records; and that
+// message numbers run on without gaps (except in compacted topics). It also
+// looks for files that the index does not refer to, including those in
+// directories of topics it does not know, and those that reconciling has
+// moved aside. Only files in FormatFramed can be
+// checked message by message. The problems are returned in a stable order. It
+// is not responsible for mutex protection.
+func (action VerifyAction) Verify() ([]Problem, error) {
+	problems := []Problem{}
+	topics := []string{}
+	for topic := range action.Index.MessageFileLists {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	for _, topic := range topics {
+		found, err := action.verifyTopic(topic)
+		if err != nil {
+			return nil, fmt.Errorf("verifyTopic(): %v", err)
+		}
+		problems = append(problems, found...)
+	}
+	found, err := action.findUnknownTopics()
+	if err != nil {
+		return nil, fmt.Errorf("findUnknownTopics(): %v", err)
+	}
+	return append(problems, found...), nil
+}
+
+// verifyTopic is a topic-specific helper function for Verify.
+func (action VerifyAction) verifyTopic(topic string) ([]Problem, error) {
+	problems := []Problem{}
+	report := func(kind ProblemKind, file string, format string,
+		args ...interface{}) {
+		problems = append(problems, Problem{Kind: kind, Topic: topic,
+			File: file, Detail: fmt.Sprintf(format, args...)})
+	}
+	msgFileList := action.Index.MessageFileLists[topic]
+	parentTopic, _ := contract.ParsePartitionLog(topic)
+	compacted := action.Index.RetentionPolicy(parentTopic).Compact
+	var previous int32
+	for _, fileName := range msgFileList.Names {
+		fileMeta := msgFileList.Meta[fileName]
+		for _, msgNum := range fileMeta.MessageNumbers() {
+			switch {
+			case previous == 0:
+			case msgNum <= previous:
+				report(OutOfSequence, fileName, "Message %d follows message %d",
+					msgNum, previous)
+			case msgNum > previous+1 && compacted == false:
+				report(SequenceGap, fileName, "Messages %d to %d are missing",
+					previous+1, msgNum-1)
+			}
+			previous = msgNum
+		}
+		contents, err := ioutil.ReadFile(
+			filenamer.MessageFilePath(fileName, topic, action.RootDir))
+		if os.IsNotExist(err) {
+			report(MissingFile, fileName, "The index records %d messages in it",
+				len(fileMeta.SeekOffsetForMessageNumber))
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ioutil.ReadFile(): %v", err)
+		}
+		if int64(len(contents)) != fileMeta.Size {
+			report(SizeMismatch, fileName,
+				"The index records %d bytes, but the file holds %d",
+				fileMeta.Size, len(contents))
+		}
+		if fileMeta.Format == envelope.FormatFramed {
+			for _, problem := range verifyFrames(contents, fileMeta) {
+				report(problem.Kind, fileName, "%v", problem.Detail)
+			}
+		}
+	}
+	if previous != 0 && previous >= action.Index.NextMessageNumbers[topic] {
+		report(OutOfSequence, "",
+			"The next message number to be issued, %d, is already in use",
+			action.Index.NextMessageNumbers[topic])
+	}
+	orphans, err := orphanedFiles(
+		filenamer.DirectoryForTopic(topic, action.RootDir), msgFileList.Meta)
+	if err != nil {
+		return nil, fmt.Errorf("orphanedFiles(): %v", err)
+	}
+	for _, orphan := range orphans {
+		report(OrphanedFile, orphan, "The index does not refer to it")
+	}
+	quarantined, err := orphanedFiles(
+		filenamer.QuarantineDirectory(topic, action.RootDir), nil)
+	if err != nil {
+		return nil, fmt.Errorf("orphanedFiles(): %v", err)
+	}
+	for _, fileName := range quarantined {
+		report(QuarantinedFile, fileName,
+			"Moved aside because the index did not refer to it")
+	}
+	return problems, nil
+}
+
+// verifyFrames checks that the frames in the given contents of a framed
+// message file are intact, and agree with its FileMeta. Only the Kind and
+// Detail of the problems it returns are set. It stops at the first frame that
+// is damaged, because the frames beyond cannot then be found.
+func verifyFrames(contents []byte, fileMeta *indexing.FileMeta) []Problem {
+	problems := []Problem{}
+	report := func(kind ProblemKind, format string, args ...interface{}) {
+		problems = append(problems, Problem{Kind: kind,
+			Detail: fmt.Sprintf(format, args...)})
+	}
+	if _, err := envelope.ReadFileHeader(contents); err != nil {
+		report(CorruptMessage, "%v", err)
+		return problems
+	}
+	numberAtOffset := map[int64]int32{}
+	for msgNum, offset := range fileMeta.SeekOffsetForMessageNumber {
+		numberAtOffset[offset] = msgNum
+	}
+	end := fileMeta.Size
+	if int64(len(contents)) < end {
+		end = int64(len(contents))
+	}
+	offset := int64(envelope.FileHeaderSize)
+	for offset < end {
+		msgNum, _, size, err := envelope.Unframe(contents[offset:end])
+		if err != nil {
+			report(CorruptMessage, "At offset %d: %v", offset, err)
+			return problems
+		}
+		indexed, ok := numberAtOffset[offset]
+		switch {
+		case ok == false:
+			report(MisplacedMessage,
+				"The index does not record message %d, at offset %d",
+				msgNum, offset)
+		case indexed != msgNum:
+			report(MisplacedMessage,
+				"The index records message %d at offset %d, but it is "+
+					"message %d", indexed, offset, msgNum)
+		}
+		delete(numberAtOffset, offset)
+		offset += int64(size)
+	}
+	missing := []int64{}
+	for offset := range numberAtOffset {
+		if offset < end {
+			missing = append(missing, offset)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+	for _, offset := range missing {
+		report(MisplacedMessage,
+			"The index records message %d at offset %d, where no message "+
+				"starts", numberAtOffset[offset], offset)
+	}
+	return problems
+}
+
+// findUnknownTopics reports the files in directories of the root directory
+// that are not topics the index knows.
+func (action VerifyAction) findUnknownTopics() ([]Problem, error) {
+	problems := []Problem{}
+	entries, err := ioutil.ReadDir(action.RootDir)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadDir(): %v", err)
+	}
+	for _, entry := range entries {
+		topic := entry.Name()
+		if _, ok := action.Index.MessageFileLists[topic]; ok ||
+			entry.IsDir() == false {
+			continue
+		}
+		orphans, err := orphanedFiles(
+			filenamer.DirectoryForTopic(topic, action.RootDir), nil)
+		if err != nil {
+			return nil, fmt.Errorf("orphanedFiles(): %v", err)
+		}
+		for _, orphan := range orphans {
+			problems = append(problems, Problem{Kind: OrphanedFile,
+				Topic: topic, File: orphan,
+				Detail: "The index does not know the topic"})
+		}
+	}
+	return problems, nil
+}
+
+// orphanedFiles provides the names of the message files in the given
+// directory that are not in *known*, in order.
+func orphanedFiles(dir string, known map[string]*indexing.FileMeta) (
+	[]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadDir(): %v", err)
+	}
+	orphans := []string{}
+	for _, entry := range entries {
+		if _, ok := known[entry.Name()]; ok || entry.IsDir() ||
+			filenamer.IsIndexFile(entry.Name()) {
+			continue
+		}
+		orphans = append(orphans, entry.Name())
+	}
+	return orphans, nil
+}
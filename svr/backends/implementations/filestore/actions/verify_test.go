@@ -0,0 +1,121 @@
+package actions
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/peterhoward42/minikafka"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/ioutils"
+)
+
+func TestVerifyWhenAllIsWell(t *testing.T) {
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	index := storeForVerify(t, rootDir)
+	action := VerifyAction{Index: index, RootDir: rootDir}
+	problems, err := action.Verify()
+	assert.Nil(t, err)
+	assert.Len(t, problems, 0)
+}
+
+func TestVerifyFindsProblems(t *testing.T) {
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	index := storeForVerify(t, rootDir)
+	msgFileList := index.MessageFileLists["topicA"]
+	filePath := func(i int) string {
+		return filenamer.MessageFilePath(msgFileList.Names[i], "topicA",
+			rootDir)
+	}
+
+	// Lose the first file, forget the last message in the second, corrupt
+	// the third, and leave files the index does not know about, one of them
+	// quarantined.
+	err := os.Remove(filePath(0))
+	assert.Nil(t, err)
+	fileMeta := msgFileList.Meta[msgFileList.Names[1]]
+	delete(fileMeta.SeekOffsetForMessageNumber, 4)
+	fileMeta.Newest.MsgNum = 3
+	contents, err := ioutil.ReadFile(filePath(2))
+	assert.Nil(t, err)
+	contents[len(contents)-1]++
+	err = ioutil.WriteFile(filePath(2), contents, 0666)
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(filenamer.MessageFilePath("ORPHAN", "topicA",
+		rootDir), []byte("abc"), 0666)
+	assert.Nil(t, err)
+	quarantineDir := filenamer.QuarantineDirectory("topicA", rootDir)
+	err = os.Mkdir(quarantineDir, 0777)
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(quarantineDir, "QUARANTINED"),
+		[]byte("abc"), 0666)
+	assert.Nil(t, err)
+	err = os.Mkdir(filenamer.DirectoryForTopic("topicX", rootDir), 0777)
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(filenamer.MessageFilePath("UNKNOWN", "topicX",
+		rootDir), []byte("abc"), 0666)
+	assert.Nil(t, err)
+
+	action := VerifyAction{Index: index, RootDir: rootDir}
+	problems, err := action.Verify()
+	assert.Nil(t, err)
+	kinds := []ProblemKind{}
+	for _, problem := range problems {
+		kinds = append(kinds, problem.Kind)
+	}
+	assert.Equal(t, []ProblemKind{MissingFile, MisplacedMessage, SequenceGap,
+		CorruptMessage, OrphanedFile, QuarantinedFile, OrphanedFile}, kinds)
+	assert.Equal(t, "QUARANTINED", problems[5].File)
+	assert.Equal(t, "topicX", problems[6].Topic)
+	assert.Equal(t, "UNKNOWN", problems[6].File)
+}
+
+func TestVerifyFindsSizeMismatch(t *testing.T) {
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	index := storeForVerify(t, rootDir)
+	msgFileList := index.MessageFileLists["topicA"]
+	fileName := msgFileList.Names[2]
+	err := ioutils.AppendToFile(
+		filenamer.MessageFilePath(fileName, "topicA", rootDir),
+		[]byte("partial"))
+	assert.Nil(t, err)
+	index.NextMessageNumbers["topicA"] = 5
+
+	action := VerifyAction{Index: index, RootDir: rootDir}
+	problems, err := action.Verify()
+	assert.Nil(t, err)
+	size := msgFileList.Meta[fileName].Size
+	assert.Equal(t, []Problem{
+		{Kind: SizeMismatch, Topic: "topicA", File: fileName,
+			Detail: fmt.Sprintf(
+				"The index records %d bytes, but the file holds %d",
+				size, size+7)},
+		{Kind: OutOfSequence, Topic: "topicA",
+			Detail: "The next message number to be issued, 5, is already in use"},
+	}, problems)
+}
+
+// storeForVerify stores five messages in topicA, big enough that the files
+// hold: [1 2] [3 4] [5].
+func storeForVerify(t *testing.T, rootDir string) *indexing.Index {
+	index := indexing.NewIndex()
+	for i := 0; i < 5; i++ {
+		storeAction := StoreAction{Topic: "topicA", Message: minikafka.Message{
+			Payload: make([]byte, 400000)}, Index: index, RootDir: rootDir}
+		_, _, err := storeAction.Store()
+		assert.Nil(t, err)
+	}
+	assert.Len(t, index.MessageFileLists["topicA"].Names, 3)
+	return index
+}
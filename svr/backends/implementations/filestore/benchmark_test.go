@@ -0,0 +1,79 @@
+package filestore
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	minikafka "github.com/peterhoward42/minikafka"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/ioutils"
+)
+
+// The benchmarks run against a topic that already holds benchmarkBacklog
+// messages, so that its index is of a realistic size, spanning several message
+// files.
+const benchmarkBacklog = 50000
+
+// benchmarkStore provides a FileStore whose topic "topicA" holds
+// benchmarkBacklog messages, and a function to clean up after it.
+func benchmarkStore(b *testing.B) (*FileStore, func()) {
+	rootDir := ioutils.TmpRootDir(b)
+	filestore, err := NewFileStore(rootDir)
+	if err != nil {
+		os.RemoveAll(rootDir)
+		b.Fatalf("NewFileStore(): %v", err)
+	}
+	batch := []minikafka.Message{}
+	for i := 0; i < 1000; i++ {
+		batch = append(batch, minikafka.Message{
+			Payload: []byte(fmt.Sprintf("message %d", i))})
+	}
+	for i := 0; i < benchmarkBacklog/len(batch); i++ {
+		_, _, err = filestore.StoreBatch("topicA", batch)
+		if err != nil {
+			os.RemoveAll(rootDir)
+			b.Fatalf("filestore.StoreBatch(): %v", err)
+		}
+	}
+	return filestore, func() { os.RemoveAll(rootDir) }
+}
+
+func BenchmarkStore(b *testing.B) {
+	filestore, cleanUp := benchmarkStore(b)
+	defer cleanUp()
+	message := minikafka.Message{Payload: []byte("abc")}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := filestore.Store("topicA", message)
+		if err != nil {
+			b.Fatalf("filestore.Store(): %v", err)
+		}
+	}
+}
+
+func BenchmarkPoll(b *testing.B) {
+	filestore, cleanUp := benchmarkStore(b)
+	defer cleanUp()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		readFrom := 1 + i%(benchmarkBacklog-10)
+		_, _, err := filestore.Poll("topicA", readFrom, 10, 0)
+		if err != nil {
+			b.Fatalf("filestore.Poll(): %v", err)
+		}
+	}
+}
+
+func BenchmarkRemoveOldMessages(b *testing.B) {
+	filestore, cleanUp := benchmarkStore(b)
+	defer cleanUp()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Nothing is old enough to be removed, so each call does the same.
+		err := filestore.RemoveOldMessages(time.Time{})
+		if err != nil {
+			b.Fatalf("filestore.RemoveOldMessages(): %v", err)
+		}
+	}
+}
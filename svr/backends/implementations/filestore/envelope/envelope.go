@@ -0,0 +1,205 @@
+// Package envelope knows how messages are laid out in the file store's
+// message files, and provides the single source of truth for that. Each
+// message is held in an envelope, that carries its key, headers and
+// timestamps, along with its payload.
+//
+// The layout of an envelope is as follows. (Integers are big-endian).
+//
+//	int64   Creation time (Unix nanoseconds), as assigned by the store.
+//	int64   Timestamp (Unix nanoseconds), as provided by the producer. Or
+//	        zero when none was provided.
+//	uint32  Key length, followed by the key itself.
+//	uint32  Number of headers, followed by each header as:
+//	        uint32 name length, the name, uint32 value length, the value.
+//	...     The payload, which occupies the rest of the envelope.
+//
+// The envelope's own length is not included, because the index records where
+// each message starts, and thus its length. But in files of the current
+// format, each envelope is held in a frame, which does record it. (See
+// frame.go).
+package envelope
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+
+	minikafka "github.com/peterhoward42/minikafka"
+)
+
+// The formats that message files can be written in.
+const (
+	// FormatRaw is the format of message files written before envelopes
+	// existed, in which each message is simply its payload.
+	FormatRaw int8 = 0
+	// FormatEnvelope is the format in which each message is held in an
+	// envelope.
+	FormatEnvelope int8 = 1
+	// FormatFramed is the format in which the file starts with a header,
+	// and each envelope is held in a checksummed frame.
+	FormatFramed int8 = 2
+	// CurrentFormat is the format in which new message files are written.
+	CurrentFormat = FormatFramed
+)
+
+// Encode provides the envelope for the given message, that was stored at the
+// given time.
+func Encode(message minikafka.Message, created time.Time) []byte {
+	buf := make([]byte, 0, 24+message.Size()+8*len(message.Headers))
+	buf = appendInt64(buf, created.UnixNano())
+	var timestamp int64
+	if message.Timestamp.IsZero() == false {
+		timestamp = message.Timestamp.UnixNano()
+	}
+	buf = appendInt64(buf, timestamp)
+	buf = appendBytes(buf, message.Key)
+	// Sort the header names so that the encoding is repeatable.
+	names := []string{}
+	for name := range message.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf = appendUint32(buf, uint32(len(names)))
+	for _, name := range names {
+		buf = appendBytes(buf, []byte(name))
+		buf = appendBytes(buf, message.Headers[name])
+	}
+	return append(buf, message.Payload...)
+}
+
+// Decode reconstructs the message held in the given slice of a message file,
+// which is in the given format. It also provides the time at which the message
+// was stored; except for FormatRaw, which does not record this, and for which
+// it provides the zero time. For FormatFramed, it is an error for the frame's
+// checksum not to match. The message returned refers to the slice provided
+// rather than copying from it.
+func Decode(record []byte, format int8) (
+	message minikafka.Message, created time.Time, err error) {
+	switch format {
+	case FormatRaw:
+		return minikafka.Message{Payload: record}, time.Time{}, nil
+	case FormatEnvelope:
+		return decodeEnvelope(record)
+	case FormatFramed:
+		_, envelope, _, err := Unframe(record)
+		if err != nil {
+			return message, created, err
+		}
+		return decodeEnvelope(envelope)
+	}
+	return message, created, fmt.Errorf("Unknown message file format: %d",
+		format)
+}
+
+// CreatedSize is the number of bytes at the start of an envelope that hold
+// its creation time. Reading just these, and passing them to DecodeCreated,
+// avoids reading the whole message when only its creation time is needed.
+// (See also CreatedOffset).
+const CreatedSize = 8
+
+// DecodeCreated provides the creation time held at the start of an envelope,
+// given at least the first CreatedSize bytes of it.
+func DecodeCreated(prefix []byte) (time.Time, error) {
+	r := reader{remaining: prefix}
+	createdNanos := r.int64()
+	if r.err != nil {
+		return time.Time{}, fmt.Errorf("Corrupt message envelope: %v", r.err)
+	}
+	return time.Unix(0, createdNanos), nil
+}
+
+// decodeEnvelope is the FormatEnvelope specific helper for Decode.
+func decodeEnvelope(record []byte) (
+	message minikafka.Message, created time.Time, err error) {
+	r := reader{remaining: record}
+	createdNanos := r.int64()
+	timestampNanos := r.int64()
+	message.Key = r.bytes()
+	nHeaders := r.uint32()
+	if nHeaders > 0 && r.err == nil {
+		message.Headers = map[string][]byte{}
+	}
+	for i := uint32(0); i < nHeaders && r.err == nil; i++ {
+		name := r.bytes()
+		message.Headers[string(name)] = r.bytes()
+	}
+	if r.err != nil {
+		return message, created, fmt.Errorf("Corrupt message envelope: %v",
+			r.err)
+	}
+	message.Payload = r.remaining
+	if timestampNanos != 0 {
+		message.Timestamp = time.Unix(0, timestampNanos)
+	}
+	return message, time.Unix(0, createdNanos), nil
+}
+
+// ------------------------------------------------------------------------
+// Encoding helpers.
+// ------------------------------------------------------------------------
+
+func appendInt64(buf []byte, value int64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(value))
+	return append(buf, b[:]...)
+}
+
+func appendUint32(buf []byte, value uint32) []byte {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], value)
+	return append(buf, b[:]...)
+}
+
+// appendBytes appends the given bytes, preceded by their length.
+func appendBytes(buf []byte, value []byte) []byte {
+	buf = appendUint32(buf, uint32(len(value)))
+	return append(buf, value...)
+}
+
+// ------------------------------------------------------------------------
+// Decoding helpers.
+// ------------------------------------------------------------------------
+
+// reader consumes the fields of an envelope in turn. Once it has encountered
+// an error, it records it, and returns zero values thereafter.
+type reader struct {
+	remaining []byte
+	err       error
+}
+
+func (r *reader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.remaining) {
+		r.err = fmt.Errorf("Need %d bytes, but only %d remain", n,
+			len(r.remaining))
+		return nil
+	}
+	taken := r.remaining[:n]
+	r.remaining = r.remaining[n:]
+	return taken
+}
+
+func (r *reader) int64() int64 {
+	b := r.take(8)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+func (r *reader) uint32() uint32 {
+	b := r.take(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+// bytes consumes a length, and then that many bytes.
+func (r *reader) bytes() []byte {
+	n := r.uint32()
+	return r.take(int(n))
+}
@@ -0,0 +1,79 @@
+package envelope
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	minikafka "github.com/peterhoward42/minikafka"
+)
+
+func TestRoundTrip(t *testing.T) {
+	message := minikafka.Message{
+		Payload: []byte("some payload"),
+		Key:     []byte("some key"),
+		Headers: map[string][]byte{
+			"content-type": []byte("text/plain"),
+			"empty":        []byte{},
+		},
+		Timestamp: time.Date(2018, 5, 1, 9, 0, 0, 123456789, time.UTC),
+	}
+	created := time.Now()
+	record := Encode(message, created)
+
+	decoded, decodedCreated, err := Decode(record, FormatEnvelope)
+	assert.Nil(t, err)
+	assert.Equal(t, message.Payload, decoded.Payload)
+	assert.Equal(t, message.Key, decoded.Key)
+	assert.Equal(t, message.Headers, decoded.Headers)
+	assert.True(t, message.Timestamp.Equal(decoded.Timestamp))
+	assert.True(t, created.Equal(decodedCreated))
+}
+
+func TestRoundTripWhenOnlyPayload(t *testing.T) {
+	message := minikafka.Message{Payload: []byte("some payload")}
+	record := Encode(message, time.Now())
+
+	decoded, _, err := Decode(record, FormatEnvelope)
+	assert.Nil(t, err)
+	assert.Equal(t, message.Payload, decoded.Payload)
+	assert.Equal(t, 0, len(decoded.Key))
+	assert.Nil(t, decoded.Headers)
+	assert.True(t, decoded.Timestamp.IsZero())
+}
+
+func TestEncodingIsRepeatable(t *testing.T) {
+	// Header maps iterate in a random order.
+	message := minikafka.Message{Headers: map[string][]byte{
+		"a": []byte("1"), "b": []byte("2"), "c": []byte("3")}}
+	created := time.Now()
+	assert.Equal(t, Encode(message, created), Encode(message, created))
+}
+
+func TestDecodeRaw(t *testing.T) {
+	decoded, created, err := Decode([]byte("some payload"), FormatRaw)
+	assert.Nil(t, err)
+	assert.Equal(t, "some payload", string(decoded.Payload))
+	assert.True(t, created.IsZero())
+}
+
+func TestDecodeWhenCorrupt(t *testing.T) {
+	record := Encode(minikafka.Message{Key: []byte("some key")}, time.Now())
+	_, _, err := Decode(record[:20], FormatEnvelope)
+	assert.NotNil(t, err)
+
+	_, _, err = Decode(record, 99)
+	assert.NotNil(t, err)
+}
+
+func TestDecodeCreated(t *testing.T) {
+	created := time.Now()
+	record := Encode(minikafka.Message{Payload: []byte("x")}, created)
+	decoded, err := DecodeCreated(record[:CreatedSize])
+	assert.Nil(t, err)
+	assert.True(t, created.Equal(decoded))
+
+	_, err = DecodeCreated(record[:CreatedSize-1])
+	assert.NotNil(t, err)
+}
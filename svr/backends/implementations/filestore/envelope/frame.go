@@ -0,0 +1,107 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// Message files in FormatFramed start with a header, and hold each envelope
+// in a frame, so that the files describe themselves: the messages in them
+// can be found, checked and numbered without the index. The layout is as
+// follows. (Integers are big-endian).
+//
+// The file header:
+//
+//	[4]byte  Magic number: "MKFK".
+//	uint32   The file's format. (FormatFramed).
+//
+// Then each message, as:
+//
+//	uint32   CRC32C (Castagnoli) checksum of the rest of the frame.
+//	uint32   Length of the envelope.
+//	uint32   Message number.
+//	...      The envelope, which starts with the message's creation time.
+
+// magic is the magic number with which framed message files start.
+var magic = []byte("MKFK")
+
+// FileHeaderSize is the size of the header that framed message files start
+// with.
+const FileHeaderSize = 8
+
+// FrameHeaderSize is the size of the part of each frame that comes before
+// the envelope.
+const FrameHeaderSize = 12
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// FileHeader provides the bytes with which a message file in the given format
+// starts. Formats older than FormatFramed have no header.
+func FileHeader(format int8) []byte {
+	if format < FormatFramed {
+		return []byte{}
+	}
+	header := append([]byte{}, magic...)
+	return appendUint32(header, uint32(format))
+}
+
+// ReadFileHeader provides the format of a message file, given at least the
+// first FileHeaderSize bytes of it. It is an error for the file not to start
+// with a header; as is the case for formats older than FormatFramed, which
+// cannot be recognised from their contents.
+func ReadFileHeader(prefix []byte) (format int8, err error) {
+	if len(prefix) < FileHeaderSize || bytes.Equal(prefix[:4], magic) == false {
+		return 0, fmt.Errorf("Message file has no header")
+	}
+	format = int8(binary.BigEndian.Uint32(prefix[4:FileHeaderSize]))
+	if format != FormatFramed {
+		return 0, fmt.Errorf("Unknown message file format: %d", format)
+	}
+	return format, nil
+}
+
+// Frame provides the frame that holds the given envelope, for the message
+// with the given number.
+func Frame(msgNumber int32, envelope []byte) []byte {
+	frame := make([]byte, 4, FrameHeaderSize+len(envelope))
+	frame = appendUint32(frame, uint32(len(envelope)))
+	frame = appendUint32(frame, uint32(msgNumber))
+	frame = append(frame, envelope...)
+	binary.BigEndian.PutUint32(frame, crc32.Checksum(frame[4:], crcTable))
+	return frame
+}
+
+// Unframe checks the frame that the given bytes start with, and provides the
+// message number and envelope it holds, along with the frame's size. It is
+// an error for the frame to be incomplete, or for its checksum not to match.
+// The envelope returned refers to the bytes provided rather than copying
+// them.
+func Unframe(data []byte) (msgNumber int32, envelope []byte, size int,
+	err error) {
+	if len(data) < FrameHeaderSize {
+		return 0, nil, 0, fmt.Errorf("Incomplete frame header")
+	}
+	length := int(binary.BigEndian.Uint32(data[4:8]))
+	size = FrameHeaderSize + length
+	if length > len(data)-FrameHeaderSize {
+		return 0, nil, 0, fmt.Errorf("Incomplete frame")
+	}
+	checksum := binary.BigEndian.Uint32(data[0:4])
+	if crc32.Checksum(data[4:size], crcTable) != checksum {
+		return 0, nil, 0, fmt.Errorf("Frame checksum does not match")
+	}
+	msgNumber = int32(binary.BigEndian.Uint32(data[8:12]))
+	return msgNumber, data[FrameHeaderSize:size], size, nil
+}
+
+// CreatedOffset provides where, in the bytes that hold a message in a file of
+// the given format, the creation time that DecodeCreated reads is to be
+// found.
+func CreatedOffset(format int8) int64 {
+	if format == FormatFramed {
+		return FrameHeaderSize
+	}
+	return 0
+}
@@ -0,0 +1,64 @@
+package envelope
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	minikafka "github.com/peterhoward42/minikafka"
+)
+
+func TestFileHeader(t *testing.T) {
+	header := FileHeader(FormatFramed)
+	assert.Equal(t, FileHeaderSize, len(header))
+	format, err := ReadFileHeader(header)
+	assert.Nil(t, err)
+	assert.Equal(t, FormatFramed, format)
+
+	// Older formats have no header.
+	assert.Equal(t, 0, len(FileHeader(FormatEnvelope)))
+	_, err = ReadFileHeader([]byte("some payload"))
+	assert.NotNil(t, err)
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	envelope := Encode(minikafka.Message{Payload: []byte("abc")}, time.Now())
+	frame := Frame(42, envelope)
+	assert.Equal(t, FrameHeaderSize+len(envelope), len(frame))
+
+	// Unframing ignores what follows the frame.
+	msgNumber, unframed, size, err := Unframe(append(frame, 1, 2, 3))
+	assert.Nil(t, err)
+	assert.Equal(t, int32(42), msgNumber)
+	assert.Equal(t, envelope, unframed)
+	assert.Equal(t, len(frame), size)
+
+	decoded, _, err := Decode(frame, FormatFramed)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", string(decoded.Payload))
+}
+
+func TestUnframeWhenCorrupt(t *testing.T) {
+	frame := Frame(42, Encode(minikafka.Message{}, time.Now()))
+	_, _, _, err := Unframe(frame[:len(frame)-1])
+	assert.NotNil(t, err)
+	_, _, _, err = Unframe(frame[:5])
+	assert.NotNil(t, err)
+
+	frame[len(frame)-1]++
+	_, _, _, err = Unframe(frame)
+	assert.NotNil(t, err)
+	_, _, err = Decode(frame, FormatFramed)
+	assert.NotNil(t, err)
+}
+
+func TestCreatedOffset(t *testing.T) {
+	created := time.Now()
+	frame := Frame(42, Encode(minikafka.Message{}, created))
+	offset := CreatedOffset(FormatFramed)
+	decoded, err := DecodeCreated(frame[offset : offset+CreatedSize])
+	assert.Nil(t, err)
+	assert.True(t, created.Equal(decoded))
+	assert.Equal(t, int64(0), CreatedOffset(FormatEnvelope))
+}
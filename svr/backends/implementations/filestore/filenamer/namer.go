@@ -5,16 +5,46 @@ package filenamer
 import (
 	"math/rand"
 	"path"
+	"strings"
 	"time"
 )
 
 const indexName = "index"
+const journalName = "index.journal"
+const updatesName = "index.updates"
+const quarantineName = "quarantine"
 
-// IndexFile provides the full path of the index file.
+// IndexFile provides the full path of the store-wide index file.
 func IndexFile(rootDir string) string {
 	return path.Join(rootDir, indexName)
 }
 
+// LogIndexFile provides the full path of the index file for the given topic,
+// (or partition's log), which lives in the topic's directory.
+func LogIndexFile(topic, rootDir string) string {
+	return path.Join(DirectoryForTopic(topic, rootDir), indexName)
+}
+
+// LogUpdatesFile provides the full path of the file that records the updates
+// to the index of the given topic, (or partition's log), since its index file
+// was last saved. It lives in the topic's directory.
+func LogUpdatesFile(topic, rootDir string) string {
+	return path.Join(DirectoryForTopic(topic, rootDir), updatesName)
+}
+
+// IsIndexFile reports whether a file in a topic's directory with the given
+// base name is its index file, its update file, or the temporary file
+// written when saving its index, rather than a message file.
+func IsIndexFile(fileName string) bool {
+	return strings.HasPrefix(fileName, indexName)
+}
+
+// JournalFile provides the full path of the file that records changes to
+// several index files, while they are being made.
+func JournalFile(rootDir string) string {
+	return path.Join(rootDir, journalName)
+}
+
 // DirectoryForTopic provides the directory that should be used for the
 // given topic.
 func DirectoryForTopic(topic, rootDir string) string {
@@ -23,6 +53,13 @@ func DirectoryForTopic(topic, rootDir string) string {
 	return path.Join(rootDir, topic)
 }
 
+// QuarantineDirectory provides the directory, within the given topic's
+// directory, to which files found there that its index does not refer to are
+// moved aside. Its name cannot be mistaken for a message file's.
+func QuarantineDirectory(topic, rootDir string) string {
+	return path.Join(DirectoryForTopic(topic, rootDir), quarantineName)
+}
+
 // MessageFilePath provides the full path of where a message file with a given
 // basename can be found for a given topic.
 func MessageFilePath(msgFileName, topic, rootDir string) string {
@@ -4,55 +4,76 @@ package filestore
 
 import (
 	"fmt"
-	"sync"
+	"os"
 	"time"
 
 	minikafka "github.com/peterhoward42/minikafka"
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
 	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/actions"
 	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
 	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
 	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/ioutils"
+	"github.com/peterhoward42/minikafka/svr/backends/notifier"
 )
 
-var mutex = &sync.Mutex{} // Guards concurrent access of the FileStore.
-
 // FileStore encapsulates the store.
 type FileStore struct {
 	RootDir string
+	// Wakes up those waiting for messages to arrive.
+	notifier *notifier.Notifier
+	// Its locks and resident indexes.
+	state *storeState
+}
+
+// storeState is what a FileStore holds in memory about its root directory:
+// its locks, (see locks.go), and its resident indexes, (see resident.go). It
+// is held by pointer, so that copies of a FileStore share it.
+type storeState struct {
+	storeLocks
+	residentIndexes
 }
 
 // NewFileStore provides an intialised FileStore object based on the root
 // directory provided. It either consumes the file store that is already
-// persisted there, or sets up a new one if there isn't one there.
+// persisted there, or sets up a new one if there isn't one there. When the
+// message files of a topic are there, but its index is not, it rebuilds the
+// index from the message files. The indexes are loaded once, and then kept in
+// memory, (see resident.go).
 func NewFileStore(rootDir string) (*FileStore, error) {
 	// Create the root directory if it does not exist.
 	err := ioutils.CreateDirIfDoesntExist(rootDir)
 	if err != nil {
 		return nil, fmt.Errorf("ioutils.CreateDirIfDoesntExist(): %v", err)
 	}
-	// Create and persist a blank index file if doesn't exist.
-	indexFilePath := filenamer.IndexFile(rootDir)
-	if ioutils.Exists(indexFilePath) == false {
-		index := indexing.NewIndex()
-		err := index.Save(indexFilePath)
+	s := &FileStore{RootDir: rootDir, notifier: notifier.NewNotifier(),
+		state: &storeState{}}
+	err = s.recover()
+	if err != nil {
+		return nil, fmt.Errorf("recover(): %v", err)
+	}
+	// Create and persist a blank store-wide index file if doesn't exist.
+	if ioutils.Exists(filenamer.IndexFile(rootDir)) == false {
+		err := s.saveStoreWideIndex(indexing.NewIndex())
 		if err != nil {
-			return nil, fmt.Errorf("index.Save(): %v", err)
+			return nil, fmt.Errorf("saveStoreWideIndex(): %v", err)
 		}
 	}
-	return &FileStore{rootDir}, nil
+	return s, nil
 }
 
 // ------------------------------------------------------------------------
 // METHODS TO SATISFY THE BackingStore INTERFACE.
 //
-// Most of these methods delegate to a helper function, but wrap it the
-// call in a mutex().
+// Most of these methods delegate to a helper function, but wrap the call in
+// the locks for the logs concerned (see locks.go).
 // ------------------------------------------------------------------------
 
 // DeleteContents removes all contents from the store.
 func (s FileStore) DeleteContents() error {
-	mutex.Lock()
-	defer mutex.Unlock()
+	s.state.storeMutex.Lock()
+	defer s.state.storeMutex.Unlock()
+	s.forgetResidentIndexes()
+	defer s.notifier.NotifyAll()
 	return s.deleteContents()
 }
 
@@ -61,109 +82,682 @@ func (s FileStore) DeleteContents() error {
 func (s FileStore) Store(topic string, message minikafka.Message) (
 	messageNumber int, err error) {
 
-	mutex.Lock()
-	defer mutex.Unlock()
+	unlock := s.lockLogs(true, topic)
+	defer unlock()
 
-	// Establish the index, - either virgin, or deserialised from disk.
-	index := indexing.NewIndex()
-	indexPath := filenamer.IndexFile(s.RootDir)
-	if ioutils.Exists(indexPath) {
-		err = index.PopulateFromDisk(filenamer.IndexFile(s.RootDir))
+	// A batch of one gets the same all-or-nothing treatment as any other.
+	messageNumber, _, err = s.storeBatch(topic, 0, "", 0,
+		[]minikafka.Message{message})
+	return messageNumber, err
+}
+
+// StoreBatch is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (s FileStore) StoreBatch(topic string, messages []minikafka.Message) (
+	firstMsgNumber int, lastMsgNumber int, err error) {
+
+	unlock := s.lockLogs(true, topic)
+	defer unlock()
+	return s.storeBatch(topic, 0, "", 0, messages)
+}
+
+// StoreSequenced is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (s FileStore) StoreSequenced(topic string, producerID string,
+	sequence uint64, messages []minikafka.Message) (
+	firstMsgNumber int, lastMsgNumber int, err error) {
+
+	unlock := s.lockLogs(true, topic)
+	defer unlock()
+	return s.storeBatch(topic, 0, producerID, sequence, messages)
+}
+
+// StoreBatchIfNext is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (s FileStore) StoreBatchIfNext(topic string, expectedNext int,
+	producerID string, sequence uint64, messages []minikafka.Message) (
+	firstMsgNumber int, lastMsgNumber int, err error) {
+
+	unlock := s.lockLogs(true, topic)
+	defer unlock()
+	return s.storeBatch(topic, expectedNext, producerID, sequence, messages)
+}
+
+// StoreTransaction is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (s FileStore) StoreTransaction(batches []contract.TopicBatch) (
+	ranges []contract.MsgNumberRange, err error) {
+
+	logs := []string{}
+	for _, batch := range batches {
+		logs = append(logs, batch.Topic)
+	}
+	unlock := s.lockLogs(true, logs...)
+	defer unlock()
+
+	// Establish the logs' indexes, - either virgin, or deserialised from
+	// disk.
+	index, err := s.loadLogIndexes(logs...)
+	if err != nil {
+		return nil, fmt.Errorf("loadLogIndexes(): %v", err)
+	}
+	created, err := s.createLogs(index, logs...)
+	if err != nil {
+		s.removeLogs(created...)
+		return nil, fmt.Errorf("createLogs(): %v", err)
+	}
+
+	// Delegate to a StoreTransactionAction instance. When it fails, the
+	// index it has updated must not be saved, so that every message is
+	// forgotten; and the topics it would have created must not exist. The
+	// resident indexes it has updated must be loaded afresh.
+	action := actions.StoreTransactionAction{
+		Batches: batches, Index: index, RootDir: s.RootDir}
+	ranges, err = action.StoreTransaction()
+	if err != nil {
+		s.removeLogs(created...)
+		s.forgetLogs(logs...)
+		return nil, fmt.Errorf("action.StoreTransaction(): %v", err)
+	}
+
+	// Saving the indexes is what makes the messages visible, all at once.
+	err = s.saveLogIndexes(index, logs...)
+	if err != nil {
+		return nil, fmt.Errorf("saveLogIndexes(): %v", err)
+	}
+	for _, batch := range batches {
+		s.notifier.Notify(batch.Topic)
+	}
+
+	return ranges, nil
+}
+
+// RemoveOldMessages is defined by, and documented in the
+// backends/contract/BackingStore interface. Each log is dealt with in turn,
+// holding only its own lock.
+func (s FileStore) RemoveOldMessages(maxAge time.Time) error {
+	logs, err := s.existingLogs()
+	if err != nil {
+		return fmt.Errorf("existingLogs(): %v", err)
+	}
+	for _, log := range logs {
+		err = s.removeOldMessages(log, maxAge)
 		if err != nil {
-			return -1, fmt.Errorf("index.PopulateFromDisk(): %v", err)
+			return fmt.Errorf("removeOldMessages(): %v", err)
 		}
 	}
+	return nil
+}
 
-	// Delegate to a StoreAction instance.
-	storeAction := actions.StoreAction{
-		Topic: topic, Message: message, Index: index, RootDir: s.RootDir}
-	messageNumber, _, err = storeAction.Store()
+// Compact is defined by, and documented in the
+// backends/contract/BackingStore interface. This implementation does not
+// compact the message file that each topic is currently appending to. Each
+// log is dealt with in turn, holding only its own lock.
+func (s FileStore) Compact(tombstonesBefore time.Time) error {
+	logs, err := s.existingLogs()
+	if err != nil {
+		return fmt.Errorf("existingLogs(): %v", err)
+	}
+	for _, log := range logs {
+		err = s.compact(log, tombstonesBefore)
+		if err != nil {
+			return fmt.Errorf("compact(): %v", err)
+		}
+	}
+	return nil
+}
+
+// Poll is defined by, and documented in the backends/contract/BackingStore
+// interface.
+func (s FileStore) Poll(topic string, readFrom int, maxMessages int,
+	maxBytes int) (
+	foundMessages []minikafka.StoredMessage, newReadFrom int, err error) {
+
+	unlock := s.lockLogs(false, topic)
+	defer unlock()
 
-	// Finish up by mandating the index to re-save itself to disk, ready
-	// for the next API operation to pick up.
-	err = index.Save(filenamer.IndexFile(s.RootDir))
+	// Establish the index, - either virgin, or resident in memory.
+	index, err := s.loadLogIndexes(topic)
 	if err != nil {
-		return -1, fmt.Errorf("SaveIndex(): %v", err)
+		return nil, -1, fmt.Errorf("loadLogIndexes(): %v", err)
+	}
+
+	// Delegate to a PollAction instance. Polling changes nothing, so the
+	// index need not be saved afterwards.
+	pollAction := actions.PollAction{
+		Topic:       topic,
+		ReadFrom:    readFrom,
+		Index:       index,
+		RootDir:     s.RootDir,
+		MaxMessages: maxMessages,
+		MaxBytes:    maxBytes}
+	foundMessages, newReadFrom, err = pollAction.Poll()
+	switch err.(type) {
+	case contract.OutOfRangeError, contract.NoSuchTopicError:
+		return nil, -1, err
+	}
+	if err != nil {
+		return nil, -1, fmt.Errorf("possAction.Poll(): %v", err)
 	}
 
-	return messageNumber, nil
+	return foundMessages, newReadFrom, nil
 }
 
-// RemoveOldMessages is defined by, and documented in the
+// AvailableRange is defined by, and documented in the
 // backends/contract/BackingStore interface.
-func (s FileStore) RemoveOldMessages(maxAge time.Time) error {
+func (s FileStore) AvailableRange(topic string) (
+	earliest int, next int, err error) {
 
-	mutex.Lock()
-	defer mutex.Unlock()
+	unlock := s.lockLogs(false, topic)
+	defer unlock()
 
-	// Establish the index, - either virgin, or deserialised from disk.
-	index := indexing.NewIndex()
-	indexPath := filenamer.IndexFile(s.RootDir)
-	if ioutils.Exists(indexPath) {
-		err := index.PopulateFromDisk(filenamer.IndexFile(s.RootDir))
-		if err != nil {
-			return fmt.Errorf("index.PopulateFromDisk(): %v", err)
+	// Establish the index, - either virgin, or resident in memory.
+	index, err := s.loadLogIndexes(topic)
+	if err != nil {
+		return -1, -1, fmt.Errorf("loadLogIndexes(): %v", err)
+	}
+	first, following, ok := index.AvailableRange(topic)
+	if ok == false {
+		return -1, -1, fmt.Errorf("Unknown topic: %v", topic)
+	}
+	return int(first), int(following), nil
+}
+
+// ListOffsets is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (s FileStore) ListOffsets(topic string) (
+	offsets []contract.PartitionOffsets, err error) {
+
+	numPartitions, err := s.NumPartitions(topic)
+	if err != nil {
+		return nil, err
+	}
+	logs := []string{}
+	for partition := 0; partition < numPartitions; partition++ {
+		logs = append(logs, contract.PartitionLog(topic, partition))
+	}
+	unlock := s.lockLogs(false, logs...)
+	defer unlock()
+
+	// Establish the indexes, - either virgin, or resident in memory.
+	index, err := s.loadLogIndexes(logs...)
+	if err != nil {
+		return nil, fmt.Errorf("loadLogIndexes(): %v", err)
+	}
+	offsets = []contract.PartitionOffsets{}
+	for partition, log := range logs {
+		earliest, next, ok := index.AvailableRange(log)
+		if ok == false {
+			return nil, fmt.Errorf("Unknown topic: %v", topic)
 		}
+		offsets = append(offsets, contract.PartitionOffsets{
+			Partition: partition, Earliest: int(earliest), Next: int(next)})
 	}
+	return offsets, nil
+}
 
-	// Delegate to a RemoveOldMessagesAction instance.
-	rmOldAction := actions.RemoveOldMessagesAction{
-		MaxAge: maxAge, Index: index, RootDir: s.RootDir}
-	_, _, err := rmOldAction.RemoveOldMessages()
+// OffsetForTime is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (s FileStore) OffsetForTime(topic string, t time.Time) (
+	msgNumber int, err error) {
+
+	unlock := s.lockLogs(false, topic)
+	defer unlock()
+
+	// Establish the index, - either virgin, or resident in memory.
+	index, err := s.loadLogIndexes(topic)
+	if err != nil {
+		return -1, fmt.Errorf("loadLogIndexes(): %v", err)
+	}
+
+	// Delegate to an OffsetForTimeAction instance.
+	action := actions.OffsetForTimeAction{
+		Topic: topic, Time: t, Index: index, RootDir: s.RootDir}
+	msgNumber, err = action.OffsetForTime()
+	if _, ok := err.(contract.NoSuchTopicError); ok {
+		return -1, err
+	}
+	if err != nil {
+		return -1, fmt.Errorf("action.OffsetForTime(): %v", err)
+	}
+	return msgNumber, nil
+}
+
+// ArrivalC is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (s FileStore) ArrivalC(topic string) <-chan struct{} {
+	unlock := s.lockLogs(false, topic)
+	defer unlock()
+	if s.logExists(topic) == false {
+		return notifier.Closed()
+	}
+	return s.notifier.ArrivalC(topic)
+}
+
+// CommitOffset is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (s FileStore) CommitOffset(group string, topic string, readFrom int) error {
+
+	s.state.storeMutex.RLock()
+	defer s.state.storeMutex.RUnlock()
+	s.state.offsetsMutex.Lock()
+	defer s.state.offsetsMutex.Unlock()
 
-	// Finish up by mandating the index to re-save itself to disk, ready
-	// for the next API operation to pick up.
-	err = index.Save(filenamer.IndexFile(s.RootDir))
+	// Establish the index, - either virgin, or resident in memory.
+	index, err := s.loadStoreWideIndex()
 	if err != nil {
-		return fmt.Errorf("SaveIndex(): %v", err)
+		return fmt.Errorf("loadStoreWideIndex(): %v", err)
 	}
 
+	index.CommitOffset(group, topic, int32(readFrom))
+
+	err = s.saveStoreWideIndex(index)
+	if err != nil {
+		return fmt.Errorf("saveStoreWideIndex(): %v", err)
+	}
 	return nil
 }
 
-// Poll is defined by, and documented in the backends/contract/BackingStore
-// interface.
-func (s FileStore) Poll(topic string, readFrom int) (
-	foundMessages []minikafka.Message, newReadFrom int, err error) {
+// FetchOffset is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (s FileStore) FetchOffset(group string, topic string) (
+	readFrom int, committed bool, err error) {
 
-	mutex.Lock()
-	defer mutex.Unlock()
+	s.state.storeMutex.RLock()
+	defer s.state.storeMutex.RUnlock()
+	s.state.offsetsMutex.Lock()
+	defer s.state.offsetsMutex.Unlock()
 
-	// Establish the index, - either virgin, or deserialised from disk.
+	// Establish the index, - either virgin, or resident in memory.
+	index, err := s.loadStoreWideIndex()
+	if err != nil {
+		return -1, false, fmt.Errorf("loadStoreWideIndex(): %v", err)
+	}
+
+	committedReadFrom, committed := index.CommittedOffset(group, topic)
+	return int(committedReadFrom), committed, nil
+}
+
+// CreateTopic is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (s FileStore) CreateTopic(topic string, numPartitions int) error {
+
+	logs := []string{}
+	for partition := 0; partition < numPartitions; partition++ {
+		logs = append(logs, contract.PartitionLog(topic, partition))
+	}
+	unlock := s.lockLogs(true, logs...)
+	defer unlock()
+
+	if s.logExists(topic) {
+		return fmt.Errorf("Topic already exists: %v", topic)
+	}
+	// Each partition's log gets a directory, and an index, of its own.
 	index := indexing.NewIndex()
-	indexPath := filenamer.IndexFile(s.RootDir)
-	if ioutils.Exists(indexPath) {
-		err = index.PopulateFromDisk(filenamer.IndexFile(s.RootDir))
+	for _, log := range logs {
+		err := ioutils.CreateDirIfDoesntExist(
+			filenamer.DirectoryForTopic(log, s.RootDir))
 		if err != nil {
-			return nil, -1, fmt.Errorf("index.PopulateFromDisk(): %v", err)
+			return fmt.Errorf("ioutils.CreateDirIfDoesntExist(): %v", err)
 		}
+		index.RegisterTopic(log)
 	}
+	index.SetNumPartitions(topic, int32(numPartitions))
 
-	// Delegate to a PollAction instance.
-	pollAction := actions.PollAction{
-		Topic:    topic,
-		ReadFrom: readFrom,
-		Index:    index,
-		RootDir:  s.RootDir}
-	foundMessages, newReadFrom, err = pollAction.Poll()
+	err := s.saveLogIndexes(index, logs...)
 	if err != nil {
-		return nil, -1, fmt.Errorf("possAction.Poll(): %v", err)
+		return fmt.Errorf("saveLogIndexes(): %v", err)
 	}
+	return nil
+}
+
+// NumPartitions is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (s FileStore) NumPartitions(topic string) (numPartitions int, err error) {
 
-	// Finish up by mandating the index to re-save itself to disk, ready
-	// for the next API operation to pick up.
-	err = index.Save(filenamer.IndexFile(s.RootDir))
+	unlock := s.lockLogs(false, topic)
+	defer unlock()
+
+	// Establish the index, - either virgin, or resident in memory.
+	index, err := s.loadLogIndexes(topic)
 	if err != nil {
-		return nil, -1, fmt.Errorf("SaveIndex(): %v", err)
+		return -1, fmt.Errorf("loadLogIndexes(): %v", err)
 	}
+	return int(index.NumPartitions(topic)), nil
+}
 
-	return foundMessages, newReadFrom, nil
+// DeleteTopic is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (s FileStore) DeleteTopic(topic string) error {
+
+	numPartitions, err := s.NumPartitions(topic)
+	if err != nil {
+		return err
+	}
+	logs := []string{}
+	for partition := 0; partition < numPartitions; partition++ {
+		logs = append(logs, contract.PartitionLog(topic, partition))
+	}
+	unlock := s.lockLogs(true, logs...)
+	defer unlock()
+	s.state.offsetsMutex.Lock()
+	defer s.state.offsetsMutex.Unlock()
+
+	if s.logExists(topic) == false {
+		return fmt.Errorf("Unknown topic: %v", topic)
+	}
+	// The read-from message numbers committed for the topic are forgotten
+	// in the same change as its directories are removed, so that a failure
+	// part way through cannot leave some of it behind.
+	index, err := s.loadStoreWideIndex()
+	if err != nil {
+		return fmt.Errorf("loadStoreWideIndex(): %v", err)
+	}
+	changes := indexing.ChangeSet{Saves: map[string]*indexing.Index{
+		filenamer.IndexFile(s.RootDir): index}}
+	for _, log := range logs {
+		index.ForgetTopic(log)
+		changes.Removals = append(changes.Removals,
+			filenamer.DirectoryForTopic(log, s.RootDir))
+	}
+	s.forgetLogs(logs...)
+	err = s.applyChanges(changes)
+	if err != nil {
+		s.forgetStoreWideIndex()
+		return fmt.Errorf("applyChanges(): %v", err)
+	}
+	// Those waiting for messages then find the topic gone.
+	for _, log := range logs {
+		s.notifier.Notify(log)
+	}
+	return nil
+}
+
+// ListTopics is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (s FileStore) ListTopics() (topics []string, err error) {
+
+	s.state.storeMutex.RLock()
+	defer s.state.storeMutex.RUnlock()
+
+	logs, err := s.logs()
+	if err != nil {
+		return nil, fmt.Errorf("logs(): %v", err)
+	}
+	topics = []string{}
+	for _, log := range logs {
+		if _, partition := contract.ParsePartitionLog(log); partition != 0 {
+			continue
+		}
+		topics = append(topics, log)
+	}
+	return topics, nil
+}
+
+// DescribeTopic is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (s FileStore) DescribeTopic(topic string) (
+	description contract.TopicDescription, err error) {
+
+	// Partitions share their topic's retention policy and partition count.
+	parentTopic, _ := contract.ParsePartitionLog(topic)
+	unlock := s.lockLogs(false, topic, parentTopic)
+	defer unlock()
+
+	// Establish the indexes, - either virgin, or resident in memory.
+	index, err := s.loadLogIndexes(topic, parentTopic)
+	if err != nil {
+		return description, fmt.Errorf("loadLogIndexes(): %v", err)
+	}
+
+	msgFileList, ok := index.MessageFileLists[topic]
+	if ok == false {
+		return description, fmt.Errorf("Unknown topic: %v", topic)
+	}
+	if oldest, ok := msgFileList.Oldest(); ok {
+		description.OldestMsgNumber = int(oldest.MsgNum)
+		description.OldestCreated = oldest.Created
+	}
+	if newest, ok := msgFileList.Newest(); ok {
+		description.NewestMsgNumber = int(newest.MsgNum)
+		description.NewestCreated = newest.Created
+	}
+	description.NumMessages = msgFileList.NumMessages()
+	description.NumBytes = msgFileList.TotalSize()
+	description.NumSegments = len(msgFileList.Names)
+	description.Retention = index.RetentionPolicy(parentTopic)
+	description.NumPartitions = int(index.NumPartitions(parentTopic))
+	return description, nil
+}
+
+// SetRetentionPolicy is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (s FileStore) SetRetentionPolicy(
+	topic string, policy contract.RetentionPolicy) error {
+
+	unlock := s.lockLogs(true, topic)
+	defer unlock()
+
+	// Establish the index, - either virgin, or resident in memory.
+	index, err := s.loadLogIndexes(topic)
+	if err != nil {
+		return fmt.Errorf("loadLogIndexes(): %v", err)
+	}
+
+	if _, ok := index.MessageFileLists[topic]; ok == false {
+		return fmt.Errorf("Unknown topic: %v", topic)
+	}
+	index.SetRetentionPolicy(topic, policy)
+
+	err = s.saveLogIndexes(index, topic)
+	if err != nil {
+		return fmt.Errorf("saveLogIndexes(): %v", err)
+	}
+	return nil
 }
 
 // ------------------------------------------------------------------------
 // Miscellaneous Implementation functions.
 // ------------------------------------------------------------------------
 
+// existingLogs provides the names of the logs that exist.
+func (s FileStore) existingLogs() ([]string, error) {
+	s.state.storeMutex.RLock()
+	defer s.state.storeMutex.RUnlock()
+	return s.logs()
+}
+
+// removeOldMessages removes the expired messages from one log. (See
+// RemoveOldMessages).
+func (s FileStore) removeOldMessages(log string, maxAge time.Time) error {
+
+	// Establish the index, - either virgin, or resident in memory; along
+	// with the retention policy it shares with its topic.
+	parentTopic, _ := contract.ParsePartitionLog(log)
+	policy, err := s.retentionPolicy(log)
+	if err != nil {
+		return fmt.Errorf("retentionPolicy(): %v", err)
+	}
+	unlock := s.lockLogs(true, log)
+	defer unlock()
+	if s.logExists(log) == false {
+		return nil
+	}
+	index, err := s.loadLogIndexes(log)
+	if err != nil {
+		return fmt.Errorf("loadLogIndexes(): %v", err)
+	}
+	if parentTopic != log {
+		// Held only in memory; the log's own index does not save it.
+		index.SetRetentionPolicy(parentTopic, policy)
+	}
+
+	// Delegate to a RemoveOldMessagesAction instance.
+	rmOldAction := actions.RemoveOldMessagesAction{
+		MaxAge: maxAge, Index: index, RootDir: s.RootDir}
+	obsoleteFiles, _ := rmOldAction.RemoveOldMessages()
+
+	// Saving the index is what makes the log forget the old files. Only
+	// then can they be removed; and when that fails, those left behind are
+	// orphans, that reconciling the log moves aside.
+	err = s.saveLogIndexes(index, log)
+	if err != nil {
+		return fmt.Errorf("saveLogIndexes(): %v", err)
+	}
+	for _, filePath := range obsoleteFiles {
+		err = os.Remove(filePath)
+		if err != nil {
+			return fmt.Errorf("os.Remove(): %v", err)
+		}
+	}
+	return nil
+}
+
+// compact compacts one log. (See Compact).
+func (s FileStore) compact(log string, tombstonesBefore time.Time) error {
+
+	// Establish the index, - either virgin, or resident in memory; along
+	// with the retention policy it shares with its topic.
+	parentTopic, _ := contract.ParsePartitionLog(log)
+	policy, err := s.retentionPolicy(log)
+	if err != nil {
+		return fmt.Errorf("retentionPolicy(): %v", err)
+	}
+	if policy.Compact == false {
+		return nil
+	}
+	unlock := s.lockLogs(true, log)
+	defer unlock()
+	if s.logExists(log) == false {
+		return nil
+	}
+	index, err := s.loadLogIndexes(log)
+	if err != nil {
+		return fmt.Errorf("loadLogIndexes(): %v", err)
+	}
+	if parentTopic != log {
+		// Held only in memory; the log's own index does not save it.
+		index.SetRetentionPolicy(parentTopic, policy)
+	}
+
+	// Delegate to a CompactAction instance. When it fails, the index it has
+	// updated must not be saved, and the resident index must be loaded
+	// afresh.
+	action := actions.CompactAction{
+		TombstonesBefore: tombstonesBefore, Index: index, RootDir: s.RootDir}
+	obsoleteFiles, _, err := action.Compact()
+	if err != nil {
+		s.forgetLogs(log)
+		return fmt.Errorf("action.Compact(): %v", err)
+	}
+
+	// Saving the index is what switches the log over to its compacted
+	// files. Only then can the files they replace be removed.
+	err = s.saveLogIndexes(index, log)
+	if err != nil {
+		return fmt.Errorf("saveLogIndexes(): %v", err)
+	}
+	for _, filePath := range obsoleteFiles {
+		err = os.Remove(filePath)
+		if err != nil {
+			return fmt.Errorf("os.Remove(): %v", err)
+		}
+	}
+	return nil
+}
+
+// reconcile repairs the discrepancies between a log's index and its message
+// files, that the server stopping abruptly can leave behind. (See
+// actions.ReconcileAction). It also makes a checkpoint of the log's index,
+// when it has an update file; so that the updates appended from now on do not
+// follow one left incomplete. It is not responsible for mutex protection.
+func (s FileStore) reconcile(log string) (actions.Reconciliation, error) {
+	index, err := s.loadLogIndexes(log)
+	if err != nil {
+		return actions.Reconciliation{}, fmt.Errorf("loadLogIndexes(): %v", err)
+	}
+	action := actions.ReconcileAction{Index: index, RootDir: s.RootDir}
+	reconciliation, err := action.Reconcile()
+	if err != nil {
+		return reconciliation, fmt.Errorf("action.Reconcile(): %v", err)
+	}
+	if reconciliation.IndexChanged() ||
+		ioutils.Exists(filenamer.LogUpdatesFile(log, s.RootDir)) {
+		err = s.checkpoint(log, index)
+		if err != nil {
+			return reconciliation, fmt.Errorf("checkpoint(): %v", err)
+		}
+	}
+	return reconciliation, nil
+}
+
+// storeBatch is the common implementation of Store, StoreBatch,
+// StoreSequenced and StoreBatchIfNext. A zero *expectedNext* means there is
+// no condition, and an empty *producerID* means the request is not
+// sequenced. It is not responsible for mutex protection.
+func (s FileStore) storeBatch(topic string, expectedNext int,
+	producerID string, sequence uint64, messages []minikafka.Message) (
+	firstMsgNumber int, lastMsgNumber int, err error) {
+
+	// Establish the index, - either virgin, or resident in memory.
+	index, err := s.loadLogIndexes(topic)
+	if err != nil {
+		return -1, -1, fmt.Errorf("loadLogIndexes(): %v", err)
+	}
+
+	// A retry of a request already stored, stores nothing.
+	if producerID != "" {
+		batch, ok := index.FindSequence(topic, producerID, sequence)
+		if ok {
+			return batch.FirstMsgNumber, batch.LastMsgNumber, nil
+		}
+	}
+	if expectedNext != 0 {
+		next, ok := index.NextMessageNumbers[topic]
+		if ok == false {
+			next = 1
+		}
+		err = contract.CheckExpectedNext(expectedNext, int(next))
+		if err != nil {
+			return -1, -1, err
+		}
+	}
+	created, err := s.createLogs(index, topic)
+	if err != nil {
+		s.removeLogs(created...)
+		return -1, -1, fmt.Errorf("createLogs(): %v", err)
+	}
+
+	// Delegate to a StoreBatchAction instance. When it fails, the index it
+	// has updated must not be saved, so that every message is forgotten;
+	// and the topic it would have created must not exist. The resident index
+	// it has updated must be loaded afresh.
+	action := actions.StoreBatchAction{
+		Topic: topic, Messages: messages, Index: index, RootDir: s.RootDir}
+	firstMsgNumber, lastMsgNumber, err = action.StoreBatch()
+	if err != nil {
+		s.removeLogs(created...)
+		s.forgetLogs(topic)
+		return -1, -1, fmt.Errorf("action.StoreBatch(): %v", err)
+	}
+	if producerID != "" {
+		index.RecordSequence(topic, producerID, contract.SequencedBatch{
+			Sequence:       sequence,
+			FirstMsgNumber: firstMsgNumber,
+			LastMsgNumber:  lastMsgNumber})
+	}
+
+	// Finish up by persisting the changes to the index, which is then
+	// resident, ready for the next API operation to pick up.
+	err = s.saveLogIndexes(index, topic)
+	if err != nil {
+		return -1, -1, fmt.Errorf("saveLogIndexes(): %v", err)
+	}
+	s.notifier.Notify(topic)
+
+	return firstMsgNumber, lastMsgNumber, nil
+}
+
 func (s FileStore) deleteContents() error {
 	err := ioutils.DeleteDirectoryContents(s.RootDir)
 	if err != nil {
@@ -2,13 +2,18 @@ package filestore
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
 	"testing"
+	"time"
 
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/actions"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
 	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/ioutils"
 	"github.com/stretchr/testify/assert"
 
+	minikafka "github.com/peterhoward42/minikafka"
 	"github.com/peterhoward42/minikafka/svr/backends/contract"
 )
 
@@ -55,7 +60,7 @@ func TestConstructionOnADirectoryThatDoesntExist(t *testing.T) {
 		assert.Fail(t, msg)
 	}
 	// Make sure we can store something in it without error.
-	_, err = filestore.Store("some_topic", []byte("a message"))
+	_, err = filestore.Store("some_topic", minikafka.Message{Payload: []byte("a message")})
 	if err != nil {
 		msg := fmt.Sprintf("filestore.Store(): %v", err)
 		assert.Fail(t, msg)
@@ -78,7 +83,7 @@ func TestPersistence(t *testing.T) {
 		assert.Fail(t, msg)
 	}
 	topic := "some topic"
-	msgNumber, err := filestore.Store(topic, []byte("a message"))
+	msgNumber, err := filestore.Store(topic, minikafka.Message{Payload: []byte("a message")})
 	if err != nil {
 		msg := fmt.Sprintf("filestore.Store(): %v", err)
 		assert.Fail(t, msg)
@@ -92,7 +97,7 @@ func TestPersistence(t *testing.T) {
 		msg := fmt.Sprintf("NewFileStore(): %v", err)
 		assert.Fail(t, msg)
 	}
-	msgNumber, err = newFileStore.Store(topic, []byte("a message"))
+	msgNumber, err = newFileStore.Store(topic, minikafka.Message{Payload: []byte("a message")})
 	if err != nil {
 		msg := fmt.Sprintf("filestore.Store(): %v", err)
 		assert.Fail(t, msg)
@@ -100,7 +105,7 @@ func TestPersistence(t *testing.T) {
 	assert.Equal(t, 2, msgNumber)
 
 	readFrom := 1
-	messages, newReadFrom, err := newFileStore.Poll(topic, readFrom)
+	messages, newReadFrom, err := newFileStore.Poll(topic, readFrom, 0, 0)
 	if err != nil {
 		msg := fmt.Sprintf("newFileStore.Poll(): %v", err)
 		assert.Fail(t, msg)
@@ -108,3 +113,371 @@ func TestPersistence(t *testing.T) {
 	assert.Equal(t, 2, len(messages))
 	assert.Equal(t, 3, newReadFrom)
 }
+
+func TestRecoveryOnRestart(t *testing.T) {
+	// This test makes sure that a new FileStore instance repairs what a
+	// server stopping part way through storing a message leaves behind;
+	// here, the start of a message that the index does not record.
+
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	filestore, err := NewFileStore(rootDir)
+	assert.Nil(t, err)
+	topic := "some topic"
+	_, err = filestore.Store(topic, minikafka.Message{Payload: []byte("abc")})
+	assert.Nil(t, err)
+	index, err := filestore.loadLogIndexes(topic)
+	assert.Nil(t, err)
+	fileName := index.CurrentMsgFileNameFor(topic)
+	filePath := filenamer.MessageFilePath(fileName, topic, rootDir)
+	err = ioutils.AppendToFile(filePath, []byte("partial"))
+	assert.Nil(t, err)
+
+	newFileStore, err := NewFileStore(rootDir)
+	assert.Nil(t, err)
+	info, err := os.Stat(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, index.MessageFileLists[topic].Meta[fileName].Size,
+		info.Size())
+	msgNumber, err := newFileStore.Store(topic,
+		minikafka.Message{Payload: []byte("def")})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, msgNumber)
+	messages, _, err := newFileStore.Poll(topic, 1, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, "def", string(messages[1].Payload))
+}
+
+func TestRebuildWhenIndexIsLost(t *testing.T) {
+	// This test makes sure that a new FileStore instance rebuilds the index
+	// of a topic from its message files, when its index file has been lost.
+
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	filestore, err := NewFileStore(rootDir)
+	assert.Nil(t, err)
+	topic := "some topic"
+	for _, payload := range []string{"abc", "def"} {
+		_, err = filestore.Store(topic,
+			minikafka.Message{Payload: []byte(payload)})
+		assert.Nil(t, err)
+	}
+	err = os.Remove(filenamer.LogIndexFile(topic, rootDir))
+	assert.Nil(t, err)
+
+	newFileStore, err := NewFileStore(rootDir)
+	assert.Nil(t, err)
+	msgNumber, err := newFileStore.Store(topic,
+		minikafka.Message{Payload: []byte("ghi")})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, msgNumber)
+	messages, _, err := newFileStore.Poll(topic, 1, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(messages))
+	assert.Equal(t, "abc", string(messages[0].Payload))
+	assert.Equal(t, "ghi", string(messages[2].Payload))
+}
+
+func TestVerifyAndRebuild(t *testing.T) {
+	// This test makes sure that a store whose index has been damaged can be
+	// rebuilt, keeping what it can of the old index.
+
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	filestore, err := NewFileStore(rootDir)
+	assert.Nil(t, err)
+	topic := "some topic"
+	for _, payload := range []string{"abc", "def"} {
+		_, err = filestore.Store(topic,
+			minikafka.Message{Payload: []byte(payload)})
+		assert.Nil(t, err)
+	}
+	err = filestore.CommitOffset("groupA", topic, 2)
+	assert.Nil(t, err)
+	problems, err := Verify(rootDir)
+	assert.Nil(t, err)
+	assert.Len(t, problems, 0)
+
+	// Rebuilding a readable index keeps its retention policy, and leaves
+	// the committed offsets in the store-wide index alone.
+	policy := contract.RetentionPolicy{MaxMessages: 10}
+	err = filestore.SetRetentionPolicy(topic, policy)
+	assert.Nil(t, err)
+	kept, err := Rebuild(rootDir)
+	assert.Nil(t, err)
+	assert.True(t, kept)
+	readFrom, committed, err := filestore.FetchOffset("groupA", topic)
+	assert.Nil(t, err)
+	assert.True(t, committed)
+	assert.Equal(t, 2, readFrom)
+	description, err := filestore.DescribeTopic(topic)
+	assert.Nil(t, err)
+	assert.Equal(t, policy, description.Retention)
+
+	// A damaged index cannot be verified, but can be rebuilt.
+	err = ioutil.WriteFile(filenamer.LogIndexFile(topic, rootDir), []byte("junk"),
+		0666)
+	assert.Nil(t, err)
+	_, err = Verify(rootDir)
+	assert.NotNil(t, err)
+	kept, err = Rebuild(rootDir)
+	assert.Nil(t, err)
+	assert.False(t, kept)
+	problems, err = Verify(rootDir)
+	assert.Nil(t, err)
+	assert.Len(t, problems, 0)
+	messages, _, err := filestore.Poll(topic, 1, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(messages))
+}
+
+func TestMigrationToLogIndexes(t *testing.T) {
+	// This test makes sure that a store saved before each log had an index
+	// of its own, with everything in the one store-wide index, is split up
+	// when it is opened.
+
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	filestore, err := NewFileStore(rootDir)
+	assert.Nil(t, err)
+	topic := "some topic"
+	for _, payload := range []string{"abc", "def"} {
+		_, err = filestore.Store(topic,
+			minikafka.Message{Payload: []byte(payload)})
+		assert.Nil(t, err)
+	}
+	err = filestore.CommitOffset("groupA", topic, 2)
+	assert.Nil(t, err)
+
+	// Put the store back as it would have been saved.
+	index, err := filestore.loadLogIndexes(topic)
+	assert.Nil(t, err)
+	storeWideIndex, err := filestore.loadStoreWideIndex()
+	assert.Nil(t, err)
+	index.Absorb(storeWideIndex)
+	err = index.Save(filenamer.IndexFile(rootDir))
+	assert.Nil(t, err)
+	err = os.Remove(filenamer.LogIndexFile(topic, rootDir))
+	assert.Nil(t, err)
+
+	newFileStore, err := NewFileStore(rootDir)
+	assert.Nil(t, err)
+	assert.True(t, newFileStore.logExists(topic))
+	storeWideIndex, err = newFileStore.loadStoreWideIndex()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(storeWideIndex.MessageFileLists))
+	readFrom, committed, err := newFileStore.FetchOffset("groupA", topic)
+	assert.Nil(t, err)
+	assert.True(t, committed)
+	assert.Equal(t, 2, readFrom)
+	messages, _, err := newFileStore.Poll(topic, 1, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(messages))
+}
+
+func TestTopicsAreLockedIndependently(t *testing.T) {
+	// This test makes sure that an operation on one topic does not wait
+	// for one on another topic to finish, but does wait for one on the same
+	// topic.
+
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	filestore, err := NewFileStore(rootDir)
+	assert.Nil(t, err)
+	store := func(topic string) <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			_, err := filestore.Store(topic,
+				minikafka.Message{Payload: []byte("abc")})
+			done <- err
+		}()
+		return done
+	}
+
+	unlock := filestore.lockLogs(true, "topicA")
+	select {
+	case err = <-store("topicB"):
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "Storing to topicB waited for topicA")
+	}
+	doneA := store("topicA")
+	select {
+	case <-doneA:
+		assert.FailNow(t, "Storing to topicA did not wait for its lock")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	assert.Nil(t, <-doneA)
+}
+
+func TestIndexUpdatesAndCheckpoints(t *testing.T) {
+	// This test makes sure that changes to a topic's index are appended to
+	// its update file, that the index file is saved afresh once the updates
+	// outgrow it, and that a new FileStore instance picks up both.
+
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	filestore, err := NewFileStore(rootDir)
+	assert.Nil(t, err)
+	topic := "some topic"
+	updatesPath := filenamer.LogUpdatesFile(topic, rootDir)
+	_, err = filestore.Store(topic, minikafka.Message{Payload: []byte("abc")})
+	assert.Nil(t, err)
+	_, err = filestore.Store(topic, minikafka.Message{Payload: []byte("def")})
+	assert.Nil(t, err)
+	assert.True(t, ioutils.Exists(updatesPath))
+
+	// Keep storing until a checkpoint is made, which removes the update
+	// file.
+	stored := 2
+	checkpointed := false
+	for checkpointed == false && stored < 10000 {
+		_, err = filestore.Store(topic,
+			minikafka.Message{Payload: []byte("ghi")})
+		assert.Nil(t, err)
+		stored++
+		checkpointed = ioutils.Exists(updatesPath) == false
+	}
+	assert.True(t, checkpointed)
+	_, err = filestore.Store(topic, minikafka.Message{Payload: []byte("jkl")})
+	assert.Nil(t, err)
+	stored++
+
+	newFileStore, err := NewFileStore(rootDir)
+	assert.Nil(t, err)
+	messages, _, err := newFileStore.Poll(topic, 1, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, stored, len(messages))
+	assert.Equal(t, "abc", string(messages[0].Payload))
+	assert.Equal(t, "jkl", string(messages[stored-1].Payload))
+}
+
+func TestIncompleteIndexUpdate(t *testing.T) {
+	// This test makes sure that a new FileStore instance ignores an update
+	// to an index left incomplete by the server stopping, and can then carry
+	// on storing messages.
+
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	filestore, err := NewFileStore(rootDir)
+	assert.Nil(t, err)
+	topic := "some topic"
+	for _, payload := range []string{"abc", "def"} {
+		_, err = filestore.Store(topic,
+			minikafka.Message{Payload: []byte(payload)})
+		assert.Nil(t, err)
+	}
+	err = ioutils.AppendToFile(filenamer.LogUpdatesFile(topic, rootDir),
+		[]byte("partial"))
+	assert.Nil(t, err)
+
+	newFileStore, err := NewFileStore(rootDir)
+	assert.Nil(t, err)
+	msgNumber, err := newFileStore.Store(topic,
+		minikafka.Message{Payload: []byte("ghi")})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, msgNumber)
+
+	newFileStore, err = NewFileStore(rootDir)
+	assert.Nil(t, err)
+	messages, _, err := newFileStore.Poll(topic, 1, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(messages))
+	assert.Equal(t, "ghi", string(messages[2].Payload))
+}
+
+func TestOrphansAreQuarantined(t *testing.T) {
+	// This test makes sure that a new FileStore instance moves aside the
+	// files that a topic's index does not refer to, rather than deleting
+	// them; and that they are only deleted on request.
+
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	filestore, err := NewFileStore(rootDir)
+	assert.Nil(t, err)
+	topic := "some topic"
+	_, err = filestore.Store(topic, minikafka.Message{Payload: []byte("abc")})
+	assert.Nil(t, err)
+	orphan := filenamer.MessageFilePath("ORPHAN", topic, rootDir)
+	err = ioutil.WriteFile(orphan, []byte("def"), 0666)
+	assert.Nil(t, err)
+
+	_, err = NewFileStore(rootDir)
+	assert.Nil(t, err)
+	assert.False(t, ioutils.Exists(orphan))
+	quarantined := path.Join(filenamer.QuarantineDirectory(topic, rootDir),
+		"ORPHAN")
+	assert.True(t, ioutils.Exists(quarantined))
+	problems, err := Verify(rootDir)
+	assert.Nil(t, err)
+	assert.Len(t, problems, 1)
+	assert.Equal(t, actions.QuarantinedFile, problems[0].Kind)
+
+	removed, err := RemoveOrphans(rootDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, removed)
+	assert.False(t, ioutils.Exists(quarantined))
+	problems, err = Verify(rootDir)
+	assert.Nil(t, err)
+	assert.Len(t, problems, 0)
+}
+
+func TestFailureToRemoveOldFile(t *testing.T) {
+	// This test makes sure that when an old message file cannot be removed,
+	// the log can still be polled; both straight away, and once the store
+	// is opened again.
+
+	rootDir := ioutils.TmpRootDir(t)
+	defer os.RemoveAll(rootDir)
+
+	filestore, err := NewFileStore(rootDir)
+	assert.Nil(t, err)
+	topic := "some topic"
+	// With messages of this size, 10 fit in each file; so this spawns 3.
+	message := minikafka.Message{Payload: make([]byte, 100000)}
+	for i := 0; i < 21; i++ {
+		_, err = filestore.Store(topic, message)
+		assert.Nil(t, err)
+	}
+	index, err := filestore.loadLogIndexes(topic)
+	assert.Nil(t, err)
+	second := index.MessageFileLists[topic].Names[1]
+
+	// A non-empty directory in place of the second file cannot be removed;
+	// whereas the first file can be.
+	secondPath := filenamer.MessageFilePath(second, topic, rootDir)
+	assert.Nil(t, os.Remove(secondPath))
+	assert.Nil(t, os.Mkdir(secondPath, 0777))
+	err = ioutil.WriteFile(path.Join(secondPath, "file"), []byte("abc"), 0666)
+	assert.Nil(t, err)
+
+	err = filestore.SetRetentionPolicy(topic,
+		contract.RetentionPolicy{MaxMessages: 1})
+	assert.Nil(t, err)
+	err = filestore.RemoveOldMessages(time.Now().Add(-time.Hour))
+	assert.NotNil(t, err)
+
+	// The log no longer refers to the first two files.
+	_, _, err = filestore.Poll(topic, 1, 0, 0)
+	assert.Equal(t, contract.OutOfRangeError{
+		ReadFrom: 1, Earliest: 21, Next: 22}, err)
+	messages, _, err := filestore.Poll(topic, 21, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(messages))
+
+	newFileStore, err := NewFileStore(rootDir)
+	assert.Nil(t, err)
+	messages, _, err = newFileStore.Poll(topic, 21, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(messages))
+}
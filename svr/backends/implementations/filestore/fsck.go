@@ -0,0 +1,139 @@
+package filestore
+
+import (
+	"fmt"
+
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/actions"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/ioutils"
+)
+
+// Verify checks the file store rooted at the given directory; that its
+// message files are intact, and agree with its logs' indexes. It reports the
+// problems it finds, and changes nothing. It is an error for an index to be
+// unreadable - see Rebuild. The store should not be in use by a FileStore, in
+// this process or another, at the time.
+func Verify(rootDir string) ([]actions.Problem, error) {
+	s := FileStore{RootDir: rootDir, state: &storeState{}}
+	index, err := s.readAllLogIndexes()
+	if err != nil {
+		return nil, fmt.Errorf("readAllLogIndexes(): %v", err)
+	}
+	action := actions.VerifyAction{Index: index, RootDir: rootDir}
+	problems, err := action.Verify()
+	if err != nil {
+		return nil, fmt.Errorf("action.Verify(): %v", err)
+	}
+	return problems, nil
+}
+
+// RemoveOrphans deletes the files in the logs' directories of the file store
+// rooted at the given directory that their indexes do not refer to, along
+// with those that have been moved aside to the logs' quarantine directories
+// when the store was opened. (See actions.RemoveOrphansAction). It reports
+// how many files it removed. It is an error for an index to be unreadable -
+// see Rebuild. The store should not be in use by a FileStore, in this process
+// or another, at the time.
+func RemoveOrphans(rootDir string) (removed int, err error) {
+	s := FileStore{RootDir: rootDir, state: &storeState{}}
+	index, err := s.readAllLogIndexes()
+	if err != nil {
+		return 0, fmt.Errorf("readAllLogIndexes(): %v", err)
+	}
+	action := actions.RemoveOrphansAction{Index: index, RootDir: rootDir}
+	removed, err = action.RemoveOrphans()
+	if err != nil {
+		return removed, fmt.Errorf("action.RemoveOrphans(): %v", err)
+	}
+	return removed, nil
+}
+
+// readAllLogIndexes provides an index holding what the index files of every
+// log hold, read afresh from disk.
+func (s FileStore) readAllLogIndexes() (*indexing.Index, error) {
+	logs, err := s.logs()
+	if err != nil {
+		return nil, fmt.Errorf("logs(): %v", err)
+	}
+	index := indexing.NewIndex()
+	for _, log := range logs {
+		logIndex, err := s.readLogIndex(log)
+		if err != nil {
+			return nil, fmt.Errorf("readLogIndex(): %v", err)
+		}
+		index.Absorb(logIndex)
+	}
+	return index, nil
+}
+
+// Rebuild replaces the index of every log in the file store rooted at the
+// given directory, with one rebuilt from its message files, (see
+// actions.RebuildIndexAction). When a log's old index can still be read,
+// what the message files do not record is kept from it: the retention
+// policy, partition count, producers' recent requests, and the next message
+// number to issue. It reports whether every old index could be read. The
+// store-wide index, which holds the committed offsets, is left alone. It
+// changes nothing but the indexes; the bytes and files that the new indexes
+// leave out are removed when the store is next opened. The store should not
+// be in use by a FileStore, in this process or another, at the time.
+func Rebuild(rootDir string) (keptFromOldIndex bool, err error) {
+	s := FileStore{RootDir: rootDir, state: &storeState{}}
+	action := actions.RebuildIndexAction{RootDir: rootDir}
+	index, err := action.RebuildIndex()
+	if err != nil {
+		return false, fmt.Errorf("action.RebuildIndex(): %v", err)
+	}
+	keptFromOldIndex = true
+	oldIndex := indexing.NewIndex()
+	logs := index.Logs()
+	for _, log := range logs {
+		// The rebuilt index includes the updates in the log's update file,
+		// which must not then be applied to it.
+		index.UpdateNumbers[log], err = s.lastUpdateNumber(log)
+		if err != nil {
+			return false, fmt.Errorf("lastUpdateNumber(): %v", err)
+		}
+		if ioutils.Exists(filenamer.LogIndexFile(log, rootDir)) == false {
+			keptFromOldIndex = false
+			continue
+		}
+		oldLogIndex, err := s.readLogIndex(log)
+		if err != nil {
+			keptFromOldIndex = false
+			continue
+		}
+		oldIndex.Absorb(oldLogIndex)
+	}
+	keepFromOldIndex(index, oldIndex)
+	err = s.checkpointLogs(index, logs...)
+	if err != nil {
+		return false, fmt.Errorf("checkpointLogs(): %v", err)
+	}
+	return keptFromOldIndex, nil
+}
+
+// keepFromOldIndex copies into a rebuilt index what it cannot know from the
+// message files, from the indexes it replaces.
+func keepFromOldIndex(index *indexing.Index, oldIndex *indexing.Index) {
+	index.RetentionPolicies = oldIndex.RetentionPolicies
+	index.ProducerSequences = oldIndex.ProducerSequences
+	for topic, numPartitions := range oldIndex.PartitionCounts {
+		if numPartitions > index.NumPartitions(topic) {
+			index.SetNumPartitions(topic, numPartitions)
+		}
+	}
+	for topic, number := range oldIndex.UpdateNumbers {
+		if number > index.UpdateNumbers[topic] {
+			index.UpdateNumbers[topic] = number
+		}
+	}
+	for topic, next := range oldIndex.NextMessageNumbers {
+		if _, ok := index.MessageFileLists[topic]; ok == false {
+			continue
+		}
+		if next > index.NextMessageNumbers[topic] {
+			index.NextMessageNumbers[topic] = next
+		}
+	}
+}
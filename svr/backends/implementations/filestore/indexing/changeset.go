@@ -0,0 +1,144 @@
+package indexing
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path"
+)
+
+// ChangeSet is a set of changes to several index files, that must be made all
+// at once: saving indexes, and removing the directories of others, (along
+// with the index files in them). Saving one index is atomic (see Save), but
+// a server can stop part way through a series of them. So the changes are
+// recorded in a journal file before they are made, and should the server stop
+// part way through, they are finished by FinishChanges when it starts up
+// again.
+type ChangeSet struct {
+	// The indexes to save, keyed on the path to save each to.
+	Saves map[string]*Index
+	// The directories to remove.
+	Removals []string
+}
+
+// journal is what a ChangeSet records in its journal file: the paths of the
+// index files already written to their temporary paths (see TmpPath), ready
+// to be renamed into place, and of the directories to remove.
+type journal struct {
+	Saved   []string
+	Removed []string
+}
+
+// Apply makes the changes. The journal file is not needed when there is only
+// one index to save, and nothing to remove.
+func (changes ChangeSet) Apply(journalPath string) error {
+	if len(changes.Saves) == 0 && len(changes.Removals) == 0 {
+		return nil
+	}
+	if len(changes.Saves) == 1 && len(changes.Removals) == 0 {
+		for filepath, index := range changes.Saves {
+			return index.Save(filepath)
+		}
+	}
+	j := journal{Removed: changes.Removals}
+	for filepath, index := range changes.Saves {
+		tmpPath := TmpPath(filepath)
+		err := writeAndSync(tmpPath, index)
+		if err != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("writeAndSync(): %v", err)
+		}
+		j.Saved = append(j.Saved, filepath)
+	}
+	// Once the journal is saved, the changes are as good as made.
+	err := saveJournal(journalPath, j)
+	if err != nil {
+		return fmt.Errorf("saveJournal(): %v", err)
+	}
+	err = finish(journalPath, j)
+	if err != nil {
+		return fmt.Errorf("finish(): %v", err)
+	}
+	return nil
+}
+
+// FinishChanges finishes the changes that a ChangeSet recorded in the given
+// journal file, if there is one; which means the server stopped part way
+// through applying them.
+func FinishChanges(journalPath string) error {
+	file, err := os.Open(journalPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("os.Open(): %v", err)
+	}
+	var j journal
+	err = gob.NewDecoder(file).Decode(&j)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("decoder.Decode(): %v", err)
+	}
+	err = finish(journalPath, j)
+	if err != nil {
+		return fmt.Errorf("finish(): %v", err)
+	}
+	return nil
+}
+
+// saveJournal saves the journal, replacing the file atomically, just as Save
+// does.
+func saveJournal(journalPath string, j journal) error {
+	tmpPath := TmpPath(journalPath)
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("os.Create(): %v", err)
+	}
+	err = gob.NewEncoder(file).Encode(j)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("file.Write(): %v", err)
+	}
+	err = os.Rename(tmpPath, journalPath)
+	if err != nil {
+		return fmt.Errorf("os.Rename(): %v", err)
+	}
+	err = syncDir(path.Dir(journalPath))
+	if err != nil {
+		return fmt.Errorf("syncDir(): %v", err)
+	}
+	return nil
+}
+
+// finish makes the changes recorded in the given journal, and then removes
+// the journal file. It can be repeated, should it be interrupted.
+func finish(journalPath string, j journal) error {
+	for _, filepath := range j.Saved {
+		err := os.Rename(TmpPath(filepath), filepath)
+		if err != nil && os.IsNotExist(err) == false {
+			return fmt.Errorf("os.Rename(): %v", err)
+		}
+		err = syncDir(path.Dir(filepath))
+		if err != nil && os.IsNotExist(err) == false {
+			return fmt.Errorf("syncDir(): %v", err)
+		}
+	}
+	for _, dir := range j.Removed {
+		err := os.RemoveAll(dir)
+		if err != nil {
+			return fmt.Errorf("os.RemoveAll(): %v", err)
+		}
+	}
+	err := os.Remove(journalPath)
+	if err != nil && os.IsNotExist(err) == false {
+		return fmt.Errorf("os.Remove(): %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package indexing
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Make sure that applying a change set saves and removes what it says, and
+// leaves neither the journal nor temporary files behind.
+func TestApplyChangeSet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index_")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	journalPath := path.Join(dir, "index.journal")
+	pathA := path.Join(dir, "indexA")
+	pathB := path.Join(dir, "indexB")
+	removed := path.Join(dir, "removed")
+	err = os.Mkdir(removed, 0777)
+	assert.Nil(t, err)
+
+	index, _ := MakeReferenceIndex()
+	changes := ChangeSet{
+		Saves:    map[string]*Index{pathA: index, pathB: NewIndex()},
+		Removals: []string{removed}}
+	err = changes.Apply(journalPath)
+	assert.Nil(t, err)
+
+	newIndex := NewIndex()
+	err = newIndex.PopulateFromDisk(pathA)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(newIndex.MessageFileLists["topicA"].Names))
+	_, err = os.Stat(pathB)
+	assert.Nil(t, err)
+	for _, filepath := range []string{removed, journalPath, TmpPath(pathA),
+		TmpPath(pathB)} {
+		_, err = os.Stat(filepath)
+		assert.True(t, os.IsNotExist(err))
+	}
+}
+
+// Make sure that changes recorded in the journal, by a server that stopped
+// before it finished making them, are finished when it starts up again.
+func TestFinishChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index_")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	journalPath := path.Join(dir, "index.journal")
+	pathA := path.Join(dir, "indexA")
+	removed := path.Join(dir, "removed")
+	err = os.Mkdir(removed, 0777)
+	assert.Nil(t, err)
+
+	// There being no journal is not a problem.
+	err = FinishChanges(journalPath)
+	assert.Nil(t, err)
+
+	// Simulate stopping just after the journal was saved.
+	index, _ := MakeReferenceIndex()
+	err = writeAndSync(TmpPath(pathA), index)
+	assert.Nil(t, err)
+	err = saveJournal(journalPath,
+		journal{Saved: []string{pathA}, Removed: []string{removed}})
+	assert.Nil(t, err)
+
+	err = FinishChanges(journalPath)
+	assert.Nil(t, err)
+	newIndex := NewIndex()
+	err = newIndex.PopulateFromDisk(pathA)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(newIndex.MessageFileLists["topicA"].Names))
+	for _, filepath := range []string{removed, journalPath, TmpPath(pathA)} {
+		_, err = os.Stat(filepath)
+		assert.True(t, os.IsNotExist(err))
+	}
+
+	// Finishing again, as when interrupted part way through, does no harm.
+	err = saveJournal(journalPath,
+		journal{Saved: []string{pathA}, Removed: []string{removed}})
+	assert.Nil(t, err)
+	err = FinishChanges(journalPath)
+	assert.Nil(t, err)
+	err = newIndex.PopulateFromDisk(pathA)
+	assert.Nil(t, err)
+}
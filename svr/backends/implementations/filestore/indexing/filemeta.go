@@ -1,6 +1,7 @@
 package indexing
 
 import (
+	"sort"
 	"time"
 )
 
@@ -11,12 +12,15 @@ import (
 
 // FileMeta holds information about the oldest and newest message in
 // one message file, its current size, and the file-seek-offsets at which each
-// message starts.
+// message starts. Format records how the messages are laid out in the file
+// (see the envelope package). It is zero for files written before formats were
+// introduced.
 type FileMeta struct {
 	Oldest                     MsgMeta
 	Newest                     MsgMeta
 	Size                       int64
 	SeekOffsetForMessageNumber map[int32]int64
+	Format                     int8
 }
 
 // NewFileMeta provides an initialised FileMeta, ready to use.
@@ -27,12 +31,17 @@ func NewFileMeta() *FileMeta {
 // RegisterNewMessage updates the FileMeta object according to this new
 // message arriving in the store.
 func (fm *FileMeta) RegisterNewMessage(msgNumber int32, messageSize int64) {
+	fm.RegisterNewMessageAt(msgNumber, messageSize, time.Now())
+}
+
+// RegisterNewMessageAt is like RegisterNewMessage, but for when the caller
+// has decided on the message's creation time.
+func (fm *FileMeta) RegisterNewMessageAt(msgNumber int32, messageSize int64,
+	creationTime time.Time) {
 
 	fm.SeekOffsetForMessageNumber[msgNumber] = fm.Size
 	fm.Size += messageSize
 
-	creationTime := time.Now()
-
 	// Special case, when this is the first message to arrive for the file.
 	if fm.Oldest.MsgNum == int32(0) {
 		fm.Oldest.MsgNum = msgNumber
@@ -40,3 +49,52 @@ func (fm *FileMeta) RegisterNewMessage(msgNumber int32, messageSize int64) {
 	}
 	fm.Newest = MsgMeta{msgNumber, creationTime}
 }
+
+// MessageNumbers provides the numbers of the messages held in the file, in
+// order. They are consecutive, unless the file has been compacted.
+func (fm *FileMeta) MessageNumbers() []int32 {
+	numbers := make([]int32, 0, len(fm.SeekOffsetForMessageNumber))
+	if fm.Oldest.MsgNum == 0 {
+		return numbers
+	}
+	// Avoid sorting in the usual case, of there being no gaps.
+	if len(fm.SeekOffsetForMessageNumber) ==
+		int(fm.Newest.MsgNum-fm.Oldest.MsgNum)+1 {
+		for msgNum := fm.Oldest.MsgNum; msgNum <= fm.Newest.MsgNum; msgNum++ {
+			numbers = append(numbers, msgNum)
+		}
+		return numbers
+	}
+	for msgNum := range fm.SeekOffsetForMessageNumber {
+		numbers = append(numbers, msgNum)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return numbers
+}
+
+// ForgetMessagesBeyond forgets the messages that do not lie wholly within the
+// first *size* bytes of the file, and reduces the file's recorded size to
+// the end of the last message that remains. It returns how many messages it
+// forgot. The index does not record the creation time of every message, so
+// when the newest message is forgotten, the caller must correct
+// *Newest.Created*.
+func (fm *FileMeta) ForgetMessagesBeyond(size int64) (nForgotten int) {
+	numbers := fm.MessageNumbers()
+	last := len(numbers) - 1
+	for last >= 0 && fm.Size > size {
+		fm.Size = fm.SeekOffsetForMessageNumber[numbers[last]]
+		delete(fm.SeekOffsetForMessageNumber, numbers[last])
+		last--
+		nForgotten++
+	}
+	if nForgotten == 0 {
+		return 0
+	}
+	if last < 0 {
+		fm.Oldest = MsgMeta{}
+		fm.Newest = MsgMeta{}
+		return nForgotten
+	}
+	fm.Newest.MsgNum = numbers[last]
+	return nForgotten
+}
@@ -8,6 +8,10 @@
 // files are.
 package indexing
 
+import (
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+)
+
 // The types' fields are exported so they can be automatically gob-encoded
 // without bothering with structure tags.
 
@@ -18,6 +22,19 @@ type Index struct {
 	MessageFileLists map[string]*MessageFileList
 	// The next message number to issue for each topic.
 	NextMessageNumbers map[string]int32
+	// The read-from message numbers committed by consumer groups. Keyed on
+	// group and then on topic.
+	CommittedOffsets map[string]map[string]int32
+	// The retention policies set for topics. Keyed on topic.
+	RetentionPolicies map[string]contract.RetentionPolicy
+	// The number of partitions for topics that have more than one. Keyed on
+	// topic.
+	PartitionCounts map[string]int32
+	// Producers' recent requests, to recognise retries. Keyed on topic.
+	ProducerSequences map[string]contract.ProducerSequences
+	// The number of the last update (see Update) that the index includes,
+	// for each topic.
+	UpdateNumbers map[string]int64
 }
 
 // NewIndex creates and initialized an Index.
@@ -25,6 +42,11 @@ func NewIndex() *Index {
 	return &Index{
 		map[string]*MessageFileList{},
 		map[string]int32{},
+		map[string]map[string]int32{},
+		map[string]contract.RetentionPolicy{},
+		map[string]int32{},
+		map[string]contract.ProducerSequences{},
+		map[string]int64{},
 	}
 }
 
@@ -35,6 +57,23 @@ func (index *Index) RegisterTopic(topic string) {
 	index.NextMessageNumbers[topic] = 1
 }
 
+// ForgetTopic updates the index data structures to forget everything they
+// know about a topic; including the read-from message numbers committed for
+// it by consumer groups, its retention policy, its partition count, and its
+// producers' recent requests. (When given the name of a partition's log, it
+// forgets only that log).
+func (index *Index) ForgetTopic(topic string) {
+	delete(index.MessageFileLists, topic)
+	delete(index.NextMessageNumbers, topic)
+	for _, offsets := range index.CommittedOffsets {
+		delete(offsets, topic)
+	}
+	delete(index.RetentionPolicies, topic)
+	delete(index.PartitionCounts, topic)
+	delete(index.ProducerSequences, topic)
+	delete(index.UpdateNumbers, topic)
+}
+
 // GetMessageFileListFor provides access to the MesageFileList for the
 // given topic. It copes gracefully with the topic being hithertoo unknown.
 func (index *Index) GetMessageFileListFor(topic string) *MessageFileList {
@@ -54,6 +93,24 @@ func (index *Index) GetAndIncrementMessageNumberFor(topic string) int32 {
 	return current
 }
 
+// AvailableRange provides the number of the oldest message held for a topic,
+// and the number the next message stored will get. They are equal when no
+// messages are held. It copes gracefully with the topic being unknown, by
+// returning false for *ok*.
+func (index *Index) AvailableRange(topic string) (
+	earliest int32, next int32, ok bool) {
+	msgFileList, ok := index.MessageFileLists[topic]
+	if ok == false {
+		return 0, 0, false
+	}
+	next = index.NextMessageNumbers[topic]
+	oldest, ok := msgFileList.Oldest()
+	if ok == false {
+		return next, next, true
+	}
+	return oldest.MsgNum, next, true
+}
+
 // CurrentMsgFileNameFor provides the name of the file that is currently being
 // used to store incoming messages for a topic. It copes gracefully with there
 // not being one - by returning an empty string.
@@ -19,6 +19,26 @@ func TestGetAndIncrementMessageNumberFor(t *testing.T) {
 	assert.Equal(t, int32(8), nextNum)
 }
 
+func TestForgetTopic(t *testing.T) {
+	index, _ := MakeReferenceIndex()
+	index.CommitOffset("groupA", "topicA", 3)
+	index.CommitOffset("groupA", "topicB", 4)
+	index.ForgetTopic("topicA")
+
+	assert.NotContains(t, index.MessageFileLists, "topicA")
+	assert.NotContains(t, index.NextMessageNumbers, "topicA")
+	_, ok := index.CommittedOffset("groupA", "topicA")
+	assert.False(t, ok)
+
+	// Other topics should be untouched.
+	assert.Contains(t, index.MessageFileLists, "topicB")
+	_, ok = index.CommittedOffset("groupA", "topicB")
+	assert.True(t, ok)
+
+	// Check it copes silently when the topic is not known.
+	index.ForgetTopic("neverheardof")
+}
+
 func TestCurrentMsgFileNameFor(t *testing.T) {
 	index, _ := MakeReferenceIndex()
 	// Check correct when topic is known and has files registered.
@@ -31,6 +51,25 @@ func TestCurrentMsgFileNameFor(t *testing.T) {
 	assert.Equal(t, expected, currentName)
 }
 
+func TestAvailableRange(t *testing.T) {
+	index, _ := MakeReferenceIndex()
+	earliest, next, ok := index.AvailableRange("topicA")
+	assert.True(t, ok)
+	assert.Equal(t, int32(1), earliest)
+	assert.Equal(t, int32(7), next)
+
+	// Case when no messages are held.
+	index.RegisterTopic("empty")
+	index.GetAndIncrementMessageNumberFor("empty")
+	earliest, next, ok = index.AvailableRange("empty")
+	assert.True(t, ok)
+	assert.Equal(t, int32(2), earliest)
+	assert.Equal(t, int32(2), next)
+
+	_, _, ok = index.AvailableRange("nosuchtopic")
+	assert.False(t, ok)
+}
+
 func TestPreviouslyUsed(t *testing.T) {
 	index, _ := MakeReferenceIndex()
 	// When should say yes.
@@ -114,6 +153,53 @@ func TestNumMessagesInFile(t *testing.T) {
 	n = lst.NumMessagesInFile("some file")
 	expected = 0
 	assert.Equal(t, expected, n)
+
+	// Case when compaction has left gaps in the message numbers.
+	lst.Meta["some file"].RegisterNewMessage(3, 10)
+	lst.Meta["some file"].RegisterNewMessage(7, 10)
+	n = lst.NumMessagesInFile("some file")
+	expected = 2
+	assert.Equal(t, expected, n)
+}
+
+func TestMessageNumbers(t *testing.T) {
+	// Consecutive numbers.
+	index, _ := MakeReferenceIndex()
+	fileMeta := index.MessageFileLists["topicA"].Meta["file2"]
+	assert.Equal(t, []int32{4, 5, 6}, fileMeta.MessageNumbers())
+
+	// With gaps.
+	fileMeta = NewFileMeta()
+	for _, msgNum := range []int32{3, 7, 8, 12} {
+		fileMeta.RegisterNewMessage(msgNum, 10)
+	}
+	assert.Equal(t, []int32{3, 7, 8, 12}, fileMeta.MessageNumbers())
+
+	// Empty.
+	assert.Equal(t, []int32{}, NewFileMeta().MessageNumbers())
+}
+
+func TestForgetMessagesBeyond(t *testing.T) {
+	fileMeta := NewFileMeta()
+	for _, msgNum := range []int32{3, 4, 5} {
+		fileMeta.RegisterNewMessage(msgNum, 10)
+	}
+
+	// Nothing lies beyond.
+	assert.Equal(t, 0, fileMeta.ForgetMessagesBeyond(30))
+	assert.Equal(t, int64(30), fileMeta.Size)
+
+	// Part of the last message is missing.
+	assert.Equal(t, 1, fileMeta.ForgetMessagesBeyond(25))
+	assert.Equal(t, int64(20), fileMeta.Size)
+	assert.Equal(t, []int32{3, 4}, fileMeta.MessageNumbers())
+	assert.Equal(t, int32(4), fileMeta.Newest.MsgNum)
+
+	// Every message is missing.
+	assert.Equal(t, 2, fileMeta.ForgetMessagesBeyond(5))
+	assert.Equal(t, int64(0), fileMeta.Size)
+	assert.Equal(t, int32(0), fileMeta.Oldest.MsgNum)
+	assert.Equal(t, []int32{}, fileMeta.MessageNumbers())
 }
 
 func TestMessageFilesForMessagesFrom(t *testing.T) {
@@ -148,4 +234,68 @@ func TestMessageFilesForMessagesFrom(t *testing.T) {
 	assert.Equal(t, expected, files)
 }
 
+func TestOldestAndNewest(t *testing.T) {
+	index, times := MakeReferenceIndex()
+	lst := index.MessageFileLists["topicA"]
+	oldest, ok := lst.Oldest()
+	assert.True(t, ok)
+	assert.Equal(t, int32(1), oldest.MsgNum)
+	assert.WithinDuration(t, times[0], oldest.Created, 50*time.Millisecond)
+	newest, ok := lst.Newest()
+	assert.True(t, ok)
+	assert.Equal(t, int32(6), newest.MsgNum)
+	assert.WithinDuration(t, times[5], newest.Created, 50*time.Millisecond)
+
+	// Case when no messages registered.
+	lst = NewMessageFileList()
+	lst.RegisterNewFile("some file")
+	_, ok = lst.Oldest()
+	assert.False(t, ok)
+	_, ok = lst.Newest()
+	assert.False(t, ok)
+}
+
+func TestNumMessagesAndTotalSize(t *testing.T) {
+	index, _ := MakeReferenceIndex()
+	lst := index.MessageFileLists["topicA"]
+	assert.Equal(t, 6, lst.NumMessages())
+	assert.Equal(t, int64(6*1024), lst.TotalSize())
+
+	// Case when no files registered.
+	lst = NewMessageFileList()
+	assert.Equal(t, 0, lst.NumMessages())
+	assert.Equal(t, int64(0), lst.TotalSize())
+}
+
+func TestExcessFiles(t *testing.T) {
+	// The reference index has 3 messages, each of 1024 bytes, in each file.
+	index, _ := MakeReferenceIndex()
+	lst := index.MessageFileLists["topicA"]
+
+	// No limits.
+	assert.Equal(t, []string{}, lst.ExcessFiles(0, 0))
+
+	// Limits that removing file1 would still satisfy.
+	assert.Equal(t, []string{"file1"}, lst.ExcessFiles(3, 0))
+	assert.Equal(t, []string{"file1"}, lst.ExcessFiles(0, 3*1024))
+
+	// Limits that removing file1 would not satisfy.
+	assert.Equal(t, []string{}, lst.ExcessFiles(4, 0))
+	assert.Equal(t, []string{}, lst.ExcessFiles(0, 3*1024+1))
+
+	// Either limit being satisfied is sufficient.
+	assert.Equal(t, []string{"file1"}, lst.ExcessFiles(4, 3*1024))
+}
+
+func TestForgetFilesWhenNamesNotInAlphabeticalOrder(t *testing.T) {
+	lst := NewMessageFileList()
+	for _, name := range []string{"ZZZ", "MMM", "AAA"} {
+		lst.RegisterNewFile(name)
+	}
+	lst.ForgetFiles([]string{"MMM"})
+	assert.Equal(t, []string{"ZZZ", "AAA"}, lst.Names)
+	lst.ForgetFiles([]string{"ZZZ"})
+	assert.Equal(t, []string{"AAA"}, lst.Names)
+}
+
 // Add other cases.
@@ -0,0 +1,106 @@
+package indexing
+
+import (
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+)
+
+// Each topic's (or partition's) log is saved in an index of its own, which
+// holds only what is keyed on that log. The store-wide index holds only the
+// committed offsets. These methods split an index into those parts, and put
+// them back together.
+
+// LogIndex provides a new index, holding only what the index holds about the
+// given log: its message files, its next message number, its producers'
+// recent requests and the number of its last update; and when the log is a
+// topic's first partition, (which shares the topic's name), the topic's
+// retention policy and partition count. It shares these with the index, rather than copying them.
+func (index *Index) LogIndex(log string) *Index {
+	logIndex := NewIndex()
+	if msgFileList, ok := index.MessageFileLists[log]; ok {
+		logIndex.MessageFileLists[log] = msgFileList
+	}
+	if next, ok := index.NextMessageNumbers[log]; ok {
+		logIndex.NextMessageNumbers[log] = next
+	}
+	if policy, ok := index.RetentionPolicies[log]; ok {
+		logIndex.RetentionPolicies[log] = policy
+	}
+	if numPartitions, ok := index.PartitionCounts[log]; ok {
+		logIndex.PartitionCounts[log] = numPartitions
+	}
+	if sequences, ok := index.ProducerSequences[log]; ok {
+		logIndex.ProducerSequences[log] = sequences
+	}
+	if number, ok := index.UpdateNumbers[log]; ok {
+		logIndex.UpdateNumbers[log] = number
+	}
+	return logIndex
+}
+
+// StoreWideIndex provides a new index, holding only the committed offsets
+// the index holds. It shares these with the index, rather than copying them.
+func (index *Index) StoreWideIndex() *Index {
+	storeWideIndex := NewIndex()
+	if index.CommittedOffsets != nil {
+		storeWideIndex.CommittedOffsets = index.CommittedOffsets
+	}
+	return storeWideIndex
+}
+
+// Absorb adds everything the other index holds to this one, replacing what
+// this one holds for the same keys.
+func (index *Index) Absorb(other *Index) {
+	index.ensureMaps()
+	for log, msgFileList := range other.MessageFileLists {
+		index.MessageFileLists[log] = msgFileList
+	}
+	for log, next := range other.NextMessageNumbers {
+		index.NextMessageNumbers[log] = next
+	}
+	for group, offsets := range other.CommittedOffsets {
+		for log, readFrom := range offsets {
+			index.CommitOffset(group, log, readFrom)
+		}
+	}
+	for topic, policy := range other.RetentionPolicies {
+		index.RetentionPolicies[topic] = policy
+	}
+	for topic, numPartitions := range other.PartitionCounts {
+		index.PartitionCounts[topic] = numPartitions
+	}
+	for log, sequences := range other.ProducerSequences {
+		index.ProducerSequences[log] = sequences
+	}
+	for log, number := range other.UpdateNumbers {
+		index.UpdateNumbers[log] = number
+	}
+}
+
+// Logs provides the names of the logs the index holds message files for.
+func (index *Index) Logs() []string {
+	logs := []string{}
+	for log := range index.MessageFileLists {
+		logs = append(logs, log)
+	}
+	return logs
+}
+
+// ensureMaps makes the maps that indexes persisted by older versions
+// deserialize without.
+func (index *Index) ensureMaps() {
+	if index.CommittedOffsets == nil {
+		index.CommittedOffsets = map[string]map[string]int32{}
+	}
+	if index.RetentionPolicies == nil {
+		index.RetentionPolicies = map[string]contract.RetentionPolicy{}
+	}
+	if index.PartitionCounts == nil {
+		index.PartitionCounts = map[string]int32{}
+	}
+	if index.ProducerSequences == nil {
+		index.ProducerSequences = map[string]contract.ProducerSequences{}
+	}
+	if index.UpdateNumbers == nil {
+		index.UpdateNumbers = map[string]int64{}
+	}
+}
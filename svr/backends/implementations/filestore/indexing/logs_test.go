@@ -0,0 +1,54 @@
+package indexing
+
+import (
+	"testing"
+
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogIndexAndAbsorb(t *testing.T) {
+	index, _ := MakeReferenceIndex()
+	index.CommitOffset("groupA", "topicA", 3)
+	index.SetRetentionPolicy("topicA", contract.RetentionPolicy{MaxMessages: 5})
+	index.SetNumPartitions("topicA", 2)
+	index.RegisterTopic("topicA#1")
+
+	// A log's index holds only what is keyed on the log.
+	logIndex := index.LogIndex("topicA")
+	assert.Equal(t, []string{"topicA"}, logIndex.Logs())
+	assert.Equal(t, index.NextMessageNumbers["topicA"],
+		logIndex.NextMessageNumbers["topicA"])
+	assert.Equal(t, 5, logIndex.RetentionPolicy("topicA").MaxMessages)
+	assert.Equal(t, int32(2), logIndex.NumPartitions("topicA"))
+	assert.Equal(t, 0, len(logIndex.CommittedOffsets))
+
+	// The store-wide index holds only the committed offsets.
+	storeWideIndex := index.StoreWideIndex()
+	assert.Equal(t, 0, len(storeWideIndex.MessageFileLists))
+	readFrom, ok := storeWideIndex.CommittedOffset("groupA", "topicA")
+	assert.True(t, ok)
+	assert.Equal(t, int32(3), readFrom)
+
+	// Absorbing the parts puts the index back together.
+	combined := NewIndex()
+	combined.Absorb(storeWideIndex)
+	combined.Absorb(logIndex)
+	combined.Absorb(index.LogIndex("topicA#1"))
+	assert.ElementsMatch(t, []string{"topicA", "topicA#1"}, combined.Logs())
+	assert.Equal(t, index.MessageFileLists["topicA"],
+		combined.MessageFileLists["topicA"])
+	readFrom, ok = combined.CommittedOffset("groupA", "topicA")
+	assert.True(t, ok)
+	assert.Equal(t, int32(3), readFrom)
+}
+
+func TestAbsorbWhenMapsAbsent(t *testing.T) {
+	// Indexes saved by older versions have no maps for some things.
+	index := &Index{MessageFileLists: map[string]*MessageFileList{},
+		NextMessageNumbers: map[string]int32{}}
+	other := NewIndex()
+	other.SetNumPartitions("topicA", 3)
+	index.Absorb(other)
+	assert.Equal(t, int32(3), index.NumPartitions("topicA"))
+}
@@ -49,21 +49,18 @@ func (lst *MessageFileList) ForgetFiles(names []string) {
 	for _, name := range names {
 		// Get rid of this name from the map of file names to FileMeta.
 		delete(lst.Meta, name)
-		// Take the name out of the ordered list of filenames also.
-		n := len(lst.Names)
-		index := sort.SearchStrings(lst.Names, name)
-		if index == n { // Not present.
-			continue
+		// Take the name out of the ordered list of filenames also. (The
+		// list is ordered by age, not by name, so it cannot be binary
+		// searched.)
+		for i, existingName := range lst.Names {
+			if existingName == name {
+				newList := []string{}
+				newList = append(newList, lst.Names[0:i]...)
+				newList = append(newList, lst.Names[i+1:]...)
+				lst.Names = newList
+				break
+			}
 		}
-		if index == n-1 { // Special case when it's the last element.
-			lst.Names = lst.Names[0 : n-1]
-			continue
-		}
-		// General case.
-		newList := []string{}
-		newList = append(newList, lst.Names[0:index]...)
-		newList = append(newList, lst.Names[index+1:]...)
-		lst.Names = newList
 	}
 }
 
@@ -75,12 +72,9 @@ func (lst *MessageFileList) NumMessagesInFile(name string) int {
 	if ok == false {
 		return 0
 	}
-	// Name known, but no messages recorded for it yet.
-	if fileMeta.Oldest.MsgNum == 0 {
-		return 0
-	}
-	// General case.
-	return int(fileMeta.Newest.MsgNum) - int(fileMeta.Oldest.MsgNum) + 1
+	// Compaction can leave gaps in the message numbers, so count them
+	// individually.
+	return len(fileMeta.SeekOffsetForMessageNumber)
 }
 
 // MessageFilesForMessagesFrom provides all the message files that contain
@@ -101,3 +95,70 @@ func (lst *MessageFileList) MessageFilesForMessagesFrom(
 	// We want the one just identified, plus all later ones.
 	return lst.Names[idx:]
 }
+
+// Oldest provides the MsgMeta for the oldest message held in the list's
+// files. It copes gracefully with there being no messages, by returning false
+// for *ok*.
+func (lst *MessageFileList) Oldest() (msgMeta MsgMeta, ok bool) {
+	for _, name := range lst.Names {
+		fileMeta := lst.Meta[name]
+		if fileMeta.Oldest.MsgNum != 0 {
+			return fileMeta.Oldest, true
+		}
+	}
+	return MsgMeta{}, false
+}
+
+// Newest provides the MsgMeta for the newest message held in the list's
+// files. It copes gracefully with there being no messages, by returning false
+// for *ok*.
+func (lst *MessageFileList) Newest() (msgMeta MsgMeta, ok bool) {
+	for i := len(lst.Names) - 1; i >= 0; i-- {
+		fileMeta := lst.Meta[lst.Names[i]]
+		if fileMeta.Newest.MsgNum != 0 {
+			return fileMeta.Newest, true
+		}
+	}
+	return MsgMeta{}, false
+}
+
+// NumMessages provides a count of how many messages are held in all of the
+// list's files.
+func (lst *MessageFileList) NumMessages() int {
+	n := 0
+	for _, name := range lst.Names {
+		n += lst.NumMessagesInFile(name)
+	}
+	return n
+}
+
+// TotalSize provides the sum of the sizes of all the list's files.
+func (lst *MessageFileList) TotalSize() int64 {
+	var size int64
+	for _, fileMeta := range lst.Meta {
+		size += fileMeta.Size
+	}
+	return size
+}
+
+// ExcessFiles provides the oldest files from the list, that can be removed
+// while the messages in the files that remain still number at least
+// *maxMessages*, or still total at least *maxBytes*. (Limits of zero do not
+// apply). It provides them oldest first.
+func (lst *MessageFileList) ExcessFiles(
+	maxMessages int, maxBytes int64) []string {
+	excess := []string{}
+	nRemaining := lst.NumMessages()
+	bytesRemaining := lst.TotalSize()
+	for _, name := range lst.Names {
+		nRemaining -= lst.NumMessagesInFile(name)
+		bytesRemaining -= lst.Meta[name].Size
+		enoughMessages := maxMessages > 0 && nRemaining >= maxMessages
+		enoughBytes := maxBytes > 0 && bytesRemaining >= maxBytes
+		if !enoughMessages && !enoughBytes {
+			break
+		}
+		excess = append(excess, name)
+	}
+	return excess
+}
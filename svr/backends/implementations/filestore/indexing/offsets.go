@@ -0,0 +1,30 @@
+package indexing
+
+// CommitOffset records the read-from message number committed by a consumer
+// group for a topic.
+func (index *Index) CommitOffset(group string, topic string, readFrom int32) {
+	// Indexes persisted before consumer groups existed, deserialize without
+	// this map.
+	if index.CommittedOffsets == nil {
+		index.CommittedOffsets = map[string]map[string]int32{}
+	}
+	offsets, ok := index.CommittedOffsets[group]
+	if ok == false {
+		offsets = map[string]int32{}
+		index.CommittedOffsets[group] = offsets
+	}
+	offsets[topic] = readFrom
+}
+
+// CommittedOffset provides the read-from message number most recently
+// committed by a consumer group for a topic. It copes gracefully with there
+// not being one, by returning false for *ok*.
+func (index Index) CommittedOffset(group string, topic string) (
+	readFrom int32, ok bool) {
+	offsets, ok := index.CommittedOffsets[group]
+	if ok == false {
+		return 0, false
+	}
+	readFrom, ok = offsets[topic]
+	return readFrom, ok
+}
@@ -0,0 +1,36 @@
+package indexing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitOffset(t *testing.T) {
+	index, _ := MakeReferenceIndex()
+	index.CommitOffset("groupA", "topicA", 3)
+	index.CommitOffset("groupA", "topicA", 4)
+	index.CommitOffset("groupB", "topicA", 5)
+
+	readFrom, ok := index.CommittedOffset("groupA", "topicA")
+	assert.True(t, ok)
+	assert.Equal(t, int32(4), readFrom)
+	readFrom, ok = index.CommittedOffset("groupB", "topicA")
+	assert.True(t, ok)
+	assert.Equal(t, int32(5), readFrom)
+
+	// When nothing committed.
+	_, ok = index.CommittedOffset("groupA", "topicB")
+	assert.False(t, ok)
+	_, ok = index.CommittedOffset("groupC", "topicA")
+	assert.False(t, ok)
+}
+
+func TestCommitOffsetWhenMapAbsent(t *testing.T) {
+	// Indexes saved before consumer groups existed have no map for them.
+	index := &Index{}
+	index.CommitOffset("groupA", "topicA", 3)
+	readFrom, ok := index.CommittedOffset("groupA", "topicA")
+	assert.True(t, ok)
+	assert.Equal(t, int32(3), readFrom)
+}
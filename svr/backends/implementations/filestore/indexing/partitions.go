@@ -0,0 +1,25 @@
+package indexing
+
+// SetNumPartitions records the number of partitions a topic has.
+func (index *Index) SetNumPartitions(topic string, numPartitions int32) {
+	// Indexes persisted before partitions existed, deserialize without this
+	// map.
+	if index.PartitionCounts == nil {
+		index.PartitionCounts = map[string]int32{}
+	}
+	if numPartitions <= 1 {
+		delete(index.PartitionCounts, topic)
+		return
+	}
+	index.PartitionCounts[topic] = numPartitions
+}
+
+// NumPartitions provides the number of partitions a topic has. It copes
+// gracefully with there being no record of this, which means just one.
+func (index Index) NumPartitions(topic string) int32 {
+	numPartitions, ok := index.PartitionCounts[topic]
+	if ok == false {
+		return 1
+	}
+	return numPartitions
+}
@@ -0,0 +1,28 @@
+package indexing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetNumPartitions(t *testing.T) {
+	index, _ := MakeReferenceIndex()
+	index.SetNumPartitions("topicA", 4)
+	assert.Equal(t, int32(4), index.NumPartitions("topicA"))
+
+	// When none recorded.
+	assert.Equal(t, int32(1), index.NumPartitions("topicB"))
+
+	// Forgetting the topic should forget its partition count.
+	index.ForgetTopic("topicA")
+	assert.Equal(t, int32(1), index.NumPartitions("topicA"))
+}
+
+func TestSetNumPartitionsWhenMapAbsent(t *testing.T) {
+	// Indexes saved before partitions existed have no map for them.
+	index := &Index{}
+	assert.Equal(t, int32(1), index.NumPartitions("topicA"))
+	index.SetNumPartitions("topicA", 2)
+	assert.Equal(t, int32(2), index.NumPartitions("topicA"))
+}
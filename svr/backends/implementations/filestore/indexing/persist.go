@@ -1,25 +1,47 @@
 package indexing
 
 import (
+	"bufio"
 	"fmt"
 	"os"
+	"path"
 )
 
+// tmpSuffix is appended to the index file's path, to name the file that Save
+// writes before renaming it into place.
+const tmpSuffix = ".tmp"
+
 // Save serializes the index into a byte stream representation, and saves this
-// as a binary file.
+// as a binary file. The file is replaced atomically: the index is written
+// to a temporary file, which is flushed to disk and then renamed over the
+// old one. So a server that stops part way through leaves either the old
+// index or the new one, never a mixture.
 func (index *Index) Save(filepath string) error {
-	file, err := os.Create(filepath)
+	tmpPath := TmpPath(filepath)
+	err := writeAndSync(tmpPath, index)
 	if err != nil {
-		return fmt.Errorf("os.Create(): %v", err)
+		os.Remove(tmpPath)
+		return fmt.Errorf("writeAndSync(): %v", err)
 	}
-	defer file.Close()
-	err = index.Encode(file)
+	err = os.Rename(tmpPath, filepath)
 	if err != nil {
-		return fmt.Errorf("Encode(): %v", err)
+		return fmt.Errorf("os.Rename(): %v", err)
+	}
+	// The rename is only durable once the directory is.
+	err = syncDir(path.Dir(filepath))
+	if err != nil {
+		return fmt.Errorf("syncDir(): %v", err)
 	}
 	return nil
 }
 
+// TmpPath provides the path of the temporary file that Save writes, for the
+// index file with the given path. A file there is left over from a Save
+// that did not finish, and can be removed.
+func TmpPath(filepath string) string {
+	return filepath + tmpSuffix
+}
+
 // PopulateFromDisk reads the bytes from the nominated file which was created
 // using the SaveIndex sister method, and deserializes them popualate this
 // Index object.
@@ -29,9 +51,51 @@ func (index *Index) PopulateFromDisk(filepath string) error {
 		return fmt.Errorf("os.Open(): %v", err)
 	}
 	defer file.Close()
-	err = index.Decode(file)
+	err = index.Decode(bufio.NewReader(file))
 	if err != nil {
 		return fmt.Errorf("Decode(): %v", err)
 	}
 	return nil
 }
+
+// writeAndSync writes the encoded index to a new file with the given path,
+// and flushes it to disk.
+func writeAndSync(filepath string, index *Index) error {
+	file, err := os.Create(filepath)
+	if err != nil {
+		return fmt.Errorf("os.Create(): %v", err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	err = index.Encode(writer)
+	if err != nil {
+		return fmt.Errorf("Encode(): %v", err)
+	}
+	err = writer.Flush()
+	if err != nil {
+		return fmt.Errorf("writer.Flush(): %v", err)
+	}
+	err = file.Sync()
+	if err != nil {
+		return fmt.Errorf("file.Sync(): %v", err)
+	}
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("file.Close(): %v", err)
+	}
+	return nil
+}
+
+// syncDir flushes the given directory's entries to disk.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("os.Open(): %v", err)
+	}
+	defer file.Close()
+	err = file.Sync()
+	if err != nil {
+		return fmt.Errorf("file.Sync(): %v", err)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -38,3 +39,25 @@ func TestSaveAndRetrieve(t *testing.T) {
 	}
 	assert.Equal(t, 2, len(index.MessageFileLists["topicA"].Names))
 }
+
+// Make sure that saving replaces the file as a whole, without leaving the
+// temporary file behind.
+func TestSaveReplacesWholeFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index_")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	filepath := path.Join(dir, "index")
+
+	index, _ := MakeReferenceIndex()
+	err = index.Save(filepath)
+	assert.Nil(t, err)
+	err = NewIndex().Save(filepath)
+	assert.Nil(t, err)
+
+	newIndex := NewIndex()
+	err = newIndex.PopulateFromDisk(filepath)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(newIndex.MessageFileLists))
+	_, err = os.Stat(TmpPath(filepath))
+	assert.True(t, os.IsNotExist(err))
+}
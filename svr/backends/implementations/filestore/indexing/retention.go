@@ -0,0 +1,22 @@
+package indexing
+
+import (
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+)
+
+// SetRetentionPolicy records the retention policy for a topic.
+func (index *Index) SetRetentionPolicy(
+	topic string, policy contract.RetentionPolicy) {
+	// Indexes persisted before retention policies existed, deserialize
+	// without this map.
+	if index.RetentionPolicies == nil {
+		index.RetentionPolicies = map[string]contract.RetentionPolicy{}
+	}
+	index.RetentionPolicies[topic] = policy
+}
+
+// RetentionPolicy provides the retention policy recorded for a topic. It
+// copes gracefully with there not being one, by returning the zero value.
+func (index Index) RetentionPolicy(topic string) contract.RetentionPolicy {
+	return index.RetentionPolicies[topic]
+}
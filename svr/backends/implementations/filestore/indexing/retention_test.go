@@ -0,0 +1,29 @@
+package indexing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+)
+
+func TestSetRetentionPolicy(t *testing.T) {
+	index, _ := MakeReferenceIndex()
+	policy := contract.RetentionPolicy{MaxAge: time.Hour, MaxMessages: 3}
+	index.SetRetentionPolicy("topicA", policy)
+	assert.Equal(t, policy, index.RetentionPolicy("topicA"))
+
+	// When none set.
+	assert.Equal(t, contract.RetentionPolicy{}, index.RetentionPolicy("topicB"))
+}
+
+func TestSetRetentionPolicyWhenMapAbsent(t *testing.T) {
+	// Indexes saved before retention policies existed have no map for them.
+	index := &Index{}
+	assert.Equal(t, contract.RetentionPolicy{}, index.RetentionPolicy("topicA"))
+	policy := contract.RetentionPolicy{Infinite: true}
+	index.SetRetentionPolicy("topicA", policy)
+	assert.Equal(t, policy, index.RetentionPolicy("topicA"))
+}
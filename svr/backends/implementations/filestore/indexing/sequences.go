@@ -0,0 +1,30 @@
+package indexing
+
+import (
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+)
+
+// RecordSequence remembers a producer's request, stored in a topic. (See
+// contract.ProducerSequences).
+func (index *Index) RecordSequence(topic string, producerID string,
+	batch contract.SequencedBatch) {
+	// Indexes persisted before producer sequences existed, deserialize
+	// without this map.
+	if index.ProducerSequences == nil {
+		index.ProducerSequences = map[string]contract.ProducerSequences{}
+	}
+	sequences, ok := index.ProducerSequences[topic]
+	if ok == false {
+		sequences = contract.ProducerSequences{}
+		index.ProducerSequences[topic] = sequences
+	}
+	sequences.Record(producerID, batch)
+}
+
+// FindSequence looks for a producer's request, stored in a topic, with the
+// given sequence number. It copes gracefully with there being no record of
+// it, by returning false for *ok*.
+func (index Index) FindSequence(topic string, producerID string,
+	sequence uint64) (batch contract.SequencedBatch, ok bool) {
+	return index.ProducerSequences[topic].Find(producerID, sequence)
+}
@@ -0,0 +1,39 @@
+package indexing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+)
+
+func TestRecordSequence(t *testing.T) {
+	index, _ := MakeReferenceIndex()
+	batch := contract.SequencedBatch{
+		Sequence: 7, FirstMsgNumber: 3, LastMsgNumber: 4}
+	index.RecordSequence("topicA", "p1", batch)
+
+	found, ok := index.FindSequence("topicA", "p1", 7)
+	assert.True(t, ok)
+	assert.Equal(t, batch, found)
+
+	// Topics are independent.
+	_, ok = index.FindSequence("topicB", "p1", 7)
+	assert.False(t, ok)
+
+	// Forgetting the topic should forget its producers' requests.
+	index.ForgetTopic("topicA")
+	_, ok = index.FindSequence("topicA", "p1", 7)
+	assert.False(t, ok)
+}
+
+func TestRecordSequenceWhenMapAbsent(t *testing.T) {
+	// Indexes saved before producer sequences existed have no map for them.
+	index := &Index{}
+	_, ok := index.FindSequence("topicA", "p1", 7)
+	assert.False(t, ok)
+	index.RecordSequence("topicA", "p1", contract.SequencedBatch{Sequence: 7})
+	_, ok = index.FindSequence("topicA", "p1", 7)
+	assert.True(t, ok)
+}
@@ -0,0 +1,291 @@
+package indexing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Update records the changes that one operation made to a log's index, so
+// that they can be persisted by appending them to the log's update file,
+// rather than by saving the whole index. The cost of an update is
+// proportional to what changed: the names of the log's message files, the
+// metadata of those that are new or changed, and the few values held for the
+// log as a whole. When messages have only been appended to a file, just the
+// seek offsets of the new messages are recorded.
+type Update struct {
+	// Numbers run on from one update to the next, so that those an index
+	// already includes can be recognised. (See Index.UpdateNumbers).
+	Number int64
+	Log    string
+	// The names of the log's message files, in order.
+	Names []string
+	// The metadata of files that are new, or have changed other than by
+	// having messages appended to them.
+	Replaced map[string]*FileMeta
+	// The metadata of files that have had messages appended to them; holding
+	// the seek offsets of only the new messages.
+	Appended map[string]*FileMeta
+	// Everything else the log's index holds. (See LogIndex).
+	Rest *Index
+}
+
+// Snapshot records enough about a log's message files to tell how they have
+// since changed. (See Changes).
+type Snapshot map[string]fileSignature
+
+type fileSignature struct {
+	Oldest      int32
+	Newest      int32
+	Size        int64
+	NumMessages int
+	Format      int8
+}
+
+// Snapshot takes a Snapshot of the given log's message files.
+func (index *Index) Snapshot(log string) Snapshot {
+	snapshot := Snapshot{}
+	msgFileList, ok := index.MessageFileLists[log]
+	if ok == false {
+		return snapshot
+	}
+	for name, fileMeta := range msgFileList.Meta {
+		snapshot[name] = signatureOf(fileMeta)
+	}
+	return snapshot
+}
+
+func signatureOf(fileMeta *FileMeta) fileSignature {
+	return fileSignature{
+		Oldest:      fileMeta.Oldest.MsgNum,
+		Newest:      fileMeta.Newest.MsgNum,
+		Size:        fileMeta.Size,
+		NumMessages: len(fileMeta.SeekOffsetForMessageNumber),
+		Format:      fileMeta.Format,
+	}
+}
+
+// Changes provides an Update that records how the given log's part of the
+// index has changed since the Snapshot was taken. Its Number is left for the
+// caller to set.
+func (index *Index) Changes(log string, since Snapshot) *Update {
+	update := &Update{
+		Log:      log,
+		Names:    []string{},
+		Replaced: map[string]*FileMeta{},
+		Appended: map[string]*FileMeta{},
+		Rest:     index.LogIndex(log),
+	}
+	delete(update.Rest.MessageFileLists, log)
+	msgFileList, ok := index.MessageFileLists[log]
+	if ok == false {
+		return update
+	}
+	update.Names = append(update.Names, msgFileList.Names...)
+	for _, name := range msgFileList.Names {
+		fileMeta := msgFileList.Meta[name]
+		before, ok := since[name]
+		switch {
+		case ok && signatureOf(fileMeta) == before:
+		case ok:
+			if appended, ok := appendedSince(fileMeta, before); ok {
+				update.Appended[name] = appended
+				continue
+			}
+			update.Replaced[name] = fileMeta
+		default:
+			update.Replaced[name] = fileMeta
+		}
+	}
+	return update
+}
+
+// appendedSince provides a FileMeta like the given one, but holding the seek
+// offsets of only those messages appended since the file had the given
+// signature. It returns false for *ok* when the file has changed in some
+// other way.
+func appendedSince(fileMeta *FileMeta, before fileSignature) (
+	appended *FileMeta, ok bool) {
+	if before.NumMessages == 0 || fileMeta.Oldest.MsgNum != before.Oldest ||
+		fileMeta.Format != before.Format || fileMeta.Size < before.Size ||
+		fileMeta.Newest.MsgNum < before.Newest {
+		return nil, false
+	}
+	appended = &FileMeta{
+		Oldest:                     fileMeta.Oldest,
+		Newest:                     fileMeta.Newest,
+		Size:                       fileMeta.Size,
+		Format:                     fileMeta.Format,
+		SeekOffsetForMessageNumber: map[int32]int64{},
+	}
+	// Appended messages are numbered on from the newest before.
+	for msgNum := before.Newest + 1; msgNum <= fileMeta.Newest.MsgNum; msgNum++ {
+		offset, ok := fileMeta.SeekOffsetForMessageNumber[msgNum]
+		if ok == false {
+			continue
+		}
+		if offset < before.Size {
+			return nil, false
+		}
+		appended.SeekOffsetForMessageNumber[msgNum] = offset
+	}
+	if before.NumMessages+len(appended.SeekOffsetForMessageNumber) !=
+		len(fileMeta.SeekOffsetForMessageNumber) {
+		return nil, false
+	}
+	return appended, true
+}
+
+// ApplyUpdate makes the changes the update records, unless the index already
+// includes them.
+func (index *Index) ApplyUpdate(update *Update) {
+	index.ensureMaps()
+	log := update.Log
+	if update.Number <= index.UpdateNumbers[log] {
+		return
+	}
+	msgFileList := index.GetMessageFileListFor(log)
+	meta := map[string]*FileMeta{}
+	for _, name := range update.Names {
+		fileMeta, ok := update.Replaced[name]
+		if ok == false {
+			fileMeta, ok = msgFileList.Meta[name]
+		}
+		if ok == false {
+			// Not possible for an update file written by Changes.
+			fileMeta = NewFileMeta()
+		}
+		// Gob decodes an empty map as nil.
+		if fileMeta.SeekOffsetForMessageNumber == nil {
+			fileMeta.SeekOffsetForMessageNumber = map[int32]int64{}
+		}
+		if appended, ok := update.Appended[name]; ok {
+			fileMeta.Oldest = appended.Oldest
+			fileMeta.Newest = appended.Newest
+			fileMeta.Size = appended.Size
+			fileMeta.Format = appended.Format
+			for msgNum, offset := range appended.SeekOffsetForMessageNumber {
+				fileMeta.SeekOffsetForMessageNumber[msgNum] = offset
+			}
+		}
+		meta[name] = fileMeta
+	}
+	msgFileList.Names = append([]string{}, update.Names...)
+	msgFileList.Meta = meta
+	delete(index.NextMessageNumbers, log)
+	delete(index.RetentionPolicies, log)
+	delete(index.PartitionCounts, log)
+	delete(index.ProducerSequences, log)
+	if update.Rest != nil {
+		index.Absorb(update.Rest)
+	}
+	index.UpdateNumbers[log] = update.Number
+}
+
+// updateHeaderSize is the size of the header that precedes each update in an
+// update file: a CRC32C checksum, and then the length, of the gob-encoded
+// update that follows.
+const updateHeaderSize = 8
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// AppendUpdate appends the update to the update file with the given path,
+// creating it if need be, and flushes it to disk. It provides the number of
+// bytes appended. When writing fails part way through, the file is put back
+// how it was, so that later updates are not appended after a damaged one.
+func AppendUpdate(filepath string, update *Update) (int64, error) {
+	var encoded bytes.Buffer
+	err := gob.NewEncoder(&encoded).Encode(update)
+	if err != nil {
+		return 0, fmt.Errorf("encoder.Encode(): %v", err)
+	}
+	record := make([]byte, updateHeaderSize, updateHeaderSize+encoded.Len())
+	binary.BigEndian.PutUint32(record[0:4],
+		crc32.Checksum(encoded.Bytes(), castagnoli))
+	binary.BigEndian.PutUint32(record[4:8], uint32(encoded.Len()))
+	record = append(record, encoded.Bytes()...)
+
+	file, err := os.OpenFile(filepath, os.O_WRONLY|os.O_CREATE|os.O_APPEND,
+		0644)
+	if err != nil {
+		return 0, fmt.Errorf("os.OpenFile(): %v", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("file.Stat(): %v", err)
+	}
+	_, err = file.Write(record)
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Truncate(info.Size())
+		return 0, fmt.Errorf("file.Write(): %v", err)
+	}
+	err = file.Close()
+	if err != nil {
+		return 0, fmt.Errorf("file.Close(): %v", err)
+	}
+	return int64(len(record)), nil
+}
+
+// ApplyUpdatesFromDisk applies to the index the updates in the update file
+// with the given path, in order, if there is one. It stops at the first
+// update that is incomplete or fails its checksum, which can only be the last
+// one, left by a server that stopped while appending it. That update's
+// operation did not succeed.
+func (index *Index) ApplyUpdatesFromDisk(filepath string) error {
+	file, err := os.Open(filepath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("os.Open(): %v", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("file.Stat(): %v", err)
+	}
+	remaining := info.Size()
+	reader := bufio.NewReader(file)
+	header := make([]byte, updateHeaderSize)
+	for {
+		_, err = io.ReadFull(reader, header)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("io.ReadFull(): %v", err)
+		}
+		length := int64(binary.BigEndian.Uint32(header[4:8]))
+		remaining -= updateHeaderSize + length
+		if remaining < 0 {
+			return nil
+		}
+		encoded := make([]byte, length)
+		_, err = io.ReadFull(reader, encoded)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("io.ReadFull(): %v", err)
+		}
+		if crc32.Checksum(encoded, castagnoli) !=
+			binary.BigEndian.Uint32(header[0:4]) {
+			return nil
+		}
+		var update Update
+		err = gob.NewDecoder(bytes.NewReader(encoded)).Decode(&update)
+		if err != nil {
+			return fmt.Errorf("decoder.Decode(): %v", err)
+		}
+		index.ApplyUpdate(&update)
+	}
+}
@@ -0,0 +1,151 @@
+package indexing
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangesAndApplyUpdate(t *testing.T) {
+	index, _ := MakeReferenceIndex()
+	var encoded bytes.Buffer
+	err := index.Encode(&encoded)
+	assert.Nil(t, err)
+	persisted := NewIndex()
+	err = persisted.Decode(&encoded)
+	assert.Nil(t, err)
+	snapshot := index.Snapshot("topicA")
+
+	// Nothing has changed.
+	update := index.Changes("topicA", snapshot)
+	assert.Equal(t, []string{"file1", "file2"}, update.Names)
+	assert.Equal(t, 0, len(update.Replaced))
+	assert.Equal(t, 0, len(update.Appended))
+
+	// Append to one file, start another, and set the retention policy.
+	msgFileList := index.GetMessageFileListFor("topicA")
+	msgNum := index.GetAndIncrementMessageNumberFor("topicA")
+	msgFileList.Meta["file2"].RegisterNewMessage(msgNum, 100)
+	msgFileList.RegisterNewFile("file3")
+	msgNum = index.GetAndIncrementMessageNumberFor("topicA")
+	msgFileList.Meta["file3"].RegisterNewMessage(msgNum, 100)
+	index.SetRetentionPolicy("topicA", contract.RetentionPolicy{MaxMessages: 5})
+	update = index.Changes("topicA", snapshot)
+	update.Number = 1
+	assert.Equal(t, []string{"file1", "file2", "file3"}, update.Names)
+	assert.Equal(t, 1, len(update.Replaced))
+	assert.NotNil(t, update.Replaced["file3"])
+	assert.Equal(t, 1, len(update.Appended))
+	assert.Equal(t, 1,
+		len(update.Appended["file2"].SeekOffsetForMessageNumber))
+
+	persisted.ApplyUpdate(update)
+	assertSameMessageFiles(t, index.MessageFileLists["topicA"],
+		persisted.MessageFileLists["topicA"])
+	assert.Equal(t, index.NextMessageNumbers["topicA"],
+		persisted.NextMessageNumbers["topicA"])
+	assert.Equal(t, 5, persisted.RetentionPolicy("topicA").MaxMessages)
+	assert.Equal(t, int64(1), persisted.UpdateNumbers["topicA"])
+	// Other topics are untouched.
+	assertSameMessageFiles(t, index.MessageFileLists["topicB"],
+		persisted.MessageFileLists["topicB"])
+
+	// Forget a file, and truncate another.
+	snapshot = index.Snapshot("topicA")
+	msgFileList.ForgetFiles([]string{"file1"})
+	msgFileList.Meta["file2"].ForgetMessagesBeyond(1024)
+	update = index.Changes("topicA", snapshot)
+	update.Number = 2
+	assert.Equal(t, []string{"file2", "file3"}, update.Names)
+	assert.NotNil(t, update.Replaced["file2"])
+	assert.Equal(t, 0, len(update.Appended))
+	persisted.ApplyUpdate(update)
+	assertSameMessageFiles(t, index.MessageFileLists["topicA"],
+		persisted.MessageFileLists["topicA"])
+
+	// An update the index already includes is ignored.
+	update = index.Changes("topicA", index.Snapshot("topicA"))
+	update.Number = 2
+	update.Names = []string{}
+	persisted.ApplyUpdate(update)
+	assertSameMessageFiles(t, index.MessageFileLists["topicA"],
+		persisted.MessageFileLists["topicA"])
+}
+
+// Make sure that updates appended to a file are applied in order, and that
+// an update left incomplete at the end is ignored.
+func TestAppendAndApplyUpdates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index_")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	filepath := path.Join(dir, "index.updates")
+
+	// There being no update file is not a problem.
+	index := NewIndex()
+	err = index.ApplyUpdatesFromDisk(filepath)
+	assert.Nil(t, err)
+
+	current := NewIndex()
+	snapshot := current.Snapshot("topicA")
+	var sizes []int64
+	for number := int64(1); number <= 3; number++ {
+		msgFileList := current.GetMessageFileListFor("topicA")
+		if len(msgFileList.Names) == 0 {
+			msgFileList.RegisterNewFile("file1")
+		}
+		msgNum := current.GetAndIncrementMessageNumberFor("topicA")
+		msgFileList.Meta["file1"].RegisterNewMessage(msgNum, 100)
+		update := current.Changes("topicA", snapshot)
+		update.Number = number
+		size, err := AppendUpdate(filepath, update)
+		assert.Nil(t, err)
+		sizes = append(sizes, size)
+		snapshot = current.Snapshot("topicA")
+	}
+
+	err = index.ApplyUpdatesFromDisk(filepath)
+	assert.Nil(t, err)
+	assertSameMessageFiles(t, current.MessageFileLists["topicA"],
+		index.MessageFileLists["topicA"])
+	assert.Equal(t, int32(4), index.NextMessageNumbers["topicA"])
+
+	// Cut the last update short.
+	err = os.Truncate(filepath, sizes[0]+sizes[1]+sizes[2]/2)
+	assert.Nil(t, err)
+	index = NewIndex()
+	err = index.ApplyUpdatesFromDisk(filepath)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), index.NextMessageNumbers["topicA"])
+	fileMeta := index.MessageFileLists["topicA"].Meta["file1"]
+	assert.Equal(t, 2, len(fileMeta.SeekOffsetForMessageNumber))
+}
+
+// assertSameMessageFiles asserts that two message file lists hold the same,
+// allowing for times that have been through serialization, and so lost their
+// monotonic clock readings.
+func assertSameMessageFiles(t *testing.T, expected *MessageFileList,
+	actual *MessageFileList) {
+	assert.Equal(t, expected.Names, actual.Names)
+	assert.Equal(t, len(expected.Meta), len(actual.Meta))
+	for name, expectedMeta := range expected.Meta {
+		actualMeta := actual.Meta[name]
+		if assert.NotNil(t, actualMeta) == false {
+			continue
+		}
+		assert.Equal(t, expectedMeta.Oldest.MsgNum, actualMeta.Oldest.MsgNum)
+		assert.True(t, expectedMeta.Oldest.Created.Equal(
+			actualMeta.Oldest.Created))
+		assert.Equal(t, expectedMeta.Newest.MsgNum, actualMeta.Newest.MsgNum)
+		assert.True(t, expectedMeta.Newest.Created.Equal(
+			actualMeta.Newest.Created))
+		assert.Equal(t, expectedMeta.Size, actualMeta.Size)
+		assert.Equal(t, expectedMeta.Format, actualMeta.Format)
+		assert.Equal(t, expectedMeta.SeekOffsetForMessageNumber,
+			actualMeta.SeekOffsetForMessageNumber)
+	}
+}
@@ -54,6 +54,21 @@ func AppendToFile(filepath string, someData []byte) error {
 	return nil
 }
 
+// SyncFile flushes the contents of the specified file to disk; or when it is
+// a directory, its entries.
+func SyncFile(filepath string) error {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return fmt.Errorf("os.Open(): %v", err)
+	}
+	defer file.Close()
+	err = file.Sync()
+	if err != nil {
+		return fmt.Errorf("file.Sync(): %v", err)
+	}
+	return nil
+}
+
 // Exists evaluates whether there is an entity in the file system at the
 // given path. Note it does not guarantee that this is a file.
 func Exists(path string) bool {
@@ -71,9 +86,9 @@ func CountEntitiesInDir(dir string) (int, error) {
 }
 
 // TmpRootDir creates a temporary directory with a name that begins
-// with "filestore" - in the context of a testing.T object passed in.
-// It handles errors by calling assert.Fail(t,...).
-func TmpRootDir(t *testing.T) string {
+// with "filestore" - in the context of a testing.T (or testing.B) object
+// passed in. It handles errors by calling assert.Fail(t,...).
+func TmpRootDir(t testing.TB) string {
 
 	// Prepare a root directory that we can delete after the test.
 	rootDir, err := ioutil.TempDir("", "filestore")
@@ -0,0 +1,83 @@
+package filestore
+
+import (
+	"sort"
+	"sync"
+)
+
+// Each topic's (or partition's) log has a lock of its own, so that operations
+// on different topics can proceed in parallel. Operations that only read a
+// log share its lock; those that change it hold it exclusively. Operations on
+// several logs take their locks in order of name, so that they cannot
+// deadlock.
+//
+// Every operation on logs also shares the store's own lock, which operations
+// on the store as a whole hold exclusively. The locks belong to the FileStore
+// that is using them, (see storeState), so a root directory must not be used
+// by more than one FileStore at once.
+
+// storeLocks are a FileStore's locks.
+type storeLocks struct {
+	storeMutex sync.RWMutex
+
+	// offsetsMutex guards the store-wide index, which holds the offsets
+	// committed by consumer groups.
+	offsetsMutex sync.Mutex
+
+	// journalMutex serialises changes to several logs' indexes at once,
+	// which share the journal file. (See indexing.ChangeSet).
+	journalMutex sync.Mutex
+
+	logMutexesMutex sync.Mutex               // Guards logMutexes.
+	logMutexes      map[string]*sync.RWMutex // Keyed on log.
+}
+
+// logMutex provides the lock for the given log.
+func (s FileStore) logMutex(log string) *sync.RWMutex {
+	s.state.logMutexesMutex.Lock()
+	defer s.state.logMutexesMutex.Unlock()
+	if s.state.logMutexes == nil {
+		s.state.logMutexes = map[string]*sync.RWMutex{}
+	}
+	logMutex, ok := s.state.logMutexes[log]
+	if ok == false {
+		logMutex = &sync.RWMutex{}
+		s.state.logMutexes[log] = logMutex
+	}
+	return logMutex
+}
+
+// lockLogs takes the locks for the given logs, exclusively or shared, and
+// provides the function that releases them. Duplicates are ignored.
+func (s FileStore) lockLogs(exclusive bool, logs ...string) (unlock func()) {
+	sorted := []string{}
+	seen := map[string]bool{}
+	for _, log := range logs {
+		if seen[log] == false {
+			sorted = append(sorted, log)
+			seen[log] = true
+		}
+	}
+	sort.Strings(sorted)
+	s.state.storeMutex.RLock()
+	logMutexes := []*sync.RWMutex{}
+	for _, log := range sorted {
+		logMutex := s.logMutex(log)
+		if exclusive {
+			logMutex.Lock()
+		} else {
+			logMutex.RLock()
+		}
+		logMutexes = append(logMutexes, logMutex)
+	}
+	return func() {
+		for i := len(logMutexes) - 1; i >= 0; i-- {
+			if exclusive {
+				logMutexes[i].Unlock()
+			} else {
+				logMutexes[i].RUnlock()
+			}
+		}
+		s.state.storeMutex.RUnlock()
+	}
+}
@@ -0,0 +1,307 @@
+package filestore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/actions"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/ioutils"
+)
+
+// Each topic's (or partition's) log has an index of its own, in its
+// directory, so that the cost of loading and saving an index is proportional
+// to one log rather than to the whole store. The store-wide index, in the root
+// directory, holds only the offsets committed by consumer groups. (See
+// indexing.Index.LogIndex). Operations load the indexes of the logs they
+// concern into one index, and save each log's part of it back.
+
+// logExists reports whether the given log exists; which it does once its
+// index has been saved.
+func (s FileStore) logExists(log string) bool {
+	return ioutils.Exists(filenamer.LogIndexFile(log, s.RootDir))
+}
+
+// logs provides the names of the logs that exist, in order.
+func (s FileStore) logs() ([]string, error) {
+	entries, err := ioutil.ReadDir(s.RootDir)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadDir(): %v", err)
+	}
+	logs := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() && s.logExists(entry.Name()) {
+			logs = append(logs, entry.Name())
+		}
+	}
+	return logs, nil
+}
+
+// loadLogIndexes provides an index holding what the resident indexes of the
+// given logs hold, (see resident.go); or virgin for those that do not exist.
+// It shares their message file lists, and their producers' recent requests.
+func (s FileStore) loadLogIndexes(logs ...string) (*indexing.Index, error) {
+	index := indexing.NewIndex()
+	for _, log := range logs {
+		resident, err := s.residentLog(log)
+		if err != nil {
+			return nil, fmt.Errorf("residentLog(): %v", err)
+		}
+		if resident != nil {
+			index.Absorb(resident.index)
+		}
+	}
+	return index, nil
+}
+
+// saveLogIndexes persists the parts of the given index that belong to each
+// of the given logs, all at once; which are then resident. A single log's
+// changes are appended to its update file, but several logs' indexes are
+// saved whole, (see checkpointLogs).
+func (s FileStore) saveLogIndexes(index *indexing.Index, logs ...string) error {
+	unique := map[string]bool{}
+	for _, log := range logs {
+		unique[log] = true
+	}
+	if len(unique) == 1 {
+		err := s.persist(logs[0], index)
+		if err != nil {
+			return fmt.Errorf("persist(): %v", err)
+		}
+		return nil
+	}
+	err := s.checkpointLogs(index, logs...)
+	if err != nil {
+		return fmt.Errorf("checkpointLogs(): %v", err)
+	}
+	return nil
+}
+
+// checkpointLogs saves the parts of the given index that belong to each of
+// the given logs, to their index files, all at once; which are then resident.
+func (s FileStore) checkpointLogs(index *indexing.Index, logs ...string) error {
+	changes := indexing.ChangeSet{Saves: map[string]*indexing.Index{}}
+	for _, log := range logs {
+		changes.Saves[filenamer.LogIndexFile(log, s.RootDir)] =
+			index.LogIndex(log)
+	}
+	err := s.applyChanges(changes)
+	if err != nil {
+		s.forgetLogs(logs...)
+		return fmt.Errorf("applyChanges(): %v", err)
+	}
+	for _, log := range logs {
+		err = s.checkpointed(log,
+			changes.Saves[filenamer.LogIndexFile(log, s.RootDir)])
+		if err != nil {
+			return fmt.Errorf("checkpointed(): %v", err)
+		}
+	}
+	return nil
+}
+
+// applyChanges applies the given changes to the indexes.
+func (s FileStore) applyChanges(changes indexing.ChangeSet) error {
+	s.state.journalMutex.Lock()
+	defer s.state.journalMutex.Unlock()
+	err := changes.Apply(filenamer.JournalFile(s.RootDir))
+	if err != nil {
+		return fmt.Errorf("changes.Apply(): %v", err)
+	}
+	return nil
+}
+
+// createLogs creates the directory of each of the given logs that does not
+// exist yet, and saves an index for it that knows about it; and provides the
+// logs it created. It registers every one of the logs in the given index.
+// Saving the index before anything is written to the log, means that the log
+// is never without one. Should what is then written to them fail, the
+// created logs must be removed, (see removeLogs).
+func (s FileStore) createLogs(index *indexing.Index, logs ...string) (
+	created []string, err error) {
+	for _, log := range logs {
+		index.GetMessageFileListFor(log)
+		if s.logExists(log) {
+			continue
+		}
+		err = ioutils.CreateDirIfDoesntExist(
+			filenamer.DirectoryForTopic(log, s.RootDir))
+		if err != nil {
+			return created, fmt.Errorf("ioutils.CreateDirIfDoesntExist(): %v",
+				err)
+		}
+		err = s.checkpoint(log, index)
+		if err != nil {
+			return created, fmt.Errorf("checkpoint(): %v", err)
+		}
+		created = append(created, log)
+	}
+	return created, nil
+}
+
+// removeLogs removes the given logs' directories, along with their indexes,
+// all at once.
+func (s FileStore) removeLogs(logs ...string) error {
+	s.forgetLogs(logs...)
+	changes := indexing.ChangeSet{}
+	for _, log := range logs {
+		changes.Removals = append(changes.Removals,
+			filenamer.DirectoryForTopic(log, s.RootDir))
+	}
+	err := s.applyChanges(changes)
+	if err != nil {
+		return fmt.Errorf("applyChanges(): %v", err)
+	}
+	return nil
+}
+
+// retentionPolicy provides the retention policy that applies to the given
+// log; which is held in the index of its topic's first partition. It takes
+// that log's lock itself, so must not be called holding the lock of any log.
+func (s FileStore) retentionPolicy(log string) (
+	contract.RetentionPolicy, error) {
+	parentTopic, _ := contract.ParsePartitionLog(log)
+	unlock := s.lockLogs(false, parentTopic)
+	defer unlock()
+	index, err := s.loadLogIndexes(parentTopic)
+	if err != nil {
+		return contract.RetentionPolicy{}, fmt.Errorf("loadLogIndexes(): %v", err)
+	}
+	return index.RetentionPolicy(parentTopic), nil
+}
+
+// recover brings the store to a consistent state when it is opened. It
+// finishes the changes to several indexes that were being made when the
+// server stopped, gives each log of a store saved before logs had indexes of
+// their own its own index, rebuilds those that are missing, and then
+// reconciles each log with its index, (see actions.ReconcileAction). The
+// indexes are loaded afresh from disk, and are then resident.
+func (s FileStore) recover() error {
+	s.state.storeMutex.Lock()
+	defer s.state.storeMutex.Unlock()
+
+	s.forgetResidentIndexes()
+	err := indexing.FinishChanges(filenamer.JournalFile(s.RootDir))
+	if err != nil {
+		return fmt.Errorf("indexing.FinishChanges(): %v", err)
+	}
+	err = s.splitStoreWideIndex()
+	if err != nil {
+		return fmt.Errorf("splitStoreWideIndex(): %v", err)
+	}
+	err = s.rebuildMissingIndexes()
+	if err != nil {
+		return fmt.Errorf("rebuildMissingIndexes(): %v", err)
+	}
+	logs, err := s.logs()
+	if err != nil {
+		return fmt.Errorf("logs(): %v", err)
+	}
+	for _, log := range logs {
+		_, err = s.reconcile(log)
+		if err != nil {
+			return fmt.Errorf("reconcile(): %v", err)
+		}
+	}
+	return nil
+}
+
+// splitStoreWideIndex moves what the store-wide index holds about each log,
+// to the log's own index, when the store was saved before logs had indexes
+// of their own. The store-wide index is saved last, so should the server stop
+// part way through, it is simply done again.
+func (s FileStore) splitStoreWideIndex() error {
+	index, err := s.loadStoreWideIndex()
+	if err != nil {
+		return fmt.Errorf("loadStoreWideIndex(): %v", err)
+	}
+	if len(index.MessageFileLists) == 0 {
+		return nil
+	}
+	for log := range index.MessageFileLists {
+		err = ioutils.CreateDirIfDoesntExist(
+			filenamer.DirectoryForTopic(log, s.RootDir))
+		if err != nil {
+			return fmt.Errorf("ioutils.CreateDirIfDoesntExist(): %v", err)
+		}
+		err = index.LogIndex(log).Save(filenamer.LogIndexFile(log, s.RootDir))
+		if err != nil {
+			return fmt.Errorf("SaveIndex(): %v", err)
+		}
+	}
+	err = s.saveStoreWideIndex(index.StoreWideIndex())
+	if err != nil {
+		return fmt.Errorf("saveStoreWideIndex(): %v", err)
+	}
+	return nil
+}
+
+// rebuildMissingIndexes rebuilds the index of each directory in the root
+// directory that has message files, but no index. (See
+// actions.RebuildIndexAction). Directories that have neither are left over
+// from creating a topic that did not finish, and are removed.
+func (s FileStore) rebuildMissingIndexes() error {
+	entries, err := ioutil.ReadDir(s.RootDir)
+	if err != nil {
+		return fmt.Errorf("ioutil.ReadDir(): %v", err)
+	}
+	missing := []string{}
+	for _, entry := range entries {
+		log := entry.Name()
+		if entry.IsDir() == false || s.logExists(log) {
+			continue
+		}
+		dir := filenamer.DirectoryForTopic(log, s.RootDir)
+		hasMessageFiles, err := hasMessageFiles(dir)
+		if err != nil {
+			return fmt.Errorf("hasMessageFiles(): %v", err)
+		}
+		if hasMessageFiles {
+			missing = append(missing, log)
+			continue
+		}
+		err = os.RemoveAll(dir)
+		if err != nil {
+			return fmt.Errorf("os.RemoveAll(): %v", err)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	action := actions.RebuildIndexAction{RootDir: s.RootDir, Logs: missing}
+	index, err := action.RebuildIndex()
+	if err != nil {
+		return fmt.Errorf("action.RebuildIndex(): %v", err)
+	}
+	for _, log := range missing {
+		// The rebuilt index includes the updates left in the log's update
+		// file, which must not then be applied to it.
+		index.UpdateNumbers[log], err = s.lastUpdateNumber(log)
+		if err != nil {
+			return fmt.Errorf("lastUpdateNumber(): %v", err)
+		}
+		err = s.checkpoint(log, index)
+		if err != nil {
+			return fmt.Errorf("checkpoint(): %v", err)
+		}
+	}
+	return nil
+}
+
+// hasMessageFiles reports whether the given directory holds any files other
+// than index files.
+func hasMessageFiles(dir string) (bool, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false, fmt.Errorf("ioutil.ReadDir(): %v", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() == false && filenamer.IsIndexFile(entry.Name()) == false {
+			return true, nil
+		}
+	}
+	return false, nil
+}
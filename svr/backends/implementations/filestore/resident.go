@@ -0,0 +1,262 @@
+package filestore
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/filenamer"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/indexing"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/filestore/ioutils"
+)
+
+// Each log's index is loaded from disk once, and then kept in memory, so that
+// operations that only read a log are served from memory alone. The changes
+// an operation makes to a log's index are persisted by appending them to the
+// log's update file, (see indexing.Update). Once that has grown bigger than
+// the log's index file, the index file is saved afresh - a checkpoint - and
+// the update file is removed. So the cost of persisting an operation is
+// proportional to what it changed, rather than to the whole index. The
+// changes a transaction makes to several logs are persisted by saving each
+// of their indexes whole, all at once, (see indexing.ChangeSet).
+//
+// A log's resident index is guarded by the log's lock, (see locks.go). It
+// shares its message file lists with the indexes that operations load, (see
+// loadLogIndexes), so an operation that fails part way through must forget
+// it, for it to be loaded afresh from disk. The store-wide index is kept in
+// memory too, but is small, and is saved whole when it changes.
+
+// minUpdatesSize is the size that a log's update file can grow to, however
+// small its index file, before a checkpoint is made.
+const minUpdatesSize = 64 * 1024
+
+// residentLog is a log's index, kept in memory.
+type residentLog struct {
+	index *indexing.Index
+	// Its message files, as last persisted.
+	snapshot indexing.Snapshot
+	// The sizes of its update file, and its index file.
+	updatesSize    int64
+	checkpointSize int64
+}
+
+// residentIndexes are a FileStore's resident indexes. (See storeState).
+type residentIndexes struct {
+	residentMutex  sync.Mutex              // Guards the fields below.
+	residentLogs   map[string]*residentLog // Keyed on log.
+	storeWideIndex *indexing.Index         // Nil until loaded.
+}
+
+// residentLog provides the given log's resident index; loading it from disk
+// when it is not yet resident. It provides nil when the log does not exist.
+func (s FileStore) residentLog(log string) (*residentLog, error) {
+	s.state.residentMutex.Lock()
+	defer s.state.residentMutex.Unlock()
+	if resident, ok := s.state.residentLogs[log]; ok {
+		return resident, nil
+	}
+	if s.logExists(log) == false {
+		return nil, nil
+	}
+	index, err := s.readLogIndex(log)
+	if err != nil {
+		return nil, fmt.Errorf("readLogIndex(): %v", err)
+	}
+	resident := &residentLog{index: index, snapshot: index.Snapshot(log)}
+	resident.checkpointSize, err = fileSize(
+		filenamer.LogIndexFile(log, s.RootDir))
+	if err != nil {
+		return nil, fmt.Errorf("fileSize(): %v", err)
+	}
+	resident.updatesSize, err = fileSize(
+		filenamer.LogUpdatesFile(log, s.RootDir))
+	if err != nil {
+		return nil, fmt.Errorf("fileSize(): %v", err)
+	}
+	s.state.setResidentLog(log, resident)
+	return resident, nil
+}
+
+// readLogIndex reads the given log's index from disk: its index file, and
+// then the updates in its update file.
+func (s FileStore) readLogIndex(log string) (*indexing.Index, error) {
+	index := indexing.NewIndex()
+	err := index.PopulateFromDisk(filenamer.LogIndexFile(log, s.RootDir))
+	if err != nil {
+		return nil, fmt.Errorf("index.PopulateFromDisk(): %v", err)
+	}
+	err = index.ApplyUpdatesFromDisk(filenamer.LogUpdatesFile(log, s.RootDir))
+	if err != nil {
+		return nil, fmt.Errorf("index.ApplyUpdatesFromDisk(): %v", err)
+	}
+	return index, nil
+}
+
+// lastUpdateNumber provides the number of the last update in the given log's
+// update file, or zero when there is none. It needs nothing else, so can be
+// used when the log's index file is missing or damaged.
+func (s FileStore) lastUpdateNumber(log string) (int64, error) {
+	index := indexing.NewIndex()
+	err := index.ApplyUpdatesFromDisk(filenamer.LogUpdatesFile(log, s.RootDir))
+	if err != nil {
+		return 0, fmt.Errorf("index.ApplyUpdatesFromDisk(): %v", err)
+	}
+	return index.UpdateNumbers[log], nil
+}
+
+// persist persists the changes to the given log's part of the given index,
+// and makes that part resident. It appends an update to the log's update
+// file, unless the log has no resident index to compare with, or a
+// checkpoint is due.
+func (s FileStore) persist(log string, index *indexing.Index) error {
+	resident, err := s.residentLog(log)
+	if err != nil {
+		return fmt.Errorf("residentLog(): %v", err)
+	}
+	if resident == nil {
+		return s.checkpoint(log, index)
+	}
+	number := index.UpdateNumbers[log] + 1
+	index.UpdateNumbers[log] = number
+	update := index.Changes(log, resident.snapshot)
+	update.Number = number
+	size, err := indexing.AppendUpdate(
+		filenamer.LogUpdatesFile(log, s.RootDir), update)
+	if err != nil {
+		s.forgetLogs(log)
+		return fmt.Errorf("indexing.AppendUpdate(): %v", err)
+	}
+	resident.index = index.LogIndex(log)
+	resident.snapshot = resident.index.Snapshot(log)
+	resident.updatesSize += size
+	if resident.updatesSize > resident.checkpointSize &&
+		resident.updatesSize > minUpdatesSize {
+		return s.checkpoint(log, resident.index)
+	}
+	return nil
+}
+
+// checkpoint saves the given log's part of the given index to the log's
+// index file, and makes it resident.
+func (s FileStore) checkpoint(log string, index *indexing.Index) error {
+	logIndex := index.LogIndex(log)
+	err := logIndex.Save(filenamer.LogIndexFile(log, s.RootDir))
+	if err != nil {
+		s.forgetLogs(log)
+		return fmt.Errorf("SaveIndex(): %v", err)
+	}
+	err = s.checkpointed(log, logIndex)
+	if err != nil {
+		return fmt.Errorf("checkpointed(): %v", err)
+	}
+	return nil
+}
+
+// checkpointed removes the given log's update file, now that its index file
+// has been saved, and makes the saved index resident. The updates need not be
+// removed for the index to be correct, because its update number shows that
+// it includes them.
+func (s FileStore) checkpointed(log string, logIndex *indexing.Index) error {
+	err := os.Remove(filenamer.LogUpdatesFile(log, s.RootDir))
+	if err != nil && os.IsNotExist(err) == false {
+		s.forgetLogs(log)
+		return fmt.Errorf("os.Remove(): %v", err)
+	}
+	checkpointSize, err := fileSize(filenamer.LogIndexFile(log, s.RootDir))
+	if err != nil {
+		s.forgetLogs(log)
+		return fmt.Errorf("fileSize(): %v", err)
+	}
+	s.state.residentMutex.Lock()
+	defer s.state.residentMutex.Unlock()
+	s.state.setResidentLog(log, &residentLog{
+		index:          logIndex,
+		snapshot:       logIndex.Snapshot(log),
+		checkpointSize: checkpointSize,
+	})
+	return nil
+}
+
+// setResidentLog makes the given index the given log's resident index. It
+// expects the residentMutex to be held.
+func (r *residentIndexes) setResidentLog(log string, resident *residentLog) {
+	if r.residentLogs == nil {
+		r.residentLogs = map[string]*residentLog{}
+	}
+	r.residentLogs[log] = resident
+}
+
+// forgetLogs forgets the given logs' resident indexes, so that they are
+// loaded afresh from disk when next needed.
+func (s FileStore) forgetLogs(logs ...string) {
+	s.state.residentMutex.Lock()
+	defer s.state.residentMutex.Unlock()
+	for _, log := range logs {
+		delete(s.state.residentLogs, log)
+	}
+}
+
+// forgetResidentIndexes forgets every resident index of the store, including
+// the store-wide index.
+func (s FileStore) forgetResidentIndexes() {
+	s.state.residentMutex.Lock()
+	defer s.state.residentMutex.Unlock()
+	s.state.residentLogs = nil
+	s.state.storeWideIndex = nil
+}
+
+// loadStoreWideIndex provides the resident store-wide index; loading it from
+// disk when it is not yet resident, or providing a virgin one when there
+// isn't one on disk. It is not responsible for mutex protection.
+func (s FileStore) loadStoreWideIndex() (*indexing.Index, error) {
+	s.state.residentMutex.Lock()
+	defer s.state.residentMutex.Unlock()
+	if s.state.storeWideIndex != nil {
+		return s.state.storeWideIndex, nil
+	}
+	index := indexing.NewIndex()
+	indexPath := filenamer.IndexFile(s.RootDir)
+	if ioutils.Exists(indexPath) {
+		err := index.PopulateFromDisk(indexPath)
+		if err != nil {
+			return nil, fmt.Errorf("index.PopulateFromDisk(): %v", err)
+		}
+	}
+	s.state.storeWideIndex = index
+	return index, nil
+}
+
+// saveStoreWideIndex saves the given store-wide index, which is then
+// resident. It is not responsible for mutex protection.
+func (s FileStore) saveStoreWideIndex(index *indexing.Index) error {
+	err := index.Save(filenamer.IndexFile(s.RootDir))
+	if err != nil {
+		s.forgetStoreWideIndex()
+		return fmt.Errorf("SaveIndex(): %v", err)
+	}
+	s.state.residentMutex.Lock()
+	defer s.state.residentMutex.Unlock()
+	s.state.storeWideIndex = index
+	return nil
+}
+
+// forgetStoreWideIndex forgets the resident store-wide index, so that it is
+// loaded afresh from disk when next needed.
+func (s FileStore) forgetStoreWideIndex() {
+	s.state.residentMutex.Lock()
+	defer s.state.residentMutex.Unlock()
+	s.state.storeWideIndex = nil
+}
+
+// fileSize provides the size of the file with the given path, or zero when
+// it does not exist.
+func fileSize(filepath string) (int64, error) {
+	info, err := os.Stat(filepath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("os.Stat(): %v", err)
+	}
+	return info.Size(), nil
+}
@@ -7,6 +7,8 @@ import (
 	"time"
 
 	minikafka "github.com/peterhoward42/minikafka"
+	"github.com/peterhoward42/minikafka/svr/backends/contract"
+	"github.com/peterhoward42/minikafka/svr/backends/notifier"
 )
 
 var mutex = &sync.Mutex{} // Guards concurrent access of the MemStore.
@@ -21,6 +23,17 @@ type MemStore struct {
 	// message-number.)
 	messagesPerTopic    map[string][]storedMessage // Keyed on topic.
 	newestMessageNumber map[string]int             // Keyed on topic.
+	// Consumer groups' committed read-from message numbers. Keyed on group
+	// and then topic.
+	committedOffsets map[string]map[string]int
+	// Retention policies set for topics. Keyed on topic.
+	retentionPolicies map[string]contract.RetentionPolicy
+	// Partition counts of topics that have more than one. Keyed on topic.
+	partitionCounts map[string]int
+	// Producers' recent requests. Keyed on topic.
+	producerSequences map[string]contract.ProducerSequences
+	// Wakes up those waiting for messages to arrive.
+	notifier *notifier.Notifier
 }
 
 // NewMemStore instantiates, initializes and returns a MemStore.
@@ -28,6 +41,11 @@ func NewMemStore() *MemStore {
 	return &MemStore{
 		messagesPerTopic:    map[string][]storedMessage{},
 		newestMessageNumber: map[string]int{},
+		committedOffsets:    map[string]map[string]int{},
+		retentionPolicies:   map[string]contract.RetentionPolicy{},
+		partitionCounts:     map[string]int{},
+		producerSequences:   map[string]contract.ProducerSequences{},
+		notifier:            notifier.NewNotifier(),
 	}
 }
 
@@ -45,6 +63,19 @@ func (m MemStore) DeleteContents() error {
 	for k := range m.newestMessageNumber {
 		delete(m.newestMessageNumber, k)
 	}
+	for k := range m.committedOffsets {
+		delete(m.committedOffsets, k)
+	}
+	for k := range m.retentionPolicies {
+		delete(m.retentionPolicies, k)
+	}
+	for k := range m.partitionCounts {
+		delete(m.partitionCounts, k)
+	}
+	for k := range m.producerSequences {
+		delete(m.producerSequences, k)
+	}
+	m.notifier.NotifyAll()
 	return nil
 }
 
@@ -56,23 +87,70 @@ func (m MemStore) Store(topic string, message minikafka.Message) (
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	// Bit of extra work if this is a new topic.
-	if _, ok := m.messagesPerTopic[topic]; ok == false {
-		m.messagesPerTopic[topic] = []storedMessage{}
-		m.newestMessageNumber[topic] = 0
-	}
+	messageNumber = m.store(topic, message)
+	m.notifier.Notify(topic)
 
-	// Drop into the general case.
+	return messageNumber, nil
+}
 
-	// Allocate the next available message number.
-	m.newestMessageNumber[topic]++
+// StoreBatch is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (m MemStore) StoreBatch(topic string, messages []minikafka.Message) (
+	firstMsgNumber int, lastMsgNumber int, err error) {
+	return m.storeBatch(topic, 0, "", 0, messages)
+}
 
-	// Make and add the new message.
-	msgToAdd := storedMessage{message, time.Now(),
-		m.newestMessageNumber[topic]}
-	m.messagesPerTopic[topic] = append(m.messagesPerTopic[topic], msgToAdd)
+// StoreSequenced is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (m MemStore) StoreSequenced(topic string, producerID string,
+	sequence uint64, messages []minikafka.Message) (
+	firstMsgNumber int, lastMsgNumber int, err error) {
+	return m.storeBatch(topic, 0, producerID, sequence, messages)
+}
+
+// StoreBatchIfNext is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (m MemStore) StoreBatchIfNext(topic string, expectedNext int,
+	producerID string, sequence uint64, messages []minikafka.Message) (
+	firstMsgNumber int, lastMsgNumber int, err error) {
+	return m.storeBatch(topic, expectedNext, producerID, sequence, messages)
+}
+
+// StoreTransaction is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (m MemStore) StoreTransaction(batches []contract.TopicBatch) (
+	ranges []contract.MsgNumberRange, err error) {
 
-	return m.newestMessageNumber[topic], nil
+	if len(batches) == 0 {
+		return nil, fmt.Errorf("The transaction has no batches")
+	}
+	for _, batch := range batches {
+		if len(batch.Messages) == 0 {
+			return nil, fmt.Errorf("The batch for %s has no messages",
+				batch.Topic)
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	// Holding the mutex throughout, makes all the batches visible at once.
+	ranges = []contract.MsgNumberRange{}
+	for _, batch := range batches {
+		var msgRange contract.MsgNumberRange
+		for i, message := range batch.Messages {
+			msgRange.Last = m.store(batch.Topic, message)
+			if i == 0 {
+				msgRange.First = msgRange.Last
+			}
+		}
+		ranges = append(ranges, msgRange)
+	}
+	for _, batch := range batches {
+		m.notifier.Notify(batch.Topic)
+	}
+
+	return ranges, nil
 }
 
 // RemoveOldMessages is defined by, and documented in the
@@ -81,34 +159,83 @@ func (m MemStore) RemoveOldMessages(maxAge time.Time) (err error) {
 	mutex.Lock()
 	defer mutex.Unlock()
 	for topic := range m.messagesPerTopic {
-		_, err := m.removeOldMessagesFromTopic(topic, maxAge)
+		// Partitions share their topic's retention policy.
+		parentTopic, _ := contract.ParsePartitionLog(topic)
+		policy := m.retentionPolicies[parentTopic]
+		if policy.Infinite {
+			continue
+		}
+		topicMaxAge := maxAge
+		if policy.MaxAge != 0 {
+			topicMaxAge = time.Now().Add(-policy.MaxAge)
+		}
+		_, err := m.removeOldMessagesFromTopic(topic, topicMaxAge)
 		if err != nil {
 			return err
 		}
+		m.removeExcessMessagesFromTopic(
+			topic, policy.MaxMessages, policy.MaxBytes)
+	}
+	return nil
+}
+
+// Compact is defined by, and documented in the
+// backends/contract/BackingStore interface. This implementation compacts
+// every message, including the newest.
+func (m MemStore) Compact(tombstonesBefore time.Time) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	for topic := range m.messagesPerTopic {
+		// Partitions share their topic's retention policy.
+		parentTopic, _ := contract.ParsePartitionLog(topic)
+		if m.retentionPolicies[parentTopic].Compact {
+			m.compactTopic(topic, tombstonesBefore)
+		}
 	}
 	return nil
 }
 
 // Poll is defined by, and documented in the backends/contract/BackingStore
 // interface.
-func (m MemStore) Poll(topic string, readFrom int) (
-	foundMessages []minikafka.Message, newReadFrom int, err error) {
+func (m MemStore) Poll(topic string, readFrom int, maxMessages int,
+	maxBytes int) (
+	foundMessages []minikafka.StoredMessage, newReadFrom int, err error) {
 
 	mutex.Lock()
 	defer mutex.Unlock()
 
 	storedMessages, ok := m.messagesPerTopic[topic]
 	if !ok {
-		return nil, -1, fmt.Errorf("No such topic: %s", topic)
+		return nil, -1, contract.NoSuchTopicError{Topic: topic}
+	}
+	err = contract.CheckReadFrom(readFrom, m.earliest(topic),
+		m.newestMessageNumber[topic]+1)
+	if err != nil {
+		return nil, -1, err
 	}
 	serveFromIndex := sort.Search(len(storedMessages), func(i int) bool {
 		return storedMessages[i].messageNumber >= readFrom
 	})
 
-	foundMessages = []minikafka.Message{}
+	foundMessages = []minikafka.StoredMessage{}
 	var highest int
+	nBytes := 0
 	for _, msg := range storedMessages[serveFromIndex:] {
-		foundMessages = append(foundMessages, msg.message)
+		// Stop when the limits are reached. (But always allow the first
+		// message).
+		nFound := len(foundMessages)
+		if maxMessages > 0 && nFound >= maxMessages {
+			break
+		}
+		msgSize := msg.message.Size()
+		if maxBytes > 0 && nFound > 0 && nBytes+msgSize > maxBytes {
+			break
+		}
+		foundMessages = append(foundMessages, minikafka.StoredMessage{
+			Message: msg.message,
+			Number:  msg.messageNumber,
+			Created: msg.creationTime})
+		nBytes += msgSize
 		highest = msg.messageNumber
 	}
 	nFound := len(foundMessages)
@@ -120,10 +247,298 @@ func (m MemStore) Poll(topic string, readFrom int) (
 	return foundMessages, unchangedReadFrom, nil
 }
 
+// AvailableRange is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (m MemStore) AvailableRange(topic string) (
+	earliest int, next int, err error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if _, ok := m.messagesPerTopic[topic]; !ok {
+		return -1, -1, fmt.Errorf("No such topic: %s", topic)
+	}
+	return m.earliest(topic), m.newestMessageNumber[topic] + 1, nil
+}
+
+// ListOffsets is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (m MemStore) ListOffsets(topic string) (
+	offsets []contract.PartitionOffsets, err error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if _, ok := m.messagesPerTopic[topic]; !ok {
+		return nil, fmt.Errorf("No such topic: %s", topic)
+	}
+	offsets = []contract.PartitionOffsets{}
+	for partition := 0; partition < m.numPartitions(topic); partition++ {
+		log := contract.PartitionLog(topic, partition)
+		offsets = append(offsets, contract.PartitionOffsets{
+			Partition: partition,
+			Earliest:  m.earliest(log),
+			Next:      m.newestMessageNumber[log] + 1})
+	}
+	return offsets, nil
+}
+
+// OffsetForTime is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (m MemStore) OffsetForTime(topic string, t time.Time) (
+	msgNumber int, err error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	storedMessages, ok := m.messagesPerTopic[topic]
+	if !ok {
+		return -1, contract.NoSuchTopicError{Topic: topic}
+	}
+	i := sort.Search(len(storedMessages), func(i int) bool {
+		return storedMessages[i].creationTime.Before(t) == false
+	})
+	if i == len(storedMessages) {
+		return m.newestMessageNumber[topic] + 1, nil
+	}
+	return storedMessages[i].messageNumber, nil
+}
+
+// ArrivalC is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (m MemStore) ArrivalC(topic string) <-chan struct{} {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if _, ok := m.messagesPerTopic[topic]; ok == false {
+		return notifier.Closed()
+	}
+	return m.notifier.ArrivalC(topic)
+}
+
+// CommitOffset is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (m MemStore) CommitOffset(group string, topic string, readFrom int) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if _, ok := m.committedOffsets[group]; ok == false {
+		m.committedOffsets[group] = map[string]int{}
+	}
+	m.committedOffsets[group][topic] = readFrom
+	return nil
+}
+
+// FetchOffset is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (m MemStore) FetchOffset(group string, topic string) (
+	readFrom int, committed bool, err error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	readFrom, committed = m.committedOffsets[group][topic]
+	return readFrom, committed, nil
+}
+
+// CreateTopic is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (m MemStore) CreateTopic(topic string, numPartitions int) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if _, ok := m.messagesPerTopic[topic]; ok {
+		return fmt.Errorf("Topic already exists: %s", topic)
+	}
+	for partition := 0; partition < numPartitions; partition++ {
+		log := contract.PartitionLog(topic, partition)
+		m.messagesPerTopic[log] = []storedMessage{}
+		m.newestMessageNumber[log] = 0
+	}
+	if numPartitions > 1 {
+		m.partitionCounts[topic] = numPartitions
+	}
+	return nil
+}
+
+// NumPartitions is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (m MemStore) NumPartitions(topic string) (numPartitions int, err error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return m.numPartitions(topic), nil
+}
+
+// DeleteTopic is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (m MemStore) DeleteTopic(topic string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if _, ok := m.messagesPerTopic[topic]; ok == false {
+		return fmt.Errorf("No such topic: %s", topic)
+	}
+	for partition := 0; partition < m.numPartitions(topic); partition++ {
+		log := contract.PartitionLog(topic, partition)
+		delete(m.messagesPerTopic, log)
+		delete(m.newestMessageNumber, log)
+		delete(m.producerSequences, log)
+		for _, offsets := range m.committedOffsets {
+			delete(offsets, log)
+		}
+		// Those waiting for messages then find the topic gone.
+		m.notifier.Notify(log)
+	}
+	delete(m.retentionPolicies, topic)
+	delete(m.partitionCounts, topic)
+	return nil
+}
+
+// ListTopics is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (m MemStore) ListTopics() (topics []string, err error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	topics = []string{}
+	for log := range m.messagesPerTopic {
+		if _, partition := contract.ParsePartitionLog(log); partition != 0 {
+			continue
+		}
+		topics = append(topics, log)
+	}
+	sort.Strings(topics)
+	return topics, nil
+}
+
+// DescribeTopic is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (m MemStore) DescribeTopic(topic string) (
+	description contract.TopicDescription, err error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	messages, ok := m.messagesPerTopic[topic]
+	if ok == false {
+		return description, fmt.Errorf("No such topic: %s", topic)
+	}
+	// Partitions share their topic's retention policy and partition count.
+	parentTopic, _ := contract.ParsePartitionLog(topic)
+	description.Retention = m.retentionPolicies[parentTopic]
+	description.NumPartitions = m.numPartitions(parentTopic)
+	n := len(messages)
+	if n == 0 {
+		return description, nil
+	}
+	description.OldestMsgNumber = messages[0].messageNumber
+	description.OldestCreated = messages[0].creationTime
+	description.NewestMsgNumber = messages[n-1].messageNumber
+	description.NewestCreated = messages[n-1].creationTime
+	description.NumMessages = n
+	for _, msg := range messages {
+		description.NumBytes += int64(msg.message.Size())
+	}
+	return description, nil
+}
+
+// SetRetentionPolicy is defined by, and documented in the
+// backends/contract/BackingStore interface.
+func (m MemStore) SetRetentionPolicy(
+	topic string, policy contract.RetentionPolicy) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if _, ok := m.messagesPerTopic[topic]; ok == false {
+		return fmt.Errorf("No such topic: %s", topic)
+	}
+	m.retentionPolicies[topic] = policy
+	return nil
+}
+
 // ------------------------------------------------------------------------
 // Helper functions.
 // ------------------------------------------------------------------------
 
+// storeBatch is the common implementation of StoreBatch, StoreSequenced and
+// StoreBatchIfNext. A zero *expectedNext* means there is no condition, and an
+// empty *producerID* means the request is not sequenced.
+func (m MemStore) storeBatch(topic string, expectedNext int,
+	producerID string, sequence uint64, messages []minikafka.Message) (
+	firstMsgNumber int, lastMsgNumber int, err error) {
+
+	if len(messages) == 0 {
+		return -1, -1, fmt.Errorf("The batch has no messages")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	// A retry of a request already stored, stores nothing.
+	if producerID != "" {
+		batch, ok := m.producerSequences[topic].Find(producerID, sequence)
+		if ok {
+			return batch.FirstMsgNumber, batch.LastMsgNumber, nil
+		}
+	}
+	if expectedNext != 0 {
+		err := contract.CheckExpectedNext(
+			expectedNext, m.newestMessageNumber[topic]+1)
+		if err != nil {
+			return -1, -1, err
+		}
+	}
+
+	// Storing in memory cannot fail part way through, so the batch is
+	// inherently all-or-nothing.
+	for i, message := range messages {
+		lastMsgNumber = m.store(topic, message)
+		if i == 0 {
+			firstMsgNumber = lastMsgNumber
+		}
+	}
+	if producerID != "" {
+		sequences, ok := m.producerSequences[topic]
+		if ok == false {
+			sequences = contract.ProducerSequences{}
+			m.producerSequences[topic] = sequences
+		}
+		sequences.Record(producerID, contract.SequencedBatch{
+			Sequence:       sequence,
+			FirstMsgNumber: firstMsgNumber,
+			LastMsgNumber:  lastMsgNumber})
+	}
+	m.notifier.Notify(topic)
+
+	return firstMsgNumber, lastMsgNumber, nil
+}
+
+// store adds a message to a topic, and returns the message number allocated
+// to it.
+func (m MemStore) store(topic string, message minikafka.Message) int {
+
+	// Bit of extra work if this is a new topic.
+	if _, ok := m.messagesPerTopic[topic]; ok == false {
+		m.messagesPerTopic[topic] = []storedMessage{}
+		m.newestMessageNumber[topic] = 0
+	}
+
+	// Drop into the general case.
+
+	// Allocate the next available message number.
+	m.newestMessageNumber[topic]++
+
+	// Make and add the new message.
+	msgToAdd := storedMessage{message, time.Now(),
+		m.newestMessageNumber[topic]}
+	m.messagesPerTopic[topic] = append(m.messagesPerTopic[topic], msgToAdd)
+
+	return m.newestMessageNumber[topic]
+}
+
+// earliest provides the number of the oldest message held for the topic, or
+// when it holds none, the number the next message stored will get.
+func (m MemStore) earliest(topic string) int {
+	storedMessages := m.messagesPerTopic[topic]
+	if len(storedMessages) == 0 {
+		return m.newestMessageNumber[topic] + 1
+	}
+	return storedMessages[0].messageNumber
+}
+
+// numPartitions provides the number of partitions a topic has.
+func (m MemStore) numPartitions(topic string) int {
+	numPartitions, ok := m.partitionCounts[topic]
+	if ok == false {
+		return 1
+	}
+	return numPartitions
+}
+
 // RemoveOldMessagesFromTopic is a topic-specific helper function for the
 // whole-store RemoveOldMessages method.
 func (m MemStore) removeOldMessagesFromTopic(
@@ -134,13 +549,60 @@ func (m MemStore) removeOldMessagesFromTopic(
 	keepFromIndex := sort.Search(len(messages), func(i int) bool {
 		return messages[i].creationTime.After(maxAge)
 	})
+	m.discardMessagesFromTopic(topic, keepFromIndex)
+	return keepFromIndex, nil
+}
+
+// compactTopic is a topic-specific helper function for the whole-store
+// Compact method.
+func (m MemStore) compactTopic(topic string, tombstonesBefore time.Time) {
+	messages := m.messagesPerTopic[topic]
+	newest := contract.NewestForKeys{}
+	for _, stored := range messages {
+		newest.Record(stored.message.Key, stored.messageNumber)
+	}
+	kept := []storedMessage{}
+	for _, stored := range messages {
+		if newest.Keep(stored.message, stored.messageNumber,
+			stored.creationTime, tombstonesBefore) {
+			kept = append(kept, stored)
+		}
+	}
+	m.messagesPerTopic[topic] = kept
+}
+
+// removeExcessMessagesFromTopic removes the oldest messages from a topic,
+// until it holds no more than *maxMessages* messages, and no more than
+// *maxBytes* bytes of messages. (Limits of zero do not apply).
+func (m MemStore) removeExcessMessagesFromTopic(
+	topic string, maxMessages int, maxBytes int64) {
 
-	messagesToKeep := messages[keepFromIndex:] // Safe when keeping none.
-	nRemoved = keepFromIndex
+	// Work backwards from the newest message to find the boundary.
+	messages := m.messagesPerTopic[topic]
+	keepFromIndex := len(messages)
+	var nBytes int64
+	for keepFromIndex > 0 {
+		msgSize := int64(messages[keepFromIndex-1].message.Size())
+		nKept := len(messages) - keepFromIndex
+		if maxMessages > 0 && nKept+1 > maxMessages {
+			break
+		}
+		if maxBytes > 0 && nBytes+msgSize > maxBytes {
+			break
+		}
+		nBytes += msgSize
+		keepFromIndex--
+	}
+	m.discardMessagesFromTopic(topic, keepFromIndex)
+}
 
-	if nRemoved == 0 {
-		return 0, nil
+// discardMessagesFromTopic removes the messages from a topic, that come before
+// the given index in its slice of messages.
+func (m MemStore) discardMessagesFromTopic(topic string, keepFromIndex int) {
+	if keepFromIndex == 0 {
+		return
 	}
+	messagesToKeep := m.messagesPerTopic[topic][keepFromIndex:]
 
 	// Replace the incumbent queue slice with a newly minted one so that the
 	// underlying array gets freed for garbage collection. Otherwise it would
@@ -148,8 +610,6 @@ func (m MemStore) removeOldMessagesFromTopic(
 	freshSlice := make([]storedMessage, len(messagesToKeep))
 	copy(freshSlice, messagesToKeep)
 	m.messagesPerTopic[topic] = freshSlice
-
-	return nRemoved, nil
 }
 
 // ------------------------------------------------------------------------
@@ -0,0 +1,81 @@
+// Package notifier provides the per-topic notification mechanism that
+// BackingStore implementations use to wake up whatever is waiting for new
+// messages to arrive in a topic.
+package notifier
+
+import (
+	"sync"
+)
+
+// Notifier keeps a channel for each topic that is closed (and thus readable by
+// any number of waiters) when a message is stored in that topic. The channel
+// is then replaced with a fresh one, ready for the next arrival. A topic only
+// has a channel while something is waiting for it, so the backing store should
+// not ask for one for a topic that does not exist, (see Closed), and should
+// Notify the topic's waiters when it is deleted.
+type Notifier struct {
+	mutex    *sync.Mutex
+	arrivals map[string]chan struct{} // Keyed on topic.
+}
+
+// NewNotifier creates and initialises a Notifier.
+func NewNotifier() *Notifier {
+	return &Notifier{
+		mutex:    &sync.Mutex{},
+		arrivals: map[string]chan struct{}{},
+	}
+}
+
+// ArrivalC provides a channel that will be closed the next time a message
+// is stored in the given topic. Callers should acquire the channel *before*
+// looking for messages in the store, so that they cannot miss an arrival that
+// happens between looking and waiting.
+func (n *Notifier) ArrivalC(topic string) <-chan struct{} {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	c, ok := n.arrivals[topic]
+	if !ok {
+		c = make(chan struct{})
+		n.arrivals[topic] = c
+	}
+	return c
+}
+
+// closed is the channel that Closed provides.
+var closed = make(chan struct{})
+
+func init() {
+	close(closed)
+}
+
+// Closed provides a channel that is already closed. It is what backing stores
+// provide in place of an arrival channel for a topic that does not exist, so
+// that the caller looks in the store again at once, and finds that out.
+func Closed() <-chan struct{} {
+	return closed
+}
+
+// Notify wakes up everything that is waiting on the given topic's arrival
+// channel.
+func (n *Notifier) Notify(topic string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	c, ok := n.arrivals[topic]
+	if !ok {
+		// Nobody is waiting.
+		return
+	}
+	close(c)
+	delete(n.arrivals, topic)
+}
+
+// NotifyAll wakes up everything that is waiting on any topic's arrival
+// channel. It is for when the store is emptied.
+func (n *Notifier) NotifyAll() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for topic, c := range n.arrivals {
+		close(c)
+		delete(n.arrivals, topic)
+	}
+}
@@ -0,0 +1,61 @@
+package notifier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifyWakesAllWaitersOnTopic(t *testing.T) {
+	n := NewNotifier()
+	c1 := n.ArrivalC("topicA")
+	c2 := n.ArrivalC("topicA")
+	n.Notify("topicA")
+	assert.True(t, isClosed(c1))
+	assert.True(t, isClosed(c2))
+
+	// Having been woken, new waiters should get a fresh channel.
+	c3 := n.ArrivalC("topicA")
+	assert.False(t, isClosed(c3))
+}
+
+func TestNotifyIsTopicSpecific(t *testing.T) {
+	n := NewNotifier()
+	cA := n.ArrivalC("topicA")
+	cB := n.ArrivalC("topicB")
+	n.Notify("topicB")
+	assert.False(t, isClosed(cA))
+	assert.True(t, isClosed(cB))
+}
+
+func TestNotifyWhenNobodyWaiting(t *testing.T) {
+	n := NewNotifier()
+	// Make sure it does not crash.
+	n.Notify("topicA")
+}
+
+func TestNotifyAllWakesWaitersOnEveryTopic(t *testing.T) {
+	n := NewNotifier()
+	cA := n.ArrivalC("topicA")
+	cB := n.ArrivalC("topicB")
+	n.NotifyAll()
+	assert.True(t, isClosed(cA))
+	assert.True(t, isClosed(cB))
+	assert.Equal(t, 0, len(n.arrivals))
+}
+
+func TestClosedIsClosed(t *testing.T) {
+	assert.True(t, isClosed(Closed()))
+}
+
+// isClosed reports whether the given channel is closed, without blocking
+// for more than a moment.
+func isClosed(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	case <-time.After(10 * time.Millisecond):
+		return false
+	}
+}
@@ -2,32 +2,61 @@ package svr
 
 import (
 	"fmt"
+	"io"
 	"net"
+	"sync/atomic"
 	"time"
 
+	"github.com/golang/protobuf/ptypes"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
+	minikafka "github.com/peterhoward42/minikafka"
 	pb "github.com/peterhoward42/minikafka/protocol"
 	"github.com/peterhoward42/minikafka/svr/backends/contract"
 )
 
+// maxPollBytes is the limit the server imposes on the total size of the
+// messages it returns in one Poll response, or in one batch of a Subscribe
+// stream. It keeps responses comfortably inside gRPC's default 4 MiB message
+// size limit.
+const maxPollBytes = 3 * 1024 * 1024
+
+// maxCullCheckInterval is the longest the server waits between invitations
+// to the backing store to remove expired messages.
+const maxCullCheckInterval = time.Minute
+
+// compactionInterval is how often the server invites the backing store to
+// compact the topics whose retention policy asks for it. Compaction reads
+// all of a topic's messages, so it runs less often than culling.
+const compactionInterval = 10 * time.Minute
+
+// tombstoneRetention is how long compaction keeps a tombstone, (a message
+// with a key and an empty payload), after the messages it deletes have gone.
+// It gives consumers time to see that the key has been deleted.
+const tombstoneRetention = 24 * time.Hour
+
 // Server *is* the minikafka server.
 type Server struct {
 	// The coupling between the server and its storage backend is governed
 	// by the BackingStore interface.
 	store contract.BackingStore
+	// Used to spread messages that have neither a key nor a partition
+	// across partitions in turn. (Accessed atomically).
+	nextPartition uint32
 }
 
 // NewServer creates and initialises a new server, using a backing store
 // type-variant of the caller's choice. (In-Memory, or file-system backed).
 // It does does not fire up the underlying grpc server.
 func NewServer(backingStore contract.BackingStore) *Server {
-	return &Server{backingStore}
+	return &Server{store: backingStore}
 }
 
 // Serve mandates the server to start serving and also to start the automatic
-// culling of expired messages.
+// culling of expired messages, and compaction of topics.
 // *host* should be of the form "myhost.com:1234".
 func (s *Server) Serve(host string, retentionTime time.Duration) error {
 
@@ -63,45 +92,556 @@ func (s *Server) Serve(host string, retentionTime time.Duration) error {
 
 // Produce is the server's handler function for the *Produce* API call.
 func (s *Server) Produce(
-	ctx context.Context, req *pb.ProduceRequest) (*pb.MsgNumber, error) {
+	ctx context.Context, req *pb.ProduceRequest) (*pb.ProduceResponse, error) {
 	// Harvest the request details from the incoming gRPC request object,
 	// then delegate the storage work to the backing store, and finally
 	// package up the data to return to suit a gRPC response.
 
 	topicStr := req.GetTopic().Topic
-	messageBytes := req.GetPayload().Payload
-	msgNumber, err := s.store.Store(topicStr, messageBytes)
+	err := validateTopicName(topicStr)
 	if err != nil {
-		return nil, fmt.Errorf("store.Store: %v", err)
+		return nil, err
 	}
-	return &pb.MsgNumber{MsgNumber: uint32(msgNumber)}, nil
+	keys := [][]byte{}
+	if len(req.GetKey()) > 0 {
+		keys = append(keys, req.GetKey())
+	}
+	partition, err := s.choosePartition(
+		topicStr, req.GetPartition(), keys, req.GetProducer())
+	if err != nil {
+		return nil, err
+	}
+	message, err := makeMessage(req)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "makeMessage: %v", err)
+	}
+	err = validateExpectedNext(req.GetExpectedNext())
+	if err != nil {
+		return nil, err
+	}
+	msgNumber, _, err := s.storeBatch(
+		contract.PartitionLog(topicStr, partition),
+		[]minikafka.Message{message}, req.GetProducer(),
+		req.GetExpectedNext())
+	if unexpectedNext, ok := err.(contract.UnexpectedNextError); ok {
+		return nil, unexpectedNextStatus(unexpectedNext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storeBatch: %v", err)
+	}
+	return &pb.ProduceResponse{
+		MsgNumber: uint32(msgNumber), Partition: uint32(partition)}, nil
+}
+
+// ProduceBatch is the server's handler function for the *ProduceBatch* API
+// call.
+func (s *Server) ProduceBatch(ctx context.Context,
+	req *pb.ProduceBatchRequest) (*pb.ProduceBatchResponse, error) {
+
+	partition, messages, err := s.prepareBatch(req)
+	if err != nil {
+		return nil, err
+	}
+	err = validateExpectedNext(req.GetExpectedNext())
+	if err != nil {
+		return nil, err
+	}
+	first, last, err := s.storeBatch(
+		contract.PartitionLog(req.GetTopic().GetTopic(), partition), messages,
+		req.GetProducer(), req.GetExpectedNext())
+	if unexpectedNext, ok := err.(contract.UnexpectedNextError); ok {
+		return nil, unexpectedNextStatus(unexpectedNext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storeBatch: %v", err)
+	}
+	return &pb.ProduceBatchResponse{
+		FirstMsgNumber: uint32(first),
+		LastMsgNumber:  uint32(last),
+		Partition:      uint32(partition)}, nil
+}
+
+// ProduceTransaction is the server's handler function for the
+// *ProduceTransaction* API call.
+func (s *Server) ProduceTransaction(ctx context.Context,
+	req *pb.ProduceTransactionRequest) (*pb.ProduceTransactionResponse, error) {
+
+	if len(req.GetBatches()) == 0 {
+		return nil, status.Error(codes.InvalidArgument,
+			"The transaction has no batches")
+	}
+	batches := []contract.TopicBatch{}
+	partitions := []int{}
+	for _, batchReq := range req.GetBatches() {
+		if batchReq.GetProducer() != nil || batchReq.GetExpectedNext() != nil {
+			return nil, status.Error(codes.InvalidArgument,
+				"Batches in a transaction cannot be sequenced or conditional")
+		}
+		partition, messages, err := s.prepareBatch(batchReq)
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, contract.TopicBatch{
+			Topic: contract.PartitionLog(
+				batchReq.GetTopic().GetTopic(), partition),
+			Messages: messages})
+		partitions = append(partitions, partition)
+	}
+	ranges, err := s.store.StoreTransaction(batches)
+	if err != nil {
+		return nil, fmt.Errorf("store.StoreTransaction: %v", err)
+	}
+	resp := &pb.ProduceTransactionResponse{}
+	for i, msgRange := range ranges {
+		resp.Batches = append(resp.Batches, &pb.ProduceBatchResponse{
+			FirstMsgNumber: uint32(msgRange.First),
+			LastMsgNumber:  uint32(msgRange.Last),
+			Partition:      uint32(partitions[i])})
+	}
+	return resp, nil
+}
+
+// prepareBatch harvests the messages to store from a ProduceBatch request,
+// and chooses the partition to store them in. The errors it returns for
+// invalid requests are gRPC status errors, (InvalidArgument), which are not
+// to be wrapped.
+func (s *Server) prepareBatch(req *pb.ProduceBatchRequest) (
+	partition int, messages []minikafka.Message, err error) {
+	topicStr := req.GetTopic().GetTopic()
+	err = validateTopicName(topicStr)
+	if err != nil {
+		return -1, nil, err
+	}
+	if len(req.GetPayloads()) == 0 {
+		return -1, nil, status.Error(codes.InvalidArgument,
+			"The batch has no messages")
+	}
+	messages = []minikafka.Message{}
+	keys := [][]byte{}
+	for _, payload := range req.GetPayloads() {
+		message, err := makeMessageFromPayload(payload, payload.GetKey())
+		if err != nil {
+			return -1, nil, status.Errorf(codes.InvalidArgument,
+				"makeMessageFromPayload: %v", err)
+		}
+		messages = append(messages, message)
+		if len(message.Key) > 0 {
+			keys = append(keys, message.Key)
+		}
+	}
+	partition, err = s.choosePartition(
+		topicStr, req.GetPartition(), keys, req.GetProducer())
+	if err != nil {
+		return -1, nil, err
+	}
+	return partition, messages, nil
 }
 
-// Poll is the server's handler function for the *Poll* API call.
+// ProduceStream is the server's handler function for the *ProduceStream* API
+// call. It handles each request in the stream as ProduceBatch would, one at
+// a time, and sends back each response before reading the next request. Not
+// reading ahead is what lets gRPC flow control hold up the client, when the
+// backing store is slow. It runs until the client closes its side of the
+// stream, or a request fails.
+func (s *Server) ProduceStream(stream pb.MiniKafka_ProduceStreamServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("stream.Recv: %v", err)
+		}
+		resp, err := s.ProduceBatch(stream.Context(), req)
+		if err != nil {
+			return err
+		}
+		err = stream.Send(resp)
+		if err != nil {
+			return fmt.Errorf("stream.Send: %v", err)
+		}
+	}
+}
+
+// Poll is the server's handler function for the *Poll* API call. When the
+// request asks for long-polling, it holds on to the request until enough
+// messages are available, the requested maximum wait has elapsed, or the
+// client gives up. When the topic does not exist, it responds at once with
+// the NotFound status code, even when long-polling; it is for the client to
+// try again later.
 func (s *Server) Poll(ctx context.Context, req *pb.PollRequest) (
 	*pb.PollResponse, error) {
 	// Harvest the request details from the incoming gRPC request, then
 	// delegate the retrieval of messages to the backing store, and finally,
 	// package up the data to return to suit a gRPC response.
 
-	topicStr := req.GetTopic()
+	topicStr := contract.PartitionLog(req.GetTopic(), int(req.GetPartition()))
 	fromMsgNumber := req.GetReadFrom().GetMsgNumber()
-	messages, nextMsgNumber, err := s.store.Poll(topicStr, int(fromMsgNumber))
+	maxWait := time.Duration(req.GetMaxWaitMs()) * time.Millisecond
+	minMessages := int(req.GetMinMessages())
+	if minMessages < 1 {
+		minMessages = 1
+	}
+	maxMessages := int(req.GetMaxMessages())
+	if maxMessages > 0 && minMessages > maxMessages {
+		minMessages = maxMessages
+	}
+	maxBytes := int(req.GetMaxBytes())
+	if maxBytes == 0 || maxBytes > maxPollBytes {
+		maxBytes = maxPollBytes
+	}
+	deadline := time.NewTimer(maxWait)
+	defer deadline.Stop()
+
+	for {
+		// Acquire the arrival channel before polling, so that a message stored
+		// after the poll, but before we start waiting, is not missed.
+		arrivalC := s.store.ArrivalC(topicStr)
+		messages, nextMsgNumber, err := s.store.Poll(
+			topicStr, int(fromMsgNumber), maxMessages, maxBytes)
+		if outOfRange, ok := err.(contract.OutOfRangeError); ok {
+			return nil, outOfRangeStatus(outOfRange)
+		}
+		if noSuchTopic, ok := err.(contract.NoSuchTopicError); ok {
+			return nil, noSuchTopicStatus(noSuchTopic)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("store.Poll: %v", err)
+		}
+		if maxWait == 0 || len(messages) >= minMessages {
+			return s.makePollResponse(topicStr, messages, nextMsgNumber)
+		}
+		select {
+		case <-arrivalC:
+		case <-deadline.C:
+			return s.makePollResponse(topicStr, messages, nextMsgNumber)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Subscribe is the server's handler function for the *Subscribe* API call.
+// It streams the messages that are already in the store (from the requested
+// read-from message number), and then waits for new ones to arrive, streaming
+// them as they do. It runs until the client cancels the call, or an error is
+// encountered. When the topic does not exist, it ends the stream at once with
+// the NotFound status code; it is for the client to subscribe again later.
+func (s *Server) Subscribe(
+	req *pb.SubscribeRequest, stream pb.MiniKafka_SubscribeServer) error {
+
+	topicStr := contract.PartitionLog(req.GetTopic(), int(req.GetPartition()))
+	readFrom := int(req.GetReadFrom().GetMsgNumber())
+	for {
+		// Acquire the arrival channel before polling, so that a message stored
+		// after the poll, but before we start waiting, is not missed.
+		arrivalC := s.store.ArrivalC(topicStr)
+		messages, nextMsgNumber, err := s.store.Poll(
+			topicStr, readFrom, 0, maxPollBytes)
+		if outOfRange, ok := err.(contract.OutOfRangeError); ok {
+			return outOfRangeStatus(outOfRange)
+		}
+		if noSuchTopic, ok := err.(contract.NoSuchTopicError); ok {
+			return noSuchTopicStatus(noSuchTopic)
+		}
+		if err != nil {
+			return fmt.Errorf("store.Poll: %v", err)
+		}
+		for _, msg := range messages {
+			payload, err := makePayload(msg)
+			if err != nil {
+				return fmt.Errorf("makePayload: %v", err)
+			}
+			err = stream.Send(&pb.Message{Payload: payload})
+			if err != nil {
+				return fmt.Errorf("stream.Send: %v", err)
+			}
+		}
+		readFrom = nextMsgNumber
+
+		// Carry straight on when the store had more to give than it was
+		// allowed to return in one go.
+		if len(messages) > 0 {
+			continue
+		}
+
+		// Wait for something new to arrive, or for the client to go away.
+		select {
+		case <-arrivalC:
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// CommitOffset is the server's handler function for the *CommitOffset* API
+// call.
+func (s *Server) CommitOffset(
+	ctx context.Context, req *pb.CommitOffsetRequest) (*pb.Empty, error) {
+	readFrom := int(req.GetReadFrom().GetMsgNumber())
+	topicStr := contract.PartitionLog(req.GetTopic(), int(req.GetPartition()))
+	err := s.store.CommitOffset(req.GetGroup(), topicStr, readFrom)
+	if err != nil {
+		return nil, fmt.Errorf("store.CommitOffset: %v", err)
+	}
+	return &pb.Empty{}, nil
+}
+
+// FetchOffset is the server's handler function for the *FetchOffset* API
+// call.
+func (s *Server) FetchOffset(
+	ctx context.Context, req *pb.FetchOffsetRequest) (
+	*pb.FetchOffsetResponse, error) {
+	topicStr := contract.PartitionLog(req.GetTopic(), int(req.GetPartition()))
+	readFrom, committed, err := s.store.FetchOffset(req.GetGroup(), topicStr)
+	if err != nil {
+		return nil, fmt.Errorf("store.FetchOffset: %v", err)
+	}
+	if !committed {
+		return &pb.FetchOffsetResponse{}, nil
+	}
+	return &pb.FetchOffsetResponse{
+		ReadFrom: &pb.MsgNumber{MsgNumber: uint32(readFrom)}}, nil
+}
+
+// ListOffsets is the server's handler function for the *ListOffsets* API
+// call.
+func (s *Server) ListOffsets(
+	ctx context.Context, req *pb.Topic) (*pb.ListOffsetsResponse, error) {
+	offsets, err := s.store.ListOffsets(req.GetTopic())
+	if err != nil {
+		return nil, fmt.Errorf("store.ListOffsets: %v", err)
+	}
+	resp := &pb.ListOffsetsResponse{}
+	for _, partitionOffsets := range offsets {
+		resp.Partitions = append(resp.Partitions, &pb.PartitionOffsets{
+			Partition: uint32(partitionOffsets.Partition),
+			Available: &pb.AvailableRange{
+				Earliest: uint32(partitionOffsets.Earliest),
+				Next:     uint32(partitionOffsets.Next)}})
+	}
+	return resp, nil
+}
+
+// OffsetForTime is the server's handler function for the *OffsetForTime* API
+// call.
+func (s *Server) OffsetForTime(
+	ctx context.Context, req *pb.OffsetForTimeRequest) (*pb.MsgNumber, error) {
+	t, err := ptypes.Timestamp(req.GetTime())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"ptypes.Timestamp: %v", err)
+	}
+	topicStr := contract.PartitionLog(req.GetTopic(), int(req.GetPartition()))
+	msgNumber, err := s.store.OffsetForTime(topicStr, t)
+	if noSuchTopic, ok := err.(contract.NoSuchTopicError); ok {
+		return nil, noSuchTopicStatus(noSuchTopic)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("store.OffsetForTime: %v", err)
+	}
+	return &pb.MsgNumber{MsgNumber: uint32(msgNumber)}, nil
+}
+
+// NumPartitions is the server's handler function for the *NumPartitions* API
+// call.
+func (s *Server) NumPartitions(
+	ctx context.Context, req *pb.Topic) (*pb.PartitionCount, error) {
+	numPartitions, err := s.store.NumPartitions(req.GetTopic())
+	if err != nil {
+		return nil, fmt.Errorf("store.NumPartitions: %v", err)
+	}
+	return &pb.PartitionCount{NumPartitions: uint32(numPartitions)}, nil
+}
+
+//------------------------------------------------------------------------
+// Internal helpers
+//------------------------------------------------------------------------
+
+// choosePartition decides which partition of its topic produced messages
+// should be stored in. The one the request specifies if it does so, otherwise
+// the one the messages' keys hash to, otherwise the next one in turn. It is an
+// error for the keys to hash to different partitions. Sequenced requests
+// without keys are not spread in turn, but go to the partition their
+// producer's ID hashes to; so that a retry goes to the same partition as the
+// original, and a producer's requests keep their order. Its errors need no
+// further wrapping, and those for invalid requests are gRPC status errors.
+func (s *Server) choosePartition(topic string, requested *pb.Partition,
+	keys [][]byte, producer *pb.Producer) (int, error) {
+	numPartitions, err := s.store.NumPartitions(topic)
+	if err != nil {
+		return -1, fmt.Errorf("store.NumPartitions: %v", err)
+	}
+	if requested != nil {
+		partition := int(requested.GetPartition())
+		if partition >= numPartitions {
+			return -1, status.Errorf(codes.InvalidArgument,
+				"Partition %d requested, but topic has only %d",
+				partition, numPartitions)
+		}
+		return partition, nil
+	}
+	if len(keys) > 0 {
+		partition := minikafka.PartitionForKey(keys[0], numPartitions)
+		for _, key := range keys[1:] {
+			if minikafka.PartitionForKey(key, numPartitions) != partition {
+				return -1, status.Error(codes.InvalidArgument,
+					"The keys belong in different partitions")
+			}
+		}
+		return partition, nil
+	}
+	if producer != nil {
+		return minikafka.PartitionForKey(
+			[]byte(producer.GetProducerId()), numPartitions), nil
+	}
+	next := atomic.AddUint32(&s.nextPartition, 1)
+	return int(next % uint32(numPartitions)), nil
+}
+
+// storeBatch stores produced messages in the given log, with the backing
+// store method that suits the request: sequenced when it identifies its
+// producer, and conditional when it gives the message number expected next.
+func (s *Server) storeBatch(log string, messages []minikafka.Message,
+	producer *pb.Producer, expectedNext *pb.MsgNumber) (
+	firstMsgNumber int, lastMsgNumber int, err error) {
+	switch {
+	case expectedNext != nil:
+		return s.store.StoreBatchIfNext(log,
+			int(expectedNext.GetMsgNumber()), producer.GetProducerId(),
+			producer.GetSequence(), messages)
+	case producer != nil:
+		return s.store.StoreSequenced(log, producer.GetProducerId(),
+			producer.GetSequence(), messages)
+	}
+	return s.store.StoreBatch(log, messages)
+}
+
+// validateTopicName checks that the given topic name is one that clients may
+// use, (see contract.ValidateTopicName), and provides an InvalidArgument
+// status error when it is not.
+func validateTopicName(topic string) error {
+	err := contract.ValidateTopicName(topic)
 	if err != nil {
-		return nil, fmt.Errorf("store.Poll: %v", err)
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return nil
+}
+
+// validateExpectedNext checks that the message number a request expects to
+// be next, when it gives one, is one the log could issue; and provides an
+// InvalidArgument status error when it is not. Message numbers start at 1,
+// and the backing stores take a zero to mean there is no condition.
+func validateExpectedNext(expectedNext *pb.MsgNumber) error {
+	if expectedNext != nil && expectedNext.GetMsgNumber() == 0 {
+		return status.Error(codes.InvalidArgument,
+			"Message numbers start at 1, so none can be expected next at 0")
+	}
+	return nil
+}
+
+// makeMessage harvests the message to store from a Produce request.
+func makeMessage(req *pb.ProduceRequest) (minikafka.Message, error) {
+	return makeMessageFromPayload(req.GetPayload(), req.GetKey())
+}
+
+// makeMessageFromPayload harvests a message to store from a Payload, and the
+// key that goes with it.
+func makeMessageFromPayload(payload *pb.Payload, key []byte) (
+	minikafka.Message, error) {
+	message := minikafka.Message{
+		Payload: payload.GetPayload(),
+		Key:     key,
+		Headers: payload.GetHeaders()}
+	if payload.GetTimestamp() != nil {
+		timestamp, err := ptypes.Timestamp(payload.GetTimestamp())
+		if err != nil {
+			return message, fmt.Errorf("ptypes.Timestamp: %v", err)
+		}
+		message.Timestamp = timestamp
 	}
+	return message, nil
+}
+
+// makePayload packages up a message retrieved from the backing store to suit
+// a gRPC response.
+func makePayload(msg minikafka.StoredMessage) (*pb.Payload, error) {
+	payload := &pb.Payload{
+		Payload:   msg.Payload,
+		Headers:   msg.Headers,
+		Key:       msg.Key,
+		MsgNumber: &pb.MsgNumber{MsgNumber: uint32(msg.Number)}}
+	var err error
+	if msg.Timestamp.IsZero() == false {
+		payload.Timestamp, err = ptypes.TimestampProto(msg.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("ptypes.TimestampProto: %v", err)
+		}
+	}
+	payload.Created, err = ptypes.TimestampProto(msg.Created)
+	if err != nil {
+		return nil, fmt.Errorf("ptypes.TimestampProto: %v", err)
+	}
+	return payload, nil
+}
+
+// makePollResponse packages up the messages retrieved from the backing store,
+// the advised new read-from message number, and the range of messages
+// available in the topic, to suit a gRPC response.
+func (s *Server) makePollResponse(topic string,
+	messages []minikafka.StoredMessage,
+	nextMsgNumber int) (*pb.PollResponse, error) {
 	payloads := []*pb.Payload{}
 	for _, msg := range messages {
-		payloads = append(payloads, &pb.Payload{Payload: msg})
+		payload, err := makePayload(msg)
+		if err != nil {
+			return nil, fmt.Errorf("makePayload: %v", err)
+		}
+		payloads = append(payloads, payload)
+	}
+	earliest, next, err := s.store.AvailableRange(topic)
+	if err != nil {
+		return nil, fmt.Errorf("store.AvailableRange: %v", err)
 	}
 	return &pb.PollResponse{
 		Payloads:    payloads,
-		NewReadFrom: &pb.MsgNumber{MsgNumber: uint32(nextMsgNumber)}}, nil
+		NewReadFrom: &pb.MsgNumber{MsgNumber: uint32(nextMsgNumber)},
+		Available: &pb.AvailableRange{
+			Earliest: uint32(earliest), Next: uint32(next)}}, nil
 }
 
-//------------------------------------------------------------------------
-// Internal helpers
-//------------------------------------------------------------------------
+// outOfRangeStatus converts the backing store's OutOfRangeError into a gRPC
+// error with the OutOfRange status code. The status carries the range of
+// messages available as a detail, so that clients can choose where to resume.
+func outOfRangeStatus(outOfRange contract.OutOfRangeError) error {
+	st := status.New(codes.OutOfRange, outOfRange.Error())
+	withDetails, err := st.WithDetails(&pb.AvailableRange{
+		Earliest: uint32(outOfRange.Earliest),
+		Next:     uint32(outOfRange.Next)})
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+// noSuchTopicStatus converts the backing store's NoSuchTopicError into a gRPC
+// error with the NotFound status code.
+func noSuchTopicStatus(noSuchTopic contract.NoSuchTopicError) error {
+	return status.Error(codes.NotFound, noSuchTopic.Error())
+}
+
+// unexpectedNextStatus makes the gRPC status error that reports an
+// UnexpectedNextError, with the message numbers as a detail.
+func unexpectedNextStatus(unexpectedNext contract.UnexpectedNextError) error {
+	st := status.New(codes.FailedPrecondition, unexpectedNext.Error())
+	withDetails, err := st.WithDetails(&pb.UnexpectedNext{
+		Expected: uint32(unexpectedNext.Expected),
+		Next:     uint32(unexpectedNext.Next)})
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
 
 // startGrpcServer starts listening on the requested host network interface,
 // introduces the standard library gRPC server to this customer server
@@ -116,6 +656,7 @@ func (s *Server) startGrpcServer(
 		return
 	}
 	pb.RegisterMiniKafkaServer(grpcServer, s)
+	pb.RegisterMiniKafkaAdminServer(grpcServer, s)
 
 	err = grpcServer.Serve(lis) // Runs forever, or error encountered.
 	if err != nil {
@@ -125,15 +666,23 @@ func (s *Server) startGrpcServer(
 }
 
 // startCulling periodically removes messages from the backing store when their
-// age exceeds *retentionTime*. It runs forever, or, until an error occurs, or
-// it receives an instruction to stop on the stop channel passed in. When
-// an error occurs it signals this on the error reporting channel passed in.
+// age exceeds *retentionTime*, or when their topic's retention policy says
+// so. Every compactionInterval, it also compacts the topics whose retention
+// policy asks for it. It runs forever, or, until an error occurs, or it receives an
+// instruction to stop on the stop channel passed in. When an error occurs it
+// signals this on the error reporting channel passed in.
 func (s *Server) startCullingService(
 	errc chan<- error, stopc <-chan bool, retentionTime time.Duration) {
 	// If we're keeping messages until they are 50 minutes old, we check to see
 	// if any have expired every 5 minutes. (one tenth of the retention time.)
+	// But never less often than maxCullCheckInterval, because topics'
+	// retention policies can demand shorter retention times, and size limits.
 	cullCheckFrequency := retentionTime / 10
+	if cullCheckFrequency > maxCullCheckInterval {
+		cullCheckFrequency = maxCullCheckInterval
+	}
 	ticker := time.NewTicker(cullCheckFrequency)
+	lastCompaction := time.Now()
 	// For as long as ticks arrive...
 	for range ticker.C {
 		// Been instructed to stop since last tick?
@@ -152,5 +701,14 @@ func (s *Server) startCullingService(
 			errc <- fmt.Errorf("store.RemoveOldMessages: %v", err)
 			return
 		}
+		if time.Since(lastCompaction) < compactionInterval {
+			continue
+		}
+		lastCompaction = time.Now()
+		err = s.store.Compact(time.Now().Add(-tombstoneRetention))
+		if err != nil {
+			errc <- fmt.Errorf("store.Compact: %v", err)
+			return
+		}
 	}
 }
@@ -0,0 +1,36 @@
+package svr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/peterhoward42/minikafka/protocol"
+	"github.com/peterhoward42/minikafka/svr/backends/implementations/memstore"
+)
+
+func TestProduceRejectsZeroExpectedNext(t *testing.T) {
+	store := memstore.NewMemStore()
+	server := NewServer(store)
+	ctx := context.Background()
+	topic := &pb.Topic{Topic: "t"}
+	zero := &pb.MsgNumber{MsgNumber: 0}
+
+	_, err := server.Produce(ctx, &pb.ProduceRequest{Topic: topic,
+		Payload: &pb.Payload{Payload: []byte("msg")}, ExpectedNext: zero})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = server.ProduceBatch(ctx, &pb.ProduceBatchRequest{Topic: topic,
+		Payloads:     []*pb.Payload{{Payload: []byte("msg")}},
+		ExpectedNext: zero})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Nothing was stored; and expecting 1 succeeds.
+	resp, err := server.Produce(ctx, &pb.ProduceRequest{Topic: topic,
+		Payload:      &pb.Payload{Payload: []byte("msg")},
+		ExpectedNext: &pb.MsgNumber{MsgNumber: 1}})
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), resp.GetMsgNumber())
+}